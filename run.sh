@@ -8,7 +8,7 @@ echo "\nStarting blockchain parser..."
 
 # Start the main application
 cd tx-parser-main
-go run cmd/main.go &
+go run ./cmd &
 APP_PID=$!
 
 # Wait for server to start
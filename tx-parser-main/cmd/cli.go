@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// commands maps CLI subcommands to their implementation. Each command talks
+// to the admin API of a running parser instance.
+var commands = map[string]func(args []string) error{
+	"export":     runExport,
+	"import":     runImport,
+	"export-csv": runExportCSV,
+}
+
+// runCommand dispatches a CLI subcommand such as "export" or "import"
+func runCommand(args []string) error {
+	command, ok := commands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		return fmt.Errorf("unknown command %q (available: %s)", args[0], strings.Join(names, ", "))
+	}
+	return command(args[1:])
+}
+
+// defaultServerURL builds the admin API base URL from the server environment variables
+func defaultServerURL() string {
+	return "http://" + getEnvOrDefault("SERVER_HOST", defaultServerHost) + ":" + getEnvOrDefault("SERVER_PORT", defaultServerPort)
+}
+
+// apiRequest sends a request to the API, with the API key when one is set
+func apiRequest(method, target, contentType, key string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// runExport downloads the parser state archive from a running instance
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	server := flags.String("server", defaultServerURL(), "base URL of the running parser")
+	key := flags.String("key", os.Getenv("API_KEY"), "API key with admin scope")
+	out := flags.String("out", "-", "archive file to write, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	resp, err := apiRequest(http.MethodGet, strings.TrimSuffix(*server, "/")+"/admin/export", "", *key, nil)
+	if err != nil {
+		return fmt.Errorf("error requesting export: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("export failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return writeOutput(*out, resp.Body)
+}
+
+// runExportCSV downloads the transaction history of an address as CSV
+func runExportCSV(args []string) error {
+	flags := flag.NewFlagSet("export-csv", flag.ContinueOnError)
+	server := flags.String("server", defaultServerURL(), "base URL of the running parser")
+	key := flags.String("key", os.Getenv("API_KEY"), "API key with read scope")
+	address := flags.String("address", "", "address to export")
+	format := flags.String("format", "csv", "column layout: csv or koinly")
+	out := flags.String("out", "-", "CSV file to write, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *address == "" {
+		return fmt.Errorf("-address is required")
+	}
+
+	query := url.Values{"address": {*address}, "format": {*format}}
+	resp, err := apiRequest(http.MethodGet, strings.TrimSuffix(*server, "/")+"/transactions/export?"+query.Encode(), "", *key, nil)
+	if err != nil {
+		return fmt.Errorf("error requesting export: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("export failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return writeOutput(*out, resp.Body)
+}
+
+// writeOutput copies r to the named file, or stdout when path is "-"
+func writeOutput(path string, r io.Reader) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("error creating %s: %v", path, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// runImport uploads an archive to a running instance
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	server := flags.String("server", defaultServerURL(), "base URL of the running parser")
+	key := flags.String("key", os.Getenv("API_KEY"), "API key with admin scope")
+	in := flags.String("in", "-", "archive file to read, - for stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %v", *in, err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	resp, err := apiRequest(http.MethodPost, strings.TrimSuffix(*server, "/")+"/admin/import", "application/x-ndjson", *key, r)
+	if err != nil {
+		return fmt.Errorf("error uploading archive: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("import failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	fmt.Println(strings.TrimSpace(string(body)))
+	return nil
+}
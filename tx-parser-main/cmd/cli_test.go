@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testArchive = `{"type":"header","data":{"version":1}}
+`
+
+func TestRunCommandUnknown(t *testing.T) {
+	if err := runCommand([]string{"frobnicate"}); err == nil {
+		t.Error("Expected error for unknown command")
+	}
+}
+
+func TestExportImportCommands(t *testing.T) {
+	var imported string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "txp_test" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/admin/export":
+			io.WriteString(w, testArchive)
+		case "/admin/import":
+			body, _ := io.ReadAll(r.Body)
+			imported = string(body)
+			io.WriteString(w, `{"status":"success"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "state.ndjson")
+
+	if err := runCommand([]string{"export", "-server", server.URL, "-key", "txp_test", "-out", file}); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read exported archive: %v", err)
+	}
+	if string(data) != testArchive {
+		t.Errorf("Expected archive %q, got %q", testArchive, data)
+	}
+
+	if err := runCommand([]string{"import", "-server", server.URL, "-key", "txp_test", "-in", file}); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if imported != testArchive {
+		t.Errorf("Expected uploaded archive %q, got %q", testArchive, imported)
+	}
+}
+
+func TestExportCommandServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	out := filepath.Join(t.TempDir(), "state.ndjson")
+	if err := runCommand([]string{"export", "-server", server.URL, "-out", out}); err == nil {
+		t.Error("Expected error for failed export")
+	}
+}
+
+func TestExportCSVCommand(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		io.WriteString(w, "timestamp_utc,hash\n")
+	}))
+	defer server.Close()
+
+	if err := runCommand([]string{"export-csv", "-server", server.URL}); err == nil {
+		t.Error("Expected error without -address")
+	}
+
+	out := filepath.Join(t.TempDir(), "history.csv")
+	args := []string{"export-csv", "-server", server.URL, "-address", "0xabc", "-format", "koinly", "-out", out}
+	if err := runCommand(args); err != nil {
+		t.Fatalf("export-csv failed: %v", err)
+	}
+	if query != "address=0xabc&format=koinly" {
+		t.Errorf("Unexpected query %q", query)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "timestamp_utc,hash\n" {
+		t.Errorf("Unexpected CSV output %q", data)
+	}
+}
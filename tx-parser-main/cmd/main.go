@@ -7,17 +7,32 @@ package main
 import (
 	"blockchain-parser/config"
 	"blockchain-parser/internal/api"
+	"blockchain-parser/internal/archive"
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/ledger"
 	"blockchain-parser/internal/logger"
+	"blockchain-parser/internal/metrics"
 	"blockchain-parser/internal/monitor"
 	"blockchain-parser/internal/notification"
 	"blockchain-parser/internal/parser"
 	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/stream"
+	"blockchain-parser/internal/tracing"
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// appLog is the logger of startup and shutdown
+var appLog = logger.Component("main")
+
 // Environment variable constants with their default values
 
 const ethUrl string = "https://ethereum-sepolia-rpc.publicnode.com"
@@ -29,6 +44,23 @@ const (
 	defaultLogPath     = "./logs/blockchain-parser.log"
 	defaultEnv         = "development"
 	defaultDelay       = 5
+
+	defaultNotifier          = "console"
+	defaultPruneInterval     = 10 * time.Minute
+	defaultReconcileInterval = 10 * time.Minute
+	defaultChain             = "sepolia"
+	defaultSMTPPort          = 587
+	defaultEmailBatchWindow  = 10 * time.Second
+	defaultDigestInterval    = time.Minute
+	defaultShutdownTimeout   = 30 * time.Second
+	defaultReadyMaxLag       = 10
+	defaultReadyMaxHeadAge   = time.Minute
+	defaultLogOutputs        = "file"
+	defaultLogMaxSizeMB      = 100
+	defaultLogRotateInterval = 24 * time.Hour
+	defaultLogMaxBackups     = 7
+	defaultOTLPEndpoint      = "http://localhost:4318"
+	defaultServiceName       = "blockchain-parser"
 )
 
 // getEnvOrDefault retrieves an environment variable value or returns
@@ -51,7 +83,25 @@ func getEnvIntOrDefault(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvDurationOrDefault retrieves an environment variable as a duration
+// (e.g. "720h") or returns the default if not set or invalid
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
 func main() {
+	// Subcommands such as "export" and "import" run against a live instance
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
 
 	// Application startup sequence:
 	// 1. Load configuration from environment variables
@@ -88,21 +138,300 @@ func main() {
 			"password",
 		)
 	}
+	cfg.WithRetention(
+		getEnvDurationOrDefault("RETENTION_MAX_AGE", 0),
+		int64(getEnvIntOrDefault("RETENTION_MAX_BLOCK_DEPTH", 0)),
+		getEnvIntOrDefault("RETENTION_MAX_PER_ADDRESS", 0),
+		getEnvDurationOrDefault("RETENTION_PRUNE_INTERVAL", defaultPruneInterval),
+	)
+	cfg.ReconcileInterval = getEnvDurationOrDefault("RECONCILE_INTERVAL", defaultReconcileInterval)
 
-	if err := logger.Init(logFilePath); err != nil {
+	// Development logs everything as text; production logs info and above
+	// as JSON. LOG_LEVEL and LOG_FORMAT override either default.
+	logLevel, logFormat := "debug", "text"
+	if environment == "production" {
+		logLevel, logFormat = "info", "json"
+	}
+	level, err := logger.ParseLevel(getEnvOrDefault("LOG_LEVEL", logLevel))
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	format, err := logger.ParseFormat(getEnvOrDefault("LOG_FORMAT", logFormat))
+	if err != nil {
+		log.Fatalf("Invalid LOG_FORMAT: %v", err)
+	}
+	logOptions := []logger.Option{
+		logger.WithLevel(level),
+		logger.WithFormat(format),
+		logger.WithRotation(logger.RotationConfig{
+			MaxSize:    int64(getEnvIntOrDefault("LOG_MAX_SIZE_MB", defaultLogMaxSizeMB)) << 20,
+			Interval:   getEnvDurationOrDefault("LOG_ROTATE_INTERVAL", defaultLogRotateInterval),
+			MaxBackups: getEnvIntOrDefault("LOG_MAX_BACKUPS", defaultLogMaxBackups),
+			Compress:   getEnvOrDefault("LOG_COMPRESS", "true") != "false",
+		}),
+	}
+	// LOG_OUTPUTS lists where records go: file (LOG_FILE_PATH), stderr and
+	// syslog (LOG_SYSLOG_ADDRESS, the local /dev/log socket by default)
+	logPath := ""
+	for _, output := range config.SplitList(getEnvOrDefault("LOG_OUTPUTS", defaultLogOutputs)) {
+		switch output {
+		case "file":
+			logPath = logFilePath
+		case "stderr":
+			logOptions = append(logOptions, logger.WithStderr())
+		case "syslog":
+			logOptions = append(logOptions, logger.WithSyslog(os.Getenv("LOG_SYSLOG_ADDRESS"), defaultServiceName))
+		default:
+			log.Fatalf("Invalid LOG_OUTPUTS %q: expected file, stderr or syslog", output)
+		}
+	}
+	if err := logger.Init(logPath, logOptions...); err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 	defer logger.Close()
 
+	// Reopen the log file on SIGHUP, after logrotate has moved it
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := logger.Reopen(); err != nil {
+				log.Printf("Failed to reopen the log file: %v", err)
+				continue
+			}
+			appLog.Info("Reopened the log file")
+		}
+	}()
+
+	// Tracing: TRACE_EXPORTER=otlp sends spans to a collector over OTLP/HTTP,
+	// stdout writes them as JSON lines
+	var traces *tracing.Provider
+	var exporter tracing.Exporter
+	switch traceExporter := getEnvOrDefault("TRACE_EXPORTER", ""); traceExporter {
+	case "":
+	case "otlp":
+		endpoint := strings.TrimSuffix(getEnvOrDefault("OTEL_EXPORTER_OTLP_ENDPOINT", defaultOTLPEndpoint), "/") + "/v1/traces"
+		exporter = tracing.NewOTLPExporter(endpoint, getEnvOrDefault("OTEL_SERVICE_NAME", defaultServiceName))
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	default:
+		log.Fatalf("Invalid TRACE_EXPORTER %q: expected otlp or stdout", traceExporter)
+	}
+	if exporter != nil {
+		traceConfig := tracing.DefaultProviderConfig()
+		traceConfig.OnError = func(err error) {
+			appLog.Warn("Failed to export spans", "error", err)
+		}
+		traces = tracing.NewProvider(exporter, traceConfig)
+		tracing.SetProvider(traces)
+	}
+
 	// Initialize components
-	storage := storage.NewMemoryStorage()
+	store := storage.NewMemoryStorage()
 	rpcClient := parser.NewRPCClient(cfg)
-	p := parser.NewParser(storage, rpcClient)
 
-	// Always use console notification service for simplicity
-	notificationService := notification.NewConsoleNotificationService()
+	retention := storage.RetentionPolicy{
+		MaxAge:        cfg.Retention.MaxAge,
+		MaxBlockDepth: cfg.Retention.MaxBlockDepth,
+		MaxPerAddress: cfg.Retention.MaxPerAddress,
+	}
+	pruner := storage.NewPruner(store, retention, cfg.Retention.PruneInterval)
+
+	balances := ledger.NewLedger(store)
+	reconciler := ledger.NewReconciler(balances, store, rpcClient, cfg.ReconcileInterval)
+
+	// Webhooks are delivered through the outbox, which retries failed
+	// deliveries with backoff; retrying inside the webhook as well would
+	// multiply the attempts against a dead endpoint
+	webhookConfig := notification.DefaultWebhookConfig()
+	webhookConfig.MaxAttempts = 1
+	if os.Getenv("WEBHOOK_MAX_ATTEMPTS") != "" {
+		appLog.Warn("WEBHOOK_MAX_ATTEMPTS is ignored: webhook retries are limited by OUTBOX_MAX_ATTEMPTS")
+	}
+	webhooks := notification.NewWebhookNotificationService(webhookConfig)
+	if webhookURL := getEnvOrDefault("WEBHOOK_URL", ""); webhookURL != "" {
+		webhooks.SetDefaultEndpoint(notification.WebhookEndpoint{
+			URL:    webhookURL,
+			Secret: getEnvOrDefault("WEBHOOK_SECRET", ""),
+		})
+	}
+
+	// Each notification is routed to the channels configured for its address,
+	// falling back to NOTIFY_CHANNELS (NOTIFIER is kept for compatibility)
+	notifier := notification.NewCompositeNotificationService()
+	notifier.AddChannel("console", notification.NewConsoleNotificationService())
+	notifier.AddChannel("webhook", webhooks)
+	if path := getEnvOrDefault("NOTIFY_FILE_PATH", ""); path != "" {
+		notifier.AddChannel("file", notification.NewFileNotificationService(path))
+	}
+	sections := []archive.Section{webhooks.Settings(), notifier.Settings()}
+
+	var email *notification.EmailNotificationService
+	if smtpHost := getEnvOrDefault("SMTP_HOST", ""); smtpHost != "" {
+		templates, err := notification.LoadEmailTemplates(getEnvOrDefault("EMAIL_TEMPLATE_DIR", ""))
+		if err != nil {
+			log.Fatalf("Failed to load email templates: %v", err)
+		}
+		email = notification.NewEmailNotificationService(notification.EmailConfig{
+			Host:        smtpHost,
+			Port:        getEnvIntOrDefault("SMTP_PORT", defaultSMTPPort),
+			Username:    getEnvOrDefault("SMTP_USERNAME", ""),
+			Password:    getEnvOrDefault("SMTP_PASSWORD", ""),
+			From:        getEnvOrDefault("SMTP_FROM", ""),
+			To:          getEnvOrDefault("SMTP_TO", ""),
+			RequireTLS:  getEnvOrDefault("SMTP_REQUIRE_TLS", "true") == "true",
+			BatchWindow: getEnvDurationOrDefault("EMAIL_BATCH_WINDOW", defaultEmailBatchWindow),
+		}, templates)
+		notifier.AddChannel("email", email)
+		sections = append(sections, email.Settings())
+	}
+
+	// Chat channels link to the block explorer of CHAIN unless EXPLORER_URL is set
+	explorer := notification.NewExplorer(getEnvOrDefault("CHAIN", defaultChain), getEnvOrDefault("EXPLORER_URL", ""))
+	for name, format := range map[string]notification.ChatFormat{
+		"SLACK_WEBHOOK_URL":   notification.ChatSlack,
+		"DISCORD_WEBHOOK_URL": notification.ChatDiscord,
+		"TEAMS_WEBHOOK_URL":   notification.ChatTeams,
+	} {
+		if chatURL := getEnvOrDefault(name, ""); chatURL != "" {
+			notifier.AddChannel(string(format), notification.NewChatNotificationService(format, chatURL, explorer))
+		}
+	}
+
+	channels := getEnvOrDefault("NOTIFY_CHANNELS", getEnvOrDefault("NOTIFIER", defaultNotifier))
+	if err := notifier.SetDefaultChannels(config.SplitList(channels)...); err != nil {
+		log.Fatalf("Invalid NOTIFY_CHANNELS: %v", err)
+	}
+
+	// Notification filters apply when a notification is queued, rate caps and
+	// quiet hours when it is delivered
+	rules, err := notification.LoadRuleEngine(getEnvOrDefault("RULES_FILE", ""))
+	if err != nil {
+		log.Fatalf("Failed to load notification rules: %v", err)
+	}
+	filter := notification.NewFilteredNotificationService(notifier, rules)
+	sections = append(sections, rules.Settings(), filter.Settings())
+
+	// API keys are hashed in the storage. With API_AUTH enabled every
+	// endpoint needs a key; ADMIN_API_KEY provides the first admin key.
+	keys := auth.NewManager(store)
+	sections = append(sections, keys.Settings())
+
+	// The state saved at the last shutdown, including the block checkpoint,
+	// is restored before anything else uses the storage
+	stateFile := getEnvOrDefault("STATE_FILE", "")
+	if stateFile != "" {
+		stats, err := archive.LoadFile(stateFile, store, sections...)
+		if err != nil {
+			log.Fatalf("Failed to load STATE_FILE: %v", err)
+		}
+		if stats != nil {
+			fmt.Printf("Restored state from %s at block %d\n", stateFile, store.GetCurrentBlock())
+		}
+	}
+	var apiKeys *auth.Manager
+	if getEnvOrDefault("API_AUTH", "false") == "true" {
+		if secret := os.Getenv("ADMIN_API_KEY"); secret != "" {
+			if _, err := keys.Import("admin", "", secret, []auth.Scope{auth.ScopeAdmin}); err != nil {
+				log.Fatalf("Invalid ADMIN_API_KEY: %v", err)
+			}
+		} else if !keys.HasKeys() {
+			_, secret, err := keys.Create("bootstrap", "", []auth.Scope{auth.ScopeAdmin})
+			if err != nil {
+				log.Fatalf("Failed to create bootstrap API key: %v", err)
+			}
+			fmt.Printf("Created bootstrap admin API key, shown only once: %s\n", secret)
+		}
+		apiKeys = keys
+	}
+
+	// Notifications are persisted with their transaction and delivered by the
+	// outbox workers, so a failing notifier never blocks block processing
+	outboxConfig := notification.DefaultOutboxConfig()
+	outboxConfig.Workers = getEnvIntOrDefault("OUTBOX_WORKERS", outboxConfig.Workers)
+	outboxConfig.MaxAttempts = getEnvIntOrDefault("OUTBOX_MAX_ATTEMPTS", outboxConfig.MaxAttempts)
+	outbox := notification.NewOutbox(store, filter, outboxConfig)
+
+	// Notifications of an address watched by several tenants are delivered
+	// once per tenant, through the channels of that tenant
+	outbox.SetTenants(store)
+
+	// Quiet-hour digests are queued like any other notification
+	filter.SetDigestNotifier(outbox)
+
+	p := parser.NewParser(store, rpcClient, parser.WithOutbox(store, outbox.Builder(store)))
+
+	// Queue sizes and subscriptions are read from the storage on every scrape
+	metrics.Default.NewGaugeFunc("parser_subscribers", "Subscribed addresses", func() float64 {
+		return float64(len(store.GetSubscribers()))
+	})
+	metrics.Default.NewGaugeFunc("parser_outbox_pending", "Notifications waiting for delivery", func() float64 {
+		return float64(outbox.Stats().Pending)
+	})
+	metrics.Default.NewGaugeFunc("parser_outbox_dead_letters", "Notifications that exhausted their delivery attempts", func() float64 {
+		return float64(outbox.Stats().DeadLetters)
+	})
+
+	// Periodic summaries are queued in the outbox and follow each address route
+	var summaries *notification.SummaryScheduler
+	if period := getEnvOrDefault("SUMMARY_PERIOD", ""); period != "" {
+		summaryConfig := notification.DefaultSummaryConfig()
+		if summaryConfig.Period, err = notification.ParseSummaryPeriod(period); err != nil {
+			log.Fatalf("Invalid SUMMARY_PERIOD: %v", err)
+		}
+		if summaryConfig.Location, err = time.LoadLocation(getEnvOrDefault("SUMMARY_TIMEZONE", "UTC")); err != nil {
+			log.Fatalf("Invalid SUMMARY_TIMEZONE: %v", err)
+		}
+		summaryConfig.Largest = getEnvIntOrDefault("SUMMARY_LARGEST", summaryConfig.Largest)
+		summaryConfig.MaxCatchUp = getEnvIntOrDefault("SUMMARY_MAX_CATCH_UP", summaryConfig.MaxCatchUp)
+		summaries = notification.NewSummaryScheduler(store, outbox, summaryConfig)
+	}
+	// Live events for /stream, with a bounded history for resuming clients
+	hub := stream.NewHub(store, getEnvIntOrDefault("STREAM_HISTORY", stream.DefaultHistory))
+	monitor := monitor.NewBlockMonitor(p, rpcClient, nil, monitor.WithPublisher(hub))
+
+	// WebSocket clients share the hub; tokens authenticate each connection
+	slowPolicy, err := stream.ParseSlowPolicy(os.Getenv("WS_SLOW_CONSUMER"))
+	if err != nil {
+		log.Fatalf("Invalid WS_SLOW_CONSUMER: %v", err)
+	}
+	wsConfig := api.WebSocketConfig{
+		Tokens:       config.SplitList(os.Getenv("WS_AUTH_TOKENS")),
+		SlowPolicy:   slowPolicy,
+		MaxMonitored: getEnvIntOrDefault("WS_MAX_MONITORED", 0),
+	}
+	if len(wsConfig.Tokens) > 0 {
+		// Token holders may monitor new addresses; an open /ws only watches
+		// the monitored ones
+		wsConfig.Scope = auth.ScopeSubscribe
+		if apiKeys != nil {
+			appLog.Warn("WS_AUTH_TOKENS is ignored with API_AUTH=true: WebSocket clients authenticate with API keys")
+		}
+	}
 
-	monitor := monitor.NewBlockMonitor(p, rpcClient, notificationService)
+	// Requests are throttled per IP and per API key when any limit or quota
+	// is configured
+	var limiter *api.RateLimiter
+	defaultLimit, err := api.ParseRateLimit(os.Getenv("RATE_LIMIT"))
+	if err != nil {
+		log.Fatalf("Invalid RATE_LIMIT: %v", err)
+	}
+	routeLimits, err := api.ParseRouteLimits(os.Getenv("RATE_LIMIT_ROUTES"))
+	if err != nil {
+		log.Fatalf("Invalid RATE_LIMIT_ROUTES: %v", err)
+	}
+	perIP, err := api.ParseRateLimit(os.Getenv("RATE_LIMIT_PER_IP"))
+	if err != nil {
+		log.Fatalf("Invalid RATE_LIMIT_PER_IP: %v", err)
+	}
+	if dailyQuota := getEnvIntOrDefault("RATE_LIMIT_DAILY_QUOTA", 0); defaultLimit.Requests > 0 || len(routeLimits) > 0 || dailyQuota > 0 || perIP.Requests > 0 {
+		limiter = api.NewRateLimiter(api.RateLimitConfig{
+			Default:    defaultLimit,
+			Routes:     routeLimits,
+			DailyQuota: dailyQuota,
+			PerIP:      perIP,
+		})
+	}
 
 	// Example addresses for testing
 	testAddresses := []string{
@@ -117,10 +446,132 @@ func main() {
 		}
 	}
 
-	// Start block monitoring in the existing goroutine
-	go monitor.StartMonitoring()
+	// SIGINT and SIGTERM cancel ctx, which stops the monitor between blocks
+	// and every background worker
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+	run := func(start func(stop <-chan struct{})) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			start(ctx.Done())
+		}()
+	}
+
+	// Start block monitoring
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		monitor.Run(ctx)
+	}()
+
+	// Deliver queued notifications in the background
+	run(outbox.Start)
+
+	// Send periodic summaries in the background, catching up missed windows
+	if summaries != nil {
+		run(summaries.Start)
+	}
+
+	// Release quiet-hour digests in the background
+	run(func(stop <-chan struct{}) { filter.Start(defaultDigestInterval, stop) })
+
+	// Enforce retention policies in the background
+	run(pruner.Start)
+
+	// Compare computed balances with the node in the background
+	run(reconciler.Start)
+
+	server := api.NewServer(p, cfg.GetServerAddress(),
+		api.WithPruner(pruner),
+		api.WithArchive(store, sections...),
+		api.WithWebhooks(webhooks),
+		api.WithOutbox(outbox),
+		api.WithRoutes(notifier),
+		api.WithRules(rules, store),
+		api.WithEmail(email),
+		api.WithLabels(store),
+		api.WithTransactionExport(store),
+		api.WithStream(hub),
+		api.WithWebSocket(hub, wsConfig),
+		api.WithAuth(apiKeys),
+		api.WithTenants(store),
+		api.WithRateLimit(limiter),
+		api.WithLedger(balances),
+		api.WithMetrics(metrics.Default),
+		api.WithHealth(monitor, store, api.HealthConfig{
+			MaxLag:     int64(getEnvIntOrDefault("READY_MAX_LAG", defaultReadyMaxLag)),
+			MaxHeadAge: getEnvDurationOrDefault("READY_MAX_HEAD_AGE", defaultReadyMaxHeadAge),
+		}),
+	)
 
-	// Start HTTP server (this will block)
 	fmt.Printf("Starting HTTP server on %s\n", cfg.GetServerAddress())
-	api.StartServer(p, cfg.GetServerAddress())
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		fmt.Println("Shutting down...")
+	case err := <-serverErr:
+		appLog.Error("HTTP server failed", "error", err)
+		fmt.Printf("HTTP server failed: %v\n", err)
+		stop()
+	}
+
+	// Shutdown order: drain HTTP requests, wait for the monitor and the
+	// workers, deliver what is left in the notification queues, then save
+	// the state with the final checkpoint. The logger is closed last.
+	shutdown, cancel := context.WithTimeout(context.Background(), getEnvDurationOrDefault("SHUTDOWN_TIMEOUT", defaultShutdownTimeout))
+	defer cancel()
+
+	if err := server.Shutdown(shutdown); err != nil {
+		appLog.Warn("HTTP server did not drain in time", "error", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdown.Done():
+		appLog.Warn("Background workers did not stop before the shutdown timeout")
+	}
+
+	// Quiet-hour digests are saved with the state, or sent now without one
+	if stateFile == "" {
+		if flushed := filter.Flush(); flushed > 0 {
+			appLog.Info("Sent held notification digests during shutdown", "count", flushed)
+		}
+	}
+	if delivered := outbox.Drain(shutdown); delivered > 0 {
+		appLog.Info("Delivered queued notifications during shutdown", "count", delivered)
+	}
+	if email != nil {
+		if err := email.Flush(); err != nil {
+			appLog.Warn("Failed to flush batched emails", "error", err)
+		}
+	}
+	// Messages in an email batch are completed once the batch is sent; any
+	// still pending at the timeout stay queued
+	outbox.Wait(shutdown)
+
+	if stateFile != "" {
+		if _, err := archive.SaveFile(stateFile, store, sections...); err != nil {
+			appLog.Error("Failed to save state", "error", err)
+		} else {
+			appLog.Info("Saved state", "file", stateFile, "block", store.GetCurrentBlock())
+		}
+	}
+	if traces != nil {
+		if err := traces.Shutdown(shutdown); err != nil {
+			appLog.Warn("Failed to export the last spans", "error", err)
+		}
+	}
+	appLog.Info("Shutdown complete", "block", store.GetCurrentBlock())
 }
@@ -3,6 +3,7 @@ package main
 import (
     "os"
     "testing"
+    "time"
 )
 
 func TestGetEnvOrDefault(t *testing.T) {
@@ -194,4 +195,49 @@ func TestEnvironmentOverrides(t *testing.T) {
     if delay := getEnvIntOrDefault("MONITOR_DELAY", defaultDelay); delay != 10 {
         t.Errorf("Expected custom delay, got %d", delay)
     }
-}
\ No newline at end of file
+}
+func TestGetEnvDurationOrDefault(t *testing.T) {
+    testCases := []struct {
+        name         string
+        key          string
+        defaultValue time.Duration
+        envValue     string
+        expected     time.Duration
+    }{
+        {
+            name:         "returns default when env not set",
+            key:          "TEST_DURATION_1",
+            defaultValue: time.Minute,
+            envValue:     "",
+            expected:     time.Minute,
+        },
+        {
+            name:         "returns env value when set",
+            key:          "TEST_DURATION_2",
+            defaultValue: time.Minute,
+            envValue:     "720h",
+            expected:     720 * time.Hour,
+        },
+        {
+            name:         "returns default for invalid duration",
+            key:          "TEST_DURATION_3",
+            defaultValue: time.Minute,
+            envValue:     "30 days",
+            expected:     time.Minute,
+        },
+    }
+
+    for _, tc := range testCases {
+        t.Run(tc.name, func(t *testing.T) {
+            if tc.envValue != "" {
+                os.Setenv(tc.key, tc.envValue)
+                defer os.Unsetenv(tc.key)
+            }
+
+            result := getEnvDurationOrDefault(tc.key, tc.defaultValue)
+            if result != tc.expected {
+                t.Errorf("Expected %s, got %s", tc.expected, result)
+            }
+        })
+    }
+}
@@ -38,6 +38,15 @@ type DatabaseConfig struct {
 	Password string
 }
 
+// RetentionConfig controls how long transaction history is kept.
+// Zero values disable the corresponding limit.
+type RetentionConfig struct {
+	MaxAge        time.Duration
+	MaxBlockDepth int64
+	MaxPerAddress int
+	PruneInterval time.Duration
+}
+
 type Config struct {
 	RPCEndpoint  string
 	ServerHost   string
@@ -47,6 +56,10 @@ type Config struct {
 	MonitorDelay int
 	Database     DatabaseConfig
 	Network      NetworkConfig
+	Retention    RetentionConfig
+
+	// ReconcileInterval is how often computed balances are checked against the node
+	ReconcileInterval time.Duration
 }
 
 func NewConfig(RPCEndpoint, ServerHost, ServerPort, LogFilePath, Environment string, MonitorDelay int) *Config {
@@ -66,6 +79,10 @@ func NewConfig(RPCEndpoint, ServerHost, ServerPort, LogFilePath, Environment str
 			Type: MemoryDB,
 		},
 		Network: getNetworkConfig(networkType),
+		Retention: RetentionConfig{
+			PruneInterval: 10 * time.Minute,
+		},
+		ReconcileInterval: 10 * time.Minute,
 	}
 }
 
@@ -111,3 +128,26 @@ func (cfg *Config) WithDatabase(dbType DatabaseType, host, port, name, user, pas
 	}
 	return cfg
 }
+
+// WithRetention sets the transaction retention configuration and returns the updated Config
+func (cfg *Config) WithRetention(maxAge time.Duration, maxBlockDepth int64, maxPerAddress int, pruneInterval time.Duration) *Config {
+	cfg.Retention = RetentionConfig{
+		MaxAge:        maxAge,
+		MaxBlockDepth: maxBlockDepth,
+		MaxPerAddress: maxPerAddress,
+		PruneInterval: pruneInterval,
+	}
+	return cfg
+}
+
+// SplitList splits a comma-separated setting or parameter, trimming spaces
+// and dropping empty items
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
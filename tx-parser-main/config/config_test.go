@@ -0,0 +1,13 @@
+package config
+
+import "testing"
+
+func TestSplitList(t *testing.T) {
+	result := SplitList(" console, webhook,,file ")
+	if len(result) != 3 || result[0] != "console" || result[1] != "webhook" || result[2] != "file" {
+		t.Errorf("Expected [console webhook file], got %v", result)
+	}
+	if result := SplitList(""); len(result) != 0 {
+		t.Errorf("Expected empty list, got %v", result)
+	}
+}
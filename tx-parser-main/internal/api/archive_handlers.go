@@ -0,0 +1,58 @@
+package api
+
+import (
+	"blockchain-parser/internal/archive"
+	"net/http"
+)
+
+// makeExportHandler creates a handler for /admin/export which streams the
+// parser state as a newline-delimited JSON archive
+func makeExportHandler(store archive.Store, sections []archive.Section) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling export request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			log.WarnContext(r.Context(), "Invalid method for export endpoint", "method", r.Method)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="parser-state.ndjson"`)
+		w.WriteHeader(http.StatusOK)
+
+		// The status is already sent, so a failure can only be logged
+		if _, err := archive.Export(w, store, sections...); err != nil {
+			log.ErrorContext(r.Context(), "Export failed", "remote", r.RemoteAddr, "error", err)
+		}
+	}
+}
+
+// makeImportHandler creates a handler for /admin/import which loads an
+// archive produced by /admin/export
+func makeImportHandler(store archive.Store, sections []archive.Section) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling import request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodPost) {
+			log.WarnContext(r.Context(), "Invalid method for import endpoint", "method", r.Method)
+			return
+		}
+		defer r.Body.Close()
+
+		stats, err := archive.Import(r.Body, store, sections...)
+		if err != nil {
+			log.ErrorContext(r.Context(), "Import failed", "remote", r.RemoteAddr, "error", err)
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Code:    ErrCodeInvalidArchive,
+			})
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"status":   "success",
+			"imported": stats,
+		})
+	}
+}
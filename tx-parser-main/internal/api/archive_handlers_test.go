@@ -0,0 +1,55 @@
+package api
+
+import (
+	"blockchain-parser/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportImportHandlers(t *testing.T) {
+	source := storage.NewMemoryStorage()
+	source.AddSubscriber(testAddress)
+	source.StoreTransaction(storage.Transaction{
+		Hash:        "0xaaa",
+		FromAddress: testAddress,
+		BlockNumber: 7,
+	})
+	source.UpdateCurrentBlock(7)
+
+	rec := httptest.NewRecorder()
+	makeExportHandler(source, nil)(rec, httptest.NewRequest(http.MethodGet, "/admin/export", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON content type, got %s", ct)
+	}
+
+	target := storage.NewMemoryStorage()
+	importRec := httptest.NewRecorder()
+	makeImportHandler(target, nil)(importRec, httptest.NewRequest(http.MethodPost, "/admin/import", rec.Body))
+	if importRec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, importRec.Code, importRec.Body.String())
+	}
+	if target.GetCurrentBlock() != 7 || !target.IsSubscribed(testAddress) {
+		t.Error("Expected state to be imported")
+	}
+	if len(target.GetTransactions(testAddress)) != 1 {
+		t.Error("Expected transaction to be imported")
+	}
+}
+
+func TestImportHandlerRejectsInvalidArchive(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/import", strings.NewReader("garbage"))
+	makeImportHandler(storage.NewMemoryStorage(), nil)(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), ErrCodeInvalidArchive) {
+		t.Errorf("Expected %s error code, got %s", ErrCodeInvalidArchive, rec.Body.String())
+	}
+}
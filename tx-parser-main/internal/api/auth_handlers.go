@@ -0,0 +1,256 @@
+package api
+
+import (
+	"blockchain-parser/internal/auth"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key management limits
+const (
+	maxKeyBodySize    = 1 << 16
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// requestKey returns the API key sent in the X-API-Key or Authorization
+// header
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return ""
+}
+
+// statusRecorder captures the status written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection over for WebSocket upgrades, which answer
+// 101 on the raw connection
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// requireScope wraps a handler so it only runs for requests carrying an
+// active key with the required scope. Requests needing more than read access
+// are recorded in the audit log with the key that made them.
+func requireScope(keys *auth.Manager, scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := keys.Authenticate(requestKey(r))
+		if !ok {
+			log.WarnContext(r.Context(), "Rejected unauthenticated request", "path", r.URL.Path, "remote", r.RemoteAddr)
+			sendRequestError(w, r, ErrUnauthorized)
+			return
+		}
+		if !auth.Allows(key.Scopes, scope) {
+			log.WarnContext(r.Context(), "Key lacks the required scope", "key", key.ID, "name", key.Name, "scope", scope, "path", r.URL.Path)
+			sendRequestError(w, r, ErrForbidden)
+			return
+		}
+
+		r = r.WithContext(auth.WithKey(r.Context(), key))
+		if scope == auth.ScopeRead {
+			next(w, r)
+			return
+		}
+
+		// Handlers reading the address from a JSON body report it through
+		// setAuditAddress
+		address := r.URL.Query().Get("address")
+		if address == "" {
+			address = r.PathValue("address")
+		}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, withAuditAddress(r, &address))
+		keys.Record(key, r.Method+" "+r.URL.Path, address, r.RemoteAddr, recorder.status)
+	}
+}
+
+// apiKeyResponse describes a key without its hash
+type apiKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Tenant     string     `json:"tenant"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Revoked    bool       `json:"revoked"`
+	Key        string     `json:"key,omitempty"`
+}
+
+// createKeyRequest is the body of POST /admin/keys
+type createKeyRequest struct {
+	Name   string   `json:"name"`
+	Tenant string   `json:"tenant"`
+	Scopes []string `json:"scopes"`
+}
+
+// makeKeysHandler creates a handler for /admin/keys. GET lists the keys,
+// POST creates a key and returns its secret once, and DELETE revokes the key
+// given by the id parameter.
+func makeKeysHandler(keys *auth.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling API keys request", "remote", r.RemoteAddr)
+
+		switch r.Method {
+		case http.MethodGet:
+			response := []apiKeyResponse{}
+			for _, key := range keys.Keys() {
+				item := apiKeyResponse{
+					ID:        key.ID,
+					Name:      key.Name,
+					Scopes:    key.Scopes,
+					Tenant:    key.Tenant,
+					CreatedAt: key.CreatedAt,
+					Revoked:   key.Revoked,
+				}
+				if !key.LastUsedAt.IsZero() {
+					lastUsed := key.LastUsedAt
+					item.LastUsedAt = &lastUsed
+				}
+				response = append(response, item)
+			}
+			respondWithJSON(w, http.StatusOK, response)
+
+		case http.MethodPost:
+			r.Body = http.MaxBytesReader(w, r.Body, maxKeyBodySize)
+			var req createKeyRequest
+			decoder := json.NewDecoder(r.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&req); err != nil {
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: "Invalid JSON body",
+					Code:    ErrCodeJSONParseError,
+				})
+				return
+			}
+
+			var scopes []auth.Scope
+			for _, value := range req.Scopes {
+				scope, err := auth.ParseScope(value)
+				if err != nil {
+					SendError(w, &APIError{
+						Status:  http.StatusBadRequest,
+						Message: err.Error(),
+						Code:    ErrCodeInvalidParameter,
+					})
+					return
+				}
+				scopes = append(scopes, scope)
+			}
+
+			key, secret, err := keys.Create(req.Name, req.Tenant, scopes)
+			if err != nil {
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Error(),
+					Code:    ErrCodeInvalidParameter,
+				})
+				return
+			}
+			respondWithJSON(w, http.StatusCreated, apiKeyResponse{
+				ID:        key.ID,
+				Name:      key.Name,
+				Scopes:    key.Scopes,
+				Tenant:    key.Tenant,
+				CreatedAt: key.CreatedAt,
+				Key:       secret,
+			})
+
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if err := keys.Revoke(id); err != nil {
+				SendError(w, &APIError{
+					Status:  http.StatusNotFound,
+					Message: "API key not found",
+					Code:    ErrCodeNotFound,
+				})
+				return
+			}
+			respondWithJSON(w, http.StatusOK, map[string]string{
+				"status": "revoked",
+				"id":     id,
+			})
+
+		default:
+			SendError(w, ErrMethodNotAllowed)
+		}
+	}
+}
+
+// makeAuditHandler creates a handler for /admin/keys/audit which lists the
+// newest audit entries, of one key when the key parameter is given
+func makeAuditHandler(keys *auth.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling audit log request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		limit := defaultAuditLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 || parsed > maxAuditLimit {
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: "limit must be between 1 and 1000",
+					Code:    ErrCodeInvalidParameter,
+				})
+				return
+			}
+			limit = parsed
+		}
+
+		entries := []map[string]interface{}{}
+		for _, entry := range keys.Audit(r.URL.Query().Get("key"), limit) {
+			entries = append(entries, map[string]interface{}{
+				"time":        entry.Time,
+				"key_id":      entry.KeyID,
+				"key_name":    entry.KeyName,
+				"tenant":      entry.Tenant,
+				"action":      entry.Action,
+				"address":     entry.Address,
+				"remote_addr": entry.RemoteAddr,
+				"status":      entry.Status,
+			})
+		}
+		respondWithJSON(w, http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/stream"
+	"blockchain-parser/internal/websocket"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireScope(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	keys := auth.NewManager(store)
+	_, reader, _ := keys.Create("reader", "", []auth.Scope{auth.ScopeRead})
+	_, subscriber, _ := keys.Create("subscriber", "", []auth.Scope{auth.ScopeSubscribe})
+	handler := requireScope(keys, auth.ScopeSubscribe, makeSubscribeHandler(parser.NewParser(store, nil), nil, nil, nil))
+
+	testCases := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"missing key", "", "", http.StatusUnauthorized},
+		{"unknown key", "X-API-Key", "txp_unknown", http.StatusUnauthorized},
+		{"read only key", "X-API-Key", reader, http.StatusForbidden},
+		{"subscribe key", "Authorization", "Bearer " + subscriber, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/subscribe?address="+testAddress, nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	entries := keys.Audit("", 10)
+	if len(entries) != 1 || entries[0].KeyName != "subscriber" || entries[0].Address != testAddress || entries[0].Action != "POST /subscribe" {
+		t.Errorf("Expected the subscription to be audited, got %+v", entries)
+	}
+}
+
+func TestKeysHandler(t *testing.T) {
+	keys := auth.NewManager(storage.NewMemoryStorage())
+	handler := makeKeysHandler(keys)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/keys", strings.NewReader(`{"name":"indexer","scopes":["read"]}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created apiKeyResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.Key == "" || created.ID == "" {
+		t.Fatalf("Expected the secret in the response, got %+v", created)
+	}
+	if _, ok := keys.Authenticate(created.Key); !ok {
+		t.Error("Expected the returned secret to authenticate")
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/keys", nil))
+	if strings.Contains(rec.Body.String(), created.Key) || strings.Contains(rec.Body.String(), auth.HashSecret(created.Key)) {
+		t.Error("Expected the list to hide secrets and hashes")
+	}
+	var listed []apiKeyResponse
+	json.NewDecoder(rec.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].Name != "indexer" {
+		t.Errorf("Unexpected key list: %+v", listed)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/admin/keys?id="+created.ID, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if _, ok := keys.Authenticate(created.Key); ok {
+		t.Error("Expected the revoked key to fail")
+	}
+
+	testCases := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+	}{
+		{"unknown scope", http.MethodPost, "/admin/keys", `{"name":"x","scopes":["owner"]}`, http.StatusBadRequest},
+		{"missing name", http.MethodPost, "/admin/keys", `{"scopes":["read"]}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "/admin/keys", `{"name":"x","scopes":["read"],"secret":"s"}`, http.StatusBadRequest},
+		{"revoke unknown", http.MethodDelete, "/admin/keys?id=missing", "", http.StatusNotFound},
+		{"invalid method", http.MethodPut, "/admin/keys", "", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	keys := auth.NewManager(storage.NewMemoryStorage())
+	first, _, _ := keys.Create("first", "", []auth.Scope{auth.ScopeSubscribe})
+	second, _, _ := keys.Create("second", "", []auth.Scope{auth.ScopeSubscribe})
+	keys.Record(first, "POST /subscribe", testAddress, "127.0.0.1", http.StatusOK)
+	keys.Record(second, "POST /subscribe", testAddress, "127.0.0.1", http.StatusOK)
+
+	rec := httptest.NewRecorder()
+	makeAuditHandler(keys)(rec, httptest.NewRequest(http.MethodGet, "/admin/keys/audit?key="+first.ID, nil))
+	var entries []map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&entries)
+	if len(entries) != 1 || entries[0]["key_name"] != "first" || entries[0]["address"] != testAddress {
+		t.Errorf("Expected the entry of the first key, got %+v", entries)
+	}
+
+	rec = httptest.NewRecorder()
+	makeAuditHandler(keys)(rec, httptest.NewRequest(http.MethodGet, "/admin/keys/audit?limit=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid limit, got %d", rec.Code)
+	}
+}
+
+func TestWebSocketAPIKeys(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	keys := auth.NewManager(store)
+	_, reader, _ := keys.Create("reader", "", []auth.Scope{auth.ScopeRead})
+	_, subscriber, _ := keys.Create("subscriber", "", []auth.Scope{auth.ScopeSubscribe})
+	p := parser.NewParser(store, nil)
+	cfg := WebSocketConfig{Keys: keys, Tokens: []string{"secret"}, Scope: auth.ScopeSubscribe}
+	server := httptest.NewServer(makeWebSocketHandler(p, stream.NewHub(store, 10), cfg))
+	defer server.Close()
+
+	// Static tokens carry no tenant or audit identity once keys are enabled
+	if _, resp, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?token=secret", nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a static token, got %v", err)
+	}
+
+	conn := wsDial(t, server, http.Header{"Authorization": []string{"Bearer " + reader}})
+	wsRead(t, conn)
+	wsSend(t, conn, wsClientMessage{Type: wsTypeSubscribe, ID: "1", Addresses: []string{testAddress}})
+	if msg := wsRead(t, conn); msg.Type != wsTypeError || msg.Code != ErrCodeForbidden {
+		t.Errorf("Expected a read-only key to be refused, got %+v", msg)
+	}
+	conn.Close(websocket.CloseNormal, "")
+
+	conn = wsDial(t, server, nil)
+	defer conn.Close(websocket.CloseNormal, "")
+	wsSend(t, conn, wsClientMessage{Type: wsTypeAuth, Token: subscriber})
+	wsRead(t, conn)
+	wsSend(t, conn, wsClientMessage{Type: wsTypeSubscribe, ID: "2", Addresses: []string{testAddress}})
+	if msg := wsRead(t, conn); msg.Type != wsTypeAck {
+		t.Errorf("Expected a subscribe ack, got %+v", msg)
+	}
+	if entries := keys.Audit("", 10); len(entries) != 1 || entries[0].KeyName != "subscriber" || entries[0].Action != "WS subscribe" {
+		t.Errorf("Expected the WebSocket subscription to be audited, got %+v", entries)
+	}
+}
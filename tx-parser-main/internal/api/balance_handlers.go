@@ -0,0 +1,118 @@
+package api
+
+import (
+	"blockchain-parser/internal/ledger"
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/utils"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// assetBalanceResponse is the balance of one asset in base units. Formatted
+// is only set for ether, whose decimals are known.
+type assetBalanceResponse struct {
+	Raw       string `json:"raw"`
+	Formatted string `json:"formatted,omitempty"`
+}
+
+// driftResponse is the JSON form of a ledger.Drift
+type driftResponse struct {
+	Block      int64  `json:"block"`
+	Expected   string `json:"expected_wei"`
+	Actual     string `json:"actual_wei"`
+	Difference string `json:"difference_wei"`
+	DetectedAt string `json:"detected_at"`
+}
+
+// makeBalanceHandler creates a handler for /balances/{address}. The optional
+// block query parameter returns the historical balance at that block.
+func makeBalanceHandler(l *ledger.Ledger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling balance request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			log.WarnContext(r.Context(), "Invalid method for balances endpoint", "method", r.Method)
+			return
+		}
+
+		address := r.PathValue("address")
+		if err := ValidateAddress(address); err != nil {
+			log.WarnContext(r.Context(), "Invalid address format", "address", address, "error", err.Message)
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: err.Message,
+				Code:    ErrCodeInvalidAddress,
+			})
+			return
+		}
+
+		block := int64(-1)
+		if value := r.URL.Query().Get("block"); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err == nil {
+				if verr := ValidateBlockNumber(parsed); verr == nil {
+					block = parsed
+				}
+			}
+			if block < 0 {
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: "block must be a non-negative integer",
+					Code:    ErrCodeInvalidParameter,
+				})
+				return
+			}
+		}
+
+		balances, err := l.BalanceAt(address, block)
+		if errors.Is(err, ledger.ErrPruned) {
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Code:    ErrCodeInvalidParameter,
+			})
+			return
+		}
+		if err != nil {
+			log.ErrorContext(r.Context(), "Failed to compute balance", "address", address, "error", err)
+			SendError(w, ErrInternalServer)
+			return
+		}
+
+		response := map[string]interface{}{
+			"address":  address,
+			"balances": toBalancesResponse(balances),
+		}
+		if block >= 0 {
+			response["block"] = block
+		} else {
+			response["block"] = "latest"
+		}
+		if drift, ok := l.Drift(address); ok {
+			response["drift"] = driftResponse{
+				Block:      drift.Block,
+				Expected:   drift.Expected.String(),
+				Actual:     drift.Actual.String(),
+				Difference: drift.Difference.String(),
+				DetectedAt: drift.DetectedAt.UTC().Format(time.RFC3339),
+			}
+		}
+
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+func toBalancesResponse(balances map[string]*big.Int) map[string]assetBalanceResponse {
+	response := make(map[string]assetBalanceResponse, len(balances))
+	for asset, balance := range balances {
+		entry := assetBalanceResponse{Raw: balance.String()}
+		if asset == storage.NativeAsset {
+			entry.Formatted = utils.WeiToEther(balance)
+		}
+		response[asset] = entry
+	}
+	return response
+}
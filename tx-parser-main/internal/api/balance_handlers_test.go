@@ -0,0 +1,67 @@
+package api
+
+import (
+	"blockchain-parser/internal/ledger"
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBalanceHandler(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.StoreTransaction(storage.Transaction{
+		Hash:        "0xaaa",
+		FromAddress: "0xdd93e92dc32d0b2f51430b0e6da29bdd01af68d6",
+		ToAddress:   testAddress,
+		ValueWei:    "2000000000000000000",
+		BlockNumber: 10,
+	})
+	store.StoreTransaction(storage.Transaction{
+		Hash:        "0xbbb",
+		FromAddress: "0xdd93e92dc32d0b2f51430b0e6da29bdd01af68d6",
+		ToAddress:   testAddress,
+		ValueWei:    "500000000000000000",
+		BlockNumber: 20,
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/balances/{address}", makeBalanceHandler(ledger.NewLedger(store)))
+
+	testCases := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantEther  string
+	}{
+		{"latest balance", "/balances/" + testAddress, http.StatusOK, "2.5"},
+		{"historical balance", "/balances/" + testAddress + "?block=15", http.StatusOK, "2"},
+		{"invalid address", "/balances/0x123", http.StatusBadRequest, ""},
+		{"invalid block", "/balances/" + testAddress + "?block=-1", http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantEther == "" {
+				return
+			}
+
+			var response struct {
+				Balances map[string]assetBalanceResponse `json:"balances"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if got := response.Balances["ETH"].Formatted; got != tc.wantEther {
+				t.Errorf("Expected %s ETH, got %s", tc.wantEther, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"blockchain-parser/internal/notification"
+	"net/http"
+)
+
+// makeEmailsHandler creates a handler for /admin/emails. GET lists the
+// per-address recipients, POST sets the recipient of an address and an
+// empty recipient removes it.
+func makeEmailsHandler(email *notification.EmailNotificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling email recipients request", "remote", r.RemoteAddr)
+
+		switch r.Method {
+		case http.MethodGet:
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"recipients": email.Recipients(),
+			})
+
+		case http.MethodPost:
+			query := r.URL.Query()
+			address := query.Get("address")
+			if err := ValidateAddress(address); err != nil {
+				log.WarnContext(r.Context(), "Invalid address format", "address", address)
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Message,
+					Code:    ErrCodeInvalidAddress,
+				})
+				return
+			}
+
+			recipient := query.Get("recipient")
+			if err := ValidateEmail(recipient); recipient != "" && err != nil {
+				log.WarnContext(r.Context(), "Invalid email recipient", "address", address, "recipient", recipient)
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Message,
+					Code:    ErrCodeInvalidParameter,
+				})
+				return
+			}
+
+			email.SetRecipient(address, recipient)
+			log.InfoContext(r.Context(), "Updated email recipient", "address", address)
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"status":    "success",
+				"address":   address,
+				"recipient": recipient,
+			})
+
+		default:
+			log.WarnContext(r.Context(), "Invalid method for email recipients endpoint", "method", r.Method)
+			SendError(w, ErrMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"blockchain-parser/internal/notification"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEmailsHandler(t *testing.T) {
+	email := notification.NewEmailNotificationService(notification.EmailConfig{}, nil)
+	handler := makeEmailsHandler(email)
+
+	testCases := []struct {
+		name       string
+		method     string
+		query      string
+		wantStatus int
+	}{
+		{"set recipient", http.MethodPost, "?address=" + testAddress + "&recipient=owner@example.com", http.StatusOK},
+		{"invalid recipient", http.MethodPost, "?address=" + testAddress + "&recipient=not-an-email", http.StatusBadRequest},
+		{"invalid address", http.MethodPost, "?address=0x1&recipient=owner@example.com", http.StatusBadRequest},
+		{"list recipients", http.MethodGet, "", http.StatusOK},
+		{"invalid method", http.MethodPut, "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tc.method, "/admin/emails"+tc.query, nil))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if recipient := email.Recipients()[strings.ToLower(testAddress)]; recipient != "owner@example.com" {
+		t.Errorf("Expected recipient to be stored, got %q", recipient)
+	}
+
+	// An empty recipient removes it
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/emails?address="+testAddress, nil))
+	if len(email.Recipients()) != 0 {
+		t.Error("Expected recipient to be removed")
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 type APIError struct {
@@ -19,6 +20,12 @@ const (
 	ErrCodeServerError       = "SERVER_ERROR"
 	ErrCodeInvalidMethod     = "INVALID_METHOD"
 	ErrCodeJSONParseError    = "JSON_PARSE_ERROR"
+	ErrCodeInvalidParameter  = "INVALID_PARAMETER"
+	ErrCodeInvalidArchive    = "INVALID_ARCHIVE"
+	ErrCodeNotFound          = "NOT_FOUND"
+	ErrCodeUnauthorized      = "UNAUTHORIZED"
+	ErrCodeForbidden         = "FORBIDDEN"
+	ErrCodeRateLimited       = "RATE_LIMITED"
 )
 
 // Error responses
@@ -47,6 +54,30 @@ var (
 		Code:    ErrCodeInvalidMethod,
 	}
 
+	ErrUnauthorized = &APIError{
+		Status:  http.StatusUnauthorized,
+		Message: "Missing or invalid credentials",
+		Code:    ErrCodeUnauthorized,
+	}
+
+	ErrForbidden = &APIError{
+		Status:  http.StatusForbidden,
+		Message: "API key lacks the required scope",
+		Code:    ErrCodeForbidden,
+	}
+
+	ErrRateLimited = &APIError{
+		Status:  http.StatusTooManyRequests,
+		Message: "Too many requests, retry after the Retry-After delay",
+		Code:    ErrCodeRateLimited,
+	}
+
+	ErrQuotaExceeded = &APIError{
+		Status:  http.StatusTooManyRequests,
+		Message: "Daily request quota exceeded",
+		Code:    ErrCodeRateLimited,
+	}
+
 	ErrInternalServer = &APIError{
 		Status:  http.StatusInternalServerError,
 		Message: "Internal server error",
@@ -61,6 +92,16 @@ func SendError(w http.ResponseWriter, err *APIError) {
 	json.NewEncoder(w).Encode(err)
 }
 
+// sendRequestError sends an error in the shape of the API version of the
+// request: the /v1 envelope for /v1 routes, a plain APIError otherwise
+func sendRequestError(w http.ResponseWriter, r *http.Request, err *APIError) {
+	if strings.HasPrefix(r.URL.Path, "/v1/") {
+		sendV1Error(w, err)
+		return
+	}
+	SendError(w, err)
+}
+
 // ValidateMethod checks if the request method is allowed
 func ValidateMethod(w http.ResponseWriter, r *http.Request, allowed string) bool {
 	if r.Method != allowed {
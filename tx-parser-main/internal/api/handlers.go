@@ -2,31 +2,368 @@
 package api
 
 import (
+	"blockchain-parser/internal/archive"
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/ledger"
 	"blockchain-parser/internal/logger"
+	"blockchain-parser/internal/metrics"
+	"blockchain-parser/internal/notification"
 	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/stream"
+	"context"
 	"encoding/json"
+	"net"
 	"net/http"
 )
 
+// log is the logger of the HTTP API
+var log = logger.Component("api")
+
+// ServerOption enables optional endpoints on the HTTP server
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	pruner          *storage.Pruner
+	archiveStore    archive.Store
+	archiveSections []archive.Section
+	txScanner       storage.TransactionScanner
+	ledger          *ledger.Ledger
+	webhooks        *notification.WebhookNotificationService
+	outbox          *notification.Outbox
+	routes          *notification.CompositeNotificationService
+	email           *notification.EmailNotificationService
+	labels          storage.LabelStore
+	rules           *notification.RuleEngine
+	rulesScanner    storage.TransactionScanner
+	hub             *stream.Hub
+	wsHub           *stream.Hub
+	wsConfig        WebSocketConfig
+	keys            *auth.Manager
+	tenants         storage.TenantStore
+	limiter         *RateLimiter
+	status          StatusReporter
+	healthStore     storage.Pinger
+	health          HealthConfig
+	metrics         *metrics.Registry
+}
+
+// WithPruner exposes the retention and compaction admin endpoints
+func WithPruner(pruner *storage.Pruner) ServerOption {
+	return func(o *serverOptions) {
+		o.pruner = pruner
+	}
+}
+
+// WithArchive exposes the state export and import admin endpoints
+func WithArchive(store archive.Store, sections ...archive.Section) ServerOption {
+	return func(o *serverOptions) {
+		o.archiveStore = store
+		o.archiveSections = sections
+	}
+}
+
+// WithTransactionExport exposes the CSV transaction export endpoint
+func WithTransactionExport(scanner storage.TransactionScanner) ServerOption {
+	return func(o *serverOptions) {
+		o.txScanner = scanner
+	}
+}
+
+// WithLedger exposes the per-address balance endpoint
+func WithLedger(l *ledger.Ledger) ServerOption {
+	return func(o *serverOptions) {
+		o.ledger = l
+	}
+}
+
+// WithWebhooks exposes the webhook configuration endpoint
+func WithWebhooks(webhooks *notification.WebhookNotificationService) ServerOption {
+	return func(o *serverOptions) {
+		o.webhooks = webhooks
+	}
+}
+
+// WithOutbox exposes the dead-letter inspection and replay endpoints
+func WithOutbox(outbox *notification.Outbox) ServerOption {
+	return func(o *serverOptions) {
+		o.outbox = outbox
+	}
+}
+
+// WithRoutes exposes the notification routing endpoint
+func WithRoutes(composite *notification.CompositeNotificationService) ServerOption {
+	return func(o *serverOptions) {
+		o.routes = composite
+	}
+}
+
+// WithEmail exposes the email recipient configuration endpoint
+func WithEmail(email *notification.EmailNotificationService) ServerOption {
+	return func(o *serverOptions) {
+		o.email = email
+	}
+}
+
+// WithLabels accepts a label when subscribing an address
+func WithLabels(labels storage.LabelStore) ServerOption {
+	return func(o *serverOptions) {
+		o.labels = labels
+	}
+}
+
+// WithRules exposes the notification rule endpoints, replaying the history
+// read from scanner for dry runs
+func WithRules(engine *notification.RuleEngine, scanner storage.TransactionScanner) ServerOption {
+	return func(o *serverOptions) {
+		o.rules = engine
+		o.rulesScanner = scanner
+	}
+}
+
+// WithStream exposes the Server-Sent Events stream of live events
+func WithStream(hub *stream.Hub) ServerOption {
+	return func(o *serverOptions) {
+		o.hub = hub
+	}
+}
+
+// WithWebSocket exposes the WebSocket endpoint for live subscriptions
+func WithWebSocket(hub *stream.Hub, cfg WebSocketConfig) ServerOption {
+	return func(o *serverOptions) {
+		o.wsHub = hub
+		o.wsConfig = cfg
+	}
+}
+
+// WithAuth requires an API key on every endpoint: read scope for queries and
+// streams, subscribe scope for /subscribe and admin scope for /admin. Without
+// it the /admin endpoints are not mounted.
+func WithAuth(keys *auth.Manager) ServerOption {
+	return func(o *serverOptions) {
+		o.keys = keys
+	}
+}
+
+// WithTenants scopes subscriptions and transaction visibility to the tenant
+// of each API key and exposes the per-tenant notification settings
+func WithTenants(tenants storage.TenantStore) ServerOption {
+	return func(o *serverOptions) {
+		o.tenants = tenants
+	}
+}
+
+// WithRateLimit throttles every endpoint per client and exposes the
+// throttling metrics
+func WithRateLimit(limiter *RateLimiter) ServerOption {
+	return func(o *serverOptions) {
+		o.limiter = limiter
+	}
+}
+
+// WithHealth exposes the readiness check and the monitor status. The store
+// is pinged by the readiness check unless it is nil.
+func WithHealth(reporter StatusReporter, store storage.Pinger, cfg HealthConfig) ServerOption {
+	return func(o *serverOptions) {
+		o.status = reporter
+		o.healthStore = store
+		o.health = cfg
+	}
+}
+
+// WithMetrics exposes the registry on /metrics in the Prometheus text format
+func WithMetrics(registry *metrics.Registry) ServerOption {
+	return func(o *serverOptions) {
+		o.metrics = registry
+	}
+}
+
 // StartServer initializes and starts the HTTP server with all endpoints
-func StartServer(p parser.Parser, address string) error {
-	http.HandleFunc("/currentBlock", makeCurrentBlockHandler(p))
-	http.HandleFunc("/subscribe", makeSubscribeHandler(p))
-	http.HandleFunc("/transactions", makeTransactionsHandler(p))
+func StartServer(p parser.Parser, address string, opts ...ServerOption) error {
+	return NewServer(p, address, opts...).ListenAndServe()
+}
+
+// NewServer creates the HTTP server with all endpoints on its own mux. Its
+// Shutdown drains in-flight requests and ends /stream and /ws connections,
+// whose request contexts are cancelled when shutdown starts.
+func NewServer(p parser.Parser, address string, opts ...ServerOption) *http.Server {
+	options := &serverOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	mux := http.NewServeMux()
+	streams, cancelStreams := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        address,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return streams },
+	}
+	server.RegisterOnShutdown(cancelStreams)
+
+	// register adds a handler to the mux, recording its request metrics
+	register := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, instrument(pattern, handler))
+	}
+
+	// handle registers a handler, throttled when rate limiting is enabled
+	// and requiring an API key with scope when authentication is enabled.
+	// Clients are limited by their IP address before authentication, so
+	// requests without a valid key are throttled too, and by their key
+	// after it. Admin endpoints can replace or dump the whole state, so they
+	// are only mounted behind authentication.
+	adminDisabled := false
+	handle := func(pattern string, scope auth.Scope, handler http.HandlerFunc) {
+		if scope == auth.ScopeAdmin && options.keys == nil {
+			adminDisabled = true
+			return
+		}
+		if options.limiter != nil {
+			handler = options.limiter.wrap(pattern, handler)
+		}
+		if options.keys != nil {
+			handler = requireScope(options.keys, scope, handler)
+			if options.limiter != nil {
+				handler = options.limiter.wrapAddress(pattern, handler)
+			}
+		}
+		register(pattern, handler)
+	}
+
+	// visible hides the addresses of other tenants when tenants are enabled
+	visible := func(handler http.HandlerFunc) http.HandlerFunc {
+		if options.tenants == nil {
+			return handler
+		}
+		return requireTenantAddress(options.tenants, handler)
+	}
+
+	// Probes are public and never throttled so orchestrators can always
+	// reach them
+	register("/healthz", makeHealthHandler())
+	if options.status != nil {
+		register("/readyz", makeReadinessHandler(options.status, options.healthStore, options.health))
+		handle("/status", auth.ScopeRead, makeStatusHandler(p, options.status, options.tenants))
+	}
+	if options.metrics != nil {
+		handle("GET /metrics", auth.ScopeRead, options.metrics.Handler())
+	}
+
+	// The versioned API and its OpenAPI document, generated from the same
+	// route table. The document is public so clients can discover the API.
+	// Subscriptions of WebSocket clients are shared with the subscribe
+	// handlers, which take them over
+	var monitored *wsAddresses
+	if options.wsHub != nil {
+		monitored = newWSAddresses(p, options.tenants, options.wsConfig.MaxMonitored)
+		options.wsConfig.monitored = monitored
+	}
+
+	routes := v1Routes(p, options.labels, options.tenants, monitored)
+	for _, route := range routes {
+		handle(route.pattern(), route.Scope, route.handler)
+	}
+	openAPI := makeOpenAPIHandler(routes)
+	if options.limiter != nil {
+		openAPI = options.limiter.wrap("/v1/openapi.json", openAPI)
+	}
+	register("GET /v1/openapi.json", openAPI)
+
+	// Unversioned routes are kept as deprecated aliases of /v1
+	handle("/currentBlock", auth.ScopeRead, deprecated("/v1/blocks/current", makeCurrentBlockHandler(p)))
+	handle("/subscribe", auth.ScopeSubscribe, deprecated("/v1/subscriptions", makeSubscribeHandler(p, options.labels, options.tenants, monitored)))
+	handle("/transactions", auth.ScopeRead, deprecated("/v1/addresses/{address}/transactions", visible(makeTransactionsHandler(p))))
+
+	if options.txScanner != nil {
+		handle("/transactions/export", auth.ScopeRead, visible(makeTransactionsExportHandler(options.txScanner)))
+	}
+
+	if options.hub != nil {
+		handle("/stream", auth.ScopeRead, makeStreamHandler(options.hub, options.tenants))
+	}
+
+	// WebSocket clients authenticate during the handshake or with their
+	// first message, so the endpoint checks keys itself
+	if options.wsHub != nil {
+		options.wsConfig.Keys = options.keys
+		options.wsConfig.Tenants = options.tenants
+		handler := makeWebSocketHandler(p, options.wsHub, options.wsConfig)
+		if options.limiter != nil {
+			handler = options.limiter.wrap("/ws", handler)
+		}
+		register("/ws", handler)
+	}
+
+	if options.ledger != nil {
+		handle("/balances/{address}", auth.ScopeRead, visible(makeBalanceHandler(options.ledger)))
+	}
 
 	// IGONRE: for testing purposes
-	http.HandleFunc("/subscribers", makeSubscribersList(p))
+	handle("/subscribers", auth.ScopeRead, deprecated("/v1/subscriptions", makeSubscribersList(p, options.tenants)))
+
+	if options.pruner != nil {
+		handle("/admin/retention", auth.ScopeAdmin, makeRetentionHandler(options.pruner))
+		handle("/admin/compact", auth.ScopeAdmin, makeCompactHandler(options.pruner))
+	}
+
+	if options.webhooks != nil {
+		handle("/admin/webhooks", auth.ScopeAdmin, makeWebhooksHandler(options.webhooks))
+	}
+
+	if options.email != nil {
+		handle("/admin/emails", auth.ScopeAdmin, makeEmailsHandler(options.email))
+	}
 
-	return http.ListenAndServe(address, nil)
+	if options.routes != nil {
+		handle("/admin/routes", auth.ScopeAdmin, makeRoutesHandler(options.routes))
+	}
+
+	if options.rules != nil {
+		handle("/admin/rules", auth.ScopeAdmin, makeRulesHandler(options.rules))
+		if options.rulesScanner != nil {
+			handle("/admin/rules/dry-run", auth.ScopeAdmin, makeRuleDryRunHandler(options.rules, options.rulesScanner))
+		}
+	}
+
+	if options.outbox != nil {
+		handle("/admin/deadletters", auth.ScopeAdmin, makeDeadLettersHandler(options.outbox))
+		handle("/admin/deadletters/replay", auth.ScopeAdmin, makeReplayHandler(options.outbox))
+	}
+
+	if options.keys != nil {
+		handle("/admin/keys", auth.ScopeAdmin, makeKeysHandler(options.keys))
+		handle("/admin/keys/audit", auth.ScopeAdmin, makeAuditHandler(options.keys))
+	}
+
+	if options.tenants != nil {
+		handle("/admin/tenants", auth.ScopeAdmin, makeTenantsHandler(options.tenants))
+		if options.routes != nil || options.webhooks != nil {
+			handle("/tenant/notifications", auth.ScopeSubscribe, makeTenantNotificationsHandler(options.routes, options.webhooks))
+		}
+	}
+
+	if options.limiter != nil {
+		handle("/admin/ratelimits", auth.ScopeAdmin, makeRateLimitsHandler(options.limiter))
+	}
+
+	if options.archiveStore != nil {
+		handle("/admin/export", auth.ScopeAdmin, makeExportHandler(options.archiveStore, options.archiveSections))
+		handle("/admin/import", auth.ScopeAdmin, makeImportHandler(options.archiveStore, options.archiveSections))
+	}
+	if adminDisabled {
+		log.Warn("Admin endpoints are disabled because API authentication is off")
+	}
+
+	return server
 }
 
 // makeCurrentBlockHandler creates a handler for /currentBlock endpoint
 func makeCurrentBlockHandler(p parser.Parser) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger.Info("current block request from %s", r.RemoteAddr)
+		log.DebugContext(r.Context(), "Current block request", "remote", r.RemoteAddr)
 
 		if !ValidateMethod(w, r, http.MethodGet) {
-			logger.Warn("Invalid method %s for current block from %s", r.Method, r.RemoteAddr)
+			log.WarnContext(r.Context(), "Invalid method for current block", "method", r.Method, "remote", r.RemoteAddr)
 			return
 		}
 		currentBlock := p.GetCurrentBlock()
@@ -34,21 +371,25 @@ func makeCurrentBlockHandler(p parser.Parser) http.HandlerFunc {
 	}
 }
 
-// makeSubscribeHandler adds subscriber to list of subscribers
-func makeSubscribeHandler(p parser.Parser) http.HandlerFunc {
+// makeSubscribeHandler adds subscriber to list of subscribers, storing the
+// optional label when labels are supported. With tenants the address is
+// added to the tenant of the request; the parser monitors it once however
+// many tenants watch it.
+func makeSubscribeHandler(p parser.Parser, labels storage.LabelStore, tenants storage.TenantStore, monitored *wsAddresses) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger.Info("Received subscription request from %s", r.RemoteAddr)
+		log.DebugContext(r.Context(), "Received subscription request", "remote", r.RemoteAddr)
 
 		if !ValidateMethod(w, r, http.MethodPost) {
-			logger.Warn("Invalid method %s for subscription", r.Method)
+			log.WarnContext(r.Context(), "Invalid method for subscription", "method", r.Method)
 
 			return
 		}
 
 		address := r.URL.Query().Get("address")
+		label := r.URL.Query().Get("label")
 
 		if err := ValidateAddress(address); err != nil {
-			logger.Error("Invalid address format: %s", address)
+			log.WarnContext(r.Context(), "Invalid address format", "address", address)
 
 			SendError(w, &APIError{
 				Status:  http.StatusBadRequest,
@@ -58,43 +399,91 @@ func makeSubscribeHandler(p parser.Parser) http.HandlerFunc {
 			return
 		}
 
-		if p.IsSubscribed(address) {
-			logger.Warn("Address already subscribed: %s", address)
-
-			SendError(w, ErrAlreadySubscribed)
+		if err := ValidateLabel(label); err != nil {
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: err.Message,
+				Code:    ErrCodeInvalidParameter,
+			})
 			return
 		}
 
-		if !p.Subscribe(address) {
-			logger.Error("Failed to subscribe address: %s", address)
-
-			SendError(w, ErrInvalidAddress)
+		if apiErr := subscribeAddress(p, tenants, monitored, requestTenant(r), address); apiErr != nil {
+			SendError(w, apiErr)
 			return
 		}
 
-		logger.Info("Successfully subscribed address: %s", address)
-		respondWithJSON(w, http.StatusOK, map[string]string{
+		response := map[string]string{
 			"status":  "success",
 			"address": address,
-		})
+		}
+		if labels != nil && label != "" {
+			labels.SetLabel(address, label)
+			response["label"] = label
+		}
+
+		log.InfoContext(r.Context(), "Subscribed address", "address", address, "tenant", requestTenant(r))
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// subscribeAddress subscribes a validated address, for tenant when tenants
+// are enabled. The parser monitors each address once however many tenants
+// watch it.
+func subscribeAddress(p parser.Parser, tenants storage.TenantStore, monitored *wsAddresses, tenant, address string) *APIError {
+	if tenants == nil {
+		tenant = ""
+	}
+
+	// A subscription WebSocket clients made is taken over instead of being
+	// reported as existing, so it outlives the clients
+	if monitored.disown(tenant, address) {
+		return nil
+	}
+
+	if tenant != "" {
+		if tenants.IsTenantAddress(tenant, address) {
+			log.Warn("Address already subscribed", "address", address, "tenant", tenant)
+			return ErrAlreadySubscribed
+		}
+	} else if p.IsSubscribed(address) {
+		log.Warn("Address already subscribed", "address", address)
+		return ErrAlreadySubscribed
+	}
+
+	if !p.IsSubscribed(address) && !p.Subscribe(address) {
+		log.Error("Failed to subscribe address", "address", address)
+		return ErrInvalidAddress
+	}
+	if tenant != "" {
+		tenants.AddTenantAddress(tenant, address)
+	}
+	return nil
+}
+
+// visibleSubscribers returns the subscribed addresses the request may see
+func visibleSubscribers(p parser.Parser, tenants storage.TenantStore, r *http.Request) []string {
+	if tenant := requestTenant(r); tenants != nil && tenant != "" {
+		return tenants.GetTenantAddresses(tenant)
 	}
+	return p.GetSubscribers()
 }
 
 // makeTransactionsHandler creates a handler for /transactions endpoint
 func makeTransactionsHandler(p parser.Parser) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger.Info("Handling transactions request from %s", r.RemoteAddr)
+		log.DebugContext(r.Context(), "Handling transactions request", "remote", r.RemoteAddr)
 
 		if !ValidateMethod(w, r, http.MethodGet) {
-			logger.Warn("Invalid HTTP method %s for transactions endpoint", r.Method)
+			log.WarnContext(r.Context(), "Invalid method for transactions", "method", r.Method)
 			return
 		}
 
 		address := r.URL.Query().Get("address")
-		logger.Debug("Querying transactions for address: %s", address)
+		log.DebugContext(r.Context(), "Querying transactions", "address", address)
 
 		if err := ValidateAddress(address); err != nil {
-			logger.Error("Invalid address format: %s - %s", address, err.Message)
+			log.WarnContext(r.Context(), "Invalid address format", "address", address, "error", err.Message)
 			SendError(w, &APIError{
 				Status:  http.StatusBadRequest,
 				Message: err.Message,
@@ -105,7 +494,7 @@ func makeTransactionsHandler(p parser.Parser) http.HandlerFunc {
 
 		transactions := p.GetTransactions(address)
 		if transactions == nil {
-			logger.Info("No transactions found for address: %s", address)
+			log.DebugContext(r.Context(), "No transactions found", "address", address)
 			respondWithJSON(w, http.StatusOK, map[string]interface{}{
 				"status":       "not_found",
 				"address":      address,
@@ -114,12 +503,12 @@ func makeTransactionsHandler(p parser.Parser) http.HandlerFunc {
 			return
 		}
 
-		logger.Debug("Found %d transactions for address %s", len(transactions), address)
+		log.DebugContext(r.Context(), "Found transactions", "address", address, "count", len(transactions))
 
 		// Validate each transaction
-		for i, tx := range transactions {
+		for _, tx := range transactions {
 			if err := ValidateTransactionHash(tx.Hash); err != nil {
-				logger.Error("Invalid transaction hash found in storage: %s for address %s", tx.Hash, address)
+				log.ErrorContext(r.Context(), "Invalid transaction hash in storage", "hash", tx.Hash, "address", address)
 				SendError(w, &APIError{
 					Status:  http.StatusInternalServerError,
 					Message: "Invalid transaction data in storage",
@@ -127,26 +516,26 @@ func makeTransactionsHandler(p parser.Parser) http.HandlerFunc {
 				})
 				return
 			}
-			logger.Debug("Validated transaction %d/%d: %s", i+1, len(transactions), tx.Hash)
 		}
 
-		logger.Info("Successfully returning %d transactions for address %s", len(transactions), address)
+		log.DebugContext(r.Context(), "Returning transactions", "address", address, "count", len(transactions))
 		respondWithJSON(w, http.StatusOK, transactions)
 	}
 }
 
-// makeSubscribersList creates a handler for /subscribers endpoint
-func makeSubscribersList(p parser.Parser) http.HandlerFunc {
+// makeSubscribersList creates a handler for /subscribers endpoint. With
+// tenants a request only sees the addresses of its own tenant.
+func makeSubscribersList(p parser.Parser, tenants storage.TenantStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger.Info("Handling subscribers list request from %s", r.RemoteAddr)
+		log.DebugContext(r.Context(), "Handling subscribers list request", "remote", r.RemoteAddr)
 
 		if !ValidateMethod(w, r, http.MethodGet) {
-			logger.Warn("Invalid HTTP method %s for subscribers list endpoint", r.Method)
+			log.WarnContext(r.Context(), "Invalid method for subscribers list", "method", r.Method)
 			return
 		}
 
-		subscribers := p.GetSubscribers()
-		logger.Debug("Retrieved %d subscribers", len(subscribers))
+		subscribers := visibleSubscribers(p, tenants, r)
+		log.DebugContext(r.Context(), "Retrieved subscribers", "count", len(subscribers))
 
 		response := struct {
 			Title       string   `json:"title"`
@@ -157,11 +546,9 @@ func makeSubscribersList(p parser.Parser) http.HandlerFunc {
 		}
 
 		if subscribers == nil {
-			logger.Debug("No subscribers found, returning empty list")
 			response.Subscribers = []string{}
 		}
 
-		logger.Info("Successfully returning subscribers list with %d entries", len(response.Subscribers))
 		respondWithJSON(w, http.StatusOK, response)
 	}
 }
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/stream"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscribeHandlerLabel(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handler := makeSubscribeHandler(parser.NewParser(store, nil), store, nil, nil)
+
+	testCases := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{"invalid label", "?address=" + testAddress + "&label=" + strings.Repeat("x", maxLabelLength+1), http.StatusBadRequest},
+		{"subscribe with label", "?address=" + testAddress + "&label=Treasury", http.StatusOK},
+		{"already subscribed", "?address=" + testAddress, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodPost, "/subscribe"+tc.query, nil))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if label := store.GetLabel(testAddress); label != "Treasury" {
+		t.Errorf("Expected label Treasury, got %q", label)
+	}
+}
+
+func TestServerShutdownEndsStreams(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	server := NewServer(parser.NewParser(store, nil), "127.0.0.1:0", WithStream(stream.NewHub(store, 10)))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/stream")
+	if err != nil {
+		t.Fatalf("Opening the stream failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Expected the open stream to end during shutdown, got %v", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("Expected the stream to end cleanly, got %v", err)
+	}
+}
+
+func TestAdminRequiresAuth(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	p := parser.NewParser(store, nil)
+
+	open := NewServer(p, "", WithArchive(store))
+	rec := httptest.NewRecorder()
+	open.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/export", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected admin endpoints to be unmounted without auth, got %d", rec.Code)
+	}
+
+	keys := auth.NewManager(store)
+	_, admin, _ := keys.Create("admin", "", []auth.Scope{auth.ScopeAdmin})
+	protected := NewServer(p, "", WithArchive(store), WithAuth(keys))
+	rec = httptest.NewRecorder()
+	protected.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/export", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a key, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/export", nil)
+	req.Header.Set("X-API-Key", admin)
+	rec = httptest.NewRecorder()
+	protected.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the export with an admin key, got %d", rec.Code)
+	}
+}
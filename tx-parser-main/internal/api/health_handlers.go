@@ -0,0 +1,168 @@
+package api
+
+import (
+	"blockchain-parser/internal/monitor"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// StatusReporter reports the progress of the block monitor, implemented by
+// monitor.BlockMonitor
+type StatusReporter interface {
+	Status() monitor.Status
+}
+
+// HealthConfig sets the thresholds of the readiness check
+type HealthConfig struct {
+	// MaxLag is how many blocks the monitor may trail the chain head
+	MaxLag int64
+
+	// MaxHeadAge is how long ago the chain head may have been fetched
+	// before the node is considered unreachable
+	MaxHeadAge time.Duration
+}
+
+// checkResponse is the result of one readiness check
+type checkResponse struct {
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// readinessResponse is the body of /readyz
+type readinessResponse struct {
+	Ready  bool                     `json:"ready"`
+	Checks map[string]checkResponse `json:"checks"`
+}
+
+// monitorErrorResponse is the JSON form of a monitor.MonitorError
+type monitorErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	At      string `json:"at"`
+}
+
+// statusResponse is the body of /status
+type statusResponse struct {
+	CurrentBlock    int64                 `json:"current_block"`
+	ChainHead       int64                 `json:"chain_head"`
+	Lag             int64                 `json:"lag"`
+	LastProcessedAt string                `json:"last_processed_at,omitempty"`
+	LastError       *monitorErrorResponse `json:"last_error,omitempty"`
+	RPCEndpoint     string                `json:"rpc_endpoint"`
+	Subscribers     int                   `json:"subscribers"`
+}
+
+// makeHealthHandler creates a handler for /healthz, which only reports that
+// the process is serving requests
+func makeHealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ValidateMethod(w, r, http.MethodGet) {
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// readinessChecks runs the checks of /readyz. A nil store is not checked.
+func readinessChecks(reporter StatusReporter, store storage.Pinger, cfg HealthConfig, now time.Time) map[string]checkResponse {
+	checks := make(map[string]checkResponse)
+
+	if store != nil {
+		if err := store.Ping(); err != nil {
+			checks["storage"] = checkResponse{Message: err.Error()}
+		} else {
+			checks["storage"] = checkResponse{OK: true}
+		}
+	}
+
+	status := reporter.Status()
+	var message string
+	switch {
+	case status.HeadCheckedAt.IsZero():
+		message = "chain head not fetched yet"
+	case cfg.MaxHeadAge > 0 && now.Sub(status.HeadCheckedAt) > cfg.MaxHeadAge:
+		message = fmt.Sprintf("chain head last fetched %s ago", now.Sub(status.HeadCheckedAt).Round(time.Second))
+	}
+	if message == "" {
+		checks["rpc"] = checkResponse{OK: true}
+	} else {
+		if status.LastError != nil {
+			message += ": " + status.LastError.Error()
+		}
+		checks["rpc"] = checkResponse{Message: message}
+	}
+
+	switch lag := status.Lag(); {
+	case status.HeadCheckedAt.IsZero():
+		checks["lag"] = checkResponse{Message: "chain head unknown"}
+	case lag > cfg.MaxLag:
+		checks["lag"] = checkResponse{Message: fmt.Sprintf("%d blocks behind the chain head, at most %d allowed", lag, cfg.MaxLag)}
+	default:
+		checks["lag"] = checkResponse{OK: true}
+	}
+	return checks
+}
+
+// makeReadinessHandler creates a handler for /readyz. It answers 503 while
+// the storage or the node is unreachable or the monitor lags too far behind.
+func makeReadinessHandler(reporter StatusReporter, store storage.Pinger, cfg HealthConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ValidateMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		response := readinessResponse{Ready: true, Checks: readinessChecks(reporter, store, cfg, time.Now())}
+		for name, check := range response.Checks {
+			if !check.OK {
+				response.Ready = false
+				log.WarnContext(r.Context(), "Readiness check failed", "check", name, "message", check.Message)
+			}
+		}
+
+		status := http.StatusOK
+		if !response.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		respondWithJSON(w, status, response)
+	}
+}
+
+// makeStatusHandler creates a handler for /status reporting the progress of
+// the monitor. Tenant keys see the number of their own subscriptions.
+func makeStatusHandler(p parser.Parser, reporter StatusReporter, tenants storage.TenantStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling status request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			log.WarnContext(r.Context(), "Invalid method for status", "method", r.Method)
+			return
+		}
+
+		status := reporter.Status()
+		response := statusResponse{
+			CurrentBlock: status.CurrentBlock,
+			ChainHead:    status.ChainHead,
+			Lag:          status.Lag(),
+			RPCEndpoint:  status.RPCEndpoint,
+			Subscribers:  len(visibleSubscribers(p, tenants, r)),
+		}
+		if !status.LastProcessedAt.IsZero() {
+			response.LastProcessedAt = status.LastProcessedAt.UTC().Format(time.RFC3339)
+		}
+		if status.LastError != nil {
+			message := status.LastError.Message
+			if status.LastError.Err != nil {
+				message += ": " + status.LastError.Err.Error()
+			}
+			response.LastError = &monitorErrorResponse{
+				Code:    status.LastError.Code,
+				Message: message,
+				At:      status.LastErrorAt.UTC().Format(time.RFC3339),
+			}
+		}
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
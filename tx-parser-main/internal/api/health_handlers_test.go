@@ -0,0 +1,113 @@
+package api
+
+import (
+	"blockchain-parser/internal/monitor"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fixedStatus reports a fixed monitor status
+type fixedStatus monitor.Status
+
+func (s fixedStatus) Status() monitor.Status {
+	return monitor.Status(s)
+}
+
+// failingStore is a storage that cannot be reached
+type failingStore struct{}
+
+func (failingStore) Ping() error {
+	return errors.New("connection refused")
+}
+
+func TestHealthHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	makeHealthHandler()(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cfg := HealthConfig{MaxLag: 5, MaxHeadAge: time.Minute}
+	healthy := monitor.Status{CurrentBlock: 100, ChainHead: 103, HeadCheckedAt: now.Add(-10 * time.Second)}
+
+	testCases := []struct {
+		name       string
+		status     monitor.Status
+		store      storage.Pinger
+		wantFailed []string
+	}{
+		{"healthy", healthy, storage.NewMemoryStorage(), nil},
+		{"storage unreachable", healthy, failingStore{}, []string{"storage"}},
+		{"head never fetched", monitor.Status{}, nil, []string{"rpc", "lag"}},
+		{"head stale", monitor.Status{CurrentBlock: 100, ChainHead: 100, HeadCheckedAt: now.Add(-2 * time.Minute)}, nil, []string{"rpc"}},
+		{"lagging", monitor.Status{CurrentBlock: 90, ChainHead: 100, HeadCheckedAt: now}, nil, []string{"lag"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checks := readinessChecks(fixedStatus(tc.status), tc.store, cfg, now)
+			var failed []string
+			for _, name := range []string{"storage", "rpc", "lag"} {
+				if check, ok := checks[name]; ok && !check.OK {
+					failed = append(failed, name)
+				}
+			}
+			if len(failed) != len(tc.wantFailed) {
+				t.Fatalf("Expected failed checks %v, got %v (%+v)", tc.wantFailed, failed, checks)
+			}
+			for i := range failed {
+				if failed[i] != tc.wantFailed[i] {
+					t.Errorf("Expected failed checks %v, got %v", tc.wantFailed, failed)
+				}
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	makeReadinessHandler(fixedStatus{}, nil, cfg)(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var response readinessResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+	if rec.Code != http.StatusServiceUnavailable || response.Ready {
+		t.Errorf("Expected an unready monitor to answer 503, got %d %+v", rec.Code, response)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	p := parser.NewParser(store, nil)
+	p.Subscribe(testAddress)
+	processed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	reporter := fixedStatus{
+		CurrentBlock:    100,
+		ChainHead:       104,
+		LastProcessedAt: processed,
+		LastError:       monitor.NewMonitorError(monitor.ErrBlockFetch, "Failed to fetch block 101", errors.New("timeout")),
+		LastErrorAt:     processed.Add(time.Second),
+		RPCEndpoint:     "https://node.example.com",
+	}
+
+	rec := httptest.NewRecorder()
+	makeStatusHandler(p, reporter, nil)(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var response statusResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	if response.Lag != 4 || response.Subscribers != 1 || response.RPCEndpoint != "https://node.example.com" {
+		t.Errorf("Unexpected status %+v", response)
+	}
+	if response.LastProcessedAt != "2024-05-01T12:00:00Z" {
+		t.Errorf("Unexpected last processed time %q", response.LastProcessedAt)
+	}
+	if response.LastError == nil || response.LastError.Code != monitor.ErrBlockFetch || response.LastError.Message != "Failed to fetch block 101: timeout" {
+		t.Errorf("Unexpected last error %+v", response.LastError)
+	}
+}
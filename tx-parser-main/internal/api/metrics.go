@@ -0,0 +1,67 @@
+package api
+
+import (
+	"blockchain-parser/internal/metrics"
+	"blockchain-parser/internal/tracing"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP metrics, exposed on /metrics
+var (
+	httpDuration  = metrics.Default.NewHistogram("parser_http_request_duration_seconds", "HTTP request latency by route, method and status", metrics.DefaultBuckets, "route", "method", "status")
+	httpThrottled = metrics.Default.NewCounter("parser_http_throttled_total", "Requests rejected by the rate limit or the daily quota", "route", "reason")
+)
+
+// routeLabel returns the path of a ServeMux pattern, so the label stays the
+// same whatever address a request names
+func routeLabel(pattern string) string {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
+
+// instrument records the latency and status of every request to pattern,
+// including requests rejected by authentication or rate limiting. Traced
+// requests continue the trace of their traceparent header and return their
+// trace ID in X-Trace-Id. Each request is logged once it is served.
+func instrument(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	route := routeLabel(pattern)
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), r.Method+" "+route,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("http.route", route))
+		span.SetKind(tracing.KindServer)
+		if span != nil {
+			w.Header().Set("X-Trace-Id", span.TraceID().String())
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r.WithContext(ctx))
+		httpDuration.ObserveSince(start, route, r.Method, strconv.Itoa(recorder.status))
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		log.Log(ctx, level, "Request served",
+			"method", r.Method,
+			"route", route,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr)
+
+		span.SetAttributes(tracing.Int64("http.response.status_code", int64(recorder.status)))
+		if recorder.status >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("status %d", recorder.status))
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"blockchain-parser/internal/metrics"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/tracing"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	p := parser.NewParser(storage.NewMemoryStorage(), nil)
+	limiter := NewRateLimiter(RateLimitConfig{Routes: map[string]RateLimit{"/currentBlock": {Requests: 1, Per: time.Hour}}})
+	server := NewServer(p, "", WithMetrics(metrics.Default), WithRateLimit(limiter))
+	throttled := httpThrottled.Value("/currentBlock", "rate_limit")
+
+	for _, path := range []string{"/v1/subscriptions/0x123", "/currentBlock", "/currentBlock"} {
+		server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if httpThrottled.Value("/currentBlock", "rate_limit") != throttled+1 {
+		t.Error("Expected the throttled request to be counted")
+	}
+
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`parser_http_request_duration_seconds_count{route="/v1/subscriptions/{address}",method="GET",status="400"}`,
+		`parser_http_request_duration_seconds_count{route="/currentBlock",method="GET",status="429"}`,
+		`# TYPE parser_rpc_request_duration_seconds histogram`,
+		`# TYPE parser_storage_operation_duration_seconds histogram`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in the exposition", want)
+		}
+	}
+}
+
+func TestRequestTracing(t *testing.T) {
+	var out bytes.Buffer
+	provider := tracing.NewProvider(tracing.NewWriterExporter(&out), tracing.ProviderConfig{})
+	tracing.SetProvider(provider)
+	defer tracing.SetProvider(nil)
+
+	server := NewServer(parser.NewParser(storage.NewMemoryStorage(), nil), "")
+	req := httptest.NewRequest(http.MethodGet, "/currentBlock", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	server.Handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Trace-Id"); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected the incoming trace ID in X-Trace-Id, got %q", got)
+	}
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	for _, want := range []string{`"parent_span_id":"00f067aa0ba902b7"`, `"name":"GET /currentBlock"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %s in the exported span %s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// openAPIVersion is the version of the /v1 API in its OpenAPI document
+const openAPIVersion = "1.0.0"
+
+// pathParameter matches the wildcards of a ServeMux pattern
+var pathParameter = regexp.MustCompile(`\{(\w+)\}`)
+
+// schemaOf returns the JSON schema of a Go value as encoded by encoding/json.
+// Fields tagged omitempty are optional; every other field is required.
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaOf(field.Type)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	}
+	return map[string]interface{}{}
+}
+
+// envelopeSchema wraps a data schema in the /v1 envelope
+func envelopeSchema(data interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"data": schemaOf(reflect.TypeOf(data))},
+		"required":   []string{"data"},
+	}
+}
+
+// errorResponse references the error envelope
+func errorResponse(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+			},
+		},
+	}
+}
+
+// openAPIDocument generates the OpenAPI 3 document of the /v1 routes
+func openAPIDocument(routes []v1Route) map[string]interface{} {
+	paths := make(map[string]interface{})
+	for _, route := range routes {
+		operation := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": strings.ToLower(route.Method) + strings.ReplaceAll(pathParameter.ReplaceAllString(route.Path, "by_$1"), "/", "_"),
+			"x-scope":     string(route.Scope),
+		}
+
+		var parameters []interface{}
+		for _, match := range pathParameter.FindAllStringSubmatch(route.Path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if route.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+
+		responses := map[string]interface{}{
+			strconv.Itoa(route.Status): map[string]interface{}{
+				"description": http.StatusText(route.Status),
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": envelopeSchema(route.Response)},
+				},
+			},
+			"401": errorResponse("Missing or invalid API key, when authentication is enabled"),
+			"403": errorResponse("API key lacks the " + string(route.Scope) + " scope"),
+			"429": errorResponse("Rate limit or daily quota exceeded"),
+		}
+		for _, status := range route.Errors {
+			responses[strconv.Itoa(status)] = errorResponse(http.StatusText(status))
+		}
+		operation["responses"] = responses
+
+		item, ok := paths[route.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Blockchain Parser API",
+			"version": openAPIVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Error": schemaOf(reflect.TypeOf(v1ErrorEnvelope{})),
+			},
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"apiKey": []string{}}},
+	}
+}
+
+// makeOpenAPIHandler creates a handler for /v1/openapi.json serving the
+// document generated from routes
+func makeOpenAPIHandler(routes []v1Route) http.HandlerFunc {
+	document := openAPIDocument(routes)
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling OpenAPI request", "remote", r.RemoteAddr)
+		respondWithJSON(w, http.StatusOK, document)
+	}
+}
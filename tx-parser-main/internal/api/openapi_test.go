@@ -0,0 +1,218 @@
+package api
+
+import (
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkSchema reports where value does not match an OpenAPI schema
+func checkSchema(document, schema map[string]interface{}, value interface{}, path string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+		return checkSchema(document, schemas[name].(map[string]interface{}), value, path)
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{path + ": expected an object"}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required %s", path, name))
+			}
+		}
+		for name, field := range object {
+			property, ok := properties[name].(map[string]interface{})
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: undocumented field %s", path, name))
+				continue
+			}
+			problems = append(problems, checkSchema(document, property, field, path+"."+name)...)
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{path + ": expected an array"}
+		}
+		for i, item := range items {
+			problems = append(problems, checkSchema(document, schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, path+": expected a string")
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			problems = append(problems, path+": expected an integer")
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, path+": expected a number")
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, path+": expected a boolean")
+		}
+	}
+	return problems
+}
+
+func TestOpenAPIMatchesHandlers(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.StoreTransaction(storage.Transaction{
+		Hash:        "0xaaa",
+		FromAddress: testAddress,
+		ToAddress:   otherAddress,
+		Value:       1,
+		ValueWei:    "1000000000000000000",
+		BlockNumber: 7,
+	})
+	p := parser.NewParser(store, nil)
+	routes := v1Routes(p, store, nil, nil)
+
+	mux := http.NewServeMux()
+	for _, route := range routes {
+		mux.HandleFunc(route.pattern(), route.handler)
+	}
+	mux.HandleFunc("GET /v1/openapi.json", makeOpenAPIHandler(routes))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v1/openapi.json")
+	if err != nil {
+		t.Fatalf("Fetching the document failed: %v", err)
+	}
+	var document map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		t.Fatalf("Invalid document: %v", err)
+	}
+	resp.Body.Close()
+	if document["openapi"] != "3.0.3" {
+		t.Errorf("Unexpected OpenAPI version %v", document["openapi"])
+	}
+
+	// Requests exercising each documented response; the path parameter is
+	// filled in with the address
+	bodies := map[string]string{
+		"POST /v1/subscriptions": `{"address":"` + testAddress + `","label":"Treasury"}`,
+	}
+	calls := []struct {
+		method, path, address, body string
+	}{
+		{"GET", "/v1/blocks/current", "", ""},
+		{"GET", "/v1/subscriptions/{address}", testAddress, ""},
+		{"POST", "/v1/subscriptions", "", bodies["POST /v1/subscriptions"]},
+		{"POST", "/v1/subscriptions", "", bodies["POST /v1/subscriptions"]},
+		{"POST", "/v1/subscriptions", "", `{"address":"0x123"}`},
+		{"GET", "/v1/subscriptions", "", ""},
+		{"GET", "/v1/subscriptions/{address}", testAddress, ""},
+		{"GET", "/v1/subscriptions/{address}", "0x123", ""},
+		{"GET", "/v1/addresses/{address}/transactions", testAddress, ""},
+		{"GET", "/v1/addresses/{address}/transactions", otherAddress, ""},
+	}
+
+	paths := document["paths"].(map[string]interface{})
+	exercised := make(map[string]bool)
+	for _, call := range calls {
+		item, ok := paths[call.path].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Path %s is not documented", call.path)
+		}
+		operation, ok := item[strings.ToLower(call.method)].(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s %s is not documented", call.method, call.path)
+		}
+
+		req, _ := http.NewRequest(call.method, server.URL+strings.Replace(call.path, "{address}", call.address, 1), strings.NewReader(call.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", call.method, call.path, err)
+		}
+		var body interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+
+		response, ok := operation["responses"].(map[string]interface{})[strconv.Itoa(resp.StatusCode)].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s %s returned undocumented status %d", call.method, call.path, resp.StatusCode)
+			continue
+		}
+		schema := response["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+		for _, problem := range checkSchema(document, schema, body, "body") {
+			t.Errorf("%s %s %d: %s", call.method, call.path, resp.StatusCode, problem)
+		}
+		exercised[call.method+" "+call.path] = true
+	}
+
+	for _, route := range routes {
+		if !exercised[route.pattern()] {
+			t.Errorf("%s is not covered by the test", route.pattern())
+		}
+	}
+	count := 0
+	for _, item := range paths {
+		count += len(item.(map[string]interface{}))
+	}
+	if count != len(routes) {
+		t.Errorf("Expected %d documented operations, got %d", len(routes), count)
+	}
+}
+
+func TestV1Subscriptions(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	p := parser.NewParser(store, nil)
+	handler := makeV1SubscribeHandler(p, store, nil, nil)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/v1/subscriptions", strings.NewReader(`{"address":"`+testAddress+`","label":"Treasury"}`)))
+	if rec.Code != http.StatusCreated || rec.Header().Get("Location") != "/v1/subscriptions/"+testAddress {
+		t.Fatalf("Expected 201 with a Location, got %d %v", rec.Code, rec.Header())
+	}
+	var created struct {
+		Data v1Subscription `json:"data"`
+	}
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.Data.Address != testAddress || created.Data.Label != "Treasury" {
+		t.Errorf("Unexpected subscription %+v", created.Data)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/v1/subscriptions", strings.NewReader(`{"address":"`+testAddress+`"}`)))
+	var failed v1ErrorEnvelope
+	json.NewDecoder(rec.Body).Decode(&failed)
+	if rec.Code != http.StatusConflict || failed.Error.Code != ErrCodeAlreadySubscribed {
+		t.Errorf("Expected a conflict, got %d %+v", rec.Code, failed)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/v1/subscriptions", strings.NewReader(`{"addr":"x"}`)))
+	json.NewDecoder(rec.Body).Decode(&failed)
+	if rec.Code != http.StatusBadRequest || failed.Error.Code != ErrCodeJSONParseError {
+		t.Errorf("Expected unknown fields to be rejected, got %d %+v", rec.Code, failed)
+	}
+}
+
+func TestDeprecatedAlias(t *testing.T) {
+	handler := deprecated("/v1/blocks/current", makeCurrentBlockHandler(parser.NewParser(storage.NewMemoryStorage(), nil)))
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/currentBlock", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Deprecation") != "true" {
+		t.Errorf("Expected the alias to work and be marked deprecated, got %d %v", rec.Code, rec.Header())
+	}
+	if link := rec.Header().Get("Link"); link != `</v1/blocks/current>; rel="successor-version"` {
+		t.Errorf("Unexpected Link header %q", link)
+	}
+}
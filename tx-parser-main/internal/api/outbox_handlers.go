@@ -0,0 +1,97 @@
+package api
+
+import (
+	"blockchain-parser/internal/notification"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// deadLetterResponse is the JSON form of a dead-lettered outbox message
+type deadLetterResponse struct {
+	ID           int64           `json:"id"`
+	Channel      string          `json:"channel,omitempty"`
+	Attempts     int             `json:"attempts"`
+	LastError    string          `json:"last_error"`
+	CreatedAt    string          `json:"created_at"`
+	Notification json.RawMessage `json:"notification"`
+}
+
+// makeDeadLettersHandler creates a handler for GET /admin/deadletters
+func makeDeadLettersHandler(outbox *notification.Outbox) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling dead letters request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			log.WarnContext(r.Context(), "Invalid method for dead letters endpoint", "method", r.Method)
+			return
+		}
+
+		messages := outbox.DeadLetters()
+		deadLetters := make([]deadLetterResponse, 0, len(messages))
+		for _, message := range messages {
+			deadLetters = append(deadLetters, deadLetterResponse{
+				ID:           message.ID,
+				Channel:      message.Channel,
+				Attempts:     message.Attempts,
+				LastError:    message.LastError,
+				CreatedAt:    message.CreatedAt.UTC().Format(time.RFC3339),
+				Notification: json.RawMessage(message.Payload),
+			})
+		}
+
+		stats := outbox.Stats()
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"pending":      stats.Pending,
+			"dead_letters": deadLetters,
+		})
+	}
+}
+
+// makeReplayHandler creates a handler for POST /admin/deadletters/replay.
+// It replays the message given by id, or every dead letter when id is omitted.
+func makeReplayHandler(outbox *notification.Outbox) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling dead letter replay request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodPost) {
+			log.WarnContext(r.Context(), "Invalid method for replay endpoint", "method", r.Method)
+			return
+		}
+
+		value := r.URL.Query().Get("id")
+		if value == "" {
+			replayed := outbox.ReplayAll()
+			log.InfoContext(r.Context(), "Replayed dead letters", "count", replayed)
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"status":   "success",
+				"replayed": replayed,
+			})
+			return
+		}
+
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid 'id' parameter",
+				Code:    ErrCodeInvalidParameter,
+			})
+			return
+		}
+
+		if !outbox.Replay(id) {
+			SendError(w, &APIError{
+				Status:  http.StatusNotFound,
+				Message: "Dead letter not found",
+				Code:    ErrCodeNotFound,
+			})
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"status":   "success",
+			"replayed": 1,
+		})
+	}
+}
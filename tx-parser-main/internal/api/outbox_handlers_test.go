@@ -0,0 +1,57 @@
+package api
+
+import (
+	"blockchain-parser/internal/notification"
+	"blockchain-parser/internal/storage"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type failingNotifier struct{}
+
+func (failingNotifier) Notify(notification.Notification) error { return errors.New("unavailable") }
+
+func TestDeadLetterHandlers(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	outbox := notification.NewOutbox(store, failingNotifier{}, notification.OutboxConfig{MaxAttempts: 1})
+	outbox.Notify(notification.Notification{Type: notification.TransactionReceived, Address: testAddress})
+	outbox.ProcessBatch()
+
+	list := makeDeadLettersHandler(outbox)
+	rec := httptest.NewRecorder()
+	list(rec, httptest.NewRequest(http.MethodGet, "/admin/deadletters", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "unavailable") {
+		t.Fatalf("Expected dead letter in listing, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	replay := makeReplayHandler(outbox)
+	testCases := []struct {
+		name       string
+		method     string
+		query      string
+		wantStatus int
+	}{
+		{"invalid method", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid id", http.MethodPost, "?id=abc", http.StatusBadRequest},
+		{"unknown id", http.MethodPost, "?id=42", http.StatusNotFound},
+		{"replay by id", http.MethodPost, "?id=1", http.StatusOK},
+		{"replay all", http.MethodPost, "", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			replay(rec, httptest.NewRequest(tc.method, "/admin/deadletters/replay"+tc.query, nil))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if stats := outbox.Stats(); stats.Pending != 1 || stats.DeadLetters != 0 {
+		t.Errorf("Expected replayed message back in the outbox, got %+v", stats)
+	}
+}
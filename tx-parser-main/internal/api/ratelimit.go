@@ -0,0 +1,438 @@
+package api
+
+import (
+	"blockchain-parser/config"
+	"blockchain-parser/internal/auth"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often idle clients are forgotten
+const rateLimitSweepInterval = 10 * time.Minute
+
+// RateLimit allows Requests per Per to each client, with bursts of up to
+// Requests. The zero value is unlimited.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseRateLimit parses a limit such as "60/m", "5/s" or "1000/h". An
+// empty value or "0" is unlimited.
+func ParseRateLimit(value string) (RateLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return RateLimit{}, nil
+	}
+	count, unit, ok := strings.Cut(value, "/")
+	requests, err := strconv.Atoi(count)
+	if !ok || err != nil || requests <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: use <requests>/<s|m|h>", value)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}[unit]
+	if per == 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit unit %q: use s, m or h", unit)
+	}
+	return RateLimit{Requests: requests, Per: per}, nil
+}
+
+// String formats the limit as accepted by ParseRateLimit
+func (l RateLimit) String() string {
+	if l.unlimited() {
+		return "0"
+	}
+	unit := map[time.Duration]string{time.Second: "s", time.Minute: "m", time.Hour: "h"}[l.Per]
+	return fmt.Sprintf("%d/%s", l.Requests, unit)
+}
+
+func (l RateLimit) unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// ParseRouteLimits parses per-route limits such as
+// "/subscribe=10/m,/transactions/export=5/m"
+func ParseRouteLimits(value string) (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit)
+	for _, item := range config.SplitList(value) {
+		route, limit, ok := strings.Cut(item, "=")
+		if !ok || !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("invalid route limit %q: use /route=<requests>/<unit>", item)
+		}
+		parsed, err := ParseRateLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.TrimSpace(route)] = parsed
+	}
+	return limits, nil
+}
+
+// RateLimitConfig configures request throttling per client, identified by
+// its API key or, without one, by its IP address
+type RateLimitConfig struct {
+	// Default applies to routes without their own limit
+	Default RateLimit
+
+	// Routes overrides the limit of routes such as "/subscribe" or
+	// "/balances"; unlimited entries exempt a route
+	Routes map[string]RateLimit
+
+	// DailyQuota caps the requests of a client per UTC day; 0 disables it
+	DailyQuota int
+
+	// PerIP limits each IP address across all routes before authentication,
+	// so requests without a valid API key are throttled too. When unlimited,
+	// the route limits also apply per IP. Exempt routes stay exempt.
+	PerIP RateLimit
+}
+
+// RateLimitStats is a snapshot of the throttling metrics
+type RateLimitStats struct {
+	// Throttled counts requests rejected by a route limit, per route
+	Throttled map[string]int64 `json:"throttled"`
+	// QuotaExceeded counts requests rejected by the daily quota, per route
+	QuotaExceeded map[string]int64 `json:"quota_exceeded"`
+	// Clients is the number of clients currently tracked
+	Clients int `json:"clients"`
+}
+
+// bucket is the token bucket of one client on one route
+type bucket struct {
+	tokens float64
+	last   time.Time
+	per    time.Duration
+}
+
+// quota counts the requests of one client on one day
+type quota struct {
+	day   string
+	count int
+}
+
+// RateLimiter throttles requests with a token bucket per client and route
+// and an optional daily quota per client
+type RateLimiter struct {
+	config RateLimitConfig
+	now    func() time.Time
+
+	mu            sync.Mutex
+	buckets       map[string]*bucket
+	quotas        map[string]*quota
+	throttled     map[string]int64
+	quotaExceeded map[string]int64
+	lastSweep     time.Time
+}
+
+// NewRateLimiter creates a rate limiter enforcing cfg
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		config:        cfg,
+		now:           time.Now,
+		buckets:       make(map[string]*bucket),
+		quotas:        make(map[string]*quota),
+		throttled:     make(map[string]int64),
+		quotaExceeded: make(map[string]int64),
+	}
+}
+
+// Config returns the enforced configuration
+func (l *RateLimiter) Config() RateLimitConfig {
+	return l.config
+}
+
+// Stats returns a snapshot of the throttling metrics
+func (l *RateLimiter) Stats() RateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := RateLimitStats{
+		Throttled:     make(map[string]int64, len(l.throttled)),
+		QuotaExceeded: make(map[string]int64, len(l.quotaExceeded)),
+	}
+	for route, count := range l.throttled {
+		stats.Throttled[route] = count
+	}
+	for route, count := range l.quotaExceeded {
+		stats.QuotaExceeded[route] = count
+	}
+	clients := make(map[string]bool)
+	for key := range l.buckets {
+		clients[strings.SplitN(key, " ", 2)[0]] = true
+	}
+	for client := range l.quotas {
+		clients[client] = true
+	}
+	stats.Clients = len(clients)
+	return stats
+}
+
+// limitFor returns the limit of a route pattern. Patterns with wildcards
+// such as "/balances/{address}" also match their prefix "/balances", and
+// patterns with a method such as "POST /v1/subscriptions" match their path.
+func (l *RateLimiter) limitFor(route string) RateLimit {
+	if _, path, ok := strings.Cut(route, " "); ok {
+		route = path
+	}
+	if limit, ok := l.config.Routes[route]; ok {
+		return limit
+	}
+	if prefix, _, ok := strings.Cut(route, "/{"); ok {
+		if limit, ok := l.config.Routes[prefix]; ok {
+			return limit
+		}
+	}
+	return l.config.Default
+}
+
+// exempt reports whether a route pattern is exempted by an unlimited
+// route entry
+func (l *RateLimiter) exempt(route string) bool {
+	if _, path, ok := strings.Cut(route, " "); ok {
+		route = path
+	}
+	limit, ok := l.config.Routes[route]
+	if !ok {
+		if prefix, _, cut := strings.Cut(route, "/{"); cut {
+			limit, ok = l.config.Routes[prefix]
+		}
+	}
+	return ok && limit.unlimited()
+}
+
+// decision is the outcome of checking one request
+type decision struct {
+	allowed    bool
+	quota      bool
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// allow checks and records one request of client on route
+func (l *RateLimiter) allow(client, route string) decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	// The daily quota is checked first so rejected requests do not
+	// consume the route budget
+	var used *quota
+	if l.config.DailyQuota > 0 {
+		day := now.UTC().Format("2006-01-02")
+		used = l.quotas[client]
+		if used == nil || used.day != day {
+			used = &quota{day: day}
+			l.quotas[client] = used
+		}
+		if used.count >= l.config.DailyQuota {
+			midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			l.quotaExceeded[route]++
+			return decision{
+				quota:      true,
+				limit:      l.config.DailyQuota,
+				reset:      midnight.Sub(now),
+				retryAfter: midnight.Sub(now),
+			}
+		}
+	}
+
+	result := decision{allowed: true}
+	if limit := l.limitFor(route); !limit.unlimited() {
+		result = l.take(client+" "+route, limit, now)
+		if !result.allowed {
+			l.throttled[route]++
+			return result
+		}
+	}
+
+	if used != nil {
+		used.count++
+		if result.limit == 0 {
+			result.limit = l.config.DailyQuota
+			result.remaining = l.config.DailyQuota - used.count
+			result.reset = now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+		}
+	}
+	return result
+}
+
+// allowAddress checks and records one request of the IP client on route,
+// before the request is authenticated
+func (l *RateLimiter) allowAddress(client, route string) decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	key := client + " " + route
+	limit := l.limitFor(route)
+	if !l.config.PerIP.unlimited() && !l.exempt(route) {
+		key = client + " *"
+		limit = l.config.PerIP
+	}
+	if limit.unlimited() {
+		return decision{allowed: true}
+	}
+	result := l.take(key, limit, now)
+	if !result.allowed {
+		l.throttled[route]++
+	}
+	return result
+}
+
+// take takes a token from the bucket key refilling at limit. Callers must
+// hold the lock.
+func (l *RateLimiter) take(key string, limit RateLimit, now time.Time) decision {
+	rate := float64(limit.Requests) / limit.Per.Seconds()
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(limit.Requests), last: now, per: limit.Per}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Requests), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	reset := time.Duration((float64(limit.Requests) - b.tokens) / rate * float64(time.Second))
+	if b.tokens < 1 {
+		return decision{
+			limit:      limit.Requests,
+			reset:      reset,
+			retryAfter: time.Duration((1 - b.tokens) / rate * float64(time.Second)),
+		}
+	}
+	b.tokens--
+	return decision{
+		allowed:   true,
+		limit:     limit.Requests,
+		remaining: int(b.tokens),
+		reset:     time.Duration((float64(limit.Requests) - b.tokens) / rate * float64(time.Second)),
+	}
+}
+
+// sweep forgets full buckets and quotas of past days. Callers must hold the lock.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= b.per {
+			delete(l.buckets, key)
+		}
+	}
+	day := now.UTC().Format("2006-01-02")
+	for client, used := range l.quotas {
+		if used.day != day {
+			delete(l.quotas, client)
+		}
+	}
+}
+
+// requestClient identifies the client of a request by its API key, or by
+// its IP address without one
+func requestClient(r *http.Request) string {
+	if key, ok := auth.KeyFrom(r.Context()); ok {
+		return "key:" + key.ID
+	}
+	return addressClient(r)
+}
+
+// addressClient identifies the client of a request by its IP address
+func addressClient(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ceilSeconds rounds a duration up to whole seconds for headers
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// wrap throttles a handler registered under route, setting the RateLimit-*
+// headers on every limited response and Retry-After on rejections
+func (l *RateLimiter) wrap(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := requestClient(r)
+		result := l.allow(client, route)
+		if result.limit > 0 {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(result.reset))
+		}
+		if result.allowed {
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", ceilSeconds(result.retryAfter))
+		if result.quota {
+			httpThrottled.Inc(routeLabel(route), "daily_quota")
+			log.WarnContext(r.Context(), "Client exceeded its daily quota", "client", client, "route", route)
+			sendRequestError(w, r, ErrQuotaExceeded)
+			return
+		}
+		httpThrottled.Inc(routeLabel(route), "rate_limit")
+		log.WarnContext(r.Context(), "Throttled client", "client", client, "route", route)
+		sendRequestError(w, r, ErrRateLimited)
+	}
+}
+
+// wrapAddress throttles a handler registered under route per IP address.
+// It runs in front of authentication; the per-key limits and their headers
+// apply after it.
+func (l *RateLimiter) wrapAddress(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := addressClient(r)
+		result := l.allowAddress(client, route)
+		if result.allowed {
+			next(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.limit))
+		w.Header().Set("RateLimit-Remaining", "0")
+		w.Header().Set("RateLimit-Reset", ceilSeconds(result.reset))
+		w.Header().Set("Retry-After", ceilSeconds(result.retryAfter))
+		httpThrottled.Inc(routeLabel(route), "ip_limit")
+		log.WarnContext(r.Context(), "Throttled client before authentication", "client", client, "route", route)
+		sendRequestError(w, r, ErrRateLimited)
+	}
+}
+
+// makeRateLimitsHandler creates a handler for /admin/ratelimits which shows
+// the configured limits and the throttling metrics
+func makeRateLimitsHandler(limiter *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling rate limits request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		cfg := limiter.Config()
+		routes := make(map[string]string, len(cfg.Routes))
+		for route, limit := range cfg.Routes {
+			routes[route] = limit.String()
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"default":     cfg.Default.String(),
+			"routes":      routes,
+			"daily_quota": cfg.DailyQuota,
+			"per_ip":      cfg.PerIP.String(),
+			"stats":       limiter.Stats(),
+		})
+	}
+}
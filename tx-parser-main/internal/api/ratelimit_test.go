@@ -0,0 +1,159 @@
+package api
+
+import (
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	testCases := []struct {
+		value   string
+		want    RateLimit
+		wantErr bool
+	}{
+		{"", RateLimit{}, false},
+		{"0", RateLimit{}, false},
+		{"60/m", RateLimit{Requests: 60, Per: time.Minute}, false},
+		{"5/s", RateLimit{Requests: 5, Per: time.Second}, false},
+		{"1000/h", RateLimit{Requests: 1000, Per: time.Hour}, false},
+		{"60", RateLimit{}, true},
+		{"-1/m", RateLimit{}, true},
+		{"10/d", RateLimit{}, true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseRateLimit(tc.value)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("ParseRateLimit(%q) = %+v, %v", tc.value, got, err)
+		}
+	}
+
+	routes, err := ParseRouteLimits("/subscribe=10/m, /stream=0")
+	if err != nil || routes["/subscribe"].Requests != 10 || !routes["/stream"].unlimited() {
+		t.Errorf("Unexpected route limits %+v, %v", routes, err)
+	}
+	if _, err := ParseRouteLimits("subscribe=10/m"); err == nil {
+		t.Error("Expected an error for a route without a leading slash")
+	}
+}
+
+// limitedRequest sends a request from remoteAddr through handler
+func limitedRequest(handler http.HandlerFunc, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/currentBlock", nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(RateLimitConfig{
+		Default: RateLimit{Requests: 2, Per: time.Minute},
+		Routes:  map[string]RateLimit{"/balances": {Requests: 1, Per: time.Minute}},
+	})
+	limiter.now = func() time.Time { return now }
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	handler := limiter.wrap("/currentBlock", ok)
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		rec := limitedRequest(handler, "10.0.0.1:5000")
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != wantRemaining {
+			t.Fatalf("Request %d: status %d, remaining %q", i+1, rec.Code, rec.Header().Get("RateLimit-Remaining"))
+		}
+	}
+
+	rec := limitedRequest(handler, "10.0.0.1:5001")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "30" || rec.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("Unexpected headers %v", rec.Header())
+	}
+
+	if rec := limitedRequest(handler, "10.0.0.2:5000"); rec.Code != http.StatusOK {
+		t.Errorf("Expected other clients to be unaffected, got %d", rec.Code)
+	}
+
+	now = now.Add(30 * time.Second)
+	if rec := limitedRequest(handler, "10.0.0.1:5000"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the bucket to refill, got %d", rec.Code)
+	}
+
+	balances := limiter.wrap("/balances/{address}", ok)
+	limitedRequest(balances, "10.0.0.1:5000")
+	if rec := limitedRequest(balances, "10.0.0.1:5000"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the route limit to apply to the pattern, got %d", rec.Code)
+	}
+
+	stats := limiter.Stats()
+	if stats.Throttled["/currentBlock"] != 1 || stats.Throttled["/balances/{address}"] != 1 || stats.Clients != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestDailyQuota(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(RateLimitConfig{DailyQuota: 2})
+	limiter.now = func() time.Time { return now }
+	handler := limiter.wrap("/currentBlock", func(w http.ResponseWriter, r *http.Request) {})
+
+	limitedRequest(handler, "10.0.0.1:5000")
+	if rec := limitedRequest(handler, "10.0.0.1:5000"); rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected the quota to be reported, got %v", rec.Header())
+	}
+	rec := limitedRequest(handler, "10.0.0.1:5000")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3600" {
+		t.Errorf("Expected the quota to reset at midnight, got %d %v", rec.Code, rec.Header())
+	}
+
+	now = now.Add(time.Hour)
+	if rec := limitedRequest(handler, "10.0.0.1:5000"); rec.Code != http.StatusOK {
+		t.Errorf("Expected a new quota the next day, got %d", rec.Code)
+	}
+	if stats := limiter.Stats(); stats.QuotaExceeded["/currentBlock"] != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestRateLimitBeforeAuth(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	keys := auth.NewManager(store)
+	_, reader, _ := keys.Create("reader", "", []auth.Scope{auth.ScopeRead})
+	limiter := NewRateLimiter(RateLimitConfig{
+		Routes: map[string]RateLimit{"/currentBlock": {Requests: 5, Per: time.Minute}},
+		PerIP:  RateLimit{Requests: 2, Per: time.Minute},
+	})
+	server := NewServer(parser.NewParser(store, nil), "", WithAuth(keys), WithRateLimit(limiter))
+
+	send := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/currentBlock", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Requests without a key are throttled before they are rejected
+	for i := 0; i < 2; i++ {
+		if code := send(""); code != http.StatusUnauthorized {
+			t.Fatalf("Request %d: expected 401, got %d", i+1, code)
+		}
+	}
+	if code := send(""); code != http.StatusTooManyRequests {
+		t.Errorf("Expected unauthenticated requests to be throttled, got %d", code)
+	}
+	if code := send(reader); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the IP limit to apply to keys from the same IP, got %d", code)
+	}
+	if stats := limiter.Stats(); stats.Throttled["/currentBlock"] != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"blockchain-parser/internal/report"
+	"blockchain-parser/internal/storage"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// makeTransactionsExportHandler creates a handler for /transactions/export
+// which streams an address history as CSV
+func makeTransactionsExportHandler(scanner storage.TransactionScanner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling transactions export request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			log.WarnContext(r.Context(), "Invalid method for transactions export endpoint", "method", r.Method)
+			return
+		}
+
+		address := r.URL.Query().Get("address")
+		if err := ValidateAddress(address); err != nil {
+			log.WarnContext(r.Context(), "Invalid address format", "address", address, "error", err.Message)
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: err.Message,
+				Code:    ErrCodeInvalidAddress,
+			})
+			return
+		}
+
+		format, err := report.ParseFormat(r.URL.Query().Get("format"))
+		if err != nil {
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Code:    ErrCodeInvalidParameter,
+			})
+			return
+		}
+
+		filename := fmt.Sprintf("%s-%s.csv", strings.ToLower(address), format)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+
+		// The status is already sent, so a failure can only be logged
+		if err := report.WriteCSV(w, scanner, address, format); err != nil {
+			log.ErrorContext(r.Context(), "Transactions export failed", "address", address, "error", err)
+			return
+		}
+		log.InfoContext(r.Context(), "Exported transactions", "address", address, "format", format)
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"blockchain-parser/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransactionsExportHandler(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.StoreTransaction(storage.Transaction{
+		Hash:        "0xaaa",
+		FromAddress: testAddress,
+		ToAddress:   "0xdd93e92dc32d0b2f51430b0e6da29bdd01af68d6",
+		ValueWei:    "1000000000000000000",
+		BlockNumber: 1,
+	})
+	handler := makeTransactionsExportHandler(store)
+
+	testCases := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"standard csv", "?address=" + testAddress, http.StatusOK, "timestamp_utc,hash"},
+		{"tax layout", "?address=" + testAddress + "&format=koinly", http.StatusOK, "Date,Sent Amount"},
+		{"invalid address", "?address=0x1", http.StatusBadRequest, ErrCodeInvalidAddress},
+		{"invalid format", "?address=" + testAddress + "&format=xlsx", http.StatusBadRequest, ErrCodeInvalidParameter},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/transactions/export"+tc.query, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tc.wantBody) {
+				t.Errorf("Expected body to contain %q, got %s", tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"blockchain-parser/internal/storage"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retentionPolicyResponse is the JSON form of a storage.RetentionPolicy
+type retentionPolicyResponse struct {
+	MaxAge        string `json:"max_age"`
+	MaxBlockDepth int64  `json:"max_block_depth"`
+	MaxPerAddress int    `json:"max_per_address"`
+}
+
+// pruneStatsResponse is the JSON form of storage.PruneStats
+type pruneStatsResponse struct {
+	Runs        int64  `json:"runs"`
+	TotalPruned int64  `json:"total_pruned"`
+	LastPruned  int    `json:"last_pruned"`
+	LastRun     string `json:"last_run,omitempty"`
+	LastElapsed string `json:"last_elapsed"`
+}
+
+func toRetentionPolicyResponse(policy storage.RetentionPolicy) retentionPolicyResponse {
+	return retentionPolicyResponse{
+		MaxAge:        policy.MaxAge.String(),
+		MaxBlockDepth: policy.MaxBlockDepth,
+		MaxPerAddress: policy.MaxPerAddress,
+	}
+}
+
+func toPruneStatsResponse(stats storage.PruneStats) pruneStatsResponse {
+	response := pruneStatsResponse{
+		Runs:        stats.Runs,
+		TotalPruned: stats.TotalPruned,
+		LastPruned:  stats.LastPruned,
+		LastElapsed: stats.LastElapsed.String(),
+	}
+	if !stats.LastRun.IsZero() {
+		response.LastRun = stats.LastRun.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+// makeRetentionHandler creates a handler for /admin/retention.
+// GET returns the policies and pruning metrics, POST overrides the
+// policy of a single address.
+func makeRetentionHandler(pruner *storage.Pruner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling retention request", "remote", r.RemoteAddr)
+
+		switch r.Method {
+		case http.MethodGet:
+			overrides := make(map[string]retentionPolicyResponse)
+			for address, policy := range pruner.AddressPolicies() {
+				overrides[address] = toRetentionPolicyResponse(policy)
+			}
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"default":   toRetentionPolicyResponse(pruner.Policy()),
+				"addresses": overrides,
+				"stats":     toPruneStatsResponse(pruner.Stats()),
+			})
+
+		case http.MethodPost:
+			address := r.URL.Query().Get("address")
+			if err := ValidateAddress(address); err != nil {
+				log.WarnContext(r.Context(), "Invalid address format", "address", address)
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Message,
+					Code:    ErrCodeInvalidAddress,
+				})
+				return
+			}
+
+			policy, verr := parseRetentionPolicy(r)
+			if verr != nil {
+				log.WarnContext(r.Context(), "Invalid retention policy", "address", address, "error", verr.Message)
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: verr.Message,
+					Code:    ErrCodeInvalidParameter,
+				})
+				return
+			}
+
+			pruner.SetAddressPolicy(address, policy)
+			log.InfoContext(r.Context(), "Updated retention policy", "address", address)
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"status":  "success",
+				"address": address,
+				"policy":  toRetentionPolicyResponse(policy),
+			})
+
+		default:
+			log.WarnContext(r.Context(), "Invalid method for retention endpoint", "method", r.Method)
+			SendError(w, ErrMethodNotAllowed)
+		}
+	}
+}
+
+// makeCompactHandler creates a handler for /admin/compact which prunes on demand
+func makeCompactHandler(pruner *storage.Pruner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling compaction request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodPost) {
+			log.WarnContext(r.Context(), "Invalid method for compaction endpoint", "method", r.Method)
+			return
+		}
+
+		pruned := pruner.Prune()
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "success",
+			"pruned": pruned,
+			"stats":  toPruneStatsResponse(pruner.Stats()),
+		})
+	}
+}
+
+// parseRetentionPolicy reads a retention policy from the query string
+func parseRetentionPolicy(r *http.Request) (storage.RetentionPolicy, *ValidationError) {
+	var policy storage.RetentionPolicy
+	query := r.URL.Query()
+
+	if value := query.Get("max_age"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			return policy, &ValidationError{Field: "max_age", Message: "max_age must be a positive duration such as 720h"}
+		}
+		policy.MaxAge = maxAge
+	}
+
+	if value := query.Get("max_block_depth"); value != "" {
+		depth, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || depth < 0 {
+			return policy, &ValidationError{Field: "max_block_depth", Message: "max_block_depth must be a non-negative integer"}
+		}
+		policy.MaxBlockDepth = depth
+	}
+
+	if value := query.Get("max_per_address"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return policy, &ValidationError{Field: "max_per_address", Message: "max_per_address must be a non-negative integer"}
+		}
+		policy.MaxPerAddress = limit
+	}
+
+	return policy, nil
+}
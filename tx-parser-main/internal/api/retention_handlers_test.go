@@ -0,0 +1,86 @@
+package api
+
+import (
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testAddress = "0x742d35Cc6634C0532925a3b844Bc454e4438f44e"
+
+func TestRetentionHandler(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	pruner := storage.NewPruner(store, storage.RetentionPolicy{MaxAge: time.Hour}, time.Minute)
+	handler := makeRetentionHandler(pruner)
+
+	testCases := []struct {
+		name       string
+		method     string
+		query      string
+		wantStatus int
+	}{
+		{"get policies", http.MethodGet, "", http.StatusOK},
+		{"set override", http.MethodPost, "?address=" + testAddress + "&max_per_address=10&max_age=24h", http.StatusOK},
+		{"invalid address", http.MethodPost, "?address=0x123&max_per_address=10", http.StatusBadRequest},
+		{"invalid duration", http.MethodPost, "?address=" + testAddress + "&max_age=soon", http.StatusBadRequest},
+		{"invalid method", http.MethodDelete, "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/admin/retention"+tc.query, nil)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	policy, ok := store.GetRetentionPolicies()["0x742d35cc6634c0532925a3b844bc454e4438f44e"]
+	if !ok {
+		t.Fatal("Expected override to be stored")
+	}
+	if policy.MaxPerAddress != 10 || policy.MaxAge != 24*time.Hour {
+		t.Errorf("Unexpected stored policy: %+v", policy)
+	}
+}
+
+func TestCompactHandler(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	for i := 0; i < 3; i++ {
+		store.StoreTransaction(storage.Transaction{
+			Hash:        "0x" + string(rune('a'+i)),
+			FromAddress: testAddress,
+			BlockNumber: int64(i),
+		})
+	}
+	pruner := storage.NewPruner(store, storage.RetentionPolicy{MaxPerAddress: 1}, time.Minute)
+	handler := makeCompactHandler(pruner)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/compact", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/compact", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var response struct {
+		Pruned int `json:"pruned"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Pruned != 2 {
+		t.Errorf("Expected 2 pruned, got %d", response.Pruned)
+	}
+}
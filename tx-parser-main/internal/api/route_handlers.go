@@ -0,0 +1,60 @@
+package api
+
+import (
+	"blockchain-parser/config"
+	"blockchain-parser/internal/notification"
+	"net/http"
+)
+
+// makeRoutesHandler creates a handler for /admin/routes. GET lists the
+// channels and per-address routes, POST sets the channels of an address
+// from a comma-separated list and an empty list removes the route.
+func makeRoutesHandler(composite *notification.CompositeNotificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling routes request", "remote", r.RemoteAddr)
+
+		switch r.Method {
+		case http.MethodGet:
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"channels": composite.ChannelNames(),
+				"defaults": composite.DefaultChannels(),
+				"routes":   composite.Routes(),
+			})
+
+		case http.MethodPost:
+			query := r.URL.Query()
+			address := query.Get("address")
+			if err := ValidateAddress(address); err != nil {
+				log.WarnContext(r.Context(), "Invalid address format", "address", address)
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Message,
+					Code:    ErrCodeInvalidAddress,
+				})
+				return
+			}
+
+			channels := config.SplitList(query.Get("channels"))
+			if err := composite.SetRoute(address, channels); err != nil {
+				log.WarnContext(r.Context(), "Invalid notification route", "address", address, "error", err)
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Error(),
+					Code:    ErrCodeInvalidParameter,
+				})
+				return
+			}
+
+			log.InfoContext(r.Context(), "Updated notification route", "address", address, "channels", channels)
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"status":   "success",
+				"address":  address,
+				"channels": channels,
+			})
+
+		default:
+			log.WarnContext(r.Context(), "Invalid method for routes endpoint", "method", r.Method)
+			SendError(w, ErrMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"blockchain-parser/internal/notification"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoutesHandler(t *testing.T) {
+	composite := notification.NewCompositeNotificationService()
+	composite.AddChannel("console", notification.NewConsoleNotificationService())
+	composite.AddChannel("webhook", notification.NewConsoleNotificationService())
+	handler := makeRoutesHandler(composite)
+
+	testCases := []struct {
+		name       string
+		method     string
+		query      string
+		wantStatus int
+	}{
+		{"set route", http.MethodPost, "?address=" + testAddress + "&channels=console,webhook", http.StatusOK},
+		{"unknown channel", http.MethodPost, "?address=" + testAddress + "&channels=pager", http.StatusBadRequest},
+		{"invalid address", http.MethodPost, "?address=0x1&channels=console", http.StatusBadRequest},
+		{"list routes", http.MethodGet, "", http.StatusOK},
+		{"invalid method", http.MethodDelete, "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tc.method, "/admin/routes"+tc.query, nil))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if route := composite.Routes()[strings.ToLower(testAddress)]; len(route) != 2 {
+		t.Errorf("Expected route with 2 channels, got %v", route)
+	}
+
+	// An empty channel list removes the route
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/routes?address="+testAddress, nil))
+	if len(composite.Routes()) != 0 {
+		t.Error("Expected route to be removed")
+	}
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"blockchain-parser/internal/notification"
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"net/http"
+)
+
+// maxRuleBodySize bounds the size of a rule request body
+const maxRuleBodySize = 1 << 20
+
+// makeRulesHandler creates a handler for /admin/rules. GET lists the default
+// and per-address rules, POST sets the rule in the JSON body for an address
+// or the default rule when no address is given, and DELETE removes the rule
+// of an address.
+func makeRulesHandler(engine *notification.RuleEngine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling rules request", "remote", r.RemoteAddr)
+
+		switch r.Method {
+		case http.MethodGet:
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"default": engine.DefaultRule(),
+				"rules":   engine.Rules(),
+			})
+
+		case http.MethodPost:
+			address := r.URL.Query().Get("address")
+			if address != "" && !validRuleAddress(w, address) {
+				return
+			}
+			rule, apiErr := decodeRule(w, r)
+			if apiErr != nil {
+				SendError(w, apiErr)
+				return
+			}
+
+			var err error
+			if address == "" {
+				err = engine.SetDefaultRule(rule)
+			} else {
+				err = engine.SetRule(address, rule)
+			}
+			if err != nil {
+				log.WarnContext(r.Context(), "Invalid notification rule", "address", address, "error", err)
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Error(),
+					Code:    ErrCodeInvalidParameter,
+				})
+				return
+			}
+
+			log.InfoContext(r.Context(), "Updated notification rule", "address", address)
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"status":  "success",
+				"address": address,
+				"rule":    rule,
+			})
+
+		case http.MethodDelete:
+			address := r.URL.Query().Get("address")
+			if !validRuleAddress(w, address) {
+				return
+			}
+			if !engine.RemoveRule(address) {
+				SendError(w, &APIError{
+					Status:  http.StatusNotFound,
+					Message: "No rule for address",
+					Code:    ErrCodeNotFound,
+				})
+				return
+			}
+
+			log.InfoContext(r.Context(), "Removed notification rule", "address", address)
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"status":  "success",
+				"address": address,
+			})
+
+		default:
+			log.WarnContext(r.Context(), "Invalid method for rules endpoint", "method", r.Method)
+			SendError(w, ErrMethodNotAllowed)
+		}
+	}
+}
+
+// makeRuleDryRunHandler creates a handler for /admin/rules/dry-run which
+// evaluates the rule in the JSON body, or the current rule of the address
+// when the body is empty, against the stored history of the address
+func makeRuleDryRunHandler(engine *notification.RuleEngine, scanner storage.TransactionScanner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling rule dry-run request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodPost) {
+			log.WarnContext(r.Context(), "Invalid method for rule dry-run endpoint", "method", r.Method)
+			return
+		}
+
+		address := r.URL.Query().Get("address")
+		if !validRuleAddress(w, address) {
+			return
+		}
+
+		rule := engine.RuleFor(address)
+		if r.ContentLength != 0 {
+			var apiErr *APIError
+			if rule, apiErr = decodeRule(w, r); apiErr != nil {
+				SendError(w, apiErr)
+				return
+			}
+		}
+
+		var transactions []storage.Transaction
+		scanner.ScanTransactions(address, func(tx storage.Transaction) error {
+			transactions = append(transactions, tx)
+			return nil
+		})
+
+		results, err := notification.DryRun(address, rule, transactions)
+		if err != nil {
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Code:    ErrCodeInvalidParameter,
+			})
+			return
+		}
+
+		matched := 0
+		for _, result := range results {
+			if result.Decision != notification.DecisionDrop {
+				matched++
+			}
+		}
+
+		log.InfoContext(r.Context(), "Rule dry-run", "address", address, "matched", matched, "transactions", len(results))
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"address": address,
+			"rule":    rule,
+			"total":   len(results),
+			"matched": matched,
+			"results": results,
+		})
+	}
+}
+
+// validRuleAddress validates the address parameter and sends the error
+func validRuleAddress(w http.ResponseWriter, address string) bool {
+	if err := ValidateAddress(address); err != nil {
+		log.Warn("Invalid address format", "address", address)
+		SendError(w, &APIError{
+			Status:  http.StatusBadRequest,
+			Message: err.Message,
+			Code:    ErrCodeInvalidAddress,
+		})
+		return false
+	}
+	return true
+}
+
+// decodeRule reads a rule from the JSON request body
+func decodeRule(w http.ResponseWriter, r *http.Request) (notification.Rule, *APIError) {
+	var rule notification.Rule
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRuleBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rule); err != nil {
+		log.WarnContext(r.Context(), "Invalid rule body", "error", err)
+		return rule, &APIError{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid rule: " + err.Error(),
+			Code:    ErrCodeJSONParseError,
+		}
+	}
+	return rule, nil
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"blockchain-parser/internal/notification"
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRulesHandler(t *testing.T) {
+	engine := notification.NewRuleEngine()
+	handler := makeRulesHandler(engine)
+
+	testCases := []struct {
+		name       string
+		method     string
+		query      string
+		body       string
+		wantStatus int
+	}{
+		{"set default rule", http.MethodPost, "", `{"min_value":"0.1"}`, http.StatusOK},
+		{"set address rule", http.MethodPost, "?address=" + testAddress, `{"directions":["in"],"max_per_hour":3}`, http.StatusOK},
+		{"invalid rule", http.MethodPost, "?address=" + testAddress, `{"min_value":"abc"}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, "?address=" + testAddress, `{"minimum":"1"}`, http.StatusBadRequest},
+		{"invalid address", http.MethodPost, "?address=0x1", `{}`, http.StatusBadRequest},
+		{"list rules", http.MethodGet, "", "", http.StatusOK},
+		{"invalid method", http.MethodPut, "", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tc.method, "/admin/rules"+tc.query, strings.NewReader(tc.body)))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if engine.DefaultRule().MinValue != "0.1" || engine.RuleFor(testAddress).MaxPerHour != 3 {
+		t.Errorf("Unexpected rules: %+v %+v", engine.DefaultRule(), engine.Rules())
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/admin/rules?address="+testAddress, nil))
+	if rec.Code != http.StatusOK || len(engine.Rules()) != 0 {
+		t.Errorf("Expected rule to be removed, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/admin/rules?address="+testAddress, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing rule, got %d", rec.Code)
+	}
+}
+
+func TestRuleDryRunHandler(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	for i, wei := range []string{"2000000000000000000", "10000000000000000"} {
+		store.StoreTransaction(storage.Transaction{
+			Hash:        "0x" + strings.Repeat(string(rune('a'+i)), 64),
+			FromAddress: "0x1111111111111111111111111111111111111111",
+			ToAddress:   testAddress,
+			ValueWei:    wei,
+			Timestamp:   int64(1000 + i),
+		})
+	}
+	engine := notification.NewRuleEngine()
+	handler := makeRuleDryRunHandler(engine, store)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/rules/dry-run?address="+testAddress,
+		strings.NewReader(`{"min_value":"1"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response struct {
+		Total   int `json:"total"`
+		Matched int `json:"matched"`
+		Results []struct {
+			Decision string `json:"decision"`
+			Reason   string `json:"reason"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Total != 2 || response.Matched != 1 || response.Results[1].Reason == "" {
+		t.Errorf("Unexpected dry-run result: %s", rec.Body.String())
+	}
+
+	// Without a body the current rule of the address is used
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/rules/dry-run?address="+testAddress, nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"matched":2`) {
+		t.Errorf("Expected every transaction to match without rules: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/admin/rules/dry-run?address="+testAddress, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"blockchain-parser/config"
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/stream"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Server-Sent Events settings
+const (
+	sseHeartbeatInterval = 15 * time.Second
+	sseBufferSize        = 256
+)
+
+// makeStreamHandler creates a handler for /stream which pushes transaction,
+// block and reorg events as Server-Sent Events. Clients resume with the
+// Last-Event-ID header, or the last_event_id parameter, and receive a reset
+// event when the events they missed are no longer buffered.
+func makeStreamHandler(hub *stream.Hub, tenants storage.TenantStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling stream request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			log.WarnContext(r.Context(), "Invalid method for stream endpoint", "method", r.Method)
+			return
+		}
+
+		addresses := config.SplitList(r.URL.Query().Get("address"))
+		for _, address := range addresses {
+			if err := ValidateAddress(address); err != nil {
+				log.WarnContext(r.Context(), "Invalid address format", "address", address)
+				sendRequestError(w, r, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Message,
+					Code:    ErrCodeInvalidAddress,
+				})
+				return
+			}
+		}
+
+		// Tenants only stream their own addresses, all of them by default
+		if tenant := requestTenant(r); tenants != nil && tenant != "" {
+			for _, address := range addresses {
+				if !tenants.IsTenantAddress(tenant, address) {
+					sendRequestError(w, r, errAddressNotVisible)
+					return
+				}
+			}
+			if len(addresses) == 0 {
+				addresses = tenants.GetTenantAddresses(tenant)
+			}
+			if len(addresses) == 0 {
+				sendRequestError(w, r, &APIError{
+					Status:  http.StatusNotFound,
+					Message: "Tenant has no subscribed addresses",
+					Code:    ErrCodeNotFound,
+				})
+				return
+			}
+		}
+
+		lastID, apiErr := parseLastEventID(r)
+		if apiErr != nil {
+			sendRequestError(w, r, apiErr)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			sendRequestError(w, r, ErrInternalServer)
+			return
+		}
+
+		sub, replay, complete := hub.Subscribe(addresses, lastID, sseBufferSize)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+
+		if !complete {
+			fmt.Fprintf(w, "event: reset\ndata: {\"last_event_id\":%d}\n\n", hub.LastEventID())
+		}
+		for _, event := range replay {
+			writeSSE(w, event)
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				log.InfoContext(r.Context(), "Stream client disconnected", "remote", r.RemoteAddr)
+				return
+			case event, open := <-sub.Events():
+				if !open {
+					log.WarnContext(r.Context(), "Stream client fell behind, closing", "remote", r.RemoteAddr)
+					return
+				}
+				writeSSE(w, event)
+				flusher.Flush()
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// parseLastEventID reads the resume position of a stream client
+func parseLastEventID(r *http.Request) (int64, *APIError) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, &APIError{
+			Status:  http.StatusBadRequest,
+			Message: "Invalid Last-Event-ID",
+			Code:    ErrCodeInvalidParameter,
+		}
+	}
+	return id, nil
+}
+
+// writeSSE writes one event in the text/event-stream format
+func writeSSE(w io.Writer, event storage.StreamEvent) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+}
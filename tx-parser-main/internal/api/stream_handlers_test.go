@@ -0,0 +1,114 @@
+package api
+
+import (
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/stream"
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readSSE reads lines from an event stream until n events were received
+func readSSE(t *testing.T, r *bufio.Reader, n int) []string {
+	t.Helper()
+	var events []string
+	var current strings.Builder
+	for len(events) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Stream ended after %d events: %v", len(events), err)
+		}
+		if line == "\n" {
+			events = append(events, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteString(line)
+	}
+	return events
+}
+
+func TestStreamHandler(t *testing.T) {
+	hub := stream.NewHub(storage.NewMemoryStorage(), 3)
+	server := httptest.NewServer(makeStreamHandler(hub, nil))
+	defer server.Close()
+
+	hub.PublishBlock(1, "0x1", 0, 0)
+	hub.PublishBlock(2, "0x2", 0, 0)
+
+	// Resume after event 1 and filter by address
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"?address="+testAddress, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	r := bufio.NewReader(resp.Body)
+
+	if replay := readSSE(t, r, 1); !strings.Contains(replay[0], "id: 2\nevent: block\n") {
+		t.Errorf("Expected event 2 to be replayed, got %q", replay[0])
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for hub.Subscribers() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	hub.PublishTransaction(storage.Transaction{Hash: "0xother"}, []string{"0x0000000000000000000000000000000000000001"})
+	hub.PublishTransaction(storage.Transaction{Hash: "0xmine", ToAddress: testAddress}, []string{testAddress})
+
+	live := readSSE(t, r, 1)
+	if !strings.Contains(live[0], "id: 4\nevent: transaction\n") || !strings.Contains(live[0], `"hash":"0xmine"`) {
+		t.Errorf("Expected only the transaction of the address, got %q", live[0])
+	}
+}
+
+func TestStreamHandlerReset(t *testing.T) {
+	hub := stream.NewHub(storage.NewMemoryStorage(), 2)
+	for i := int64(1); i <= 5; i++ {
+		hub.PublishBlock(i, "", 0, 0)
+	}
+	server := httptest.NewServer(makeStreamHandler(hub, nil))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?last_event_id=1")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	events := readSSE(t, bufio.NewReader(resp.Body), 3)
+	if !strings.HasPrefix(events[0], "event: reset\n") || !strings.Contains(events[1], "id: 4\n") {
+		t.Errorf("Expected a reset before the retained events, got %q", events)
+	}
+}
+
+func TestStreamHandlerValidation(t *testing.T) {
+	handler := makeStreamHandler(stream.NewHub(storage.NewMemoryStorage(), 10), nil)
+
+	testCases := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{"invalid address", http.MethodGet, "/stream?address=0x1", http.StatusBadRequest},
+		{"invalid last event id", http.MethodGet, "/stream?last_event_id=abc", http.StatusBadRequest},
+		{"invalid method", http.MethodPost, "/stream", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tc.method, tc.target, nil))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, rec.Code)
+			}
+		})
+	}
+}
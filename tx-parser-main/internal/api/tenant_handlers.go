@@ -0,0 +1,190 @@
+package api
+
+import (
+	"blockchain-parser/config"
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/notification"
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// requestTenant returns the tenant whose data a request may see. Requests
+// without a key, when authentication is disabled, and admin keys see every
+// tenant and get an empty tenant.
+func requestTenant(r *http.Request) string {
+	key, ok := auth.KeyFrom(r.Context())
+	if !ok {
+		return ""
+	}
+	return auth.TenantOf(key)
+}
+
+// tenantVisible reports whether tenant may see address
+func tenantVisible(tenants storage.TenantStore, tenant, address string) bool {
+	return tenants == nil || tenant == "" || tenants.IsTenantAddress(tenant, address)
+}
+
+// errAddressNotVisible hides the addresses of other tenants as if they were
+// not monitored at all
+var errAddressNotVisible = &APIError{
+	Status:  http.StatusNotFound,
+	Message: "Address is not subscribed",
+	Code:    ErrCodeNotFound,
+}
+
+// requireTenantAddress wraps a handler taking an address in its path or
+// query so it only runs when the tenant of the request watches the address
+func requireTenantAddress(tenants storage.TenantStore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address := r.PathValue("address")
+		if address == "" {
+			address = r.URL.Query().Get("address")
+		}
+		if tenant := requestTenant(r); address != "" && !tenantVisible(tenants, tenant, address) {
+			log.WarnContext(r.Context(), "Tenant requested an address it does not watch", "tenant", tenant, "address", address)
+			sendRequestError(w, r, errAddressNotVisible)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// makeTenantNotificationsHandler creates a handler for /tenant/notifications
+// which configures the notification channels and webhook of the tenant of
+// the API key. Admin keys, and requests when authentication is disabled,
+// name the tenant with the tenant parameter. GET shows the configuration,
+// POST sets the channels from a comma-separated list and the webhook from a
+// JSON body like /admin/webhooks; empty values remove them. Webhooks make
+// the parser send requests to any URL, so changing one needs an admin key.
+func makeTenantNotificationsHandler(routes *notification.CompositeNotificationService, webhooks *notification.WebhookNotificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling tenant notifications request", "remote", r.RemoteAddr)
+
+		query := r.URL.Query()
+		tenant := requestTenant(r)
+		if tenant == "" {
+			tenant = query.Get("tenant")
+			if err := auth.ValidateTenant(tenant); err != nil {
+				sendRequestError(w, r, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Error(),
+					Code:    ErrCodeInvalidParameter,
+				})
+				return
+			}
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			// The configuration is returned below
+
+		case http.MethodPost:
+			// An empty body leaves the webhook unchanged
+			var webhook *setWebhookRequest
+			var req setWebhookRequest
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+			decoder.DisallowUnknownFields()
+			switch err := decoder.Decode(&req); {
+			case err == nil:
+				webhook = &req
+			case !errors.Is(err, io.EOF):
+				sendRequestError(w, r, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: "Invalid JSON body",
+					Code:    ErrCodeJSONParseError,
+				})
+				return
+			}
+			if key, ok := auth.KeyFrom(r.Context()); webhook != nil && ok && !auth.Allows(key.Scopes, auth.ScopeAdmin) {
+				log.WarnContext(r.Context(), "Key lacks the scope to set a tenant webhook", "key", key.ID, "name", key.Name, "scope", auth.ScopeAdmin, "tenant", tenant)
+				sendRequestError(w, r, ErrForbidden)
+				return
+			}
+
+			if query.Has("channels") {
+				if routes == nil {
+					sendRequestError(w, r, &APIError{
+						Status:  http.StatusBadRequest,
+						Message: "Notification channels are not configurable",
+						Code:    ErrCodeInvalidParameter,
+					})
+					return
+				}
+				channels := config.SplitList(query.Get("channels"))
+				if err := routes.SetTenantRoute(tenant, channels); err != nil {
+					log.WarnContext(r.Context(), "Invalid notification route", "tenant", tenant, "error", err)
+					sendRequestError(w, r, &APIError{
+						Status:  http.StatusBadRequest,
+						Message: err.Error(),
+						Code:    ErrCodeInvalidParameter,
+					})
+					return
+				}
+				log.InfoContext(r.Context(), "Updated notification route", "tenant", tenant, "channels", channels)
+			}
+
+			if webhook != nil {
+				endpoint := notification.WebhookEndpoint{URL: webhook.URL, Secret: webhook.Secret}
+				if webhooks == nil {
+					sendRequestError(w, r, &APIError{
+						Status:  http.StatusBadRequest,
+						Message: "Webhooks are not enabled",
+						Code:    ErrCodeInvalidParameter,
+					})
+					return
+				}
+				if err := ValidateWebhookURL(endpoint.URL); endpoint.URL != "" && err != nil {
+					log.WarnContext(r.Context(), "Invalid webhook URL", "tenant", tenant, "url", endpoint.URL)
+					sendRequestError(w, r, &APIError{
+						Status:  http.StatusBadRequest,
+						Message: err.Message,
+						Code:    ErrCodeInvalidParameter,
+					})
+					return
+				}
+				webhooks.SetTenantEndpoint(tenant, endpoint)
+				log.InfoContext(r.Context(), "Updated webhook", "tenant", tenant)
+			}
+
+		default:
+			log.WarnContext(r.Context(), "Invalid method for tenant notifications endpoint", "method", r.Method)
+			sendRequestError(w, r, ErrMethodNotAllowed)
+			return
+		}
+
+		response := map[string]interface{}{"tenant": tenant, "channels": []string{}}
+		if routes != nil {
+			response["available_channels"] = routes.ChannelNames()
+			if channels, ok := routes.TenantRoutes()[tenant]; ok {
+				response["channels"] = channels
+			}
+		}
+		if webhooks != nil {
+			if endpoint, ok := webhooks.TenantEndpoints()[tenant]; ok {
+				response["webhook"] = webhookResponse{URL: endpoint.URL, Signed: endpoint.Secret != ""}
+			}
+		}
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
+
+// makeTenantsHandler creates a handler for /admin/tenants which lists every
+// tenant with its subscribed addresses
+func makeTenantsHandler(tenants storage.TenantStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling tenants request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			return
+		}
+
+		response := make(map[string][]string)
+		for _, tenant := range tenants.GetTenants() {
+			response[tenant] = tenants.GetTenantAddresses(tenant)
+		}
+		respondWithJSON(w, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/notification"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const otherAddress = "0x8ba1f109551bD432803012645Ac136ddd64DBA72"
+
+// tenantRequest runs handler for a request made with secret
+func tenantRequest(handler http.HandlerFunc, method, target, secret string) *httptest.ResponseRecorder {
+	return tenantBodyRequest(handler, method, target, "", secret)
+}
+
+// tenantBodyRequest runs handler for a request with body made with secret
+func tenantBodyRequest(handler http.HandlerFunc, method, target, body, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("X-API-Key", secret)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestTenantSubscriptions(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	p := parser.NewParser(store, nil)
+	keys := auth.NewManager(store)
+	_, payments, _ := keys.Create("payments", "payments", []auth.Scope{auth.ScopeSubscribe})
+	_, treasury, _ := keys.Create("treasury", "treasury", []auth.Scope{auth.ScopeSubscribe})
+	_, admin, _ := keys.Create("ops", "", []auth.Scope{auth.ScopeAdmin})
+
+	subscribe := requireScope(keys, auth.ScopeSubscribe, makeSubscribeHandler(p, nil, store, nil))
+	list := requireScope(keys, auth.ScopeRead, makeSubscribersList(p, store))
+	transactions := requireScope(keys, auth.ScopeRead, requireTenantAddress(store, makeTransactionsHandler(p)))
+
+	for _, step := range []struct {
+		secret, address string
+		wantStatus      int
+	}{
+		{payments, testAddress, http.StatusOK},
+		{payments, testAddress, http.StatusBadRequest},
+		{treasury, testAddress, http.StatusOK},
+		{treasury, otherAddress, http.StatusOK},
+	} {
+		rec := tenantRequest(subscribe, http.MethodPost, "/subscribe?address="+step.address, step.secret)
+		if rec.Code != step.wantStatus {
+			t.Fatalf("Subscribing %s: expected status %d, got %d: %s", step.address, step.wantStatus, rec.Code, rec.Body.String())
+		}
+	}
+
+	if subscribers := p.GetSubscribers(); len(subscribers) != 2 {
+		t.Errorf("Expected each address to be monitored once, got %v", subscribers)
+	}
+
+	subscribers := func(secret string) []string {
+		var response struct {
+			Subscribers []string `json:"subscribers"`
+		}
+		json.NewDecoder(tenantRequest(list, http.MethodGet, "/subscribers", secret).Body).Decode(&response)
+		return response.Subscribers
+	}
+	if got := subscribers(payments); len(got) != 1 || got[0] != testAddress {
+		t.Errorf("Expected payments to see only its address, got %v", got)
+	}
+	if got := subscribers(treasury); len(got) != 2 {
+		t.Errorf("Expected treasury to see both addresses, got %v", got)
+	}
+	if got := subscribers(admin); len(got) != 2 {
+		t.Errorf("Expected admin keys to see every subscriber, got %v", got)
+	}
+
+	if rec := tenantRequest(transactions, http.MethodGet, "/transactions?address="+otherAddress, payments); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected transactions of another tenant to be hidden, got %d", rec.Code)
+	}
+	if rec := tenantRequest(transactions, http.MethodGet, "/transactions?address="+otherAddress, treasury); rec.Code != http.StatusOK {
+		t.Errorf("Expected treasury to read its transactions, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := tenantRequest(transactions, http.MethodGet, "/transactions?address="+otherAddress, admin); rec.Code != http.StatusOK {
+		t.Errorf("Expected admin keys to read every transaction, got %d", rec.Code)
+	}
+}
+
+func TestTenantNotificationsHandler(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	keys := auth.NewManager(store)
+	_, payments, _ := keys.Create("payments", "payments", []auth.Scope{auth.ScopeSubscribe})
+	_, admin, _ := keys.Create("ops", "", []auth.Scope{auth.ScopeAdmin})
+
+	composite := notification.NewCompositeNotificationService()
+	composite.AddChannel("console", notification.NewConsoleNotificationService())
+	composite.AddChannel("webhook", notification.NewWebhookNotificationService(notification.DefaultWebhookConfig()))
+	webhooks := notification.NewWebhookNotificationService(notification.DefaultWebhookConfig())
+	handler := requireScope(keys, auth.ScopeSubscribe, makeTenantNotificationsHandler(composite, webhooks))
+
+	rec := tenantRequest(handler, http.MethodPost, "/tenant/notifications?channels=webhook", payments)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if routes := composite.TenantRoutes()["payments"]; len(routes) != 1 || routes[0] != "webhook" {
+		t.Errorf("Expected the payments route to be stored, got %v", composite.TenantRoutes())
+	}
+
+	// Only admin keys point the parser at a new webhook URL
+	body := `{"url":"https://payments.example.com/hook","secret":"s3cret"}`
+	if rec := tenantBodyRequest(handler, http.MethodPost, "/tenant/notifications", body, payments); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected subscribe keys to be refused webhook changes, got %d", rec.Code)
+	}
+	if _, ok := webhooks.TenantEndpoints()["payments"]; ok {
+		t.Errorf("Expected the refused webhook not to be stored")
+	}
+	rec = tenantBodyRequest(handler, http.MethodPost, "/tenant/notifications?tenant=payments", body, admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if endpoint := webhooks.TenantEndpoints()["payments"]; endpoint.URL != "https://payments.example.com/hook" || endpoint.Secret != "s3cret" {
+		t.Errorf("Expected the payments webhook to be stored, got %+v", endpoint)
+	}
+	if rec := tenantBodyRequest(handler, http.MethodPost, "/tenant/notifications?tenant=payments", "{", admin); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid body to be rejected, got %d", rec.Code)
+	}
+
+	if rec := tenantRequest(handler, http.MethodPost, "/tenant/notifications?channels=pager", payments); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown channel to be rejected, got %d", rec.Code)
+	}
+	if rec := tenantRequest(handler, http.MethodGet, "/tenant/notifications", admin); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected admin keys to name the tenant, got %d", rec.Code)
+	}
+
+	rec = tenantRequest(handler, http.MethodGet, "/tenant/notifications?tenant=payments", admin)
+	var response struct {
+		Tenant   string          `json:"tenant"`
+		Channels []string        `json:"channels"`
+		Webhook  webhookResponse `json:"webhook"`
+	}
+	json.NewDecoder(rec.Body).Decode(&response)
+	if response.Tenant != "payments" || len(response.Channels) != 1 || !response.Webhook.Signed {
+		t.Errorf("Unexpected tenant configuration: %+v", response)
+	}
+}
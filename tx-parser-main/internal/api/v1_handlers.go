@@ -0,0 +1,329 @@
+package api
+
+import (
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// maxV1BodySize limits the JSON bodies of the /v1 API
+const maxV1BodySize = 1 << 16
+
+// v1Envelope wraps every successful /v1 response
+type v1Envelope struct {
+	Data interface{} `json:"data"`
+}
+
+// v1ErrorEnvelope wraps every failed /v1 response
+type v1ErrorEnvelope struct {
+	Error v1Error `json:"error"`
+}
+
+// v1Error carries an APIError code in the /v1 envelope
+type v1Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// v1Block is the current block resource
+type v1Block struct {
+	Number int64 `json:"number"`
+}
+
+// v1Subscription is a subscribed address resource
+type v1Subscription struct {
+	Address string `json:"address"`
+	Label   string `json:"label,omitempty"`
+}
+
+// v1SubscriptionRequest is the body of POST /v1/subscriptions
+type v1SubscriptionRequest struct {
+	Address string `json:"address"`
+	Label   string `json:"label,omitempty"`
+}
+
+// v1Transaction is a transaction of an address
+type v1Transaction struct {
+	Hash        string  `json:"hash"`
+	Index       int     `json:"index"`
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	Value       float64 `json:"value"`
+	ValueWei    string  `json:"value_wei,omitempty"`
+	FeeWei      string  `json:"fee_wei,omitempty"`
+	Status      string  `json:"status,omitempty"`
+	Token       string  `json:"token,omitempty"`
+	Direction   string  `json:"direction,omitempty"`
+	BlockNumber int64   `json:"block_number"`
+	Timestamp   int64   `json:"timestamp"`
+}
+
+// respondV1 writes data in the /v1 envelope
+func respondV1(w http.ResponseWriter, status int, data interface{}) {
+	respondWithJSON(w, status, v1Envelope{Data: data})
+}
+
+// sendV1Error writes an APIError in the /v1 envelope
+func sendV1Error(w http.ResponseWriter, err *APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(v1ErrorEnvelope{Error: v1Error{
+		Status:  err.Status,
+		Code:    err.Code,
+		Message: err.Message,
+	}})
+}
+
+// v1AddressError converts an address validation failure
+func v1AddressError(err *ValidationError) *APIError {
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		Message: err.Message,
+		Code:    ErrCodeInvalidAddress,
+	}
+}
+
+// deprecated marks a pre-/v1 route as an alias of its successor
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+		next(w, r)
+	}
+}
+
+type auditAddressKey struct{}
+
+// setAuditAddress records the address a request acted on when it is not
+// part of the URL, such as an address sent in a JSON body
+func setAuditAddress(r *http.Request, address string) {
+	if holder, ok := r.Context().Value(auditAddressKey{}).(*string); ok {
+		*holder = address
+	}
+}
+
+// withAuditAddress returns a request whose handler can report the address
+// it acted on through setAuditAddress
+func withAuditAddress(r *http.Request, address *string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), auditAddressKey{}, address))
+}
+
+// v1Route is an operation of the /v1 API. The same table registers the
+// handlers and generates the OpenAPI document.
+type v1Route struct {
+	Method  string
+	Path    string
+	Summary string
+	Scope   auth.Scope
+
+	// Request is the JSON body type, nil without a body
+	Request interface{}
+	// Response is the type of the data field of the envelope
+	Response interface{}
+	// Status is the status of a successful response
+	Status int
+	// Errors are the statuses of the error responses
+	Errors []int
+
+	handler http.HandlerFunc
+}
+
+// pattern returns the ServeMux pattern of the route
+func (r v1Route) pattern() string {
+	return r.Method + " " + r.Path
+}
+
+// v1Routes returns the operations of the /v1 API
+func v1Routes(p parser.Parser, labels storage.LabelStore, tenants storage.TenantStore, monitored *wsAddresses) []v1Route {
+	return []v1Route{
+		{
+			Method:   http.MethodGet,
+			Path:     "/v1/blocks/current",
+			Summary:  "Latest processed block",
+			Scope:    auth.ScopeRead,
+			Response: v1Block{},
+			Status:   http.StatusOK,
+			handler:  makeV1CurrentBlockHandler(p),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v1/subscriptions",
+			Summary:  "List subscribed addresses",
+			Scope:    auth.ScopeRead,
+			Response: []v1Subscription{},
+			Status:   http.StatusOK,
+			handler:  makeV1SubscriptionsHandler(p, labels, tenants),
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/v1/subscriptions",
+			Summary:  "Subscribe an address",
+			Scope:    auth.ScopeSubscribe,
+			Request:  v1SubscriptionRequest{},
+			Response: v1Subscription{},
+			Status:   http.StatusCreated,
+			Errors:   []int{http.StatusBadRequest, http.StatusConflict},
+			handler:  makeV1SubscribeHandler(p, labels, tenants, monitored),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v1/subscriptions/{address}",
+			Summary:  "Get a subscribed address",
+			Scope:    auth.ScopeRead,
+			Response: v1Subscription{},
+			Status:   http.StatusOK,
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+			handler:  makeV1SubscriptionHandler(p, labels, tenants),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/v1/addresses/{address}/transactions",
+			Summary:  "List the transactions of a subscribed address",
+			Scope:    auth.ScopeRead,
+			Response: []v1Transaction{},
+			Status:   http.StatusOK,
+			Errors:   []int{http.StatusBadRequest, http.StatusNotFound},
+			handler:  makeV1TransactionsHandler(p, tenants),
+		},
+	}
+}
+
+// makeV1CurrentBlockHandler creates a handler for GET /v1/blocks/current
+func makeV1CurrentBlockHandler(p parser.Parser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling v1 current block request", "remote", r.RemoteAddr)
+		respondV1(w, http.StatusOK, v1Block{Number: p.GetCurrentBlock()})
+	}
+}
+
+// subscriptionOf returns the subscription resource of an address
+func subscriptionOf(labels storage.LabelStore, address string) v1Subscription {
+	subscription := v1Subscription{Address: address}
+	if labels != nil {
+		subscription.Label = labels.GetLabel(address)
+	}
+	return subscription
+}
+
+// makeV1SubscriptionsHandler creates a handler for GET /v1/subscriptions
+func makeV1SubscriptionsHandler(p parser.Parser, labels storage.LabelStore, tenants storage.TenantStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling v1 subscriptions request", "remote", r.RemoteAddr)
+
+		subscriptions := []v1Subscription{}
+		for _, address := range visibleSubscribers(p, tenants, r) {
+			subscriptions = append(subscriptions, subscriptionOf(labels, address))
+		}
+		respondV1(w, http.StatusOK, subscriptions)
+	}
+}
+
+// makeV1SubscribeHandler creates a handler for POST /v1/subscriptions which
+// subscribes the address in the JSON body
+func makeV1SubscribeHandler(p parser.Parser, labels storage.LabelStore, tenants storage.TenantStore, monitored *wsAddresses) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling v1 subscribe request", "remote", r.RemoteAddr)
+
+		var req v1SubscriptionRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxV1BodySize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			sendV1Error(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid JSON body",
+				Code:    ErrCodeJSONParseError,
+			})
+			return
+		}
+		setAuditAddress(r, req.Address)
+
+		if err := ValidateAddress(req.Address); err != nil {
+			sendV1Error(w, v1AddressError(err))
+			return
+		}
+		if err := ValidateLabel(req.Label); err != nil {
+			sendV1Error(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: err.Message,
+				Code:    ErrCodeInvalidParameter,
+			})
+			return
+		}
+
+		if apiErr := subscribeAddress(p, tenants, monitored, requestTenant(r), req.Address); apiErr != nil {
+			// A duplicate is a conflict with the existing resource
+			if apiErr.Code == ErrCodeAlreadySubscribed {
+				apiErr = &APIError{Status: http.StatusConflict, Message: apiErr.Message, Code: apiErr.Code}
+			}
+			sendV1Error(w, apiErr)
+			return
+		}
+		if labels != nil && req.Label != "" {
+			labels.SetLabel(req.Address, req.Label)
+		}
+
+		log.InfoContext(r.Context(), "Subscribed address", "address", req.Address, "tenant", requestTenant(r))
+		w.Header().Set("Location", "/v1/subscriptions/"+req.Address)
+		respondV1(w, http.StatusCreated, subscriptionOf(labels, req.Address))
+	}
+}
+
+// makeV1SubscriptionHandler creates a handler for
+// GET /v1/subscriptions/{address}
+func makeV1SubscriptionHandler(p parser.Parser, labels storage.LabelStore, tenants storage.TenantStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling v1 subscription request", "remote", r.RemoteAddr)
+
+		address := r.PathValue("address")
+		if err := ValidateAddress(address); err != nil {
+			sendV1Error(w, v1AddressError(err))
+			return
+		}
+		if !p.IsSubscribed(address) || !tenantVisible(tenants, requestTenant(r), address) {
+			sendV1Error(w, errAddressNotVisible)
+			return
+		}
+		respondV1(w, http.StatusOK, subscriptionOf(labels, address))
+	}
+}
+
+// makeV1TransactionsHandler creates a handler for
+// GET /v1/addresses/{address}/transactions
+func makeV1TransactionsHandler(p parser.Parser, tenants storage.TenantStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling v1 transactions request", "remote", r.RemoteAddr)
+
+		address := r.PathValue("address")
+		if err := ValidateAddress(address); err != nil {
+			sendV1Error(w, v1AddressError(err))
+			return
+		}
+		if !p.IsSubscribed(address) || !tenantVisible(tenants, requestTenant(r), address) {
+			sendV1Error(w, errAddressNotVisible)
+			return
+		}
+
+		transactions := []v1Transaction{}
+		for _, tx := range p.GetTransactions(address) {
+			transactions = append(transactions, v1Transaction{
+				Hash:        tx.Hash,
+				Index:       tx.Index,
+				From:        tx.FromAddress,
+				To:          tx.ToAddress,
+				Value:       tx.Value,
+				ValueWei:    tx.ValueWei,
+				FeeWei:      tx.FeeWei,
+				Status:      tx.Status,
+				Token:       tx.Token,
+				Direction:   string(tx.Direction),
+				BlockNumber: tx.BlockNumber,
+				Timestamp:   tx.Timestamp,
+			})
+		}
+		respondV1(w, http.StatusOK, transactions)
+	}
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"net/mail"
+	"net/url"
 	"regexp"
 	"strings"
 )
@@ -103,3 +105,41 @@ func ValidateTransactionHash(hash string) *ValidationError {
 
 	return nil
 }
+
+// ValidateWebhookURL checks that a webhook URL is an absolute http(s) URL
+func ValidateWebhookURL(rawURL string) *ValidationError {
+	parsed, err := url.ParseRequestURI(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return &ValidationError{
+			Field:   "url",
+			Message: "url must be an absolute http or https URL",
+		}
+	}
+	return nil
+}
+
+// ValidateEmail checks that a recipient is a bare email address
+func ValidateEmail(address string) *ValidationError {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address {
+		return &ValidationError{
+			Field:   "recipient",
+			Message: "recipient must be a valid email address",
+		}
+	}
+	return nil
+}
+
+// maxLabelLength bounds subscription labels shown in notifications
+const maxLabelLength = 64
+
+// ValidateLabel checks that a subscription label is short and printable
+func ValidateLabel(label string) *ValidationError {
+	if len(label) > maxLabelLength || strings.ContainsAny(label, "\r\n\t") {
+		return &ValidationError{
+			Field:   "label",
+			Message: "label must be at most 64 characters on a single line",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"blockchain-parser/internal/notification"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// maxWebhookBodySize bounds the body of a webhook update
+const maxWebhookBodySize = 1 << 16
+
+// setWebhookRequest is the body of POST /admin/webhooks. The secret travels
+// in the body so it never ends up in access logs or proxy URLs.
+type setWebhookRequest struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// webhookResponse describes a configured webhook without its secret
+type webhookResponse struct {
+	URL    string `json:"url"`
+	Signed bool   `json:"signed"`
+}
+
+// deliveryAttemptResponse is the JSON form of notification.DeliveryAttempt
+type deliveryAttemptResponse struct {
+	Address    string `json:"address"`
+	URL        string `json:"url"`
+	Hash       string `json:"hash"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Duration   string `json:"duration"`
+	Time       string `json:"time"`
+}
+
+// makeWebhooksHandler creates a handler for /admin/webhooks. GET lists the
+// per-address webhooks and recent deliveries, POST sets the webhook of an
+// address from a JSON body and an empty url removes it.
+func makeWebhooksHandler(webhooks *notification.WebhookNotificationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling webhooks request", "remote", r.RemoteAddr)
+
+		switch r.Method {
+		case http.MethodGet:
+			endpoints := make(map[string]webhookResponse)
+			for address, endpoint := range webhooks.Endpoints() {
+				endpoints[address] = webhookResponse{URL: endpoint.URL, Signed: endpoint.Secret != ""}
+			}
+
+			attempts := webhooks.Attempts()
+			deliveries := make([]deliveryAttemptResponse, 0, len(attempts))
+			for _, attempt := range attempts {
+				deliveries = append(deliveries, deliveryAttemptResponse{
+					Address:    attempt.Address,
+					URL:        attempt.URL,
+					Hash:       attempt.Hash,
+					Attempt:    attempt.Attempt,
+					StatusCode: attempt.StatusCode,
+					Error:      attempt.Error,
+					Duration:   attempt.Duration.String(),
+					Time:       attempt.Time.UTC().Format(time.RFC3339),
+				})
+			}
+
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"webhooks":   endpoints,
+				"deliveries": deliveries,
+			})
+
+		case http.MethodPost:
+			address := r.URL.Query().Get("address")
+			if err := ValidateAddress(address); err != nil {
+				log.WarnContext(r.Context(), "Invalid address format", "address", address)
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Message,
+					Code:    ErrCodeInvalidAddress,
+				})
+				return
+			}
+
+			var req setWebhookRequest
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&req); err != nil {
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: "Invalid JSON body",
+					Code:    ErrCodeJSONParseError,
+				})
+				return
+			}
+
+			endpoint := notification.WebhookEndpoint{URL: req.URL, Secret: req.Secret}
+			if err := ValidateWebhookURL(endpoint.URL); endpoint.URL != "" && err != nil {
+				log.WarnContext(r.Context(), "Invalid webhook URL", "address", address, "url", endpoint.URL)
+				SendError(w, &APIError{
+					Status:  http.StatusBadRequest,
+					Message: err.Message,
+					Code:    ErrCodeInvalidParameter,
+				})
+				return
+			}
+
+			webhooks.SetEndpoint(address, endpoint)
+			log.InfoContext(r.Context(), "Updated webhook", "address", address)
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"status":  "success",
+				"address": address,
+				"webhook": webhookResponse{URL: endpoint.URL, Signed: endpoint.Secret != ""},
+			})
+
+		default:
+			log.WarnContext(r.Context(), "Invalid method for webhooks endpoint", "method", r.Method)
+			SendError(w, ErrMethodNotAllowed)
+		}
+	}
+}
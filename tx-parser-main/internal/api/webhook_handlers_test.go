@@ -0,0 +1,53 @@
+package api
+
+import (
+	"blockchain-parser/internal/notification"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhooksHandler(t *testing.T) {
+	webhooks := notification.NewWebhookNotificationService(notification.DefaultWebhookConfig())
+	handler := makeWebhooksHandler(webhooks)
+
+	testCases := []struct {
+		name       string
+		method     string
+		query      string
+		body       string
+		wantStatus int
+	}{
+		{"set webhook", http.MethodPost, "?address=" + testAddress, `{"url":"https://example.com/hook","secret":"abc"}`, http.StatusOK},
+		{"invalid url", http.MethodPost, "?address=" + testAddress, `{"url":"ftp://example.com"}`, http.StatusBadRequest},
+		{"invalid address", http.MethodPost, "?address=0x1", `{"url":"https://example.com"}`, http.StatusBadRequest},
+		{"invalid body", http.MethodPost, "?address=" + testAddress, `{"url":`, http.StatusBadRequest},
+		{"list webhooks", http.MethodGet, "", "", http.StatusOK},
+		{"invalid method", http.MethodPut, "", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tc.method, "/admin/webhooks"+tc.query, strings.NewReader(tc.body)))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if strings.Contains(rec.Body.String(), "abc") {
+				t.Error("Webhook secret must not be returned")
+			}
+		})
+	}
+
+	if endpoint := webhooks.Endpoints()[strings.ToLower(testAddress)]; endpoint.Secret != "abc" {
+		t.Errorf("Expected webhook to be stored, got %+v", endpoint)
+	}
+
+	// An empty url removes the webhook
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/admin/webhooks?address="+testAddress, strings.NewReader(`{}`)))
+	if len(webhooks.Endpoints()) != 0 {
+		t.Error("Expected webhook to be removed")
+	}
+}
@@ -0,0 +1,712 @@
+package api
+
+import (
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/stream"
+	"blockchain-parser/internal/utils"
+	"blockchain-parser/internal/websocket"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket settings
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsWriteWait    = 10 * time.Second
+	wsAuthWait     = 10 * time.Second
+	wsBufferSize   = 256
+	wsMaxAddresses = 100
+
+	// wsMaxMonitored is the default cap on the addresses WebSocket clients
+	// add to the parser together
+	wsMaxMonitored = 10000
+	wsMessageLimit = 16 << 10
+)
+
+// WebSocket message types
+const (
+	wsTypeAuth        = "auth"
+	wsTypeSubscribe   = "subscribe"
+	wsTypeUnsubscribe = "unsubscribe"
+	wsTypeSetFilter   = "set_filter"
+	wsTypePing        = "ping"
+	wsTypePong        = "pong"
+	wsTypeWelcome     = "welcome"
+	wsTypeAck         = "ack"
+	wsTypeEvent       = "event"
+	wsTypeDropped     = "dropped"
+	wsTypeError       = "error"
+)
+
+// WebSocketConfig configures the /ws endpoint
+type WebSocketConfig struct {
+	// Tokens are accepted to authenticate a connection, which is open to
+	// everyone when neither tokens nor API keys are configured. They are
+	// rejected when API keys are enabled, since they carry no tenant.
+	Tokens []string
+
+	// Scope is granted to connections without an API key: those using one
+	// of Tokens, or every connection to an open endpoint. Empty grants read
+	// scope, which watches monitored addresses but cannot add new ones.
+	Scope auth.Scope
+
+	// Keys authenticates connections with API keys having read scope. It is
+	// set by StartServer when authentication is enabled.
+	Keys *auth.Manager
+
+	// Tenants limits connections with an API key to the addresses of its
+	// tenant. It is set by StartServer when tenants are enabled.
+	Tenants storage.TenantStore
+
+	// SlowPolicy decides whether slow clients lose events or are disconnected
+	SlowPolicy stream.SlowPolicy
+
+	// MaxMonitored caps the addresses that WebSocket clients together add
+	// to the parser, 10000 when zero
+	MaxMonitored int
+
+	// monitored is shared with the subscribe handlers by StartServer, so
+	// their subscriptions take over those of WebSocket clients
+	monitored *wsAddresses
+}
+
+// wsIdentity is who a connection authenticated as
+type wsIdentity struct {
+	// key is the API key of the connection, nil when API keys are disabled
+	key *storage.APIKey
+
+	// scopes are the scopes of the key, or the configured Scope without one
+	scopes []string
+}
+
+// authenticate checks token against the API keys, or the configured tokens
+// when API keys are disabled
+func (c WebSocketConfig) authenticate(token string) (wsIdentity, bool) {
+	if c.Keys != nil {
+		if key, ok := c.Keys.Authenticate(token); ok && auth.Allows(key.Scopes, auth.ScopeRead) {
+			return wsIdentity{key: &key, scopes: key.Scopes}, true
+		}
+		return wsIdentity{}, false
+	}
+
+	scope := c.Scope
+	if scope == "" {
+		scope = auth.ScopeRead
+	}
+	identity := wsIdentity{scopes: []string{string(scope)}}
+	if len(c.Tokens) == 0 {
+		return identity, true
+	}
+	for _, allowed := range c.Tokens {
+		if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+			return identity, true
+		}
+	}
+	return wsIdentity{}, false
+}
+
+// wsFilter narrows the events sent to a connection
+type wsFilter struct {
+	// Events limits the event types, all of them when empty
+	Events []string `json:"events,omitempty"`
+
+	// MinValue is the smallest transaction value in ether
+	MinValue string `json:"min_value,omitempty"`
+
+	// Tokens limits transactions to these token contracts, ETH for ether
+	Tokens []string `json:"tokens,omitempty"`
+
+	// FailedOnly only sends failed transactions
+	FailedOnly bool `json:"failed_only,omitempty"`
+}
+
+// validate checks the event types and the minimum value
+func (f wsFilter) validate() error {
+	for _, event := range f.Events {
+		switch event {
+		case stream.EventTransaction, stream.EventBlock, stream.EventReorg:
+		default:
+			return fmt.Errorf("unknown event type %q", event)
+		}
+	}
+	if f.MinValue != "" {
+		if _, err := utils.EtherToWei(f.MinValue); err != nil {
+			return fmt.Errorf("invalid min_value %q", f.MinValue)
+		}
+	}
+	return nil
+}
+
+// matches reports whether an event passes the filter
+func (f wsFilter) matches(event storage.StreamEvent) bool {
+	if len(f.Events) > 0 && !containsString(f.Events, event.Type) {
+		return false
+	}
+	if event.Type != stream.EventTransaction {
+		return true
+	}
+
+	var tx stream.TransactionEvent
+	if err := json.Unmarshal(event.Data, &tx); err != nil {
+		return false
+	}
+	if f.FailedOnly && tx.Status != storage.StatusFailed {
+		return false
+	}
+	if len(f.Tokens) > 0 {
+		asset := tx.Token
+		if asset == "" {
+			asset = "ETH"
+		}
+		if !containsFold(f.Tokens, asset) {
+			return false
+		}
+	}
+	if f.MinValue != "" {
+		min, _ := utils.EtherToWei(f.MinValue)
+		value, ok := new(big.Int).SetString(tx.ValueWei, 10)
+		if !ok {
+			value, _ = utils.EtherToWei(strconv.FormatFloat(tx.Value, 'f', -1, 64))
+		}
+		if value == nil || value.Cmp(min) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// wsClientMessage is a message sent by a WebSocket client
+type wsClientMessage struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	Addresses []string  `json:"addresses,omitempty"`
+	Filter    *wsFilter `json:"filter,omitempty"`
+}
+
+// wsServerMessage is a message sent to a WebSocket client
+type wsServerMessage struct {
+	Type        string          `json:"type"`
+	ID          string          `json:"id,omitempty"`
+	EventID     int64           `json:"event_id,omitempty"`
+	Event       string          `json:"event,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Addresses   []string        `json:"addresses,omitempty"`
+	Filter      *wsFilter       `json:"filter,omitempty"`
+	Dropped     int64           `json:"dropped,omitempty"`
+	LastEventID int64           `json:"last_event_id,omitempty"`
+	Policy      string          `json:"slow_consumer_policy,omitempty"`
+	Code        string          `json:"code,omitempty"`
+	Message     string          `json:"message,omitempty"`
+}
+
+// wsAddresses counts the sessions watching each address and remembers the
+// subscriptions sessions made, to the parser and to their tenant, so they
+// are undone once no session watches the address. A REST or tenant
+// subscription of the same address takes the subscription over.
+type wsAddresses struct {
+	p       parser.Parser
+	tenants storage.TenantStore
+	max     int
+
+	mu    sync.Mutex
+	refs  map[string]int
+	added map[string]bool
+
+	// tenantRefs and claimed count and remember the tenant subscriptions
+	// of sessions, keyed by tenantKey
+	tenantRefs map[string]int
+	claimed    map[string]bool
+}
+
+func newWSAddresses(p parser.Parser, tenants storage.TenantStore, max int) *wsAddresses {
+	if max <= 0 {
+		max = wsMaxMonitored
+	}
+	return &wsAddresses{
+		p:          p,
+		tenants:    tenants,
+		max:        max,
+		refs:       make(map[string]int),
+		added:      make(map[string]bool),
+		tenantRefs: make(map[string]int),
+		claimed:    make(map[string]bool),
+	}
+}
+
+// tenantKey keys the subscription of address by tenant
+func tenantKey(tenant, address string) string {
+	return tenant + " " + strings.ToLower(address)
+}
+
+// acquire references addresses for a session of tenant, first checking with
+// allowed the addresses the parser does not monitor yet and those tenant
+// does not watch yet. It returns the addresses added to the parser.
+func (a *wsAddresses) acquire(tenant string, addresses []string, allowed func(monitor, claim []string) *APIError) ([]string, *APIError) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var monitor, claim []string
+	for _, address := range addresses {
+		if !a.p.IsSubscribed(address) {
+			monitor = append(monitor, address)
+		}
+		if tenant != "" && !a.tenants.IsTenantAddress(tenant, address) {
+			claim = append(claim, address)
+		}
+	}
+	if apiErr := allowed(monitor, claim); apiErr != nil {
+		return nil, apiErr
+	}
+	if len(a.added)+len(monitor) > a.max {
+		return nil, &APIError{
+			Message: fmt.Sprintf("WebSocket clients may monitor at most %d addresses", a.max),
+			Code:    ErrCodeInvalidParameter,
+		}
+	}
+
+	var added []string
+	for _, address := range monitor {
+		if a.p.Subscribe(address) {
+			a.added[strings.ToLower(address)] = true
+			added = append(added, address)
+		}
+	}
+	for _, address := range claim {
+		if a.tenants.AddTenantAddress(tenant, address) {
+			a.claimed[tenantKey(tenant, address)] = true
+		}
+	}
+	for _, address := range addresses {
+		a.refs[strings.ToLower(address)]++
+		if tenant != "" {
+			a.tenantRefs[tenantKey(tenant, address)]++
+		}
+	}
+	return added, nil
+}
+
+// release drops the references of a session of tenant and undoes the
+// subscriptions sessions made once none watches the address
+func (a *wsAddresses) release(tenant string, addresses []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, address := range addresses {
+		address = strings.ToLower(address)
+		if tenant != "" {
+			key := tenantKey(tenant, address)
+			if a.tenantRefs[key]--; a.tenantRefs[key] <= 0 {
+				delete(a.tenantRefs, key)
+				if a.claimed[key] {
+					delete(a.claimed, key)
+					a.tenants.RemoveTenantAddress(tenant, address)
+				}
+			}
+		}
+
+		if a.refs[address]--; a.refs[address] > 0 {
+			continue
+		}
+		delete(a.refs, address)
+		if !a.added[address] {
+			continue
+		}
+		delete(a.added, address)
+		if a.tenants != nil && len(a.tenants.GetAddressTenants(address)) > 0 {
+			continue
+		}
+		if a.p.Unsubscribe(address) {
+			log.Info("Unsubscribed address after its last WebSocket client left", "address", address)
+		}
+	}
+}
+
+// disown hands the subscriptions sessions made to address over to a REST
+// or tenant subscription, so they outlive the sessions. It reports whether
+// the subscription of tenant, or the parser one without a tenant, only
+// existed for WebSocket sessions. A nil wsAddresses owns nothing.
+func (a *wsAddresses) disown(tenant, address string) bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	address = strings.ToLower(address)
+	added := a.added[address]
+	delete(a.added, address)
+	if tenant == "" {
+		return added
+	}
+	key := tenantKey(tenant, address)
+	claimed := a.claimed[key]
+	delete(a.claimed, key)
+	return claimed
+}
+
+// wsSession is the state of one WebSocket connection
+type wsSession struct {
+	conn *websocket.Conn
+	p    parser.Parser
+	sub  *stream.Subscription
+
+	// monitored is shared by the sessions of the handler
+	monitored *wsAddresses
+
+	// identity is the API key and scopes of the connection
+	identity wsIdentity
+	keys     *auth.Manager
+
+	// tenant owns the addresses of the connection, empty when every
+	// address may be watched
+	tenant string
+
+	mu        sync.Mutex
+	addresses []string
+	filter    wsFilter
+}
+
+// makeWebSocketHandler creates a handler for /ws which lets clients manage
+// their subscribed addresses and filters and receive live events over a
+// WebSocket connection. The protocol is documented in the Readme.
+func makeWebSocketHandler(p parser.Parser, hub *stream.Hub, cfg WebSocketConfig) http.HandlerFunc {
+	monitored := cfg.monitored
+	if monitored == nil {
+		monitored = newWSAddresses(p, cfg.Tenants, cfg.MaxMonitored)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.DebugContext(r.Context(), "Handling WebSocket request", "remote", r.RemoteAddr)
+
+		if !ValidateMethod(w, r, http.MethodGet) {
+			log.WarnContext(r.Context(), "Invalid method for WebSocket endpoint", "method", r.Method)
+			return
+		}
+		if !websocket.IsUpgrade(r) {
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: "WebSocket upgrade required",
+				Code:    ErrCodeInvalidParameter,
+			})
+			return
+		}
+
+		// A token given during the handshake is checked before upgrading;
+		// without one the client must authenticate with its first message
+		token := requestToken(r)
+		identity, ok := cfg.authenticate(token)
+		if token != "" && !ok {
+			log.WarnContext(r.Context(), "Rejected WebSocket client with an invalid token", "remote", r.RemoteAddr)
+			SendError(w, ErrUnauthorized)
+			return
+		}
+
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			log.WarnContext(r.Context(), "WebSocket handshake failed", "remote", r.RemoteAddr, "error", err)
+			SendError(w, &APIError{
+				Status:  http.StatusBadRequest,
+				Message: err.Error(),
+				Code:    ErrCodeInvalidParameter,
+			})
+			return
+		}
+		conn.MaxMessageSize = wsMessageLimit
+
+		if !ok {
+			if identity, ok = authenticate(conn, cfg); !ok {
+				log.WarnContext(r.Context(), "WebSocket client failed to authenticate", "remote", r.RemoteAddr)
+				return
+			}
+		}
+
+		sub, _, _ := hub.Subscribe(nil, 0, wsBufferSize)
+		sub.SetAddresses(nil)
+		sub.SetPolicy(cfg.SlowPolicy)
+		defer sub.Close()
+
+		session := &wsSession{conn: conn, p: p, sub: sub, monitored: monitored, identity: identity, keys: cfg.Keys}
+		if identity.key != nil && cfg.Tenants != nil {
+			session.tenant = auth.TenantOf(*identity.key)
+		}
+		defer session.close()
+		session.send(wsServerMessage{
+			Type:        wsTypeWelcome,
+			LastEventID: hub.LastEventID(),
+			Policy:      cfg.SlowPolicy.String(),
+		})
+
+		done := make(chan struct{})
+		defer close(done)
+		go session.writeEvents(done)
+
+		// Hijacked connections are not closed by the server shutdown, so
+		// the session ends itself when the request context is cancelled
+		go func() {
+			select {
+			case <-r.Context().Done():
+				conn.Close(websocket.CloseGoingAway, "server shutting down")
+			case <-done:
+			}
+		}()
+
+		session.readMessages()
+		log.InfoContext(r.Context(), "WebSocket client disconnected", "remote", r.RemoteAddr)
+	}
+}
+
+// requestToken returns the bearer token or the token query parameter
+func requestToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authenticate waits for the auth message of a connection that did not
+// authenticate during the handshake
+func authenticate(conn *websocket.Conn, cfg WebSocketConfig) (wsIdentity, bool) {
+	conn.SetReadDeadline(time.Now().Add(wsAuthWait))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		conn.Close(websocket.ClosePolicyViolation, "authentication required")
+		return wsIdentity{}, false
+	}
+
+	var msg wsClientMessage
+	if json.Unmarshal(data, &msg) != nil || msg.Type != wsTypeAuth || msg.Token == "" {
+		conn.Close(websocket.ClosePolicyViolation, "authentication failed")
+		return wsIdentity{}, false
+	}
+	identity, ok := cfg.authenticate(msg.Token)
+	if !ok {
+		conn.Close(websocket.ClosePolicyViolation, "authentication failed")
+	}
+	return identity, ok
+}
+
+// readMessages handles client messages until the connection ends
+func (s *wsSession) readMessages() {
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func() {
+		s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				s.conn.Close(websocket.CloseGoingAway, "")
+			}
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.sendError("", ErrCodeJSONParseError, "Invalid JSON message")
+			continue
+		}
+		s.handle(msg)
+	}
+}
+
+// handle answers one client message
+func (s *wsSession) handle(msg wsClientMessage) {
+	switch msg.Type {
+	case wsTypeSubscribe:
+		for _, address := range msg.Addresses {
+			if err := ValidateAddress(address); err != nil {
+				s.sendError(msg.ID, ErrCodeInvalidAddress, err.Message)
+				return
+			}
+		}
+		addresses, apiErr := s.addAddresses(msg.Addresses)
+		if apiErr != nil {
+			s.sendError(msg.ID, apiErr.Code, apiErr.Message)
+			return
+		}
+		s.send(wsServerMessage{Type: wsTypeAck, ID: msg.ID, Addresses: addresses})
+
+	case wsTypeUnsubscribe:
+		s.send(wsServerMessage{Type: wsTypeAck, ID: msg.ID, Addresses: s.removeAddresses(msg.Addresses)})
+
+	case wsTypeSetFilter:
+		filter := wsFilter{}
+		if msg.Filter != nil {
+			filter = *msg.Filter
+		}
+		if err := filter.validate(); err != nil {
+			s.sendError(msg.ID, ErrCodeInvalidParameter, err.Error())
+			return
+		}
+		s.mu.Lock()
+		s.filter = filter
+		s.mu.Unlock()
+		s.send(wsServerMessage{Type: wsTypeAck, ID: msg.ID, Filter: &filter})
+
+	case wsTypePing:
+		s.send(wsServerMessage{Type: wsTypePong, ID: msg.ID})
+
+	default:
+		s.sendError(msg.ID, ErrCodeInvalidParameter, fmt.Sprintf("Unknown message type %q", msg.Type))
+	}
+}
+
+// addAddresses subscribes the connection, and the parser when needed, to
+// addresses and returns the resulting list. Starting to monitor an address,
+// or adding it to the tenant of the connection, needs the subscribe scope.
+func (s *wsSession) addAddresses(addresses []string) ([]string, *APIError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := append([]string(nil), s.addresses...)
+	var added []string
+	for _, address := range addresses {
+		if !containsFold(current, address) {
+			current = append(current, address)
+			added = append(added, address)
+		}
+	}
+	if len(current) > wsMaxAddresses {
+		return nil, &APIError{
+			Message: fmt.Sprintf("At most %d addresses per connection", wsMaxAddresses),
+			Code:    ErrCodeInvalidParameter,
+		}
+	}
+
+	monitored, apiErr := s.monitored.acquire(s.tenant, added, func(monitor, claim []string) *APIError {
+		if len(monitor)+len(claim) > 0 && !auth.Allows(s.identity.scopes, auth.ScopeSubscribe) {
+			return &APIError{
+				Message: "Connection lacks the subscribe scope to monitor new addresses",
+				Code:    ErrCodeForbidden,
+			}
+		}
+		return nil
+	})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	for _, address := range monitored {
+		log.Info("Subscribed address for a WebSocket client", "address", address, "remote", s.conn.RemoteAddr())
+		if s.identity.key != nil {
+			s.keys.Record(*s.identity.key, "WS subscribe", address, s.conn.RemoteAddr().String(), http.StatusOK)
+		}
+	}
+	s.addresses = current
+	s.sub.SetAddresses(current)
+	return current, nil
+}
+
+// removeAddresses unsubscribes the connection from addresses. The parser
+// stops monitoring the addresses WebSocket clients added once no client
+// watches them.
+func (s *wsSession) removeAddresses(addresses []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var remaining, removed []string
+	for _, address := range s.addresses {
+		if containsFold(addresses, address) {
+			removed = append(removed, address)
+		} else {
+			remaining = append(remaining, address)
+		}
+	}
+	s.monitored.release(s.tenant, removed)
+	s.addresses = remaining
+	s.sub.SetAddresses(remaining)
+	return remaining
+}
+
+// close releases the addresses of the connection when it ends
+func (s *wsSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.monitored.release(s.tenant, s.addresses)
+	s.addresses = nil
+}
+
+// writeEvents forwards hub events and pings the client until done is closed
+// or the subscription is dropped for being too slow
+func (s *wsSession) writeEvents(done <-chan struct{}) {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case event, open := <-s.sub.Events():
+			if !open {
+				log.Warn("WebSocket client fell behind, closing", "remote", s.conn.RemoteAddr())
+				s.conn.Close(websocket.ClosePolicyViolation, "slow consumer")
+				return
+			}
+			if dropped := s.sub.TakeDropped(); dropped > 0 {
+				s.send(wsServerMessage{Type: wsTypeDropped, Dropped: dropped})
+			}
+
+			s.mu.Lock()
+			filter := s.filter
+			s.mu.Unlock()
+			if !filter.matches(event) {
+				continue
+			}
+			if !s.send(wsServerMessage{Type: wsTypeEvent, EventID: event.ID, Event: event.Type, Data: event.Data}) {
+				s.conn.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		case <-ping.C:
+			if err := s.conn.Ping(time.Now().Add(wsWriteWait)); err != nil {
+				s.conn.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// send writes a message and reports whether it was written in time
+func (s *wsSession) send(msg wsServerMessage) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Error("Failed to encode WebSocket message", "error", err)
+		return false
+	}
+	return s.conn.WriteMessage(websocket.OpText, data, time.Now().Add(wsWriteWait)) == nil
+}
+
+// sendError reports a failed client message
+func (s *wsSession) sendError(id, code, message string) {
+	s.send(wsServerMessage{Type: wsTypeError, ID: id, Code: code, Message: message})
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
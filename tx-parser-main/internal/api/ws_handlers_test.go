@@ -0,0 +1,324 @@
+package api
+
+import (
+	"blockchain-parser/internal/auth"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/stream"
+	"blockchain-parser/internal/websocket"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsDial connects to a test server running the WebSocket handler
+func wsDial(t *testing.T, server *httptest.Server, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), header)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	return conn
+}
+
+// wsSend writes a client message
+func wsSend(t *testing.T, conn *websocket.Conn, msg interface{}) {
+	t.Helper()
+	data, _ := json.Marshal(msg)
+	if err := conn.WriteMessage(websocket.OpText, data, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+}
+
+// wsRead reads the next server message
+func wsRead(t *testing.T, conn *websocket.Conn) wsServerMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	var msg wsServerMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("Invalid server message %s: %v", data, err)
+	}
+	return msg
+}
+
+func TestWebSocketProtocol(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	p := parser.NewParser(store, nil)
+	hub := stream.NewHub(store, 10)
+	server := httptest.NewServer(makeWebSocketHandler(p, hub, WebSocketConfig{Scope: auth.ScopeSubscribe}))
+	defer server.Close()
+
+	conn := wsDial(t, server, nil)
+	defer conn.Close(websocket.CloseNormal, "")
+
+	if welcome := wsRead(t, conn); welcome.Type != wsTypeWelcome || welcome.Policy != "disconnect" {
+		t.Fatalf("Expected a welcome message, got %+v", welcome)
+	}
+
+	wsSend(t, conn, wsClientMessage{Type: wsTypeSubscribe, ID: "1", Addresses: []string{testAddress}})
+	if ack := wsRead(t, conn); ack.Type != wsTypeAck || ack.ID != "1" || len(ack.Addresses) != 1 {
+		t.Fatalf("Expected a subscribe ack, got %+v", ack)
+	}
+	if !p.IsSubscribed(testAddress) {
+		t.Error("Expected the address to be subscribed in the parser")
+	}
+
+	wsSend(t, conn, wsClientMessage{Type: wsTypeSetFilter, ID: "2", Filter: &wsFilter{
+		Events:   []string{stream.EventTransaction},
+		MinValue: "1",
+	}})
+	if ack := wsRead(t, conn); ack.Type != wsTypeAck || ack.Filter == nil || ack.Filter.MinValue != "1" {
+		t.Fatalf("Expected a filter ack, got %+v", ack)
+	}
+
+	hub.PublishBlock(1, "0x1", 0, 0)
+	hub.PublishTransaction(storage.Transaction{Hash: "0xsmall", Value: 0.5, ToAddress: testAddress}, []string{testAddress})
+	hub.PublishTransaction(storage.Transaction{Hash: "0xother", Value: 5}, []string{"0x0000000000000000000000000000000000000001"})
+	hub.PublishTransaction(storage.Transaction{Hash: "0xlarge", Value: 2, ToAddress: testAddress}, []string{testAddress})
+
+	event := wsRead(t, conn)
+	var tx stream.TransactionEvent
+	json.Unmarshal(event.Data, &tx)
+	if event.Type != wsTypeEvent || event.Event != stream.EventTransaction || tx.Hash != "0xlarge" || event.EventID != 4 {
+		t.Errorf("Expected only the large transaction, got %+v", event)
+	}
+
+	wsSend(t, conn, wsClientMessage{Type: wsTypePing, ID: "3"})
+	if pong := wsRead(t, conn); pong.Type != wsTypePong || pong.ID != "3" {
+		t.Errorf("Expected a pong, got %+v", pong)
+	}
+
+	wsSend(t, conn, wsClientMessage{Type: wsTypeUnsubscribe, ID: "4", Addresses: []string{strings.ToLower(testAddress)}})
+	if ack := wsRead(t, conn); ack.Type != wsTypeAck || len(ack.Addresses) != 0 {
+		t.Errorf("Expected an empty address list, got %+v", ack)
+	}
+}
+
+func TestWebSocketReleasesAddresses(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	p := parser.NewParser(store, nil)
+	monitored := "0x0000000000000000000000000000000000000001"
+	p.Subscribe(monitored)
+	cfg := WebSocketConfig{Scope: auth.ScopeSubscribe, MaxMonitored: 1}
+	server := httptest.NewServer(makeWebSocketHandler(p, stream.NewHub(store, 10), cfg))
+	defer server.Close()
+
+	first, second := wsDial(t, server, nil), wsDial(t, server, nil)
+	defer second.Close(websocket.CloseNormal, "")
+	for _, conn := range []*websocket.Conn{first, second} {
+		wsRead(t, conn)
+		wsSend(t, conn, wsClientMessage{Type: wsTypeSubscribe, Addresses: []string{testAddress, monitored}})
+		if ack := wsRead(t, conn); ack.Type != wsTypeAck {
+			t.Fatalf("Expected a subscribe ack, got %+v", ack)
+		}
+	}
+
+	// The cap counts the addresses clients added to the parser
+	wsSend(t, second, wsClientMessage{Type: wsTypeSubscribe, Addresses: []string{"0x0000000000000000000000000000000000000002"}})
+	if msg := wsRead(t, second); msg.Type != wsTypeError || msg.Code != ErrCodeInvalidParameter {
+		t.Errorf("Expected the monitored address cap to be enforced, got %+v", msg)
+	}
+
+	wsSend(t, first, wsClientMessage{Type: wsTypeUnsubscribe, Addresses: []string{testAddress}})
+	wsRead(t, first)
+	if !p.IsSubscribed(testAddress) {
+		t.Fatal("Expected the address to stay monitored while another client watches it")
+	}
+	first.Close(websocket.CloseNormal, "")
+
+	wsSend(t, second, wsClientMessage{Type: wsTypeUnsubscribe, Addresses: []string{testAddress, monitored}})
+	wsRead(t, second)
+	if p.IsSubscribed(testAddress) {
+		t.Error("Expected the address to be unsubscribed once no client watches it")
+	}
+	if !p.IsSubscribed(monitored) {
+		t.Error("Expected an address monitored before the clients to stay monitored")
+	}
+}
+
+func TestWebSocketSubscriptionTakenOver(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	p := parser.NewParser(store, nil)
+	monitored := newWSAddresses(p, store, 0)
+	cfg := WebSocketConfig{Scope: auth.ScopeSubscribe, monitored: monitored}
+	server := httptest.NewServer(makeWebSocketHandler(p, stream.NewHub(store, 10), cfg))
+	defer server.Close()
+
+	conn := wsDial(t, server, nil)
+	wsRead(t, conn)
+	wsSend(t, conn, wsClientMessage{Type: wsTypeSubscribe, Addresses: []string{testAddress}})
+	wsRead(t, conn)
+
+	// A REST subscription of the address takes it over from the client
+	rec := httptest.NewRecorder()
+	subscribe := makeSubscribeHandler(p, nil, nil, monitored)
+	subscribe(rec, httptest.NewRequest(http.MethodPost, "/subscribe?address="+testAddress, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the REST subscription to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Wait for the server to release the addresses of the closed session
+	conn.Close(websocket.CloseNormal, "")
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		monitored.mu.Lock()
+		released := len(monitored.refs) == 0
+		monitored.mu.Unlock()
+		if released {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the session to release its addresses")
+		}
+	}
+	if !p.IsSubscribed(testAddress) {
+		t.Error("Expected the address to stay subscribed after the client left")
+	}
+}
+
+func TestWebSocketTenantClaims(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	p := parser.NewParser(store, nil)
+	monitored := newWSAddresses(p, store, 0)
+	allow := func(monitor, claim []string) *APIError { return nil }
+	other := "0x0000000000000000000000000000000000000002"
+
+	monitored.acquire("payments", []string{testAddress, other}, allow)
+	if !store.IsTenantAddress("payments", testAddress) {
+		t.Fatal("Expected the session to claim the address for its tenant")
+	}
+
+	// The tenant subscribes one address itself, which keeps it
+	if apiErr := subscribeAddress(p, store, monitored, "payments", other); apiErr != nil {
+		t.Fatalf("Expected the tenant to take the subscription over, got %+v", apiErr)
+	}
+
+	monitored.release("payments", []string{testAddress, other})
+	if store.IsTenantAddress("payments", testAddress) || p.IsSubscribed(testAddress) {
+		t.Error("Expected the claim of the session to be undone")
+	}
+	if !store.IsTenantAddress("payments", other) || !p.IsSubscribed(other) {
+		t.Error("Expected the subscription taken over by the tenant to stay")
+	}
+}
+
+func TestWebSocketErrors(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	server := httptest.NewServer(makeWebSocketHandler(parser.NewParser(store, nil), stream.NewHub(store, 10), WebSocketConfig{}))
+	defer server.Close()
+
+	conn := wsDial(t, server, nil)
+	defer conn.Close(websocket.CloseNormal, "")
+	wsRead(t, conn)
+
+	testCases := []struct {
+		name     string
+		message  string
+		wantCode string
+	}{
+		{"invalid json", "{", ErrCodeJSONParseError},
+		{"unknown type", `{"type":"dance","id":"x"}`, ErrCodeInvalidParameter},
+		{"invalid address", `{"type":"subscribe","addresses":["0x1"]}`, ErrCodeInvalidAddress},
+		{"invalid event filter", `{"type":"set_filter","filter":{"events":["mempool"]}}`, ErrCodeInvalidParameter},
+		{"invalid min value", `{"type":"set_filter","filter":{"min_value":"abc"}}`, ErrCodeInvalidParameter},
+		{"new address with read scope", `{"type":"subscribe","addresses":["` + testAddress + `"]}`, ErrCodeForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn.WriteMessage(websocket.OpText, []byte(tc.message), time.Now().Add(time.Second))
+			if msg := wsRead(t, conn); msg.Type != wsTypeError || msg.Code != tc.wantCode {
+				t.Errorf("Expected error %s, got %+v", tc.wantCode, msg)
+			}
+		})
+	}
+}
+
+func TestWebSocketAuth(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	cfg := WebSocketConfig{Tokens: []string{"secret"}}
+	server := httptest.NewServer(makeWebSocketHandler(parser.NewParser(store, nil), stream.NewHub(store, 10), cfg))
+	defer server.Close()
+
+	// Invalid handshake tokens are rejected before upgrading
+	if _, resp, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?token=wrong", nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong token, got %v", err)
+	}
+
+	header := http.Header{"Authorization": []string{"Bearer secret"}}
+	conn := wsDial(t, server, header)
+	if msg := wsRead(t, conn); msg.Type != wsTypeWelcome {
+		t.Errorf("Expected a welcome with a bearer token, got %+v", msg)
+	}
+	conn.Close(websocket.CloseNormal, "")
+
+	// Without a handshake token the first message must authenticate
+	conn = wsDial(t, server, nil)
+	wsSend(t, conn, wsClientMessage{Type: wsTypeAuth, Token: "secret"})
+	if msg := wsRead(t, conn); msg.Type != wsTypeWelcome {
+		t.Errorf("Expected a welcome after the auth message, got %+v", msg)
+	}
+	conn.Close(websocket.CloseNormal, "")
+
+	conn = wsDial(t, server, nil)
+	defer conn.Close(websocket.CloseNormal, "")
+	wsSend(t, conn, wsClientMessage{Type: wsTypeSubscribe, Addresses: []string{testAddress}})
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Error("Expected the unauthenticated connection to be closed")
+	} else if closeErr, ok := err.(*websocket.CloseError); !ok || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Errorf("Expected close code %d, got %v", websocket.ClosePolicyViolation, err)
+	}
+}
+
+func TestWebSocketDroppedEvents(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	hub := stream.NewHub(store, 1000)
+	server := httptest.NewServer(makeWebSocketHandler(parser.NewParser(store, nil), hub, WebSocketConfig{SlowPolicy: stream.Drop}))
+	defer server.Close()
+
+	conn := wsDial(t, server, nil)
+	defer conn.Close(websocket.CloseNormal, "")
+	if welcome := wsRead(t, conn); welcome.Policy != "drop" {
+		t.Fatalf("Expected the drop policy, got %+v", welcome)
+	}
+
+	// The client does not read, so the buffer overflows
+	for i := int64(1); i <= wsBufferSize*4; i++ {
+		hub.PublishBlock(i, "", 0, 0)
+	}
+	if hub.Subscribers() != 1 {
+		t.Fatal("Expected the slow client to stay connected")
+	}
+
+	for i := 0; i < wsBufferSize*4; i++ {
+		if msg := wsRead(t, conn); msg.Type == wsTypeDropped {
+			if msg.Dropped == 0 {
+				t.Error("Expected a dropped count")
+			}
+			return
+		}
+	}
+	t.Error("Expected a dropped message")
+}
+
+func TestWebSocketRequiresUpgrade(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	handler := makeWebSocketHandler(parser.NewParser(store, nil), stream.NewHub(store, 10), WebSocketConfig{})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/ws", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/ws", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+}
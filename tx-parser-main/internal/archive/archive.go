@@ -0,0 +1,455 @@
+// Package archive exports and imports the full parser state as a versioned
+// newline-delimited JSON stream, so state can move between environments or
+// storage backends without re-scanning the chain.
+package archive
+
+import (
+	"blockchain-parser/internal/logger"
+	"blockchain-parser/internal/storage"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// log is the logger of archive export and import
+var log = logger.Component("archive")
+
+// FormatVersion is the archive format written by Export
+const FormatVersion = 1
+
+// Record types written to the archive, one JSON object per line
+const (
+	RecordHeader      = "header"
+	RecordSubscriber  = "subscriber"
+	RecordTransaction = "transaction"
+	RecordCheckpoint  = "checkpoint"
+	RecordRetention   = "retention"
+	RecordBalance     = "balance"
+)
+
+// maxLineSize bounds a single archive line when importing
+const maxLineSize = 1 << 20
+
+// Store is the storage surface needed to export and import state
+type Store interface {
+	storage.StorageInterface
+	storage.RetentionStore
+	storage.TransactionScanner
+	storage.LabelStore
+	storage.CheckpointStore
+	storage.TenantStore
+	storage.EventLog
+	storage.BalanceStore
+}
+
+// Section exports and imports settings owned outside the storage, such as
+// notification configuration. Each section writes records of its own type.
+type Section interface {
+	// Name returns the record type used for the section
+	Name() string
+
+	// Export calls emit once per record
+	Export(emit func(data interface{}) error) error
+
+	// Import applies a single record previously written by Export
+	Import(data json.RawMessage) error
+}
+
+// Stats counts the records written or read per record type
+type Stats map[string]int
+
+// record is a single archive line
+type record struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type header struct {
+	Version   int    `json:"version"`
+	CreatedAt string `json:"created_at"`
+}
+
+type subscriberRecord struct {
+	Address string   `json:"address"`
+	Label   string   `json:"label,omitempty"`
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+type transactionRecord struct {
+	Hash        string  `json:"hash"`
+	Index       int     `json:"index"`
+	From        string  `json:"from"`
+	To          string  `json:"to,omitempty"`
+	Value       float64 `json:"value"`
+	ValueWei    string  `json:"value_wei,omitempty"`
+	FeeWei      string  `json:"fee_wei,omitempty"`
+	Status      string  `json:"status,omitempty"`
+	Token       string  `json:"token,omitempty"`
+	BlockNumber int64   `json:"block_number"`
+	Timestamp   int64   `json:"timestamp"`
+}
+
+type checkpointRecord struct {
+	Name  string `json:"name"`
+	Block int64  `json:"block,omitempty"`
+
+	// Value holds named checkpoints of background jobs
+	Value int64 `json:"value,omitempty"`
+}
+
+type retentionRecord struct {
+	Address       string `json:"address"`
+	MaxAge        string `json:"max_age"`
+	MaxBlockDepth int64  `json:"max_block_depth"`
+	MaxPerAddress int    `json:"max_per_address"`
+}
+
+// balanceRecord holds the balance checkpoint of pruned transactions
+type balanceRecord struct {
+	Address  string            `json:"address"`
+	Block    int64             `json:"block"`
+	Balances map[string]string `json:"balances"`
+}
+
+// currentBlockCheckpoint names the checkpoint holding the last processed block
+const currentBlockCheckpoint = "current_block"
+
+// lastEventCheckpoint names the checkpoint holding the last stream event ID,
+// so IDs continue after a restart instead of being reused
+const lastEventCheckpoint = "last_event_id"
+
+func toTransactionRecord(tx storage.Transaction) transactionRecord {
+	return transactionRecord{
+		Hash:        tx.Hash,
+		Index:       tx.Index,
+		From:        tx.FromAddress,
+		To:          tx.ToAddress,
+		Value:       tx.Value,
+		ValueWei:    tx.ValueWei,
+		FeeWei:      tx.FeeWei,
+		Status:      tx.Status,
+		Token:       tx.Token,
+		BlockNumber: tx.BlockNumber,
+		Timestamp:   tx.Timestamp,
+	}
+}
+
+func (r transactionRecord) toTransaction() storage.Transaction {
+	return storage.Transaction{
+		Hash:        r.Hash,
+		Index:       r.Index,
+		FromAddress: r.From,
+		ToAddress:   r.To,
+		Value:       r.Value,
+		ValueWei:    r.ValueWei,
+		FeeWei:      r.FeeWei,
+		Status:      r.Status,
+		Token:       r.Token,
+		BlockNumber: r.BlockNumber,
+		Timestamp:   r.Timestamp,
+	}
+}
+
+// encoder writes archive records and counts them
+type encoder struct {
+	enc   *json.Encoder
+	stats Stats
+}
+
+func (e *encoder) write(recordType string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding %s record: %v", recordType, err)
+	}
+	if err := e.enc.Encode(record{Type: recordType, Data: raw}); err != nil {
+		return fmt.Errorf("error writing %s record: %v", recordType, err)
+	}
+	e.stats[recordType]++
+	return nil
+}
+
+// Export streams the store state and every section to w
+func Export(w io.Writer, store Store, sections ...Section) (Stats, error) {
+	e := &encoder{enc: json.NewEncoder(w), stats: Stats{}}
+
+	if err := e.write(RecordHeader, header{
+		Version:   FormatVersion,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return e.stats, err
+	}
+
+	if err := e.write(RecordCheckpoint, checkpointRecord{
+		Name:  currentBlockCheckpoint,
+		Block: store.GetCurrentBlock(),
+	}); err != nil {
+		return e.stats, err
+	}
+	if err := e.write(RecordCheckpoint, checkpointRecord{
+		Name:  lastEventCheckpoint,
+		Value: store.LastEventID(),
+	}); err != nil {
+		return e.stats, err
+	}
+	for name, value := range store.GetCheckpoints() {
+		if err := e.write(RecordCheckpoint, checkpointRecord{Name: name, Value: value}); err != nil {
+			return e.stats, err
+		}
+	}
+
+	for _, address := range store.GetSubscribers() {
+		if err := e.write(RecordSubscriber, subscriberRecord{
+			Address: address,
+			Label:   store.GetLabel(address),
+			Tenants: store.GetAddressTenants(address),
+		}); err != nil {
+			return e.stats, err
+		}
+	}
+
+	for address, policy := range store.GetRetentionPolicies() {
+		if err := e.write(RecordRetention, retentionRecord{
+			Address:       address,
+			MaxAge:        policy.MaxAge.String(),
+			MaxBlockDepth: policy.MaxBlockDepth,
+			MaxPerAddress: policy.MaxPerAddress,
+		}); err != nil {
+			return e.stats, err
+		}
+	}
+
+	for address, checkpoint := range store.BalanceCheckpoints() {
+		balances := make(map[string]string, len(checkpoint.Balances))
+		for asset, balance := range checkpoint.Balances {
+			balances[asset] = balance.String()
+		}
+		if err := e.write(RecordBalance, balanceRecord{
+			Address:  address,
+			Block:    checkpoint.Block,
+			Balances: balances,
+		}); err != nil {
+			return e.stats, err
+		}
+	}
+
+	for _, section := range sections {
+		name := section.Name()
+		if err := section.Export(func(data interface{}) error {
+			return e.write(name, data)
+		}); err != nil {
+			return e.stats, fmt.Errorf("error exporting %s: %v", name, err)
+		}
+	}
+
+	err := store.ScanTransactions("", func(tx storage.Transaction) error {
+		return e.write(RecordTransaction, toTransactionRecord(tx))
+	})
+	if err != nil {
+		return e.stats, err
+	}
+
+	log.Info("Exported archive", "stats", e.stats)
+	return e.stats, nil
+}
+
+// Import reads an archive produced by Export into store. Importing the same
+// archive twice is safe because transaction storage is idempotent.
+func Import(r io.Reader, store Store, sections ...Section) (Stats, error) {
+	stats := Stats{}
+	bySection := make(map[string]Section, len(sections))
+	for _, section := range sections {
+		bySection[section.Name()] = section
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return stats, fmt.Errorf("line %d: invalid record: %v", line, err)
+		}
+
+		if line == 1 {
+			if err := checkHeader(rec); err != nil {
+				return stats, err
+			}
+			stats[RecordHeader]++
+			continue
+		}
+
+		if err := importRecord(store, bySection, rec); err != nil {
+			return stats, fmt.Errorf("line %d: %v", line, err)
+		}
+		stats[rec.Type]++
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("error reading archive: %v", err)
+	}
+	if line == 0 {
+		return stats, fmt.Errorf("archive is empty")
+	}
+
+	log.Info("Imported archive", "stats", stats)
+	return stats, nil
+}
+
+// SaveFile exports the state to path. The archive is written to a
+// temporary file first, so an interrupted save keeps the previous state.
+func SaveFile(path string, store Store, sections ...Section) (Stats, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("error creating state file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	stats, err := Export(writer, store, sections...)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return stats, fmt.Errorf("error writing state file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return stats, fmt.Errorf("error replacing state file: %v", err)
+	}
+	return stats, nil
+}
+
+// LoadFile imports the state saved by SaveFile. A missing file is not an
+// error and returns nil stats, so the first start begins empty.
+func LoadFile(path string, store Store, sections ...Section) (Stats, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening state file: %v", err)
+	}
+	defer file.Close()
+	return Import(file, store, sections...)
+}
+
+// checkHeader verifies the first record is a header of a supported version
+func checkHeader(rec record) error {
+	if rec.Type != RecordHeader {
+		return fmt.Errorf("archive must start with a %s record, got %q", RecordHeader, rec.Type)
+	}
+	var h header
+	if err := json.Unmarshal(rec.Data, &h); err != nil {
+		return fmt.Errorf("invalid header: %v", err)
+	}
+	if h.Version < 1 || h.Version > FormatVersion {
+		return fmt.Errorf("unsupported archive version %d", h.Version)
+	}
+	return nil
+}
+
+// importRecord applies a single non-header record
+func importRecord(store Store, sections map[string]Section, rec record) error {
+	switch rec.Type {
+	case RecordSubscriber:
+		var sub subscriberRecord
+		if err := json.Unmarshal(rec.Data, &sub); err != nil {
+			return fmt.Errorf("invalid subscriber: %v", err)
+		}
+		if !store.AddSubscriber(sub.Address) {
+			return fmt.Errorf("invalid subscriber address %q", sub.Address)
+		}
+		for _, tenant := range sub.Tenants {
+			store.AddTenantAddress(tenant, sub.Address)
+		}
+		if sub.Label != "" {
+			store.SetLabel(sub.Address, sub.Label)
+		}
+
+	case RecordTransaction:
+		var tx transactionRecord
+		if err := json.Unmarshal(rec.Data, &tx); err != nil {
+			return fmt.Errorf("invalid transaction: %v", err)
+		}
+		store.StoreTransaction(tx.toTransaction())
+
+	case RecordCheckpoint:
+		var cp checkpointRecord
+		if err := json.Unmarshal(rec.Data, &cp); err != nil {
+			return fmt.Errorf("invalid checkpoint: %v", err)
+		}
+		// Never move the checkpoint backwards on a running instance
+		if cp.Name == currentBlockCheckpoint {
+			if cp.Block > store.GetCurrentBlock() {
+				store.UpdateCurrentBlock(cp.Block)
+			}
+			break
+		}
+		if cp.Name == lastEventCheckpoint {
+			store.RestoreEventID(cp.Value)
+			break
+		}
+		if current, ok := store.GetCheckpoint(cp.Name); !ok || cp.Value > current {
+			store.SetCheckpoint(cp.Name, cp.Value)
+		}
+
+	case RecordRetention:
+		var rr retentionRecord
+		if err := json.Unmarshal(rec.Data, &rr); err != nil {
+			return fmt.Errorf("invalid retention policy: %v", err)
+		}
+		maxAge, err := time.ParseDuration(rr.MaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid retention max_age %q: %v", rr.MaxAge, err)
+		}
+		store.SetRetentionPolicy(rr.Address, storage.RetentionPolicy{
+			MaxAge:        maxAge,
+			MaxBlockDepth: rr.MaxBlockDepth,
+			MaxPerAddress: rr.MaxPerAddress,
+		})
+
+	case RecordBalance:
+		var br balanceRecord
+		if err := json.Unmarshal(rec.Data, &br); err != nil {
+			return fmt.Errorf("invalid balance checkpoint: %v", err)
+		}
+		checkpoint := storage.BalanceCheckpoint{
+			Block:    br.Block,
+			Balances: make(map[string]*big.Int, len(br.Balances)),
+		}
+		for asset, value := range br.Balances {
+			balance, ok := new(big.Int).SetString(value, 10)
+			if !ok {
+				return fmt.Errorf("invalid balance %q for %s", value, br.Address)
+			}
+			checkpoint.Balances[asset] = balance
+		}
+		store.SetBalanceCheckpoint(br.Address, checkpoint)
+
+	default:
+		section, ok := sections[rec.Type]
+		if !ok {
+			log.Warn("Skipping unknown archive record type", "type", rec.Type)
+			return nil
+		}
+		if err := section.Import(rec.Data); err != nil {
+			return fmt.Errorf("error importing %s: %v", rec.Type, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package archive
+
+import (
+	"blockchain-parser/internal/storage"
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testSender   = "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	testReceiver = "0xdd93e92dc32d0b2f51430b0e6da29bdd01af68d6"
+)
+
+// testSection is a Section holding plain strings
+type testSection struct {
+	values []string
+}
+
+func (s *testSection) Name() string { return "test_setting" }
+
+func (s *testSection) Export(emit func(data interface{}) error) error {
+	for _, v := range s.values {
+		if err := emit(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *testSection) Import(data json.RawMessage) error {
+	var v string
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s.values = append(s.values, v)
+	return nil
+}
+
+func newPopulatedStore() *storage.MemoryStorage {
+	store := storage.NewMemoryStorage()
+	store.AddSubscriber(testSender)
+	store.AddSubscriber(testReceiver)
+	store.SetLabel(testSender, "Treasury")
+	store.AddTenantAddress("payments", testSender)
+	store.StoreTransaction(storage.Transaction{
+		Hash:        "0xaaa",
+		FromAddress: testSender,
+		ToAddress:   testReceiver,
+		Value:       1.5,
+		BlockNumber: 10,
+		Timestamp:   1000,
+	})
+	store.StoreTransaction(storage.Transaction{
+		Hash:        "0xbbb",
+		FromAddress: testReceiver,
+		ToAddress:   "0x0000000000000000000000000000000000000001",
+		Value:       0.5,
+		BlockNumber: 11,
+		Timestamp:   1010,
+	})
+	store.UpdateCurrentBlock(11)
+	store.SetCheckpoint("summary:daily", 86400)
+	store.SetRetentionPolicy(testSender, storage.RetentionPolicy{MaxAge: time.Hour})
+	store.AppendEvent(storage.StreamEvent{Type: "block"}, 10)
+	store.SetBalanceCheckpoint(testSender, storage.BalanceCheckpoint{
+		Block:    9,
+		Balances: map[string]*big.Int{storage.NativeAsset: big.NewInt(-2500)},
+	})
+	return store
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source := newPopulatedStore()
+	sourceSection := &testSection{values: []string{"a", "b"}}
+
+	var buf bytes.Buffer
+	stats, err := Export(&buf, source, sourceSection)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if stats[RecordTransaction] != 2 {
+		t.Errorf("Expected 2 distinct transactions exported, got %d", stats[RecordTransaction])
+	}
+
+	target := storage.NewMemoryStorage()
+	targetSection := &testSection{}
+	if _, err := Import(bytes.NewReader(buf.Bytes()), target, targetSection); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	if target.GetCurrentBlock() != 11 {
+		t.Errorf("Expected current block 11, got %d", target.GetCurrentBlock())
+	}
+	if id := target.LastEventID(); id != source.LastEventID() || id == 0 {
+		t.Errorf("Expected the stream event ID %d to be imported, got %d", source.LastEventID(), id)
+	}
+	if value, ok := target.GetCheckpoint("summary:daily"); !ok || value != 86400 {
+		t.Errorf("Expected named checkpoint to be imported, got %d (%v)", value, ok)
+	}
+	if len(target.GetSubscribers()) != 2 {
+		t.Errorf("Expected 2 subscribers, got %d", len(target.GetSubscribers()))
+	}
+	if label := target.GetLabel(testSender); label != "Treasury" {
+		t.Errorf("Expected subscriber label to be imported, got %q", label)
+	}
+	if !target.IsTenantAddress("payments", testSender) {
+		t.Error("Expected the tenant subscription to be imported")
+	}
+	if got := len(target.GetTransactions(testReceiver)); got != 2 {
+		t.Errorf("Expected 2 transactions for receiver, got %d", got)
+	}
+	if target.GetTransactions(testSender)[0].Direction != storage.DirectionOut {
+		t.Error("Expected direction to be recomputed on import")
+	}
+	if policy := target.GetRetentionPolicies()[testSender]; policy.MaxAge != time.Hour {
+		t.Errorf("Expected retention policy to be imported, got %+v", policy)
+	}
+	if checkpoint := target.BalanceCheckpoints()[testSender]; checkpoint.Block != 9 ||
+		checkpoint.Balances[storage.NativeAsset].Cmp(big.NewInt(-2500)) != 0 {
+		t.Errorf("Expected the balance checkpoint to be imported, got %+v", checkpoint)
+	}
+	if len(targetSection.values) != 2 {
+		t.Errorf("Expected 2 section records imported, got %d", len(targetSection.values))
+	}
+
+	// Importing twice must not duplicate transactions
+	if _, err := Import(bytes.NewReader(buf.Bytes()), target); err != nil {
+		t.Fatalf("Second import failed: %v", err)
+	}
+	if got := len(target.GetTransactions(testReceiver)); got != 2 {
+		t.Errorf("Expected 2 transactions after re-import, got %d", got)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	testCases := []struct {
+		name    string
+		archive string
+	}{
+		{
+			name:    "empty archive",
+			archive: "",
+		},
+		{
+			name:    "missing header",
+			archive: `{"type":"subscriber","data":{"address":"` + testSender + `"}}`,
+		},
+		{
+			name:    "unsupported version",
+			archive: `{"type":"header","data":{"version":99}}`,
+		},
+		{
+			name: "invalid record",
+			archive: `{"type":"header","data":{"version":1}}
+not json`,
+		},
+		{
+			name: "invalid subscriber",
+			archive: `{"type":"header","data":{"version":1}}
+{"type":"subscriber","data":{"address":"0x123"}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Import(strings.NewReader(tc.archive), storage.NewMemoryStorage())
+			if err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestImportSkipsUnknownRecords(t *testing.T) {
+	archive := `{"type":"header","data":{"version":1}}
+{"type":"from_the_future","data":{}}
+{"type":"checkpoint","data":{"name":"current_block","block":5}}`
+
+	store := storage.NewMemoryStorage()
+	if _, err := Import(strings.NewReader(archive), store); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if store.GetCurrentBlock() != 5 {
+		t.Errorf("Expected current block 5, got %d", store.GetCurrentBlock())
+	}
+}
+
+func TestSaveAndLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.ndjson")
+
+	target := storage.NewMemoryStorage()
+	if stats, err := LoadFile(path, target); err != nil || stats != nil {
+		t.Fatalf("Expected a missing state file to be skipped, got %v %v", stats, err)
+	}
+
+	if _, err := SaveFile(path, newPopulatedStore()); err != nil {
+		t.Fatalf("SaveFile failed: %v", err)
+	}
+	if _, err := LoadFile(path, target); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if target.GetCurrentBlock() != 11 || len(target.GetSubscribers()) != 2 {
+		t.Errorf("Expected the saved state, got block %d and %v", target.GetCurrentBlock(), target.GetSubscribers())
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,324 @@
+// Package auth manages API keys, their scopes and the audit log of what was
+// done with each key. Secrets are only shown when a key is created; the
+// storage keeps their SHA-256 hash.
+package auth
+
+import (
+	"blockchain-parser/internal/logger"
+	"blockchain-parser/internal/storage"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// log is the logger of API key management
+var log = logger.Component("auth")
+
+// Scope is a permission granted to an API key
+type Scope string
+
+// Scopes from least to most privileged. Each scope includes the ones before.
+const (
+	// ScopeRead allows reading blocks, transactions and live events
+	ScopeRead Scope = "read"
+	// ScopeSubscribe also allows subscribing addresses
+	ScopeSubscribe Scope = "subscribe"
+	// ScopeAdmin also allows every /admin endpoint, including key management
+	ScopeAdmin Scope = "admin"
+)
+
+// level orders scopes so a higher scope includes the lower ones
+var level = map[Scope]int{ScopeRead: 1, ScopeSubscribe: 2, ScopeAdmin: 3}
+
+// ParseScope validates a scope name
+func ParseScope(value string) (Scope, error) {
+	scope := Scope(strings.ToLower(strings.TrimSpace(value)))
+	if _, ok := level[scope]; !ok {
+		return "", fmt.Errorf("unknown scope %q", value)
+	}
+	return scope, nil
+}
+
+// Allows reports whether a key with scopes may act with the required scope
+func Allows(scopes []string, required Scope) bool {
+	for _, scope := range scopes {
+		if level[Scope(scope)] >= level[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultTenant owns keys created without a tenant
+const DefaultTenant = "default"
+
+// tenantPattern restricts tenant names to simple identifiers
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidateTenant checks a tenant name
+func ValidateTenant(tenant string) error {
+	if !tenantPattern.MatchString(tenant) {
+		return fmt.Errorf("invalid tenant %q: use up to 64 lowercase letters, digits, - and _", tenant)
+	}
+	return nil
+}
+
+// TenantOf returns the tenant whose data a key may see. Admin keys see every
+// tenant and get an empty tenant.
+func TenantOf(key storage.APIKey) string {
+	if Allows(key.Scopes, ScopeAdmin) {
+		return ""
+	}
+	return key.Tenant
+}
+
+// Defaults
+const (
+	// DefaultAuditHistory is the number of audit entries kept
+	DefaultAuditHistory = 10000
+
+	// secretPrefix makes keys recognisable, for example by secret scanners
+	secretPrefix = "txp_"
+
+	// lastUsedResolution limits how often the last use of a key is stored
+	lastUsedResolution = time.Minute
+)
+
+var (
+	// ErrNotFound is returned for unknown key IDs
+	ErrNotFound = errors.New("api key not found")
+
+	// ErrInvalidKey is returned for keys without a name or scope
+	ErrInvalidKey = errors.New("api key needs a name and at least one scope")
+)
+
+// HashSecret returns the stored form of a secret
+func HashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Manager creates, checks and revokes API keys and records their actions
+type Manager struct {
+	store        storage.APIKeyStore
+	auditHistory int
+	now          func() time.Time
+}
+
+// NewManager creates a manager keeping keys and audit entries in store
+func NewManager(store storage.APIKeyStore) *Manager {
+	return &Manager{
+		store:        store,
+		auditHistory: DefaultAuditHistory,
+		now:          time.Now,
+	}
+}
+
+// Create generates a key of tenant, DefaultTenant when empty, and returns
+// it with its secret, which cannot be recovered later
+func (m *Manager) Create(name, tenant string, scopes []Scope) (storage.APIKey, string, error) {
+	secret := secretPrefix + randomHex(24)
+	key, err := m.Import(name, tenant, secret, scopes)
+	return key, secret, err
+}
+
+// Import stores a key with a known secret, such as a bootstrap key from the
+// environment. Importing the same secret again returns the existing key.
+func (m *Manager) Import(name, tenant, secret string, scopes []Scope) (storage.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(scopes) == 0 || secret == "" {
+		return storage.APIKey{}, ErrInvalidKey
+	}
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	if err := ValidateTenant(tenant); err != nil {
+		return storage.APIKey{}, err
+	}
+
+	hash := HashSecret(secret)
+	if existing, ok := m.store.GetAPIKeyByHash(hash); ok {
+		return existing, nil
+	}
+
+	key := storage.APIKey{
+		ID:        randomHex(8),
+		Name:      name,
+		Hash:      hash,
+		Tenant:    tenant,
+		CreatedAt: m.now(),
+	}
+	for _, scope := range scopes {
+		if _, ok := level[scope]; !ok {
+			return storage.APIKey{}, fmt.Errorf("unknown scope %q", scope)
+		}
+		key.Scopes = append(key.Scopes, string(scope))
+	}
+	m.store.SaveAPIKey(key)
+	log.Info("Created API key", "key", key.ID, "name", key.Name, "tenant", key.Tenant, "scopes", key.Scopes)
+	return key, nil
+}
+
+// Authenticate returns the active key matching secret
+func (m *Manager) Authenticate(secret string) (storage.APIKey, bool) {
+	if secret == "" {
+		return storage.APIKey{}, false
+	}
+	key, ok := m.store.GetAPIKeyByHash(HashSecret(secret))
+	if !ok || key.Revoked {
+		return storage.APIKey{}, false
+	}
+
+	if now := m.now(); now.Sub(key.LastUsedAt) >= lastUsedResolution {
+		key.LastUsedAt = now
+		m.store.TouchAPIKey(key.ID, now)
+	}
+	return key, true
+}
+
+// Revoke disables a key. Revoked keys stay listed for the audit log.
+func (m *Manager) Revoke(id string) error {
+	key, ok := m.store.GetAPIKey(id)
+	if !ok || !m.store.RevokeAPIKey(id) {
+		return ErrNotFound
+	}
+	log.Info("Revoked API key", "key", key.ID, "name", key.Name)
+	return nil
+}
+
+// Keys returns every key
+func (m *Manager) Keys() []storage.APIKey {
+	return m.store.GetAPIKeys()
+}
+
+// HasKeys reports whether any active key exists
+func (m *Manager) HasKeys() bool {
+	for _, key := range m.store.GetAPIKeys() {
+		if !key.Revoked {
+			return true
+		}
+	}
+	return false
+}
+
+// Record appends an action taken with key to the audit log
+func (m *Manager) Record(key storage.APIKey, action, address, remoteAddr string, status int) {
+	m.store.AppendAudit(storage.AuditEntry{
+		Time:       m.now(),
+		KeyID:      key.ID,
+		KeyName:    key.Name,
+		Tenant:     key.Tenant,
+		Action:     action,
+		Address:    address,
+		RemoteAddr: remoteAddr,
+		Status:     status,
+	}, m.auditHistory)
+	log.Info("Audit", "key", key.ID, "name", key.Name, "action", action, "address", address, "remote", remoteAddr, "status", status)
+}
+
+// Audit returns the newest audit entries, of one key when keyID is set
+func (m *Manager) Audit(keyID string, limit int) []storage.AuditEntry {
+	return m.store.GetAudit(keyID, limit)
+}
+
+type contextKey struct{}
+
+// WithKey returns a context carrying the authenticated key
+func WithKey(ctx context.Context, key storage.APIKey) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// KeyFrom returns the authenticated key of a request context
+func KeyFrom(ctx context.Context) (storage.APIKey, bool) {
+	key, ok := ctx.Value(contextKey{}).(storage.APIKey)
+	return key, ok
+}
+
+// KeySettings exposes the API keys as an archive section. Only hashes are
+// exported, so restored keys keep working with their original secrets.
+type KeySettings struct {
+	manager *Manager
+}
+
+type keySetting struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	Tenant    string    `json:"tenant,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Revoked   bool      `json:"revoked,omitempty"`
+}
+
+// Settings returns the archive section holding the API keys
+func (m *Manager) Settings() *KeySettings {
+	return &KeySettings{manager: m}
+}
+
+// Name returns the archive record type
+func (k *KeySettings) Name() string {
+	return "api_key"
+}
+
+// Export emits one record per key
+func (k *KeySettings) Export(emit func(data interface{}) error) error {
+	for _, key := range k.manager.Keys() {
+		if err := emit(keySetting{
+			ID:        key.ID,
+			Name:      key.Name,
+			Hash:      key.Hash,
+			Scopes:    key.Scopes,
+			Tenant:    key.Tenant,
+			CreatedAt: key.CreatedAt,
+			Revoked:   key.Revoked,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import restores a key
+func (k *KeySettings) Import(data json.RawMessage) error {
+	var setting keySetting
+	if err := json.Unmarshal(data, &setting); err != nil {
+		return err
+	}
+	if setting.ID == "" || len(setting.Hash) != sha256.Size*2 {
+		return errors.New("api key record needs an id and a sha256 hash")
+	}
+	for _, scope := range setting.Scopes {
+		if _, err := ParseScope(scope); err != nil {
+			return err
+		}
+	}
+	if setting.Tenant == "" {
+		setting.Tenant = DefaultTenant
+	}
+	k.manager.store.SaveAPIKey(storage.APIKey{
+		ID:        setting.ID,
+		Name:      setting.Name,
+		Hash:      setting.Hash,
+		Scopes:    setting.Scopes,
+		Tenant:    setting.Tenant,
+		CreatedAt: setting.CreatedAt,
+		Revoked:   setting.Revoked,
+	})
+	return nil
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"blockchain-parser/internal/storage"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAllows(t *testing.T) {
+	testCases := []struct {
+		scopes   []string
+		required Scope
+		want     bool
+	}{
+		{[]string{"read"}, ScopeRead, true},
+		{[]string{"read"}, ScopeSubscribe, false},
+		{[]string{"subscribe"}, ScopeRead, true},
+		{[]string{"subscribe"}, ScopeAdmin, false},
+		{[]string{"admin"}, ScopeSubscribe, true},
+		{nil, ScopeRead, false},
+	}
+	for _, tc := range testCases {
+		if got := Allows(tc.scopes, tc.required); got != tc.want {
+			t.Errorf("Allows(%v, %s) = %v, want %v", tc.scopes, tc.required, got, tc.want)
+		}
+	}
+
+	if _, err := ParseScope("Owner"); err == nil {
+		t.Error("Expected an error for an unknown scope")
+	}
+	if scope, err := ParseScope(" Admin "); err != nil || scope != ScopeAdmin {
+		t.Errorf("Expected admin, got %q (%v)", scope, err)
+	}
+}
+
+func TestManager(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	m := NewManager(store)
+
+	key, secret, err := m.Create("indexer", "", []Scope{ScopeRead})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(secret, secretPrefix) {
+		t.Errorf("Expected a prefixed secret, got %q", secret)
+	}
+	if stored, _ := store.GetAPIKey(key.ID); stored.Hash != HashSecret(secret) || strings.Contains(stored.Hash, secret) {
+		t.Error("Expected only the hash of the secret to be stored")
+	}
+
+	if got, ok := m.Authenticate(secret); !ok || got.ID != key.ID || got.LastUsedAt.IsZero() {
+		t.Errorf("Expected the key to authenticate, got %+v (%v)", got, ok)
+	}
+	if _, ok := m.Authenticate("txp_wrong"); ok {
+		t.Error("Expected an unknown secret to fail")
+	}
+
+	if err := m.Revoke(key.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, ok := m.Authenticate(secret); ok {
+		t.Error("Expected a revoked key to fail")
+	}
+	if m.HasKeys() {
+		t.Error("Expected no active keys")
+	}
+	if err := m.Revoke("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if _, _, err := m.Create("", "", []Scope{ScopeRead}); err != ErrInvalidKey {
+		t.Errorf("Expected ErrInvalidKey without a name, got %v", err)
+	}
+	if _, _, err := m.Create("bad", "", []Scope{"owner"}); err == nil {
+		t.Error("Expected an error for an unknown scope")
+	}
+}
+
+func TestKeyTenants(t *testing.T) {
+	m := NewManager(storage.NewMemoryStorage())
+	key, _, err := m.Create("indexer", "", []Scope{ScopeRead})
+	if err != nil || key.Tenant != DefaultTenant {
+		t.Errorf("Expected the default tenant, got %q (%v)", key.Tenant, err)
+	}
+	if _, _, err := m.Create("indexer", "Payments Team", []Scope{ScopeRead}); err == nil {
+		t.Error("Expected an error for an invalid tenant")
+	}
+
+	payments, _, _ := m.Create("payments", "payments", []Scope{ScopeSubscribe})
+	if TenantOf(payments) != "payments" {
+		t.Errorf("Expected tenant payments, got %q", TenantOf(payments))
+	}
+	admin, _, _ := m.Create("ops", "payments", []Scope{ScopeAdmin})
+	if TenantOf(admin) != "" {
+		t.Errorf("Expected admin keys to see every tenant, got %q", TenantOf(admin))
+	}
+}
+
+func TestImportIsIdempotent(t *testing.T) {
+	m := NewManager(storage.NewMemoryStorage())
+	first, err := m.Import("bootstrap", "", "secret", []Scope{ScopeAdmin})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	second, _ := m.Import("bootstrap", "", "secret", []Scope{ScopeAdmin})
+	if first.ID != second.ID || len(m.Keys()) != 1 {
+		t.Errorf("Expected the same key to be returned, got %s and %s", first.ID, second.ID)
+	}
+}
+
+func TestAuditAndContext(t *testing.T) {
+	m := NewManager(storage.NewMemoryStorage())
+	key, _, _ := m.Create("ops", "", []Scope{ScopeSubscribe})
+	m.Record(key, "POST /subscribe", "0xabc", "127.0.0.1", 200)
+
+	entries := m.Audit(key.ID, 10)
+	if len(entries) != 1 || entries[0].KeyName != "ops" || entries[0].Address != "0xabc" {
+		t.Errorf("Unexpected audit entries: %+v", entries)
+	}
+
+	ctx := WithKey(context.Background(), key)
+	if got, ok := KeyFrom(ctx); !ok || got.ID != key.ID {
+		t.Error("Expected the key to be carried by the context")
+	}
+	if _, ok := KeyFrom(context.Background()); ok {
+		t.Error("Expected no key in an empty context")
+	}
+}
+
+func TestKeySettings(t *testing.T) {
+	source := NewManager(storage.NewMemoryStorage())
+	_, secret, _ := source.Create("indexer", "", []Scope{ScopeRead})
+
+	var records []json.RawMessage
+	source.Settings().Export(func(data interface{}) error {
+		encoded, _ := json.Marshal(data)
+		records = append(records, encoded)
+		return nil
+	})
+	if len(records) != 1 || strings.Contains(string(records[0]), secret) {
+		t.Fatalf("Expected one record without the secret, got %s", records)
+	}
+
+	target := NewManager(storage.NewMemoryStorage())
+	if err := target.Settings().Import(records[0]); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if _, ok := target.Authenticate(secret); !ok {
+		t.Error("Expected the restored key to accept the original secret")
+	}
+	if err := target.Settings().Import(json.RawMessage(`{"id":"x","hash":"short"}`)); err == nil {
+		t.Error("Expected an error for an invalid hash")
+	}
+}
@@ -0,0 +1,189 @@
+// Package ledger derives per-address running balances from stored
+// transactions and reconciles them against the node.
+package ledger
+
+import (
+	"blockchain-parser/internal/storage"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a single balance change of an address in one asset
+type Entry struct {
+	BlockNumber int64
+	Hash        string
+	Index       int
+	Asset       string
+	Delta       *big.Int
+	// Balance is the running balance of Asset after this entry
+	Balance *big.Int
+}
+
+// Drift records a mismatch between the computed and on-chain ether balance
+type Drift struct {
+	Address    string
+	Block      int64
+	Expected   *big.Int
+	Actual     *big.Int
+	Difference *big.Int
+	DetectedAt time.Time
+}
+
+// ErrPruned is returned for balances at blocks whose history was pruned
+var ErrPruned = errors.New("transaction history was pruned")
+
+// Ledger computes balances from the transaction history in storage. Because
+// history only starts when an address is subscribed, each address can carry
+// an ether opening balance anchored by the reconciler. Pruned transactions
+// are counted through the balance checkpoint of their address.
+type Ledger struct {
+	store storage.BalanceStore
+
+	mu      sync.RWMutex
+	opening map[string]*big.Int
+	drift   map[string]Drift
+}
+
+// NewLedger creates a ledger reading transactions and checkpoints from store
+func NewLedger(store storage.BalanceStore) *Ledger {
+	return &Ledger{
+		store:   store,
+		opening: make(map[string]*big.Int),
+		drift:   make(map[string]Drift),
+	}
+}
+
+// Entries returns the balance changes of address up to and including
+// maxBlock, oldest first. A negative maxBlock includes every block. Pruned
+// transactions have no entries; the balances start from their checkpoint,
+// and blocks before it return ErrPruned.
+func (l *Ledger) Entries(address string, maxBlock int64) ([]Entry, error) {
+	address = strings.ToLower(address)
+	checkpoint, stored := l.store.BalanceHistory(address)
+	if maxBlock >= 0 && maxBlock < checkpoint.Block {
+		return nil, fmt.Errorf("%w up to block %d for %s", ErrPruned, checkpoint.Block, address)
+	}
+
+	var txs []storage.Transaction
+	for _, tx := range stored {
+		if maxBlock < 0 || tx.BlockNumber <= maxBlock {
+			txs = append(txs, tx)
+		}
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		if txs[i].BlockNumber != txs[j].BlockNumber {
+			return txs[i].BlockNumber < txs[j].BlockNumber
+		}
+		return txs[i].Index < txs[j].Index
+	})
+
+	running := l.startingBalances(address, checkpoint)
+	var entries []Entry
+	for _, tx := range txs {
+		for _, change := range tx.BalanceChanges() {
+			balance, ok := running[change.Asset]
+			if !ok {
+				balance = new(big.Int)
+			}
+			balance = new(big.Int).Add(balance, change.Delta)
+			running[change.Asset] = balance
+			entries = append(entries, Entry{
+				BlockNumber: tx.BlockNumber,
+				Hash:        tx.Hash,
+				Index:       tx.Index,
+				Asset:       change.Asset,
+				Delta:       change.Delta,
+				Balance:     balance,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// startingBalances returns the balances of address before its stored
+// transactions: the opening balance plus the pruned ones
+func (l *Ledger) startingBalances(address string, checkpoint storage.BalanceCheckpoint) map[string]*big.Int {
+	balances := checkpoint.Balances
+	if balances == nil {
+		balances = make(map[string]*big.Int)
+	}
+	if opening := l.Opening(address); opening != nil {
+		if pruned, ok := balances[storage.NativeAsset]; ok {
+			opening.Add(opening, pruned)
+		}
+		balances[storage.NativeAsset] = opening
+	}
+	return balances
+}
+
+// BalanceAt returns the balance per asset of address at block. A negative
+// block returns the latest balance.
+func (l *Ledger) BalanceAt(address string, block int64) (map[string]*big.Int, error) {
+	address = strings.ToLower(address)
+	checkpoint, stored := l.store.BalanceHistory(address)
+	if block >= 0 && block < checkpoint.Block {
+		return nil, fmt.Errorf("%w up to block %d for %s", ErrPruned, checkpoint.Block, address)
+	}
+
+	balances := l.startingBalances(address, checkpoint)
+	for _, tx := range stored {
+		if block >= 0 && tx.BlockNumber > block {
+			continue
+		}
+		for _, change := range tx.BalanceChanges() {
+			balance, ok := balances[change.Asset]
+			if !ok {
+				balance = new(big.Int)
+			}
+			balances[change.Asset] = new(big.Int).Add(balance, change.Delta)
+		}
+	}
+	return balances, nil
+}
+
+// Balance returns the latest balance per asset of address
+func (l *Ledger) Balance(address string) (map[string]*big.Int, error) {
+	return l.BalanceAt(address, -1)
+}
+
+// Opening returns the ether opening balance of address, or nil if none is set
+func (l *Ledger) Opening(address string) *big.Int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if opening, ok := l.opening[strings.ToLower(address)]; ok {
+		return new(big.Int).Set(opening)
+	}
+	return nil
+}
+
+// SetOpening sets the ether balance address held before its first stored transaction
+func (l *Ledger) SetOpening(address string, wei *big.Int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.opening[strings.ToLower(address)] = new(big.Int).Set(wei)
+}
+
+// Drift returns the last drift flagged for address
+func (l *Ledger) Drift(address string) (Drift, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	drift, ok := l.drift[strings.ToLower(address)]
+	return drift, ok
+}
+
+// setDrift records or clears the drift of address
+func (l *Ledger) setDrift(address string, drift *Drift) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	address = strings.ToLower(address)
+	if drift == nil {
+		delete(l.drift, address)
+		return
+	}
+	l.drift[address] = *drift
+}
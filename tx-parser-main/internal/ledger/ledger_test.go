@@ -0,0 +1,133 @@
+package ledger
+
+import (
+	"blockchain-parser/internal/storage"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+const (
+	testAddress = "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	testOther   = "0xdd93e92dc32d0b2f51430b0e6da29bdd01af68d6"
+	testToken   = "0x1111111111111111111111111111111111111111"
+)
+
+func newTestStore() *storage.MemoryStorage {
+	store := storage.NewMemoryStorage()
+	store.StoreTransaction(storage.Transaction{
+		Hash: "0x01", FromAddress: testOther, ToAddress: testAddress,
+		ValueWei: "5000", FeeWei: "10", Status: storage.StatusSuccess, BlockNumber: 10,
+	})
+	store.StoreTransaction(storage.Transaction{
+		Hash: "0x02", FromAddress: testAddress, ToAddress: testOther,
+		ValueWei: "1000", FeeWei: "10", Status: storage.StatusSuccess, BlockNumber: 11,
+	})
+	store.StoreTransaction(storage.Transaction{
+		Hash: "0x03", FromAddress: testAddress, ToAddress: testOther,
+		ValueWei: "700", FeeWei: "10", Status: storage.StatusFailed, BlockNumber: 12,
+	})
+	store.StoreTransaction(storage.Transaction{
+		Hash: "0x04", FromAddress: testOther, ToAddress: testAddress, Index: 3,
+		ValueWei: "42", Token: testToken, BlockNumber: 12,
+	})
+	return store
+}
+
+func TestBalance(t *testing.T) {
+	ledger := NewLedger(newTestStore())
+
+	balances, err := ledger.Balance(testAddress)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// +5000 in, -1000 out, -10 fee, failed tx only pays its 10 fee
+	if got := balances[storage.NativeAsset]; got.Cmp(big.NewInt(3980)) != 0 {
+		t.Errorf("Expected ETH balance 3980, got %s", got)
+	}
+	if got := balances[testToken]; got.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("Expected token balance 42, got %s", got)
+	}
+
+	// The sender of the first transfer paid the fee
+	other, _ := ledger.Balance(testOther)
+	if got := other[storage.NativeAsset]; got.Cmp(big.NewInt(-5010+1000)) != 0 {
+		t.Errorf("Expected counterparty ETH balance -4010, got %s", got)
+	}
+}
+
+func TestBalanceAt(t *testing.T) {
+	ledger := NewLedger(newTestStore())
+
+	balances, err := ledger.BalanceAt(testAddress, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := balances[storage.NativeAsset]; got.Cmp(big.NewInt(5000)) != 0 {
+		t.Errorf("Expected ETH balance 5000 at block 10, got %s", got)
+	}
+	if _, ok := balances[testToken]; ok {
+		t.Error("Expected no token balance before block 12")
+	}
+
+	empty, _ := ledger.BalanceAt(testAddress, 5)
+	if len(empty) != 0 {
+		t.Errorf("Expected no balances before the first transaction, got %v", empty)
+	}
+}
+
+func TestOpeningBalance(t *testing.T) {
+	ledger := NewLedger(newTestStore())
+	ledger.SetOpening(testAddress, big.NewInt(100000))
+
+	balances, _ := ledger.BalanceAt(testAddress, 5)
+	if got := balances[storage.NativeAsset]; got.Cmp(big.NewInt(100000)) != 0 {
+		t.Errorf("Expected opening balance before history, got %s", got)
+	}
+
+	entries, _ := ledger.Entries(testAddress, -1)
+	last := entries[len(entries)-1]
+	if last.Asset != testToken {
+		t.Fatalf("Expected the token transfer last, got %+v", last)
+	}
+	for _, entry := range entries {
+		if entry.Asset == storage.NativeAsset {
+			last = entry
+		}
+	}
+	if last.Balance.Cmp(big.NewInt(103980)) != 0 {
+		t.Errorf("Expected running ETH balance 103980, got %s", last.Balance)
+	}
+}
+
+func TestBalanceAfterPrune(t *testing.T) {
+	store := newTestStore()
+	ledger := NewLedger(store)
+	before, _ := ledger.Balance(testAddress)
+
+	store.PruneTransactions(storage.RetentionPolicy{MaxPerAddress: 1}, time.Now())
+	if got := len(store.GetTransactions(testAddress)); got != 1 {
+		t.Fatalf("Expected 1 transaction left after pruning, got %d", got)
+	}
+
+	after, err := ledger.Balance(testAddress)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for asset, balance := range before {
+		if after[asset].Cmp(balance) != 0 {
+			t.Errorf("Expected %s balance %s after pruning, got %s", asset, balance, after[asset])
+		}
+	}
+
+	entries, _ := ledger.Entries(testAddress, -1)
+	if len(entries) != 1 || entries[0].Balance.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("Expected the remaining entry to continue from the checkpoint, got %+v", entries)
+	}
+
+	if _, err := ledger.BalanceAt(testAddress, 11); !errors.Is(err, ErrPruned) {
+		t.Errorf("Expected ErrPruned before the checkpoint, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package ledger
+
+import (
+	"blockchain-parser/internal/logger"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/utils"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// log is the logger of balance reconciliation
+var log = logger.Component("ledger")
+
+// Reconciler compares computed ether balances with eth_getBalance
+type Reconciler struct {
+	ledger    *Ledger
+	storage   storage.StorageInterface
+	rpcClient *parser.RPCClient
+	interval  time.Duration
+}
+
+// NewReconciler creates a reconciler checking every subscriber each interval
+func NewReconciler(ledger *Ledger, storage storage.StorageInterface, rpc *parser.RPCClient, interval time.Duration) *Reconciler {
+	return &Reconciler{
+		ledger:    ledger,
+		storage:   storage,
+		rpcClient: rpc,
+		interval:  interval,
+	}
+}
+
+// Start reconciles every interval until stop is closed
+func (r *Reconciler) Start(stop <-chan struct{}) {
+	if r.interval <= 0 {
+		log.Warn("Balance reconciliation disabled: non-positive interval", "interval", r.interval)
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			r.Reconcile()
+		}
+	}
+}
+
+// Reconcile checks every subscriber at the last processed block and returns
+// the number of addresses with drift
+func (r *Reconciler) Reconcile() int {
+	block := r.storage.GetCurrentBlock()
+	if block <= 0 {
+		log.Debug("Skipping reconciliation: no block processed yet")
+		return 0
+	}
+
+	drifted := 0
+	for _, address := range r.storage.GetSubscribers() {
+		drift, err := r.ReconcileAddress(address, block)
+		if err != nil {
+			log.Error("Failed to reconcile", "address", address, "error", err)
+			continue
+		}
+		if drift != nil {
+			drifted++
+		}
+	}
+	log.Info("Reconciled balances", "block", block, "drifted", drifted)
+	return drifted
+}
+
+// ReconcileAddress compares the ether balance of address at block. The first
+// check anchors the opening balance; later mismatches are flagged as drift.
+func (r *Reconciler) ReconcileAddress(address string, block int64) (*Drift, error) {
+	actual, err := r.fetchBalance(address, block)
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := r.ledger.BalanceAt(address, block)
+	if err != nil {
+		return nil, err
+	}
+	expected, ok := balances[storage.NativeAsset]
+	if !ok {
+		expected = new(big.Int)
+	}
+
+	if r.ledger.Opening(address) == nil {
+		// History starts at subscription time, so the first on-chain balance
+		// defines what the address held before its first stored transaction
+		opening := new(big.Int).Sub(actual, expected)
+		r.ledger.SetOpening(address, opening)
+		log.Info("Anchored opening balance", "address", address, "eth", utils.WeiToEther(opening))
+		return nil, nil
+	}
+
+	if expected.Cmp(actual) == 0 {
+		r.ledger.setDrift(address, nil)
+		return nil, nil
+	}
+
+	drift := &Drift{
+		Address:    address,
+		Block:      block,
+		Expected:   expected,
+		Actual:     actual,
+		Difference: new(big.Int).Sub(actual, expected),
+		DetectedAt: time.Now(),
+	}
+	r.ledger.setDrift(address, drift)
+	log.Warn("Balance drift",
+		"address", address, "block", block, "computed_eth", utils.WeiToEther(expected), "node_eth", utils.WeiToEther(actual))
+	return drift, nil
+}
+
+// fetchBalance calls eth_getBalance for address at block
+func (r *Reconciler) fetchBalance(address string, block int64) (*big.Int, error) {
+	result, err := r.rpcClient.MakeCall("eth_getBalance", []interface{}{address, fmt.Sprintf("0x%x", block)})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching balance: %v", err)
+	}
+	balanceHex, ok := result.Result.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid balance response format")
+	}
+	return utils.HexToBigInt(balanceHex)
+}
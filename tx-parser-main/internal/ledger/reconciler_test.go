@@ -0,0 +1,69 @@
+package ledger
+
+import (
+	"blockchain-parser/config"
+	"blockchain-parser/internal/parser"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newBalanceServer serves eth_getBalance with the given wei balance
+func newBalanceServer(t *testing.T, balance *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request parser.JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.Method != "eth_getBalance" {
+			t.Errorf("Unexpected method %s", request.Method)
+		}
+		json.NewEncoder(w).Encode(&parser.JSONRPCResponse{Result: fmt.Sprintf("0x%x", *balance)})
+	}))
+}
+
+func TestReconcile(t *testing.T) {
+	balance := int64(103980)
+	server := newBalanceServer(t, &balance)
+	defer server.Close()
+
+	store := newTestStore()
+	store.AddSubscriber(testAddress)
+	store.UpdateCurrentBlock(12)
+
+	ledger := NewLedger(store)
+	rpc := parser.NewRPCClient(&config.Config{RPCEndpoint: server.URL, Network: config.NetworkConfig{RequestTimeout: time.Second}})
+	reconciler := NewReconciler(ledger, store, rpc, time.Minute)
+
+	// The first run anchors the opening balance
+	if drifted := reconciler.Reconcile(); drifted != 0 {
+		t.Errorf("Expected no drift on first run, got %d", drifted)
+	}
+	if opening := ledger.Opening(testAddress); opening == nil || opening.Int64() != 100000 {
+		t.Fatalf("Expected opening balance 100000, got %v", opening)
+	}
+
+	if drifted := reconciler.Reconcile(); drifted != 0 {
+		t.Errorf("Expected balances to match, got %d drifted", drifted)
+	}
+
+	// A transfer the parser missed shows up as drift
+	balance = 103000
+	if drifted := reconciler.Reconcile(); drifted != 1 {
+		t.Fatalf("Expected 1 drifted address, got %d", drifted)
+	}
+	drift, ok := ledger.Drift(testAddress)
+	if !ok {
+		t.Fatal("Expected drift to be recorded")
+	}
+	if drift.Difference.Int64() != -980 || drift.Block != 12 {
+		t.Errorf("Unexpected drift %+v", drift)
+	}
+
+	balance = 103980
+	reconciler.Reconcile()
+	if _, ok := ledger.Drift(testAddress); ok {
+		t.Error("Expected drift to be cleared once balances match")
+	}
+}
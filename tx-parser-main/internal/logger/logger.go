@@ -1,16 +1,24 @@
-// Package logger provides a simple leveled logging system with file output
+// Package logger provides structured, leveled logging built on log/slog,
+// written to a rotating file, stderr and syslog. Components log through their
+// own *slog.Logger from Component; the printf-style functions remain for
+// compatibility.
 package logger
 
 import (
+    "blockchain-parser/internal/tracing"
+    "context"
+    "errors"
     "fmt"
-    "log"
+    "io"
+    "log/slog"
     "os"
     "path/filepath"
     "runtime"
+    "strings"
+    "sync"
     "time"
 )
 
-
 // LogLevel represents different severity levels for logging
 type LogLevel int
 
@@ -23,107 +31,390 @@ const (
     FATAL
 )
 
-// Logger contains separate loggers for each severity level
-type Logger struct {
-    debug *log.Logger
-    info  *log.Logger
-    warn  *log.Logger
-    error *log.Logger
-    fatal *log.Logger
+// levelFatal is the slog level of FATAL records, above slog.LevelError
+const levelFatal = slog.LevelError + 4
+
+// slogLevel returns the slog level of l
+func (l LogLevel) slogLevel() slog.Level {
+    switch l {
+    case DEBUG:
+        return slog.LevelDebug
+    case INFO:
+        return slog.LevelInfo
+    case WARN:
+        return slog.LevelWarn
+    case ERROR:
+        return slog.LevelError
+    default:
+        return levelFatal
+    }
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN"
+func ParseLevel(name string) (LogLevel, error) {
+    switch strings.ToLower(strings.TrimSpace(name)) {
+    case "debug":
+        return DEBUG, nil
+    case "info":
+        return INFO, nil
+    case "warn", "warning":
+        return WARN, nil
+    case "error":
+        return ERROR, nil
+    case "fatal":
+        return FATAL, nil
+    }
+    return INFO, fmt.Errorf("unknown log level %q: expected debug, info, warn, error or fatal", name)
+}
+
+// Format is the encoding of log lines
+type Format string
+
+// Supported formats
+const (
+    // FormatText writes key=value lines
+    FormatText Format = "text"
+
+    // FormatJSON writes one JSON object per line
+    FormatJSON Format = "json"
+)
+
+// ParseFormat parses a format name, text or json
+func ParseFormat(name string) (Format, error) {
+    switch format := Format(strings.ToLower(strings.TrimSpace(name))); format {
+    case FormatText, FormatJSON:
+        return format, nil
+    }
+    return FormatText, fmt.Errorf("unknown log format %q: expected text or json", name)
+}
+
+// options holds the settings applied by Init
+type options struct {
+    level     LogLevel
+    format    Format
+    rotation  RotationConfig
+    stderr    bool
+    syslog    bool
+    syslogTag string
+    syslogURL string
+}
+
+// Option configures Init
+type Option func(*options)
+
+// WithLevel drops records below level. Everything is logged by default.
+func WithLevel(level LogLevel) Option {
+    return func(o *options) {
+        o.level = level
+    }
+}
+
+// WithFormat selects the encoding of log lines, text by default
+func WithFormat(format Format) Option {
+    return func(o *options) {
+        o.format = format
+    }
+}
+
+// WithRotation rotates the log file by size and time, see RotationConfig.
+// The file is never rotated by default.
+func WithRotation(cfg RotationConfig) Option {
+    return func(o *options) {
+        o.rotation = cfg
+    }
+}
+
+// WithStderr also writes records to stderr, in the same format as the file
+func WithStderr() Option {
+    return func(o *options) {
+        o.stderr = true
+    }
+}
+
+// WithSyslog also sends records to a syslog or journald socket, a path to a
+// Unix datagram socket (DefaultSyslogAddress when empty) or a URL such as
+// udp://host:514, tagged with tag
+func WithSyslog(address, tag string) Option {
+    return func(o *options) {
+        o.syslog = true
+        o.syslogURL = address
+        o.syslogTag = tag
+    }
 }
 
 var (
-    defaultLogger *Logger
-    logFile      *os.File
+    mu         sync.RWMutex
+    handler    slog.Handler
+    logFile    *RotatingFile
+    syslogConn *syslogWriter
 )
 
-// Init initializes the logging system with the specified log file path
-func Init(logPath string) error {
-    if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
-        return fmt.Errorf("failed to create log directory: %v", err)
+// root forwards records to the handler installed by Init, so loggers
+// created before Init log once it is called
+var root = &switchHandler{}
+
+// Init initializes the logging system with the specified log file path. An
+// empty path disables the file, leaving the outputs added by options.
+func Init(logPath string, opts ...Option) error {
+    o := options{level: DEBUG, format: FormatText, syslogTag: "blockchain-parser"}
+    for _, opt := range opts {
+        opt(&o)
     }
 
-    file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-    if err != nil {
-        return fmt.Errorf("failed to open log file: %v", err)
+    var handlers []slog.Handler
+    var file *RotatingFile
+    var syslogWriter *syslogWriter
+    if logPath != "" {
+        var err error
+        if file, err = OpenRotatingFile(logPath, o.rotation); err != nil {
+            return err
+        }
+        handlers = append(handlers, newHandler(file, o))
+    }
+    if o.stderr {
+        handlers = append(handlers, newHandler(os.Stderr, o))
+    }
+    if o.syslog {
+        var err error
+        if syslogWriter, err = newSyslogWriter(o.syslogURL, o.syslogTag); err != nil {
+            if file != nil {
+                file.Close()
+            }
+            return err
+        }
+        handlers = append(handlers, newSyslogHandler(syslogWriter, o.level.slogLevel()))
+    }
+    if len(handlers) == 0 {
+        return fmt.Errorf("no log outputs: set a log file path, stderr or syslog")
     }
 
+    mu.Lock()
+    defer mu.Unlock()
+    closeOutputs()
     logFile = file
-    defaultLogger = &Logger{
-        debug: log.New(file, "DEBUG: ", log.Ldate|log.Ltime),
-        info:  log.New(file, "INFO:  ", log.Ldate|log.Ltime),
-        warn:  log.New(file, "WARN:  ", log.Ldate|log.Ltime),
-        error: log.New(file, "ERROR: ", log.Ldate|log.Ltime),
-        fatal: log.New(file, "FATAL: ", log.Ldate|log.Ltime),
+    syslogConn = syslogWriter
+    if len(handlers) == 1 {
+        handler = handlers[0]
+    } else {
+        handler = multiHandler(handlers)
     }
-
     return nil
 }
 
-// Close properly closes the log file
+// newHandler creates the slog handler writing to w
+func newHandler(w io.Writer, o options) slog.Handler {
+    handlerOptions := &slog.HandlerOptions{
+        AddSource:   true,
+        Level:       o.level.slogLevel(),
+        ReplaceAttr: replaceAttr,
+    }
+    if o.format == FormatJSON {
+        return slog.NewJSONHandler(w, handlerOptions)
+    }
+    return slog.NewTextHandler(w, handlerOptions)
+}
+
+// replaceAttr names the FATAL level and shortens sources to file:line
+func replaceAttr(groups []string, attr slog.Attr) slog.Attr {
+    if len(groups) > 0 {
+        return attr
+    }
+    switch attr.Key {
+    case slog.LevelKey:
+        if level, ok := attr.Value.Any().(slog.Level); ok && level >= levelFatal {
+            return slog.String(slog.LevelKey, "FATAL")
+        }
+    case slog.SourceKey:
+        if source, ok := attr.Value.Any().(*slog.Source); ok {
+            return slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", filepath.Base(source.File), source.Line))
+        }
+    }
+    return attr
+}
+
+// Close flushes and closes the log file and the syslog socket. Later
+// records are discarded.
 func Close() {
+    mu.Lock()
+    defer mu.Unlock()
+    closeOutputs()
+    handler = nil
+}
+
+// closeOutputs closes the current outputs. Callers hold mu.
+func closeOutputs() {
     if logFile != nil {
         logFile.Close()
+        logFile = nil
+    }
+    if syslogConn != nil {
+        syslogConn.Close()
+        syslogConn = nil
     }
 }
 
-// getCallerInfo retrieves the file name and line number of the logging call
-func getCallerInfo() string {
-    _, file, line, ok := runtime.Caller(2)
-    if !ok {
-        return "unknown"
+// Reopen reopens the log file at its path, so records go to a new file
+// after an external tool such as logrotate has moved the old one
+func Reopen() error {
+    mu.RLock()
+    defer mu.RUnlock()
+    if logFile == nil {
+        return nil
     }
-    return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+    return logFile.Reopen()
+}
+
+// Component returns a logger whose records carry component=name, such as
+// "monitor", "rpc" or "api"
+func Component(name string) *slog.Logger {
+    return slog.New(root).With("component", name)
+}
+
+// switchHandler is a slog.Handler forwarding to the current handler, with
+// the trace and span IDs of the record's context added
+type switchHandler struct {
+    // wrap replays the WithAttrs and WithGroup calls made on this handler
+    wrap []func(slog.Handler) slog.Handler
+}
+
+// current returns the installed handler, nil before Init
+func current() slog.Handler {
+    mu.RLock()
+    defer mu.RUnlock()
+    return handler
+}
+
+func (h *switchHandler) Enabled(ctx context.Context, level slog.Level) bool {
+    base := current()
+    return base != nil && base.Enabled(ctx, level)
 }
 
-// logMessage formats and writes a log message with the specified level.
-func logMessage(level LogLevel, format string, v ...interface{}) {
-    if defaultLogger == nil {
-        return
+func (h *switchHandler) Handle(ctx context.Context, record slog.Record) error {
+    base := current()
+    if base == nil {
+        return nil
     }
+    for _, wrap := range h.wrap {
+        base = wrap(base)
+    }
+    if traceID, spanID := tracing.IDs(ctx); traceID != "" {
+        record.AddAttrs(slog.String("trace_id", traceID), slog.String("span_id", spanID))
+    }
+    return base.Handle(ctx, record)
+}
 
-    msg := fmt.Sprintf(format, v...)
-    caller := getCallerInfo()
-    timestamp := time.Now().Format("2006-01-02 15:04:05")
+func (h *switchHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return h.with(func(base slog.Handler) slog.Handler { return base.WithAttrs(attrs) })
+}
 
-    logLine := fmt.Sprintf("[%s] %s - %s", timestamp, caller, msg)
+func (h *switchHandler) WithGroup(name string) slog.Handler {
+    return h.with(func(base slog.Handler) slog.Handler { return base.WithGroup(name) })
+}
 
-    switch level {
-    case DEBUG:
-        defaultLogger.debug.Println(logLine)
-    case INFO:
-        defaultLogger.info.Println(logLine)
-    case WARN:
-        defaultLogger.warn.Println(logLine)
-    case ERROR:
-        defaultLogger.error.Println(logLine)
-    case FATAL:
-        defaultLogger.fatal.Println(logLine)
+func (h *switchHandler) with(wrap func(slog.Handler) slog.Handler) *switchHandler {
+    wraps := make([]func(slog.Handler) slog.Handler, len(h.wrap), len(h.wrap)+1)
+    copy(wraps, h.wrap)
+    return &switchHandler{wrap: append(wraps, wrap)}
+}
+
+// multiHandler sends every record to each of its handlers
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+    for _, h := range m {
+        if h.Enabled(ctx, level) {
+            return true
+        }
+    }
+    return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, record slog.Record) error {
+    var errs []error
+    for _, h := range m {
+        if h.Enabled(ctx, record.Level) {
+            if err := h.Handle(ctx, record.Clone()); err != nil {
+                errs = append(errs, err)
+            }
+        }
+    }
+    return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    handlers := make(multiHandler, len(m))
+    for i, h := range m {
+        handlers[i] = h.WithAttrs(attrs)
+    }
+    return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+    handlers := make(multiHandler, len(m))
+    for i, h := range m {
+        handlers[i] = h.WithGroup(name)
+    }
+    return handlers
+}
+
+// logMessage formats and writes a log message with the specified level,
+// attributed to the caller of the exported logging function
+func logMessage(ctx context.Context, level LogLevel, format string, v ...interface{}) {
+    if root.Enabled(ctx, level.slogLevel()) {
+        var pcs [1]uintptr
+        // Skip runtime.Callers, logMessage and the exported function
+        runtime.Callers(3, pcs[:])
+        record := slog.NewRecord(time.Now(), level.slogLevel(), fmt.Sprintf(format, v...), pcs[0])
+        root.Handle(ctx, record)
+    }
+
+    if level == FATAL {
+        Close()
         os.Exit(1)
     }
 }
 
 // Debug logs debug level messages
 func Debug(format string, v ...interface{}) {
-    logMessage(DEBUG, format, v...)
+    logMessage(context.Background(), DEBUG, format, v...)
 }
 
 // Info logs informational messages
 func Info(format string, v ...interface{}) {
-    logMessage(INFO, format, v...)
+    logMessage(context.Background(), INFO, format, v...)
 }
 
 // Warn logs warning messages
 func Warn(format string, v ...interface{}) {
-    logMessage(WARN, format, v...)
+    logMessage(context.Background(), WARN, format, v...)
 }
 
 // Error logs error messages
 func Error(format string, v ...interface{}) {
-    logMessage(ERROR, format, v...)
+    logMessage(context.Background(), ERROR, format, v...)
 }
 
 // Fatal logs critical errors and terminates the program
 func Fatal(format string, v ...interface{}) {
-    logMessage(FATAL, format, v...)
-}
\ No newline at end of file
+    logMessage(context.Background(), FATAL, format, v...)
+}
+
+// DebugContext logs debug level messages with the trace of ctx
+func DebugContext(ctx context.Context, format string, v ...interface{}) {
+    logMessage(ctx, DEBUG, format, v...)
+}
+
+// InfoContext logs informational messages with the trace of ctx
+func InfoContext(ctx context.Context, format string, v ...interface{}) {
+    logMessage(ctx, INFO, format, v...)
+}
+
+// WarnContext logs warning messages with the trace of ctx
+func WarnContext(ctx context.Context, format string, v ...interface{}) {
+    logMessage(ctx, WARN, format, v...)
+}
+
+// ErrorContext logs error messages with the trace of ctx
+func ErrorContext(ctx context.Context, format string, v ...interface{}) {
+    logMessage(ctx, ERROR, format, v...)
+}
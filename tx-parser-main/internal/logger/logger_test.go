@@ -1,7 +1,10 @@
 package logger
 
 import (
+	"blockchain-parser/internal/tracing"
 	"bufio"
+	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -123,13 +126,113 @@ func TestLogging(t *testing.T) {
 	}
 }
 
-func TestGetCallerInfo(t *testing.T) {
-	info := getCallerInfo()
-	if info == "unknown" {
-		t.Error("Failed to get caller information")
+func TestLoggingWithTrace(t *testing.T) {
+	defer cleanup()
+
+	if err := Init(testLogFile); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	ctx := tracing.WithTraceParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	InfoContext(ctx, "processed block %d", 16)
+	lastLine, err := readLastLogLine()
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(lastLine, `msg="processed block 16" trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id=00f067aa0ba902b7`) {
+		t.Errorf("Expected the trace IDs in: %s", lastLine)
+	}
+
+	WarnContext(context.Background(), "untraced")
+	if lastLine, _ = readLastLogLine(); strings.Contains(lastLine, "trace_id") {
+		t.Errorf("Expected no trace IDs without a span, got: %s", lastLine)
+	}
+}
+
+func TestCallerSource(t *testing.T) {
+	defer cleanup()
+
+	if err := Init(testLogFile); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	Info("where am I")
+	lastLine, err := readLastLogLine()
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(lastLine, "source=logger_test.go:") {
+		t.Errorf("Expected the calling file as source in: %s", lastLine)
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	defer cleanup()
+
+	if err := Init(testLogFile, WithLevel(WARN)); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	Warn("kept")
+	Debug("dropped debug")
+	Info("dropped info")
+	lastLine, err := readLastLogLine()
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(lastLine, "level=WARN") || !strings.Contains(lastLine, "msg=kept") {
+		t.Errorf("Expected only the warning to be logged, last line: %s", lastLine)
+	}
+}
+
+func TestJSONComponent(t *testing.T) {
+	defer cleanup()
+
+	// Loggers created before Init log once it is called
+	log := Component("monitor")
+	if err := Init(testLogFile, WithFormat(FormatJSON)); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+
+	log.Info("Processed block", "block", 16, "transactions", 3)
+	lastLine, err := readLastLogLine()
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lastLine), &record); err != nil {
+		t.Fatalf("Expected a JSON line, got %s: %v", lastLine, err)
+	}
+	for key, want := range map[string]interface{}{
+		"level":        "INFO",
+		"msg":          "Processed block",
+		"component":    "monitor",
+		"block":        float64(16),
+		"transactions": float64(3),
+	} {
+		if record[key] != want {
+			t.Errorf("Expected %s=%v, got %v", key, want, record[key])
+		}
+	}
+	if source, _ := record["source"].(string); !strings.HasPrefix(source, "logger_test.go:") {
+		t.Errorf("Unexpected source %v", record["source"])
+	}
+}
+
+func TestParseLevelAndFormat(t *testing.T) {
+	for name, want := range map[string]LogLevel{"debug": DEBUG, "INFO": INFO, "warning": WARN, "error": ERROR} {
+		if level, err := ParseLevel(name); err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", name, level, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+	if format, err := ParseFormat("JSON"); err != nil || format != FormatJSON {
+		t.Errorf("ParseFormat(JSON) = %v, %v", format, err)
 	}
-	if !strings.Contains(info, ".go:") {
-		t.Errorf("Expected file information in caller info, got: %s", info)
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
 	}
 }
 
@@ -0,0 +1,302 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files, sortable and safe in file names
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotationConfig controls when the log file is rotated and how many rotated
+// files are kept. Zero values disable the corresponding limit.
+type RotationConfig struct {
+	// MaxSize is the size in bytes that triggers a rotation
+	MaxSize int64
+
+	// Interval rotates the file when the current time enters a new interval,
+	// such as every day at midnight UTC for 24h
+	Interval time.Duration
+
+	// MaxBackups is the number of rotated files kept, oldest removed first
+	MaxBackups int
+
+	// Compress gzips rotated files
+	Compress bool
+}
+
+// RotatingFile is a log file that rotates by size and time. Rotated files are
+// renamed to name-<time>.ext next to it, then compressed and pruned in the
+// background.
+type RotatingFile struct {
+	path   string
+	config RotationConfig
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	period time.Time
+
+	// mill serialises compression and pruning of rotated files
+	mill   sync.Mutex
+	millWG sync.WaitGroup
+}
+
+// OpenRotatingFile opens or creates the log file at path, creating its
+// directory when needed
+func OpenRotatingFile(path string, cfg RotationConfig) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+	r := &RotatingFile{path: path, config: cfg}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the file for appending, taking its size and the interval of
+// its last write from the existing file
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	r.file = file
+	r.size = info.Size()
+	r.period = r.periodOf(info.ModTime())
+	return nil
+}
+
+// periodOf returns the start of the rotation interval containing t
+func (r *RotatingFile) periodOf(t time.Time) time.Time {
+	if r.config.Interval <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(r.config.Interval)
+}
+
+// Write appends p to the file, rotating it first when p would exceed
+// MaxSize or a new interval has begun
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	now := time.Now()
+	tooLarge := r.config.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.config.MaxSize
+	if tooLarge || r.periodOf(now).After(r.period) {
+		if err := r.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file immediately
+func (r *RotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	return r.rotate(time.Now())
+}
+
+// rotate renames the current file to a backup and opens a new one. The
+// current handle is only closed once its replacement is open, so a failed
+// rotation keeps logging instead of closing the file for good.
+func (r *RotatingFile) rotate(now time.Time) error {
+	current := r.file
+	name := r.backupName(now)
+	for i := 1; fileExists(name); i++ {
+		// Rotations within the same millisecond must not overwrite each other
+		name = r.backupName(now.Add(time.Duration(i) * time.Millisecond))
+	}
+	if err := os.Rename(r.path, name); err != nil && !os.IsNotExist(err) {
+		// Keep appending to the original path and retry on a later write
+		if r.open() == nil {
+			current.Close()
+		}
+		return fmt.Errorf("failed to rotate log file: %v", err)
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	current.Close()
+	r.period = r.periodOf(now)
+
+	r.millWG.Add(1)
+	go func() {
+		defer r.millWG.Done()
+		r.millBackups()
+	}()
+	return nil
+}
+
+// Reopen closes and reopens the file at its path, for external tools such
+// as logrotate that move the file and then send SIGHUP. The current handle
+// is kept when the path cannot be opened.
+func (r *RotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current := r.file
+	if err := r.open(); err != nil {
+		return err
+	}
+	if current != nil {
+		current.Close()
+	}
+	return nil
+}
+
+// Sync commits the file to stable storage
+func (r *RotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
+// Close closes the file once pending compression has finished
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.file != nil {
+		r.file.Sync()
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.mu.Unlock()
+	r.millWG.Wait()
+	return err
+}
+
+// backupName returns the name the file is rotated to at t
+func (r *RotatingFile) backupName(t time.Time) string {
+	dir, prefix, ext := r.nameParts()
+	return filepath.Join(dir, prefix+t.UTC().Format(backupTimeFormat)+ext)
+}
+
+// nameParts splits the path into its directory, the prefix of its backups
+// and its extension
+func (r *RotatingFile) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(r.path)
+	base := filepath.Base(r.path)
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// fileExists reports whether a backup named path exists, compressed or not
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true
+	}
+	_, err = os.Stat(path + ".gz")
+	return err == nil
+}
+
+// backup is a rotated file
+type backup struct {
+	path string
+	time time.Time
+}
+
+// backups lists the rotated files of the log, newest first
+func (r *RotatingFile) backups() ([]backup, error) {
+	dir, prefix, ext := r.nameParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimPrefix(strings.TrimSuffix(name, ".gz"), prefix)
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, strings.TrimSuffix(stamp, ext))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, name), time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.After(backups[j].time) })
+	return backups, nil
+}
+
+// millBackups removes the backups beyond MaxBackups and compresses the rest
+func (r *RotatingFile) millBackups() {
+	r.mill.Lock()
+	defer r.mill.Unlock()
+
+	backups, err := r.backups()
+	if err != nil {
+		return
+	}
+	for i, b := range backups {
+		if r.config.MaxBackups > 0 && i >= r.config.MaxBackups {
+			os.Remove(b.path)
+			continue
+		}
+		if r.config.Compress && !strings.HasSuffix(b.path, ".gz") {
+			compressFile(b.path)
+		}
+	}
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
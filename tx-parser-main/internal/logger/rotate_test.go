@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "parser.log")
+	file, err := OpenRotatingFile(path, RotationConfig{MaxSize: 100, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+
+	line := strings.Repeat("x", 59) + "\n"
+	for i := 0; i < 5; i++ {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Each line exceeds the space left, so every write after the first rotates
+	backups, err := file.backups()
+	if err != nil {
+		t.Fatalf("Listing backups failed: %v", err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups kept, got %d", len(backups))
+	}
+	for _, b := range backups {
+		if !strings.HasSuffix(b.path, ".log.gz") || !strings.HasPrefix(filepath.Base(b.path), "parser-") {
+			t.Errorf("Unexpected backup name %s", b.path)
+		}
+		if content := readGzip(t, b.path); content != line {
+			t.Errorf("Unexpected backup content %q", content)
+		}
+	}
+	if content, _ := os.ReadFile(path); string(content) != line {
+		t.Errorf("Expected the last line in the current file, got %q", content)
+	}
+}
+
+func TestRotateByInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "parser.log")
+	file, err := OpenRotatingFile(path, RotationConfig{Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	defer file.Close()
+
+	file.Write([]byte("first\n"))
+	// Pretend the file was opened in the previous interval
+	file.period = file.period.Add(-time.Hour)
+	file.Write([]byte("second\n"))
+
+	backups, _ := file.backups()
+	if len(backups) != 1 {
+		t.Fatalf("Expected one backup, got %d", len(backups))
+	}
+	if content, _ := os.ReadFile(backups[0].path); string(content) != "first\n" {
+		t.Errorf("Unexpected backup content %q", content)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "second\n" {
+		t.Errorf("Unexpected current content %q", content)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	defer cleanup()
+
+	if err := Init(testLogFile); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	Info("before logrotate")
+
+	// logrotate moves the file away, then signals the process
+	moved := testLogFile + ".1"
+	if err := os.Rename(testLogFile, moved); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := Reopen(); err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	Info("after logrotate")
+
+	old, _ := os.ReadFile(moved)
+	current, _ := os.ReadFile(testLogFile)
+	if !strings.Contains(string(old), "before logrotate") || strings.Contains(string(old), "after logrotate") {
+		t.Errorf("Unexpected moved file %q", old)
+	}
+	if !strings.Contains(string(current), "after logrotate") {
+		t.Errorf("Expected new records in the reopened file, got %q", current)
+	}
+}
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Not a gzip file %s: %v", path, err)
+	}
+	content, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Reading %s failed: %v", path, err)
+	}
+	return string(content)
+}
+
+func TestFailedRotationKeepsLogging(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "parser.log")
+	file, err := OpenRotatingFile(path, RotationConfig{})
+	if err != nil {
+		t.Fatalf("OpenRotatingFile failed: %v", err)
+	}
+	defer file.Close()
+
+	// Without its directory the new file cannot be created
+	os.RemoveAll(dir)
+	if err := file.Rotate(); err == nil {
+		t.Fatal("Expected the rotation to fail")
+	}
+	if _, err := file.Write([]byte("lost\n")); err != nil {
+		t.Fatalf("Expected the old handle to stay open, got %v", err)
+	}
+
+	os.MkdirAll(dir, 0755)
+	if err := file.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	file.Write([]byte("after\n"))
+	if content, _ := os.ReadFile(path); string(content) != "after\n" {
+		t.Errorf("Expected logging to resume after the rotation, got %q", content)
+	}
+}
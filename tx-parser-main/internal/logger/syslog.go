@@ -0,0 +1,169 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSyslogAddress is the local syslog socket, also served by journald
+const DefaultSyslogAddress = "/dev/log"
+
+// syslogFacility is the daemon facility of RFC 3164
+const syslogFacility = 3
+
+// syslogSeverity maps a level to its RFC 3164 severity
+func syslogSeverity(level slog.Level) int {
+	switch {
+	case level >= levelFatal:
+		return 2 // critical
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
+
+// syslogWriter sends each record as one syslog message, reconnecting when
+// the socket is lost, for example when the syslog daemon restarts
+type syslogWriter struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+
+	mu       sync.Mutex
+	conn     net.Conn
+	severity int
+}
+
+// parseSyslogAddress splits an address such as udp://host:514 into its
+// network and address. Plain paths are Unix datagram sockets.
+func parseSyslogAddress(address string) (network, addr string, err error) {
+	if address == "" {
+		return "unixgram", DefaultSyslogAddress, nil
+	}
+	scheme, rest, ok := strings.Cut(address, "://")
+	if !ok {
+		return "unixgram", address, nil
+	}
+	switch scheme {
+	case "udp", "tcp", "unix", "unixgram":
+		return scheme, rest, nil
+	}
+	return "", "", fmt.Errorf("unsupported syslog network %q: expected udp, tcp, unix or unixgram", scheme)
+}
+
+// newSyslogWriter connects to the syslog socket at address
+func newSyslogWriter(address, tag string) (*syslogWriter, error) {
+	network, addr, err := parseSyslogAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	w := &syslogWriter{network: network, address: addr, tag: tag, hostname: hostname}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *syslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog at %s: %v", w.address, err)
+	}
+	w.conn = conn
+	return nil
+}
+
+// Write sends p, one formatted record, with the severity of that record.
+// Callers hold mu.
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "<%d>%s %s %s[%d]: ", syslogFacility*8+w.severity,
+		time.Now().Format(time.Stamp), w.hostname, w.tag, os.Getpid())
+	message.Write(bytes.TrimRight(p, "\n"))
+	if w.network == "tcp" || w.network == "unix" {
+		// Stream sockets need a delimiter between messages
+		message.WriteByte('\n')
+	}
+
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := w.conn.Write(message.Bytes()); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+		if _, err := w.conn.Write(message.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close closes the socket
+func (w *syslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// syslogHandler formats records as text without a time, which syslog adds,
+// and sends them with the severity of their level
+type syslogHandler struct {
+	w     *syslogWriter
+	inner slog.Handler
+}
+
+func newSyslogHandler(w *syslogWriter, level slog.Level) *syslogHandler {
+	return &syslogHandler{w: w, inner: slog.NewTextHandler(w, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return replaceAttr(groups, attr)
+		},
+	})}
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+	h.w.severity = syslogSeverity(record.Level)
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{w: h.w, inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{w: h.w, inner: h.inner.WithGroup(name)}
+}
@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslogAddress(t *testing.T) {
+	tests := []struct {
+		address, network, addr string
+	}{
+		{"", "unixgram", DefaultSyslogAddress},
+		{"/run/systemd/journal/syslog", "unixgram", "/run/systemd/journal/syslog"},
+		{"udp://logs:514", "udp", "logs:514"},
+		{"tcp://logs:601", "tcp", "logs:601"},
+	}
+	for _, tt := range tests {
+		network, addr, err := parseSyslogAddress(tt.address)
+		if err != nil || network != tt.network || addr != tt.addr {
+			t.Errorf("parseSyslogAddress(%q) = %s, %s, %v", tt.address, network, addr, err)
+		}
+	}
+	if _, _, err := parseSyslogAddress("http://logs"); err == nil {
+		t.Error("Expected an error for an unsupported network")
+	}
+}
+
+func TestMultipleSinks(t *testing.T) {
+	defer cleanup()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer conn.Close()
+
+	if err := Init(testLogFile, WithLevel(INFO), WithSyslog("udp://"+conn.LocalAddr().String(), "parser-test")); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	Debug("dropped everywhere")
+	Component("rpc").Warn("Node unreachable", "method", "eth_blockNumber")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2048)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("No syslog message received: %v", err)
+	}
+	message := string(buf[:n])
+	// Daemon facility (3) and warning severity (4)
+	if !strings.HasPrefix(message, "<28>") {
+		t.Errorf("Unexpected priority in %q", message)
+	}
+	for _, want := range []string{"parser-test[", `msg="Node unreachable"`, "component=rpc", "method=eth_blockNumber"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Expected %s in %q", want, message)
+		}
+	}
+	if strings.Contains(message, "time=") || strings.Contains(message, "dropped") {
+		t.Errorf("Unexpected syslog message %q", message)
+	}
+
+	content, _ := os.ReadFile(testLogFile)
+	if !strings.Contains(string(content), `msg="Node unreachable"`) || strings.Contains(string(content), "dropped") {
+		t.Errorf("Unexpected log file content %q", content)
+	}
+}
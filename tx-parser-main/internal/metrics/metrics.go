@@ -0,0 +1,337 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text exposition format, without external dependencies.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds suited to request and
+// storage latencies
+var DefaultBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry the components of the parser register their
+// metrics with
+var Default = NewRegistry()
+
+// labelSeparator joins label values into a series key. It cannot appear in
+// valid UTF-8 text.
+const labelSeparator = "\xff"
+
+// metric is a named family of series
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and writes them in the text format
+type Registry struct {
+	mu      sync.Mutex
+	names   []string
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// register adds a family, panicking on a duplicate name since that is a
+// programming error
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names = append(r.names, name)
+	sort.Strings(r.names)
+	r.metrics[name] = m
+}
+
+// WriteTo writes every family in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := make([]metric, 0, len(r.names))
+	for _, name := range r.names {
+		families = append(families, r.metrics[name])
+	}
+	r.mu.Unlock()
+
+	counter := &countingWriter{w: w}
+	buffered := bufio.NewWriter(counter)
+	for _, family := range families {
+		family.write(buffered)
+	}
+	err := buffered.Flush()
+	return counter.n, err
+}
+
+// Handler serves the registry in the text exposition format
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// desc is the name, help and label names shared by every kind of family
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, kind)
+}
+
+// key joins label values, checking that one is given per label name
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, labelSeparator)
+}
+
+// labelPairs formats the labels of a series, with extra appended pairs
+func (d desc) labelPairs(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, labelSeparator) {
+			pairs = append(pairs, d.labels[i]+`="`+escapeLabel(value)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys returns the series keys of a family in a stable order
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Counter is a family of monotonically increasing values
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name, help, labels}, series: make(map[string]float64)}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the series with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the series with the given label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic("metrics: counter " + c.name + " cannot decrease")
+	}
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.series[key] += value
+	c.mu.Unlock()
+}
+
+// Value returns the value of the series with the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.series[key]
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeHeader(w, "counter")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.series) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(key), formatFloat(c.series[key]))
+	}
+}
+
+// Gauge is a family of values that can go up and down
+type Gauge struct {
+	desc
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+// NewGauge registers a gauge with the given label names
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{name, help, labels}, series: make(map[string]float64)}
+	r.register(name, g)
+	return g
+}
+
+// Set sets the series with the given label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	g.series[key] = value
+	g.mu.Unlock()
+}
+
+// Value returns the value of the series with the given label values
+func (g *Gauge) Value(labelValues ...string) float64 {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.series[key]
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeHeader(w, "gauge")
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range sortedKeys(g.series) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelPairs(key), formatFloat(g.series[key]))
+	}
+}
+
+// Histogram is a family of observation distributions over fixed buckets
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given upper bounds, sorted
+// ascending, and label names
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name, help, labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe records a value in the series with the given label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// ObserveSince records the seconds elapsed since start
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Count returns the number of observations of the series with the given
+// label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.writeHeader(w, "histogram")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", formatFloat(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(key), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(key), s.count)
+	}
+}
+
+// GaugeFunc is a gauge whose value is read when the registry is written
+type GaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge without labels that calls fn on every scrape
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help}, fn: fn}
+	r.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
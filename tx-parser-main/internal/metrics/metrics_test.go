@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounter("test_requests_total", "Requests served", "route", "status")
+	height := registry.NewGauge("test_height", "Current height")
+	latency := registry.NewHistogram("test_latency_seconds", "Request latency", []float64{0.1, 1}, "route")
+	registry.NewGaugeFunc("test_answer", "The answer", func() float64 { return 42 })
+
+	requests.Inc("/subscribe", "200")
+	requests.Add(2, "/subscribe", "200")
+	requests.Inc(`/a"b`, "500")
+	height.Set(17)
+	latency.Observe(0.05, "/subscribe")
+	latency.Observe(0.5, "/subscribe")
+	latency.Observe(3, "/subscribe")
+
+	var out strings.Builder
+	if _, err := registry.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	want := `# HELP test_answer The answer
+# TYPE test_answer gauge
+test_answer 42
+# HELP test_height Current height
+# TYPE test_height gauge
+test_height 17
+# HELP test_latency_seconds Request latency
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/subscribe",le="0.1"} 1
+test_latency_seconds_bucket{route="/subscribe",le="1"} 2
+test_latency_seconds_bucket{route="/subscribe",le="+Inf"} 3
+test_latency_seconds_sum{route="/subscribe"} 3.55
+test_latency_seconds_count{route="/subscribe"} 3
+# HELP test_requests_total Requests served
+# TYPE test_requests_total counter
+test_requests_total{route="/a\"b",status="500"} 1
+test_requests_total{route="/subscribe",status="200"} 3
+`
+	if out.String() != want {
+		t.Errorf("Unexpected exposition:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	if requests.Value("/subscribe", "200") != 3 || latency.Count("/subscribe") != 3 || height.Value() != 17 {
+		t.Error("Unexpected values read back")
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("test_total", "Test", "label")
+
+	for name, fn := range map[string]func(){
+		"duplicate name":     func() { registry.NewGauge("test_total", "Test") },
+		"missing label":      func() { counter.Inc() },
+		"negative increment": func() { counter.Add(-1, "x") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic for %s", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_total", "Test").Inc()
+
+	rec := httptest.NewRecorder()
+	registry.Handler()(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "test_total 1\n") {
+		t.Errorf("Unexpected body %q", rec.Body.String())
+	}
+}
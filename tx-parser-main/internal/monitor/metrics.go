@@ -0,0 +1,22 @@
+package monitor
+
+import "blockchain-parser/internal/metrics"
+
+// Monitor metrics, exposed on /metrics
+var (
+	blocksProcessed     = metrics.Default.NewCounter("parser_blocks_processed_total", "Blocks processed by the monitor")
+	transactionsMatched = metrics.Default.NewCounter("parser_transactions_matched_total", "Transactions involving a subscribed address")
+	reorgsDetected      = metrics.Default.NewCounter("parser_reorgs_total", "Chain reorganisations detected")
+	monitorErrors       = metrics.Default.NewCounter("parser_monitor_errors_total", "Monitor failures by MonitorError code", "code")
+	currentBlockGauge   = metrics.Default.NewGauge("parser_current_block", "Latest processed block")
+	chainHeadGauge      = metrics.Default.NewGauge("parser_chain_head_block", "Latest block reported by the node")
+	headLagGauge        = metrics.Default.NewGauge("parser_head_lag_blocks", "Blocks the monitor trails the chain head")
+)
+
+// observeProgress updates the block gauges from the monitor status
+func (m *BlockMonitor) observeProgress() {
+	status := m.Status()
+	currentBlockGauge.Set(float64(status.CurrentBlock))
+	chainHeadGauge.Set(float64(status.ChainHead))
+	headLagGauge.Set(float64(status.Lag()))
+}
@@ -6,30 +6,113 @@ import (
 	"blockchain-parser/internal/notification"
 	"blockchain-parser/internal/parser"
 	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/tracing"
 	"blockchain-parser/internal/utils"
+	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 )
 
+// log is the logger of the block monitor
+var log = logger.Component("monitor")
+
+// maxBlockHashes bounds how many recent block hashes are kept for reorg detection
+const maxBlockHashes = 128
+
+// maxBlocksPerTick bounds how many blocks are processed per poll while
+// catching up, so a restored checkpoint far behind the head does not hold
+// up the head check and status updates
+const maxBlocksPerTick = 50
+
+// Publisher receives live events from the monitor, such as a stream hub
+type Publisher interface {
+	PublishTransaction(tx storage.Transaction, addresses []string)
+	PublishBlock(number int64, hash string, timestamp int64, transactions int)
+	PublishReorg(number int64, oldHash, newHash string)
+}
+
 // BlockMonitor watches for new blocks and processes their transactions
 type BlockMonitor struct {
 	parser    parser.Parser
 	rpcClient *parser.RPCClient
 	notifier  notification.NotificationService
+	publisher Publisher
+
+	// blockHashes holds the hashes of recently processed blocks
+	blockHashes map[int64]string
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Status is a snapshot of the progress of the monitor
+type Status struct {
+	// CurrentBlock is the latest processed block
+	CurrentBlock int64
+
+	// ChainHead is the latest block reported by the node, 0 before the
+	// first successful eth_blockNumber call
+	ChainHead int64
+
+	// HeadCheckedAt is when the chain head was last fetched successfully
+	HeadCheckedAt time.Time
+
+	// LastProcessedAt is when a block was last processed
+	LastProcessedAt time.Time
+
+	// LastError is the most recent failure, nil when none occurred
+	LastError   *MonitorError
+	LastErrorAt time.Time
+
+	// RPCEndpoint is the node the monitor reads from, without credentials
+	RPCEndpoint string
+}
+
+// Lag returns how many blocks the monitor trails the chain head
+func (s Status) Lag() int64 {
+	if s.ChainHead <= s.CurrentBlock {
+		return 0
+	}
+	return s.ChainHead - s.CurrentBlock
+}
+
+// Option configures optional BlockMonitor behaviour
+type Option func(*BlockMonitor)
+
+// WithPublisher publishes matched transactions, processed blocks and
+// detected reorgs to publisher
+func WithPublisher(publisher Publisher) Option {
+	return func(m *BlockMonitor) {
+		m.publisher = publisher
+	}
 }
 
-// NewBlockMonitor creates a new block monitor instance
-func NewBlockMonitor(p parser.Parser, rpc *parser.RPCClient, notifier notification.NotificationService) *BlockMonitor {
-	return &BlockMonitor{
-		parser:    p,
-		rpcClient: rpc,
-		notifier:  notifier,
+// NewBlockMonitor creates a new block monitor instance. The notifier may be
+// nil when the parser persists notifications in an outbox instead.
+func NewBlockMonitor(p parser.Parser, rpc *parser.RPCClient, notifier notification.NotificationService, opts ...Option) *BlockMonitor {
+	m := &BlockMonitor{
+		parser:      p,
+		rpcClient:   rpc,
+		notifier:    notifier,
+		blockHashes: make(map[int64]string),
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // StartMonitoring begins continuous monitoring of new blocks.
 func (m *BlockMonitor) StartMonitoring() {
+	m.Run(context.Background())
+}
+
+// Run monitors new blocks until ctx is cancelled. Cancellation is checked
+// between blocks, so a block being processed is always completed.
+func (m *BlockMonitor) Run(ctx context.Context) {
 	fmt.Println("Starting block monitoring...")
 
 	// Add rate limiting for public nodes
@@ -38,15 +121,53 @@ func (m *BlockMonitor) StartMonitoring() {
 
 	for {
 		select {
+		case <-ctx.Done():
+			log.Info("Block monitoring stopped", "block", m.parser.GetCurrentBlock())
+			return
 		case <-rateLimiter.C:
-			m.processNewBlocks()
+			if err := m.processNewBlocks(ctx); err != nil {
+				m.recordError(err)
+			}
 		}
 	}
 }
 
+// Status returns the progress of the monitor
+func (m *BlockMonitor) Status() Status {
+	m.mu.Lock()
+	status := m.status
+	m.mu.Unlock()
+
+	status.CurrentBlock = m.parser.GetCurrentBlock()
+	if m.rpcClient != nil {
+		status.RPCEndpoint = m.rpcClient.Endpoint()
+	}
+	return status
+}
+
+// recordError keeps the last failure for Status, logging it when it differs
+// from the previous one so an unreachable node does not flood the log
+func (m *BlockMonitor) recordError(err error) {
+	var monitorErr *MonitorError
+	if !errors.As(err, &monitorErr) {
+		monitorErr = NewMonitorError(ErrTransactionProcess, "Block processing failed", err)
+	}
+
+	monitorErrors.Inc(monitorErr.Code)
+	m.mu.Lock()
+	previous := m.status.LastError
+	m.status.LastError = monitorErr
+	m.status.LastErrorAt = time.Now()
+	m.mu.Unlock()
+
+	if previous == nil || previous.Error() != monitorErr.Error() {
+		log.Error("Block monitoring failed", "code", monitorErr.Code, "error", monitorErr)
+	}
+}
+
 // processNewBlocks checks for and processes any new blocks
-func (m *BlockMonitor) processNewBlocks() error {
-	result, err := m.rpcClient.MakeCall("eth_blockNumber", nil)
+func (m *BlockMonitor) processNewBlocks(ctx context.Context) error {
+	result, err := m.rpcClient.MakeCallContext(ctx, "eth_blockNumber", nil)
 	if err != nil {
 		return NewMonitorError(ErrBlockNumberFetch, "Failed to fetch block number", err)
 	}
@@ -61,24 +182,53 @@ func (m *BlockMonitor) processNewBlocks() error {
 		return NewMonitorError(ErrBlockNumberParse, "Failed to parse block number", err)
 	}
 
+	m.mu.Lock()
+	m.status.ChainHead = latestBlock
+	m.status.HeadCheckedAt = time.Now()
+	m.mu.Unlock()
+	m.observeProgress()
+
 	currentBlock := m.parser.GetCurrentBlock()
-	if latestBlock > currentBlock {
-		logger.Info("Processing new block: %d (current: %d)", latestBlock, currentBlock)
-		if err := m.processBlock(latestBlock); err != nil {
+	if latestBlock <= currentBlock {
+		log.DebugContext(ctx, "No new blocks to process", "current", currentBlock, "latest", latestBlock)
+		return nil
+	}
+
+	// Blocks missed since a restored checkpoint are processed in order, a
+	// fresh start without a checkpoint begins at the head
+	next := currentBlock + 1
+	if currentBlock == 0 {
+		next = latestBlock
+	}
+	last := min(latestBlock, next+maxBlocksPerTick-1)
+	log.InfoContext(ctx, "Processing new blocks", "from", next, "to", last, "latest", latestBlock)
+	for block := next; block <= last; block++ {
+		if block > next && ctx.Err() != nil {
+			break
+		}
+		// A started block is always completed: cancelling its receipt calls
+		// would store transactions without status or fee and still mark
+		// the block processed, so only the trace is taken from ctx
+		if err := m.processBlock(context.WithoutCancel(ctx), block); err != nil {
 			return err
 		}
-	} else {
-		logger.Debug("No new blocks to process. Current: %d, Latest: %d", currentBlock, latestBlock)
 	}
 
 	return nil
 }
 
-// processBlock processes a single block and its transactions
-func (m *BlockMonitor) processBlock(blockNumber int64) error {
-	logger.Debug("Fetching block details for block %d", blockNumber)
+// processBlock processes a single block and its transactions. The block is
+// the root span of a trace covering its RPC calls, storage writes and
+// notifications.
+func (m *BlockMonitor) processBlock(ctx context.Context, blockNumber int64) (err error) {
+	ctx, span := tracing.Start(ctx, "monitor.process_block", tracing.Int64("block.number", blockNumber))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	log.DebugContext(ctx, "Fetching block details", "block", blockNumber)
 
-	blockResult, err := m.rpcClient.MakeCall("eth_getBlockByNumber",
+	blockResult, err := m.rpcClient.MakeCallContext(ctx, "eth_getBlockByNumber",
 		[]interface{}{fmt.Sprintf("0x%x", blockNumber), true})
 	if err != nil {
 		return NewMonitorError(ErrBlockFetch, fmt.Sprintf("Failed to fetch block %d", blockNumber), err)
@@ -91,7 +241,7 @@ func (m *BlockMonitor) processBlock(blockNumber int64) error {
 
 	transactions, ok := block["transactions"].([]interface{})
 	if !ok {
-		logger.Warn("No transactions found in block %d", blockNumber)
+		log.WarnContext(ctx, "No transactions found in block", "block", blockNumber)
 		return nil
 	}
 
@@ -105,65 +255,130 @@ func (m *BlockMonitor) processBlock(blockNumber int64) error {
 		return NewMonitorError(ErrTimestampParse, "Failed to parse block timestamp", err)
 	}
 
-	logger.Info("Processing %d transactions from block %d", len(transactions), blockNumber)
+	hash, _ := block["hash"].(string)
+	parentHash, _ := block["parentHash"].(string)
+	m.checkReorg(blockNumber, hash, parentHash)
+
+	log.InfoContext(ctx, "Processing transactions", "block", blockNumber, "transactions", len(transactions))
+	matched := 0
 
 	for i, tx := range transactions {
 		txMap, ok := tx.(map[string]interface{})
 		if !ok {
-			logger.Error("Invalid transaction format at index %d", i)
+			log.ErrorContext(ctx, "Invalid transaction format", "block", blockNumber, "index", i)
 			continue
 		}
 
-		processedTx, err := m.parser.ProcessTransaction(txMap, timestamp)
+		processed, err := m.parser.ProcessTransaction(ctx, txMap, timestamp)
 		if err != nil {
-			logger.Error("Failed to process transaction: %v", err)
+			log.ErrorContext(ctx, "Failed to process transaction", "block", blockNumber, "index", i, "error", err)
 			continue
 		}
 
-		if processedTx != nil {
-			logger.Debug("Successfully processed transaction %s", processedTx.Hash)
-			m.notifyTransaction(*processedTx)
+		// A transaction yields a record per token transfer it logged
+		for _, processedTx := range processed {
+			log.DebugContext(ctx, "Successfully processed transaction", "hash", processedTx.Hash, "token", processedTx.Token)
+			matched++
+			transactionsMatched.Inc()
+			m.notifyTransaction(ctx, processedTx)
+			m.publishTransaction(processedTx)
 		}
 	}
 
+	_, update := tracing.Start(ctx, "storage.update_current_block", tracing.Int64("block.number", blockNumber))
 	m.parser.UpdateCurrentBlock(blockNumber)
-	logger.Info("Successfully processed block %d", blockNumber)
+	update.End()
+	m.mu.Lock()
+	m.status.LastProcessedAt = time.Now()
+	m.mu.Unlock()
+	blocksProcessed.Inc()
+	m.observeProgress()
+	if m.publisher != nil {
+		m.publisher.PublishBlock(blockNumber, hash, timestamp, matched)
+	}
+	span.SetAttributes(tracing.Int64("block.transactions", int64(len(transactions))), tracing.Int64("block.matched", int64(matched)))
+	log.InfoContext(ctx, "Successfully processed block", "block", blockNumber, "matched", matched)
 	return nil
 }
 
 // notifyTransaction sends notifications for relevant transactions
-func (m *BlockMonitor) notifyTransaction(tx storage.Transaction) {
-	isIncoming := m.parser.IsSubscribed(tx.ToAddress)
-	direction := "Outgoing"
-	address := tx.FromAddress
+func (m *BlockMonitor) notifyTransaction(ctx context.Context, tx storage.Transaction) {
+	log.DebugContext(ctx, "Transaction details",
+		"hash", tx.Hash,
+		"from", tx.FromAddress,
+		"to", tx.ToAddress,
+		"value_eth", tx.Value,
+		"block", tx.BlockNumber,
+		"time", time.Unix(tx.Timestamp, 0).UTC())
+
+	// Without a notifier the parser has already queued notifications in the outbox
+	if m.notifier == nil {
+		return
+	}
+
+	for _, n := range notification.ForTransaction(tx, m.parser.IsSubscribed) {
+		log.InfoContext(ctx, "Transaction detected", "hash", tx.Hash, "address", n.Address)
+		notifyCtx, span := tracing.Start(ctx, "notification.notify", tracing.String("notification.address", n.Address))
+		if err := m.notifier.Notify(n); err != nil {
+			span.RecordError(err)
+			log.ErrorContext(notifyCtx, "Failed to notify", "hash", tx.Hash, "address", n.Address, "error", err)
+		}
+		span.End()
+	}
+}
 
-	if isIncoming {
-		direction = "Incoming"
-		address = tx.ToAddress
+// checkReorg records the hash of a processed block and reports a reorg when
+// the parent hash no longer matches the block processed before it
+func (m *BlockMonitor) checkReorg(blockNumber int64, hash, parentHash string) {
+	if previous, ok := m.blockHashes[blockNumber-1]; ok && parentHash != "" && previous != parentHash {
+		log.Warn("Chain reorganisation detected", "block", blockNumber-1, "old_hash", previous, "new_hash", parentHash)
+		reorgsDetected.Inc()
+		if m.publisher != nil {
+			m.publisher.PublishReorg(blockNumber-1, previous, parentHash)
+		}
+		m.blockHashes[blockNumber-1] = parentHash
 	}
 
-	logger.Info("%s transaction detected for %s", direction, address)
-	logger.Debug("Transaction details: Hash: %s, From: %s, To: %s, Value: %f ETH, Block: %d, Time: %s",
-		tx.Hash,
-		tx.FromAddress,
-		tx.ToAddress,
-		tx.Value,
-		tx.BlockNumber,
-		time.Unix(tx.Timestamp, 0).Format("2006-01-02 15:04:05"))
+	if hash != "" {
+		m.blockHashes[blockNumber] = hash
+	}
+	if len(m.blockHashes) > maxBlockHashes {
+		for number := range m.blockHashes {
+			if number <= blockNumber-maxBlockHashes {
+				delete(m.blockHashes, number)
+			}
+		}
+	}
+}
 
-	m.notifier.Notify(notification.Notification{
-		Type:        notification.TransactionReceived,
-		Address:     address,
-		Transaction: tx,
-		Timestamp:   tx.Timestamp,
-	})
+// publishTransaction publishes a matched transaction for its subscribed parties
+func (m *BlockMonitor) publishTransaction(tx storage.Transaction) {
+	if m.publisher == nil {
+		return
+	}
+	var addresses []string
+	for _, address := range []string{tx.FromAddress, tx.ToAddress} {
+		if address != "" && m.parser.IsSubscribed(address) && !containsFold(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	m.publisher.PublishTransaction(tx, addresses)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
 }
 
 // parseHexToInt64 converts a hex string to int64
 func (m *BlockMonitor) parseHexToInt64(hex string) (int64, error) {
 	value, err := utils.String2Int64(hex, 16)
 	if err != nil {
-		logger.Error("Failed to parse hex value %s: %v", hex, err)
+		log.Error("Failed to parse hex value", "value", hex, "error", err)
 		return 0, err
 	}
 	return value, nil
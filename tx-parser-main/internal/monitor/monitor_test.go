@@ -1,3 +1,244 @@
 package monitor
 
-//TODO: implement monitor ut here
+import (
+	"blockchain-parser/config"
+	"blockchain-parser/internal/parser"
+	"blockchain-parser/internal/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testSender   = "0x1111111111111111111111111111111111111111"
+	testReceiver = "0x2222222222222222222222222222222222222222"
+)
+
+// recordingPublisher records the events published by the monitor
+type recordingPublisher struct {
+	transactions [][]string
+	blocks       []int64
+	reorgs       []int64
+}
+
+func (r *recordingPublisher) PublishTransaction(tx storage.Transaction, addresses []string) {
+	r.transactions = append(r.transactions, addresses)
+}
+
+func (r *recordingPublisher) PublishBlock(number int64, hash string, timestamp int64, transactions int) {
+	r.blocks = append(r.blocks, number)
+}
+
+func (r *recordingPublisher) PublishReorg(number int64, oldHash, newHash string) {
+	r.reorgs = append(r.reorgs, number)
+}
+
+func TestCheckReorg(t *testing.T) {
+	publisher := &recordingPublisher{}
+	m := NewBlockMonitor(parser.NewParser(storage.NewMemoryStorage(), nil), nil, nil, WithPublisher(publisher))
+
+	m.checkReorg(10, "0xa10", "0xa9")
+	m.checkReorg(11, "0xa11", "0xa10")
+	if len(publisher.reorgs) != 0 {
+		t.Fatalf("Expected no reorg on a linear chain, got %v", publisher.reorgs)
+	}
+
+	// Block 11 was replaced, so block 12 points at a different parent
+	m.checkReorg(12, "0xb12", "0xb11")
+	if len(publisher.reorgs) != 1 || publisher.reorgs[0] != 11 {
+		t.Errorf("Expected a reorg at block 11, got %v", publisher.reorgs)
+	}
+	if m.blockHashes[11] != "0xb11" {
+		t.Errorf("Expected the new hash of block 11 to be recorded, got %s", m.blockHashes[11])
+	}
+
+	for number := int64(13); number < 13+2*maxBlockHashes; number++ {
+		m.checkReorg(number, "0x", "0x")
+	}
+	if len(m.blockHashes) > maxBlockHashes+1 {
+		t.Errorf("Expected block hashes to stay bounded, got %d", len(m.blockHashes))
+	}
+}
+
+func TestPublishTransaction(t *testing.T) {
+	publisher := &recordingPublisher{}
+	p := parser.NewParser(storage.NewMemoryStorage(), nil)
+	p.Subscribe(testSender)
+	p.Subscribe(testReceiver)
+	m := NewBlockMonitor(p, nil, nil, WithPublisher(publisher))
+
+	m.publishTransaction(storage.Transaction{Hash: "0xabc", FromAddress: testSender, ToAddress: testReceiver})
+	m.publishTransaction(storage.Transaction{Hash: "0xdef", FromAddress: testSender, ToAddress: testSender})
+
+	if len(publisher.transactions) != 2 || len(publisher.transactions[0]) != 2 || len(publisher.transactions[1]) != 1 {
+		t.Errorf("Expected both parties, then one self-transfer party, got %v", publisher.transactions)
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	m := NewBlockMonitor(parser.NewParser(storage.NewMemoryStorage(), nil), nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Run to return after cancellation")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	failing := false
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var req parser.JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		var result interface{} = "0x10"
+		if req.Method == "eth_getBlockByNumber" {
+			result = map[string]interface{}{"hash": "0xb16", "timestamp": "0x5", "transactions": []interface{}{}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	}))
+	defer node.Close()
+
+	p := parser.NewParser(storage.NewMemoryStorage(), nil)
+	p.UpdateCurrentBlock(12)
+	m := NewBlockMonitor(p, parser.NewRPCClient(&config.Config{RPCEndpoint: node.URL + "/v3/key"}), nil)
+	if status := m.Status(); status.ChainHead != 0 || status.Lag() != 0 || status.RPCEndpoint != node.URL {
+		t.Errorf("Unexpected initial status %+v", status)
+	}
+
+	processed := blocksProcessed.Value()
+	if err := m.processNewBlocks(context.Background()); err != nil {
+		t.Fatalf("Processing failed: %v", err)
+	}
+	if blocksProcessed.Value() != processed+4 || chainHeadGauge.Value() != 16 || headLagGauge.Value() != 0 {
+		t.Error("Expected the block metrics to be updated")
+	}
+	status := m.Status()
+	if status.CurrentBlock != 16 || status.ChainHead != 16 || status.Lag() != 0 {
+		t.Errorf("Unexpected status after processing %+v", status)
+	}
+	if status.HeadCheckedAt.IsZero() || status.LastProcessedAt.IsZero() || status.LastError != nil {
+		t.Errorf("Expected the head check and processing time to be recorded, got %+v", status)
+	}
+
+	failing = true
+	if err := m.processNewBlocks(context.Background()); err != nil {
+		m.recordError(err)
+	}
+	status = m.Status()
+	if status.LastError == nil || status.LastError.Code != ErrBlockNumberFetch || status.LastErrorAt.IsZero() {
+		t.Errorf("Expected the fetch failure to be recorded, got %+v", status)
+	}
+	if status.ChainHead != 16 {
+		t.Errorf("Expected the last known head to be kept, got %d", status.ChainHead)
+	}
+}
+
+func TestStatusLag(t *testing.T) {
+	if lag := (Status{CurrentBlock: 90, ChainHead: 100}).Lag(); lag != 10 {
+		t.Errorf("Expected a lag of 10, got %d", lag)
+	}
+	if lag := (Status{CurrentBlock: 100, ChainHead: 90}).Lag(); lag != 0 {
+		t.Errorf("Expected no lag ahead of a stale head, got %d", lag)
+	}
+}
+
+func TestBlockCompletesAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req parser.JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		var result interface{} = "0x10"
+		switch req.Method {
+		case "eth_getBlockByNumber":
+			// Shutdown is requested while the block is being processed
+			cancel()
+			result = map[string]interface{}{"hash": "0xb16", "timestamp": "0x5", "transactions": []interface{}{
+				map[string]interface{}{"hash": "0xabc", "from": testSender, "to": testReceiver, "value": "0x1", "blockNumber": "0x10"},
+			}}
+		case "eth_getTransactionReceipt":
+			result = map[string]interface{}{"status": "0x1", "gasUsed": "0x5208", "effectiveGasPrice": "0x1"}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	}))
+	defer node.Close()
+
+	rpcClient := parser.NewRPCClient(&config.Config{RPCEndpoint: node.URL})
+	store := storage.NewMemoryStorage()
+	p := parser.NewParser(store, rpcClient)
+	p.Subscribe(testReceiver)
+	p.UpdateCurrentBlock(15)
+	m := NewBlockMonitor(p, rpcClient, nil)
+
+	if err := m.processNewBlocks(ctx); err != nil {
+		t.Fatalf("Processing failed: %v", err)
+	}
+	transactions := p.GetTransactions(testReceiver)
+	if len(transactions) != 1 || transactions[0].Status != storage.StatusSuccess {
+		t.Fatalf("Expected the receipt to be applied despite the cancellation, got %+v", transactions)
+	}
+	if p.GetCurrentBlock() != 16 {
+		t.Errorf("Expected block 16 to be processed, got %d", p.GetCurrentBlock())
+	}
+}
+
+func TestCatchUpFromCheckpoint(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req parser.JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		var result interface{} = fmt.Sprintf("0x%x", 100+maxBlocksPerTick)
+		if req.Method == "eth_getBlockByNumber" {
+			number := req.Params[0].(string)
+			mu.Lock()
+			fetched = append(fetched, number)
+			mu.Unlock()
+			result = map[string]interface{}{"hash": "0xb" + number, "timestamp": "0x5", "transactions": []interface{}{}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+	}))
+	defer node.Close()
+
+	// The checkpoint restored from STATE_FILE trails the head
+	store := storage.NewMemoryStorage()
+	store.UpdateCurrentBlock(97)
+	p := parser.NewParser(store, nil)
+	m := NewBlockMonitor(p, parser.NewRPCClient(&config.Config{RPCEndpoint: node.URL}), nil)
+
+	if err := m.processNewBlocks(context.Background()); err != nil {
+		t.Fatalf("Processing failed: %v", err)
+	}
+	if len(fetched) != maxBlocksPerTick || fetched[0] != "0x62" || fetched[1] != "0x63" {
+		t.Fatalf("Expected %d blocks from 98 in order, got %v", maxBlocksPerTick, fetched)
+	}
+	if current := p.GetCurrentBlock(); current != 97+maxBlocksPerTick {
+		t.Errorf("Expected the first %d missed blocks to be processed, got block %d", maxBlocksPerTick, current)
+	}
+
+	if err := m.processNewBlocks(context.Background()); err != nil {
+		t.Fatalf("Processing failed: %v", err)
+	}
+	if current := p.GetCurrentBlock(); current != 100+maxBlocksPerTick {
+		t.Errorf("Expected the monitor to reach the head, got block %d", current)
+	}
+	if len(fetched) != maxBlocksPerTick+3 {
+		t.Errorf("Expected every missed block to be fetched once, got %d fetches", len(fetched))
+	}
+}
@@ -0,0 +1,397 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ChatFormat selects the incoming-webhook message schema of a chat service
+type ChatFormat string
+
+const (
+	// ChatSlack formats messages as Slack Block Kit blocks
+	ChatSlack ChatFormat = "slack"
+
+	// ChatDiscord formats messages as Discord embeds
+	ChatDiscord ChatFormat = "discord"
+
+	// ChatTeams formats messages as Microsoft Teams adaptive cards
+	ChatTeams ChatFormat = "teams"
+)
+
+// amountDecimals bounds the fraction digits shown in chat messages
+const amountDecimals = 6
+
+// DefaultExplorers maps chain names to their block explorer base URL
+var DefaultExplorers = map[string]string{
+	"mainnet": "https://etherscan.io",
+	"sepolia": "https://sepolia.etherscan.io",
+	"holesky": "https://holesky.etherscan.io",
+}
+
+// Explorer builds block explorer links. An empty BaseURL disables links.
+type Explorer struct {
+	BaseURL string
+}
+
+// NewExplorer returns the explorer of chain, or baseURL when it is set
+func NewExplorer(chain, baseURL string) Explorer {
+	if baseURL == "" {
+		baseURL = DefaultExplorers[strings.ToLower(chain)]
+	}
+	return Explorer{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// TxURL returns the explorer page of a transaction
+func (e Explorer) TxURL(hash string) string {
+	if e.BaseURL == "" {
+		return ""
+	}
+	return e.BaseURL + "/tx/" + hash
+}
+
+// AddressURL returns the explorer page of an address
+func (e Explorer) AddressURL(address string) string {
+	if e.BaseURL == "" {
+		return ""
+	}
+	return e.BaseURL + "/address/" + address
+}
+
+// ChatNotificationService posts notifications to a Slack, Discord or Teams
+// incoming webhook in the native message schema of the service
+type ChatNotificationService struct {
+	format   ChatFormat
+	url      string
+	explorer Explorer
+	client   *http.Client
+}
+
+// NewChatNotificationService creates a chat notifier posting to webhookURL
+func NewChatNotificationService(format ChatFormat, webhookURL string, explorer Explorer) *ChatNotificationService {
+	return &ChatNotificationService{
+		format:   format,
+		url:      webhookURL,
+		explorer: explorer,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify posts the formatted notification
+func (s *ChatNotificationService) Notify(n Notification) error {
+	message, err := FormatChat(s.format, n, s.explorer)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error encoding %s message: %v", s.format, err)
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s delivery failed: %v", s.format, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s delivery failed: unexpected status code: %d", s.format, resp.StatusCode)
+	}
+	return nil
+}
+
+// FormatChat renders a notification in the message schema of format
+func FormatChat(format ChatFormat, n Notification, explorer Explorer) (map[string]interface{}, error) {
+	switch format {
+	case ChatSlack:
+		return formatSlack(newChatMessage(n, explorer)), nil
+	case ChatDiscord:
+		return formatDiscord(newChatMessage(n, explorer)), nil
+	case ChatTeams:
+		return formatTeams(newChatMessage(n, explorer)), nil
+	default:
+		return nil, fmt.Errorf("unsupported chat format %q", format)
+	}
+}
+
+// chatMessage holds the service-independent parts of a chat message
+type chatMessage struct {
+	title  string
+	link   string
+	facts  [][2]string
+	time   time.Time
+	failed bool
+}
+
+// maxDigestFacts bounds how many transactions a chat digest lists
+const maxDigestFacts = 10
+
+func newChatMessage(n Notification, explorer Explorer) chatMessage {
+	if n.Digest != nil && n.Digest.Summary != nil {
+		return newChatSummary(n, explorer)
+	}
+	if n.Digest != nil {
+		return newChatDigest(n, explorer)
+	}
+	tx := n.Transaction
+
+	amount := formatAmount(amountEther(tx), tx.Asset())
+	var title string
+	switch n.Type {
+	case TransactionSent:
+		title = fmt.Sprintf("%s sent %s", subjectName(n), amount)
+	case TransactionSelf:
+		title = fmt.Sprintf("%s sent %s to itself", subjectName(n), amount)
+	default:
+		title = fmt.Sprintf("%s received %s", subjectName(n), amount)
+	}
+
+	facts := [][2]string{
+		{"From", linkAddress(explorer, tx.FromAddress)},
+		{"To", linkAddress(explorer, tx.ToAddress)},
+		{"Block", fmt.Sprintf("%d", tx.BlockNumber)},
+		{"Hash", tx.Hash},
+	}
+	if tx.Status != "" {
+		facts = append(facts, [2]string{"Status", tx.Status})
+	}
+
+	return chatMessage{
+		title:  title,
+		link:   explorer.TxURL(tx.Hash),
+		facts:  facts,
+		time:   time.Unix(tx.Timestamp, 0).UTC(),
+		failed: tx.Status == storage.StatusFailed,
+	}
+}
+
+// newChatDigest lists the first transactions of a digest
+func newChatDigest(n Notification, explorer Explorer) chatMessage {
+	held := n.Digest.Notifications
+	facts := make([][2]string, 0, maxDigestFacts+1)
+	for i, h := range held {
+		if i == maxDigestFacts {
+			facts = append(facts, [2]string{"…", fmt.Sprintf("%d more", len(held)-maxDigestFacts)})
+			break
+		}
+		hash := h.Transaction.Hash
+		if url := explorer.TxURL(hash); url != "" {
+			hash = fmt.Sprintf("[%s](%s)", shortAddress(hash), url)
+		}
+		facts = append(facts, [2]string{formatAmount(amountEther(h.Transaction), h.Transaction.Asset()), hash})
+	}
+
+	return chatMessage{
+		title: fmt.Sprintf("%s digest: %d transactions", subjectName(n), len(held)),
+		link:  explorer.AddressURL(n.Address),
+		facts: facts,
+		time:  time.Unix(n.Timestamp, 0).UTC(),
+	}
+}
+
+// newChatSummary lists the totals and largest transfers of a summary
+func newChatSummary(n Notification, explorer Explorer) chatMessage {
+	summary := n.Digest.Summary
+	facts := [][2]string{
+		{"Transactions", fmt.Sprintf("%d (%d in, %d out, %d self)", summary.Transactions, summary.Incoming, summary.Outgoing, summary.Self)},
+		{"Total in", formatAmount(summary.TotalIn, storage.NativeAsset)},
+		{"Total out", formatAmount(summary.TotalOut, storage.NativeAsset)},
+		{"Failed", fmt.Sprintf("%d", len(summary.Failed))},
+	}
+	for i, tx := range summary.Largest {
+		hash := tx.Hash
+		if url := explorer.TxURL(hash); url != "" {
+			hash = fmt.Sprintf("[%s](%s)", shortAddress(hash), url)
+		}
+		facts = append(facts, [2]string{fmt.Sprintf("Largest #%d: %s", i+1, formatAmount(amountEther(tx), tx.Asset())), hash})
+	}
+
+	return chatMessage{
+		title:  fmt.Sprintf("%s %s summary: %d transactions", subjectName(n), summary.Period, summary.Transactions),
+		link:   explorer.AddressURL(n.Address),
+		facts:  facts,
+		time:   time.Unix(n.Digest.End, 0).UTC(),
+		failed: len(summary.Failed) > 0,
+	}
+}
+
+// subjectName returns the subscription label, or a shortened address
+func subjectName(n Notification) string {
+	if n.Label != "" {
+		return fmt.Sprintf("%s (%s)", n.Label, shortAddress(n.Address))
+	}
+	return shortAddress(n.Address)
+}
+
+// shortAddress abbreviates an address to its first and last four hex digits
+func shortAddress(address string) string {
+	if len(address) <= 12 {
+		return address
+	}
+	return address[:6] + "…" + address[len(address)-4:]
+}
+
+// linkAddress returns the address as a markdown link when an explorer is set
+func linkAddress(explorer Explorer, address string) string {
+	if address == "" {
+		return "(contract creation)"
+	}
+	if url := explorer.AddressURL(address); url != "" {
+		return fmt.Sprintf("[%s](%s)", shortAddress(address), url)
+	}
+	return address
+}
+
+// formatAmount groups the integer digits of an ether amount, trims the
+// fraction to amountDecimals digits and appends the asset symbol
+func formatAmount(amount, asset string) string {
+	negative := strings.HasPrefix(amount, "-")
+	amount = strings.TrimPrefix(amount, "-")
+
+	integer, fraction, _ := strings.Cut(amount, ".")
+	if len(fraction) > amountDecimals {
+		fraction = fraction[:amountDecimals]
+	}
+	fraction = strings.TrimRight(fraction, "0")
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(digit)
+	}
+
+	formatted := grouped.String()
+	if fraction != "" {
+		formatted += "." + fraction
+	}
+	if negative {
+		formatted = "-" + formatted
+	}
+	if asset != storage.NativeAsset {
+		asset = shortAddress(asset)
+	}
+	return formatted + " " + asset
+}
+
+// formatSlack renders a Slack Block Kit message
+func formatSlack(m chatMessage) map[string]interface{} {
+	fields := make([]map[string]interface{}, 0, len(m.facts))
+	for _, fact := range m.facts {
+		fields = append(fields, map[string]interface{}{
+			"type": "mrkdwn",
+			"text": fmt.Sprintf("*%s*\n%s", fact[0], slackLinks(fact[1])),
+		})
+	}
+
+	blocks := []map[string]interface{}{
+		{"type": "header", "text": map[string]interface{}{"type": "plain_text", "text": m.title}},
+		{"type": "section", "fields": fields},
+		{"type": "context", "elements": []map[string]interface{}{
+			{"type": "mrkdwn", "text": m.time.Format("2006-01-02 15:04:05 UTC")},
+		}},
+	}
+	if m.link != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "actions",
+			"elements": []map[string]interface{}{{
+				"type": "button",
+				"text": map[string]interface{}{"type": "plain_text", "text": "View transaction"},
+				"url":  m.link,
+			}},
+		})
+	}
+
+	return map[string]interface{}{
+		"text":   m.title,
+		"blocks": blocks,
+	}
+}
+
+// slackLinks converts markdown links to Slack's <url|text> syntax
+func slackLinks(text string) string {
+	if !strings.HasPrefix(text, "[") {
+		return text
+	}
+	label, url, ok := strings.Cut(strings.TrimPrefix(text, "["), "](")
+	if !ok {
+		return text
+	}
+	return fmt.Sprintf("<%s|%s>", strings.TrimSuffix(url, ")"), label)
+}
+
+// Embed colours used for Discord messages
+const (
+	discordColorSuccess = 0x2ecc71
+	discordColorFailed  = 0xe74c3c
+)
+
+// formatDiscord renders a Discord webhook message with one embed
+func formatDiscord(m chatMessage) map[string]interface{} {
+	fields := make([]map[string]interface{}, 0, len(m.facts))
+	for _, fact := range m.facts {
+		fields = append(fields, map[string]interface{}{
+			"name":   fact[0],
+			"value":  fact[1],
+			"inline": fact[0] != "Hash",
+		})
+	}
+
+	color := discordColorSuccess
+	if m.failed {
+		color = discordColorFailed
+	}
+
+	embed := map[string]interface{}{
+		"title":     m.title,
+		"color":     color,
+		"fields":    fields,
+		"timestamp": m.time.Format(time.RFC3339),
+	}
+	if m.link != "" {
+		embed["url"] = m.link
+	}
+	return map[string]interface{}{
+		"embeds": []map[string]interface{}{embed},
+	}
+}
+
+// formatTeams renders a Microsoft Teams message holding an adaptive card
+func formatTeams(m chatMessage) map[string]interface{} {
+	facts := make([]map[string]interface{}, 0, len(m.facts))
+	for _, fact := range m.facts {
+		facts = append(facts, map[string]interface{}{"title": fact[0], "value": fact[1]})
+	}
+
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []map[string]interface{}{
+			{"type": "TextBlock", "text": m.title, "weight": "Bolder", "size": "Medium", "wrap": true},
+			{"type": "FactSet", "facts": facts},
+			{"type": "TextBlock", "text": m.time.Format("2006-01-02 15:04:05 UTC"), "isSubtle": true, "size": "Small"},
+		},
+	}
+	if m.link != "" {
+		card["actions"] = []map[string]interface{}{
+			{"type": "Action.OpenUrl", "title": "View transaction", "url": m.link},
+		}
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     card,
+		}},
+	}
+}
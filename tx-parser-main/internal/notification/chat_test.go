@@ -0,0 +1,131 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testChatNotification() Notification {
+	n := testNotification()
+	n.Address = "0x1234567890123456789012345678901234567890"
+	n.Transaction.ToAddress = n.Address
+	n.Transaction.FromAddress = "0xabcdefabcdefabcdefabcdefabcdefabcdefabcd"
+	n.Transaction.ValueWei = "1234567891234567891234"
+	n.Label = "Treasury"
+	return n
+}
+
+func TestFormatAmount(t *testing.T) {
+	testCases := []struct {
+		amount   string
+		asset    string
+		expected string
+	}{
+		{"1", "ETH", "1 ETH"},
+		{"1234.5", "ETH", "1,234.5 ETH"},
+		{"1234567.123456789", "ETH", "1,234,567.123456 ETH"},
+		{"0.000000001", "ETH", "0 ETH"},
+		{"-1000", "ETH", "-1,000 ETH"},
+		{"5", "0xabcdefabcdefabcdefabcdefabcdefabcdefabcd", "5 0xabcd…abcd"},
+	}
+
+	for _, tc := range testCases {
+		if got := formatAmount(tc.amount, tc.asset); got != tc.expected {
+			t.Errorf("formatAmount(%q, %q) = %q, want %q", tc.amount, tc.asset, got, tc.expected)
+		}
+	}
+}
+
+func TestNewExplorer(t *testing.T) {
+	if url := NewExplorer("sepolia", "").TxURL("0xabc"); url != "https://sepolia.etherscan.io/tx/0xabc" {
+		t.Errorf("Unexpected sepolia tx URL %q", url)
+	}
+	if url := NewExplorer("sepolia", "https://explorer.example.com/").AddressURL("0x1"); url != "https://explorer.example.com/address/0x1" {
+		t.Errorf("Expected override to win, got %q", url)
+	}
+	if url := NewExplorer("unknown", "").TxURL("0xabc"); url != "" {
+		t.Errorf("Expected no link for unknown chain, got %q", url)
+	}
+}
+
+func TestFormatChat(t *testing.T) {
+	explorer := NewExplorer("mainnet", "")
+	n := testChatNotification()
+
+	testCases := []struct {
+		format ChatFormat
+		want   []string
+	}{
+		{ChatSlack, []string{`"blocks"`, `"type":"header"`, "Treasury (0x1234…7890) received 1,234.567891 ETH", "<https://etherscan.io/address/0xabcdefabcdefabcdefabcdefabcdefabcdefabcd|0xabcd…abcd>", "https://etherscan.io/tx/0xabc"}},
+		{ChatDiscord, []string{`"embeds"`, `"url":"https://etherscan.io/tx/0xabc"`, "Treasury (0x1234…7890)", `"color"`}},
+		{ChatTeams, []string{`"application/vnd.microsoft.card.adaptive"`, `"AdaptiveCard"`, `"FactSet"`, `"Action.OpenUrl"`, "Treasury"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.format), func(t *testing.T) {
+			message, err := FormatChat(tc.format, n, explorer)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			body, _ := json.Marshal(message)
+			// Undo JSON escaping of <, > and & so links can be matched literally
+			text := strings.NewReplacer(`\u003c`, "<", `\u003e`, ">", `\u0026`, "&").Replace(string(body))
+			for _, want := range tc.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("Expected %s message to contain %q:\n%s", tc.format, want, text)
+				}
+			}
+		})
+	}
+
+	if _, err := FormatChat("irc", n, explorer); err == nil {
+		t.Error("Expected error for unsupported format")
+	}
+}
+
+func TestChatNotificationService_Notify(t *testing.T) {
+	var received map[string]interface{}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	service := NewChatNotificationService(ChatDiscord, server.URL, Explorer{})
+	if err := service.Notify(testChatNotification()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := received["embeds"]; !ok {
+		t.Errorf("Expected Discord embeds, got %v", received)
+	}
+
+	status = http.StatusBadRequest
+	if err := service.Notify(testChatNotification()); err == nil {
+		t.Error("Expected error for non-2xx response")
+	}
+}
+
+func TestFormatChatDigest(t *testing.T) {
+	held := testChatNotification()
+	digest := held
+	digest.Type = TransactionDigest
+	digest.Digest = &Digest{}
+	for i := 0; i < maxDigestFacts+2; i++ {
+		digest.Digest.Notifications = append(digest.Digest.Notifications, held)
+	}
+
+	message, err := FormatChat(ChatTeams, digest, NewExplorer("mainnet", ""))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := json.Marshal(message)
+	for _, want := range []string{"Treasury (0x1234…7890) digest: 12 transactions", "2 more"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected digest message to contain %q: %s", want, body)
+		}
+	}
+}
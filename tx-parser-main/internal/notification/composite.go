@@ -0,0 +1,261 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChannelNotifier is implemented by notifiers that deliver through several
+// named channels. The outbox queues one message per channel so a failing
+// channel is retried and dead-lettered on its own.
+type ChannelNotifier interface {
+	NotificationService
+
+	// Channels returns the channels a notification should be delivered to
+	Channels(n Notification) []string
+
+	// NotifyChannel delivers a notification through a single channel
+	NotifyChannel(channel string, n Notification) error
+}
+
+// CompositeNotificationService routes each notification to the channels
+// configured for its tenant or its address, falling back to the default
+// channels
+type CompositeNotificationService struct {
+	mu           sync.RWMutex
+	channels     map[string]NotificationService
+	defaults     []string
+	routes       map[string][]string
+	tenantRoutes map[string][]string
+}
+
+// NewCompositeNotificationService creates a composite notifier without channels
+func NewCompositeNotificationService() *CompositeNotificationService {
+	return &CompositeNotificationService{
+		channels:     make(map[string]NotificationService),
+		routes:       make(map[string][]string),
+		tenantRoutes: make(map[string][]string),
+	}
+}
+
+// AddChannel registers a notifier under name
+func (c *CompositeNotificationService) AddChannel(name string, service NotificationService) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channels[name] = service
+}
+
+// ChannelNames returns the registered channel names in sorted order
+func (c *CompositeNotificationService) ChannelNames() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.channels))
+	for name := range c.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDefaultChannels sets the channels used for addresses without a route
+func (c *CompositeNotificationService) SetDefaultChannels(names ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkChannels(names); err != nil {
+		return err
+	}
+	c.defaults = append([]string(nil), names...)
+	return nil
+}
+
+// DefaultChannels returns the channels used for addresses without a route
+func (c *CompositeNotificationService) DefaultChannels() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.defaults...)
+}
+
+// SetRoute sets the channels of a subscribed address. No channels removes the route.
+func (c *CompositeNotificationService) SetRoute(address string, names []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	address = strings.ToLower(address)
+	if len(names) == 0 {
+		delete(c.routes, address)
+		return nil
+	}
+	if err := c.checkChannels(names); err != nil {
+		return err
+	}
+	c.routes[address] = append([]string(nil), names...)
+	return nil
+}
+
+// Routes returns the per-address channel routes
+func (c *CompositeNotificationService) Routes() map[string][]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	routes := make(map[string][]string, len(c.routes))
+	for address, names := range c.routes {
+		routes[address] = append([]string(nil), names...)
+	}
+	return routes
+}
+
+// SetTenantRoute sets the channels of every notification delivered for a
+// tenant. No channels removes the route.
+func (c *CompositeNotificationService) SetTenantRoute(tenant string, names []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(names) == 0 {
+		delete(c.tenantRoutes, tenant)
+		return nil
+	}
+	if err := c.checkChannels(names); err != nil {
+		return err
+	}
+	c.tenantRoutes[tenant] = append([]string(nil), names...)
+	return nil
+}
+
+// TenantRoutes returns the per-tenant channel routes
+func (c *CompositeNotificationService) TenantRoutes() map[string][]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	routes := make(map[string][]string, len(c.tenantRoutes))
+	for tenant, names := range c.tenantRoutes {
+		routes[tenant] = append([]string(nil), names...)
+	}
+	return routes
+}
+
+// checkChannels verifies every name is registered. Callers must hold the lock.
+func (c *CompositeNotificationService) checkChannels(names []string) error {
+	for _, name := range names {
+		if _, ok := c.channels[name]; !ok {
+			return fmt.Errorf("unknown notification channel %q", name)
+		}
+	}
+	return nil
+}
+
+// Channels returns the channels routed for the notification tenant, then
+// for its address, then the defaults
+func (c *CompositeNotificationService) Channels(n Notification) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if names, ok := c.tenantRoutes[n.Tenant]; ok && n.Tenant != "" {
+		return append([]string(nil), names...)
+	}
+	if names, ok := c.routes[strings.ToLower(n.Address)]; ok {
+		return append([]string(nil), names...)
+	}
+	return append([]string(nil), c.defaults...)
+}
+
+// NotifyChannel delivers a notification through one channel, or through
+// every routed channel when channel is empty
+func (c *CompositeNotificationService) NotifyChannel(channel string, n Notification) error {
+	if channel == "" {
+		return c.Notify(n)
+	}
+	c.mu.RLock()
+	service, ok := c.channels[channel]
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown notification channel %q", channel)
+	}
+	err := service.Notify(n)
+	var pending *PendingDelivery
+	if errors.As(err, &pending) {
+		return pending.then(func(err error) { countDelivery(channel, err) })
+	}
+	countDelivery(channel, err)
+	return err
+}
+
+// countDelivery counts a delivery through channel by its outcome
+func countDelivery(channel string, err error) {
+	if err != nil {
+		notificationsDelivered.Inc(channel, "failed")
+		return
+	}
+	notificationsDelivered.Inc(channel, "sent")
+}
+
+// Notify delivers the notification through every routed channel, waiting
+// for batched channels to send it. A failing channel does not prevent
+// delivery through the others.
+func (c *CompositeNotificationService) Notify(n Notification) error {
+	channels := c.Channels(n)
+	results := make([]error, len(channels))
+	for i, channel := range channels {
+		results[i] = c.NotifyChannel(channel, n)
+	}
+
+	var errs []error
+	for i, channel := range channels {
+		err := results[i]
+		var pending *PendingDelivery
+		if errors.As(err, &pending) {
+			err = pending.Wait()
+		}
+		if err != nil {
+			log.Warn("Notification channel failed", "channel", channel, "address", n.Address, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %v", channel, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RouteSettings exposes the per-address routes as an archive section
+type RouteSettings struct {
+	service *CompositeNotificationService
+}
+
+type routeSetting struct {
+	Address  string   `json:"address,omitempty"`
+	Tenant   string   `json:"tenant,omitempty"`
+	Channels []string `json:"channels"`
+}
+
+// Settings returns the archive section holding the per-address routes
+func (c *CompositeNotificationService) Settings() *RouteSettings {
+	return &RouteSettings{service: c}
+}
+
+// Name returns the archive record type
+func (r *RouteSettings) Name() string {
+	return "route"
+}
+
+// Export emits one record per address route and per tenant route
+func (r *RouteSettings) Export(emit func(data interface{}) error) error {
+	for address, channels := range r.service.Routes() {
+		if err := emit(routeSetting{Address: address, Channels: channels}); err != nil {
+			return err
+		}
+	}
+	for tenant, channels := range r.service.TenantRoutes() {
+		if err := emit(routeSetting{Tenant: tenant, Channels: channels}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import restores an address or tenant route
+func (r *RouteSettings) Import(data json.RawMessage) error {
+	var setting routeSetting
+	if err := json.Unmarshal(data, &setting); err != nil {
+		return err
+	}
+	if setting.Tenant != "" {
+		return r.service.SetTenantRoute(setting.Tenant, setting.Channels)
+	}
+	return r.service.SetRoute(setting.Address, setting.Channels)
+}
@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func newTestComposite() (*CompositeNotificationService, *recordingNotifier, *recordingNotifier) {
+	healthy := &recordingNotifier{}
+	broken := &recordingNotifier{failures: 100}
+	composite := NewCompositeNotificationService()
+	composite.AddChannel("console", healthy)
+	composite.AddChannel("webhook", broken)
+	return composite, healthy, broken
+}
+
+func TestCompositeRouting(t *testing.T) {
+	composite, healthy, _ := newTestComposite()
+	if err := composite.SetDefaultChannels("console"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := composite.SetDefaultChannels("pager"); err == nil {
+		t.Error("Expected error for unknown default channel")
+	}
+	if err := composite.SetRoute("0xABC", []string{"webhook"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if channels := composite.Channels(Notification{Address: "0xabc"}); len(channels) != 1 || channels[0] != "webhook" {
+		t.Errorf("Expected routed channel, got %v", channels)
+	}
+	if channels := composite.Channels(Notification{Address: "0xdef"}); len(channels) != 1 || channels[0] != "console" {
+		t.Errorf("Expected default channel, got %v", channels)
+	}
+
+	if err := composite.Notify(Notification{Address: "0xdef"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(healthy.delivered) != 1 {
+		t.Errorf("Expected default delivery, got %d", len(healthy.delivered))
+	}
+}
+
+func TestCompositeFailureIsolation(t *testing.T) {
+	composite, healthy, _ := newTestComposite()
+	composite.SetDefaultChannels("webhook", "console")
+	sent := notificationsDelivered.Value("console", "sent")
+	failed := notificationsDelivered.Value("webhook", "failed")
+
+	if err := composite.Notify(testNotification()); err == nil {
+		t.Error("Expected error from failing channel")
+	}
+	if len(healthy.delivered) != 1 {
+		t.Error("Expected healthy channel to receive the notification despite the failure")
+	}
+	if notificationsDelivered.Value("console", "sent") != sent+1 || notificationsDelivered.Value("webhook", "failed") != failed+1 {
+		t.Error("Expected the delivery and the failure to be counted per channel")
+	}
+}
+
+func TestOutboxQueuesPerChannel(t *testing.T) {
+	composite, healthy, _ := newTestComposite()
+	composite.SetDefaultChannels("console", "webhook")
+	outbox, _ := newTestOutbox(composite, 1)
+
+	outbox.Notify(testNotification())
+	if stats := outbox.Stats(); stats.Pending != 2 {
+		t.Fatalf("Expected one message per channel, got %+v", stats)
+	}
+
+	outbox.ProcessBatch()
+	dead := outbox.DeadLetters()
+	if len(dead) != 1 || dead[0].Channel != "webhook" {
+		t.Errorf("Expected only the webhook message to be dead-lettered, got %+v", dead)
+	}
+	if len(healthy.delivered) != 1 {
+		t.Errorf("Expected console delivery, got %d", len(healthy.delivered))
+	}
+}
+
+func TestRouteSettingsRoundTrip(t *testing.T) {
+	composite, _, _ := newTestComposite()
+	composite.SetRoute("0xabc", []string{"console", "webhook"})
+	composite.SetTenantRoute("treasury", []string{"webhook"})
+
+	var records []json.RawMessage
+	composite.Settings().Export(func(data interface{}) error {
+		raw, err := json.Marshal(data)
+		records = append(records, raw)
+		return err
+	})
+
+	restored, _, _ := newTestComposite()
+	for _, record := range records {
+		if err := restored.Settings().Import(record); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if route := restored.Routes()["0xabc"]; len(route) != 2 {
+		t.Errorf("Expected restored route, got %v", route)
+	}
+	if route := restored.TenantRoutes()["treasury"]; len(route) != 1 {
+		t.Errorf("Expected restored tenant route, got %v", route)
+	}
+}
@@ -0,0 +1,490 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// Template files looked up by LoadEmailTemplates
+const (
+	EmailSubjectTemplate = "subject.tmpl"
+	EmailTextTemplate    = "body.txt.tmpl"
+	EmailHTMLTemplate    = "body.html.tmpl"
+)
+
+const defaultEmailSubject = `{{if .Summary}}{{.Summary.Period}} summary for {{.Address}}: {{.Summary.Transactions}} transactions{{else}}{{len .Notifications}} transaction{{if gt (len .Notifications) 1}}s{{end}} for {{.Address}}{{end}}`
+
+const defaultEmailText = `{{with .Summary}}{{.Period}} summary from {{time $.Start}} to {{time $.End}}
+  Transactions: {{.Transactions}} ({{.Incoming}} in, {{.Outgoing}} out, {{.Self}} self)
+  Total in:     {{.TotalIn}} ETH
+  Total out:    {{.TotalOut}} ETH
+  Failed:       {{len .Failed}}
+{{range .Largest}}  Largest: {{amount .}} ETH {{.Hash}}
+{{end}}{{range .Failed}}  Failed: {{.Hash}} (block {{.BlockNumber}})
+{{end}}{{end}}{{range .Notifications}}{{.Type}} {{.Transaction.Hash}}
+  From:  {{.Transaction.FromAddress}}
+  To:    {{.Transaction.ToAddress}}
+  Value: {{amount .Transaction}} ETH
+  Block: {{.Transaction.BlockNumber}} ({{time .Transaction.Timestamp}})
+
+{{end}}`
+
+const defaultEmailHTML = `{{if .Summary}}{{with .Summary}}<p>{{.Period}} summary for <code>{{$.Address}}</code> from {{time $.Start}} to {{time $.End}}</p>
+<table>
+<tr><th>Transactions</th><td>{{.Transactions}} ({{.Incoming}} in, {{.Outgoing}} out, {{.Self}} self)</td></tr>
+<tr><th>Total in (ETH)</th><td>{{.TotalIn}}</td></tr>
+<tr><th>Total out (ETH)</th><td>{{.TotalOut}}</td></tr>
+<tr><th>Failed</th><td>{{len .Failed}}</td></tr>
+{{range .Largest}}<tr><th>Largest</th><td>{{amount .}} ETH <code>{{.Hash}}</code></td></tr>
+{{end}}</table>
+{{end}}{{else}}<p>{{len .Notifications}} transaction(s) for <code>{{.Address}}</code></p>
+<table>
+<tr><th>Type</th><th>Hash</th><th>From</th><th>To</th><th>Value (ETH)</th><th>Block</th><th>Time</th></tr>
+{{range .Notifications}}<tr><td>{{.Type}}</td><td>{{.Transaction.Hash}}</td><td>{{.Transaction.FromAddress}}</td><td>{{.Transaction.ToAddress}}</td><td>{{amount .Transaction}}</td><td>{{.Transaction.BlockNumber}}</td><td>{{time .Transaction.Timestamp}}</td></tr>
+{{end}}</table>
+{{end}}`
+
+// EmailConfig holds the SMTP server and batching settings
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+
+	// To receives notifications of addresses without their own recipient
+	To string
+
+	// RequireTLS fails delivery when the server does not offer STARTTLS.
+	// STARTTLS is always used when offered.
+	RequireTLS bool
+
+	Timeout time.Duration
+
+	// BatchWindow is how long notifications for one address are collected
+	// into a single email
+	BatchWindow time.Duration
+
+	// TLSConfig overrides the STARTTLS settings, mainly for tests
+	TLSConfig *tls.Config
+}
+
+// EmailTemplates renders the subject and bodies of a batch email
+type EmailTemplates struct {
+	Subject *texttemplate.Template
+	Text    *texttemplate.Template
+	HTML    *htmltemplate.Template
+}
+
+// EmailData is the value passed to email templates. Summary, Start and End
+// are only set for periodic summaries.
+type EmailData struct {
+	Address       string
+	Notifications []Notification
+	Summary       *Summary
+	Start         int64
+	End           int64
+}
+
+// emailFuncs are the helper functions available to email templates
+var emailFuncs = map[string]interface{}{
+	"amount": amountEther,
+	"time": func(timestamp int64) string {
+		return time.Unix(timestamp, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+}
+
+// DefaultEmailTemplates returns the built-in templates
+func DefaultEmailTemplates() *EmailTemplates {
+	return &EmailTemplates{
+		Subject: texttemplate.Must(texttemplate.New(EmailSubjectTemplate).Funcs(emailFuncs).Parse(defaultEmailSubject)),
+		Text:    texttemplate.Must(texttemplate.New(EmailTextTemplate).Funcs(emailFuncs).Parse(defaultEmailText)),
+		HTML:    htmltemplate.Must(htmltemplate.New(EmailHTMLTemplate).Funcs(emailFuncs).Parse(defaultEmailHTML)),
+	}
+}
+
+// LoadEmailTemplates reads user-editable templates from dir. Files that do
+// not exist, or an empty dir, fall back to the built-in templates.
+func LoadEmailTemplates(dir string) (*EmailTemplates, error) {
+	templates := DefaultEmailTemplates()
+	if dir == "" {
+		return templates, nil
+	}
+
+	read := func(name string) (string, bool, error) {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("error reading email template %s: %v", name, err)
+		}
+		return string(content), true, nil
+	}
+
+	if content, ok, err := read(EmailSubjectTemplate); err != nil {
+		return nil, err
+	} else if ok {
+		if templates.Subject, err = texttemplate.New(EmailSubjectTemplate).Funcs(emailFuncs).Parse(content); err != nil {
+			return nil, fmt.Errorf("error parsing email template %s: %v", EmailSubjectTemplate, err)
+		}
+	}
+	if content, ok, err := read(EmailTextTemplate); err != nil {
+		return nil, err
+	} else if ok {
+		if templates.Text, err = texttemplate.New(EmailTextTemplate).Funcs(emailFuncs).Parse(content); err != nil {
+			return nil, fmt.Errorf("error parsing email template %s: %v", EmailTextTemplate, err)
+		}
+	}
+	if content, ok, err := read(EmailHTMLTemplate); err != nil {
+		return nil, err
+	} else if ok {
+		if templates.HTML, err = htmltemplate.New(EmailHTMLTemplate).Funcs(emailFuncs).Parse(content); err != nil {
+			return nil, fmt.Errorf("error parsing email template %s: %v", EmailHTMLTemplate, err)
+		}
+	}
+	return templates, nil
+}
+
+// EmailNotificationService sends notifications through an SMTP server.
+// Notifications for the same address arriving within the batch window are
+// sent as one email.
+type EmailNotificationService struct {
+	config    EmailConfig
+	templates *EmailTemplates
+
+	mu         sync.Mutex
+	recipients map[string]string
+	pending    map[string]*emailBatch
+	timers     map[string]*time.Timer
+}
+
+// emailBatch collects the notifications of one address until it is sent
+type emailBatch struct {
+	notifications []Notification
+
+	// done is closed once the batch is sent or failed with err
+	done chan struct{}
+	err  error
+}
+
+// NewEmailNotificationService creates an email notifier. A nil templates
+// value uses the built-in templates.
+func NewEmailNotificationService(cfg EmailConfig, templates *EmailTemplates) *EmailNotificationService {
+	if templates == nil {
+		templates = DefaultEmailTemplates()
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &EmailNotificationService{
+		config:     cfg,
+		templates:  templates,
+		recipients: make(map[string]string),
+		pending:    make(map[string]*emailBatch),
+		timers:     make(map[string]*time.Timer),
+	}
+}
+
+// SetRecipient sets the email address notified for a subscribed address.
+// An empty recipient removes it.
+func (s *EmailNotificationService) SetRecipient(address, recipient string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	address = strings.ToLower(address)
+	if recipient == "" {
+		delete(s.recipients, address)
+		return
+	}
+	s.recipients[address] = recipient
+}
+
+// Recipients returns the per-address email recipients
+func (s *EmailNotificationService) Recipients() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recipients := make(map[string]string, len(s.recipients))
+	for address, recipient := range s.recipients {
+		recipients[address] = recipient
+	}
+	return recipients
+}
+
+// recipientFor returns the recipient of address, falling back to the default
+func (s *EmailNotificationService) recipientFor(address string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if recipient, ok := s.recipients[strings.ToLower(address)]; ok {
+		return recipient
+	}
+	return s.config.To
+}
+
+// Notify adds the notification to the batch of its address. The batch is
+// sent when the batch window elapses, or at once without a window. A batched
+// notification returns a *PendingDelivery resolved when its batch is sent.
+func (s *EmailNotificationService) Notify(n Notification) error {
+	// Summaries are sent on their own, without batching
+	if n.Digest != nil && n.Digest.Summary != nil {
+		return s.sendData(EmailData{
+			Address: n.Address,
+			Summary: n.Digest.Summary,
+			Start:   n.Digest.Start,
+			End:     n.Digest.End,
+		})
+	}
+
+	// A digest is rendered like a batch of its notifications
+	if n.Digest != nil {
+		if s.config.BatchWindow <= 0 {
+			return s.send(n.Address, n.Digest.Notifications)
+		}
+		// The notifications of a digest share its address and so its batch
+		var err error
+		for _, held := range n.Digest.Notifications {
+			err = s.Notify(held)
+		}
+		return err
+	}
+
+	if s.config.BatchWindow <= 0 {
+		return s.send(n.Address, []Notification{n})
+	}
+
+	address := strings.ToLower(n.Address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, ok := s.pending[address]
+	if !ok {
+		batch = &emailBatch{done: make(chan struct{})}
+		s.pending[address] = batch
+	}
+	batch.notifications = append(batch.notifications, n)
+	if _, scheduled := s.timers[address]; !scheduled {
+		s.timers[address] = time.AfterFunc(s.config.BatchWindow, func() {
+			if err := s.flushAddress(address); err != nil {
+				log.Error("Failed to send email batch", "address", address, "error", err)
+			}
+		})
+	}
+	return &PendingDelivery{wait: func() error {
+		<-batch.done
+		return batch.err
+	}}
+}
+
+// Flush sends every pending batch immediately
+func (s *EmailNotificationService) Flush() error {
+	s.mu.Lock()
+	addresses := make([]string, 0, len(s.pending))
+	for address := range s.pending {
+		addresses = append(addresses, address)
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, address := range addresses {
+		if err := s.flushAddress(address); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// flushAddress sends the pending batch of one address
+func (s *EmailNotificationService) flushAddress(address string) error {
+	s.mu.Lock()
+	batch := s.pending[address]
+	delete(s.pending, address)
+	if timer, ok := s.timers[address]; ok {
+		timer.Stop()
+		delete(s.timers, address)
+	}
+	s.mu.Unlock()
+
+	if batch == nil {
+		return nil
+	}
+	batch.err = s.send(address, batch.notifications)
+	close(batch.done)
+	return batch.err
+}
+
+// send renders and delivers one email for the notifications of address
+func (s *EmailNotificationService) send(address string, notifications []Notification) error {
+	return s.sendData(EmailData{Address: address, Notifications: notifications})
+}
+
+// sendData renders and delivers one email to the recipient of data.Address
+func (s *EmailNotificationService) sendData(data EmailData) error {
+	recipient := s.recipientFor(data.Address)
+	if recipient == "" {
+		log.Debug("No email recipient configured, skipping", "address", data.Address)
+		return nil
+	}
+
+	message, err := s.render(recipient, data)
+	if err != nil {
+		return err
+	}
+	if err := s.deliver(recipient, message); err != nil {
+		return fmt.Errorf("email delivery to %s failed: %v", recipient, err)
+	}
+	if data.Summary != nil {
+		log.Info("Summary email sent", "period", data.Summary.Period, "address", data.Address, "recipient", recipient)
+		return nil
+	}
+	log.Info("Email sent", "notifications", len(data.Notifications), "address", data.Address, "recipient", recipient)
+	return nil
+}
+
+// render builds a multipart/alternative message with text and HTML parts
+func (s *EmailNotificationService) render(recipient string, data EmailData) ([]byte, error) {
+	var subject, text, html bytes.Buffer
+	if err := s.templates.Subject.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("error rendering email subject: %v", err)
+	}
+	if err := s.templates.Text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("error rendering email text body: %v", err)
+	}
+	if err := s.templates.HTML.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("error rendering email HTML body: %v", err)
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		w.Write(part.content)
+	}
+	parts.Close()
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", s.config.From)
+	fmt.Fprintf(&message, "To: %s\r\n", recipient)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// deliver sends a message through the SMTP server, upgrading the connection
+// with STARTTLS when offered and authenticating when credentials are set
+func (s *EmailNotificationService) deliver(recipient string, message []byte) error {
+	address := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	conn, err := net.DialTimeout("tcp", address, s.config.Timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(s.config.Timeout))
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig := s.config.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: s.config.Host}
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	} else if s.config.RequireTLS {
+		return fmt.Errorf("server %s does not support STARTTLS", address)
+	}
+
+	if s.config.Username != "" {
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+
+	if err := client.Mail(s.config.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(recipient); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// EmailSettings exposes the per-address recipients as an archive section
+type EmailSettings struct {
+	service *EmailNotificationService
+}
+
+type emailSetting struct {
+	Address   string `json:"address"`
+	Recipient string `json:"recipient"`
+}
+
+// Settings returns the archive section holding the per-address recipients
+func (s *EmailNotificationService) Settings() *EmailSettings {
+	return &EmailSettings{service: s}
+}
+
+// Name returns the archive record type
+func (e *EmailSettings) Name() string {
+	return "email"
+}
+
+// Export emits one record per address recipient
+func (e *EmailSettings) Export(emit func(data interface{}) error) error {
+	for address, recipient := range e.service.Recipients() {
+		if err := emit(emailSetting{Address: address, Recipient: recipient}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import restores an address recipient
+func (e *EmailSettings) Import(data json.RawMessage) error {
+	var setting emailSetting
+	if err := json.Unmarshal(data, &setting); err != nil {
+		return err
+	}
+	e.service.SetRecipient(setting.Address, setting.Recipient)
+	return nil
+}
@@ -0,0 +1,308 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts mail on a local listener and records each message
+type fakeSMTPServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []fakeMail
+	auth     []string
+}
+
+type fakeMail struct {
+	from string
+	to   []string
+	data string
+}
+
+func newFakeSMTPServer(t *testing.T, withAuth bool) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &fakeSMTPServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, withAuth)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (f *fakeSMTPServer) port() int {
+	return f.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (f *fakeSMTPServer) serve(conn net.Conn, withAuth bool) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost fake SMTP")
+	var mail fakeMail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO", "HELO":
+			if withAuth {
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250 localhost")
+			}
+		case "AUTH":
+			f.mu.Lock()
+			f.auth = append(f.auth, line)
+			f.mu.Unlock()
+			reply("235 Authentication successful")
+		case "MAIL":
+			mail = fakeMail{from: line}
+			reply("250 OK")
+		case "RCPT":
+			mail.to = append(mail.to, line)
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			mail.data = data.String()
+			f.mu.Lock()
+			f.messages = append(f.messages, mail)
+			f.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (f *fakeSMTPServer) received() []fakeMail {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeMail(nil), f.messages...)
+}
+
+func newTestEmailService(server *fakeSMTPServer, window time.Duration) *EmailNotificationService {
+	return NewEmailNotificationService(EmailConfig{
+		Host:        "localhost",
+		Port:        server.port(),
+		From:        "parser@example.com",
+		To:          "ops@example.com",
+		Timeout:     time.Second,
+		BatchWindow: window,
+	}, nil)
+}
+
+func TestEmailNotificationService_Notify(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	service := newTestEmailService(server, 0)
+
+	if err := service.Notify(testNotification()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 email, got %d", len(messages))
+	}
+	data := messages[0].data
+	for _, want := range []string{
+		"To: ops@example.com",
+		"Subject: 1 transaction for 0x123",
+		"multipart/alternative",
+		"text/html",
+		"Value: 1 ETH",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("Expected email to contain %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestEmailBatching(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	service := newTestEmailService(server, time.Hour)
+
+	for i := 0; i < 50; i++ {
+		n := testNotification()
+		n.Transaction.Hash = "0x" + strconv.Itoa(i)
+		service.Notify(n)
+	}
+	if len(server.received()) != 0 {
+		t.Fatal("Expected notifications to be held until the batch window elapses")
+	}
+
+	if err := service.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("Expected one batched email, got %d", len(messages))
+	}
+	if !strings.Contains(messages[0].data, "Subject: 50 transactions for 0x123") {
+		t.Errorf("Expected batch subject, got:\n%s", messages[0].data)
+	}
+}
+
+func TestEmailBatchWindow(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	service := newTestEmailService(server, 10*time.Millisecond)
+	service.Notify(testNotification())
+	service.Notify(testNotification())
+
+	deadline := time.Now().Add(time.Second)
+	for len(server.received()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if messages := server.received(); len(messages) != 1 {
+		t.Errorf("Expected 1 email after the batch window, got %d", len(messages))
+	}
+}
+
+func TestEmailAuthAndRecipients(t *testing.T) {
+	server := newFakeSMTPServer(t, true)
+	service := newTestEmailService(server, 0)
+	service.config.Username = "user"
+	service.config.Password = "secret"
+	service.SetRecipient("0x123", "wallet-owner@example.com")
+
+	if err := service.Notify(testNotification()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	messages := server.received()
+	if len(messages) != 1 || !strings.Contains(messages[0].to[0], "wallet-owner@example.com") {
+		t.Fatalf("Expected email to the address recipient, got %+v", messages)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.auth) != 1 {
+		t.Error("Expected the client to authenticate")
+	}
+}
+
+func TestEmailRequireTLS(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	service := newTestEmailService(server, 0)
+	service.config.RequireTLS = true
+
+	if err := service.Notify(testNotification()); err == nil {
+		t.Error("Expected error when the server does not offer STARTTLS")
+	}
+}
+
+func TestLoadEmailTemplates(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, EmailSubjectTemplate), []byte("Alert: {{.Address}}"), 0644)
+
+	templates, err := LoadEmailTemplates(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	server := newFakeSMTPServer(t, false)
+	service := newTestEmailService(server, 0)
+	service.templates = templates
+	service.Notify(testNotification())
+
+	messages := server.received()
+	if len(messages) != 1 || !strings.Contains(messages[0].data, "Subject: Alert: 0x123") {
+		t.Errorf("Expected custom subject, got %+v", messages)
+	}
+
+	os.WriteFile(filepath.Join(dir, EmailTextTemplate), []byte("{{.Missing"), 0644)
+	if _, err := LoadEmailTemplates(dir); err == nil {
+		t.Error("Expected error for an invalid template")
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	service := newTestEmailService(server, 0)
+
+	digest := testNotification()
+	digest.Type = TransactionDigest
+	digest.Digest = &Digest{Notifications: []Notification{testNotification(), testNotification()}}
+	if err := service.Notify(digest); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	messages := server.received()
+	if len(messages) != 1 || !strings.Contains(messages[0].data, "Subject: 2 transactions for 0x123") {
+		t.Errorf("Expected the digest as one batched email, got %+v", messages)
+	}
+}
+
+func TestEmailBatchOutcomeReachesOutbox(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	service := newTestEmailService(server, time.Hour)
+	outbox, _ := newTestOutbox(service, 3)
+	outbox.Notify(testNotification())
+
+	// The message stays leased while its batch waits for the window
+	if claimed := outbox.ProcessBatch(); claimed != 1 {
+		t.Fatalf("Expected 1 claimed message, got %d", claimed)
+	}
+	if stats := outbox.Stats(); stats.Pending != 1 {
+		t.Fatalf("Expected the batched message to stay queued, got %+v", stats)
+	}
+
+	if err := service.Flush(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	outbox.Wait(context.Background())
+	if stats := outbox.Stats(); stats.Pending != 0 || len(server.received()) != 1 {
+		t.Errorf("Expected the message to be completed once its batch was sent, got %+v", stats)
+	}
+}
+
+func TestEmailBatchFailureIsReported(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	service := newTestEmailService(server, time.Hour)
+	service.config.RequireTLS = true
+
+	err := service.Notify(testNotification())
+	var pending *PendingDelivery
+	if !errors.As(err, &pending) {
+		t.Fatalf("Expected a pending delivery, got %v", err)
+	}
+	service.Flush()
+	if err := pending.Wait(); err == nil {
+		t.Error("Expected the failed batch to be reported")
+	}
+}
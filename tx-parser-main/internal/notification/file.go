@@ -0,0 +1,42 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileNotificationService appends notifications to a file as JSON lines,
+// using the same payload as webhooks
+type FileNotificationService struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileNotificationService creates a notifier writing to path
+func NewFileNotificationService(path string) *FileNotificationService {
+	return &FileNotificationService{path: path}
+}
+
+// Notify appends the notification to the file
+func (s *FileNotificationService) Notify(n Notification) error {
+	line, err := json.Marshal(newWebhookPayload(n))
+	if err != nil {
+		return fmt.Errorf("error encoding notification: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening notification file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing notification file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package notification
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileNotificationService(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.ndjson")
+	service := NewFileNotificationService(path)
+
+	for i := 0; i < 2; i++ {
+		if err := service.Notify(testNotification()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var payload webhookPayload
+		if err := json.Unmarshal(scanner.Bytes(), &payload); err != nil {
+			t.Fatalf("Invalid JSON line: %v", err)
+		}
+		if payload.Transaction.Hash != "0xabc" {
+			t.Errorf("Unexpected payload: %+v", payload)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("Expected 2 lines, got %d", lines)
+	}
+}
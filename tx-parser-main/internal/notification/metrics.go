@@ -0,0 +1,6 @@
+package notification
+
+import "blockchain-parser/internal/metrics"
+
+// notificationsDelivered counts deliveries per channel, exposed on /metrics
+var notificationsDelivered = metrics.Default.NewCounter("parser_notifications_total", "Notification deliveries by channel and result (sent or failed)", "channel", "result")
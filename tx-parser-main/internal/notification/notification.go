@@ -4,9 +4,17 @@ package notification
 import (
 	"blockchain-parser/internal/logger"
 	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/utils"
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// log is the logger of notification delivery
+var log = logger.Component("notification")
+
 // NotificationType defines the type of transaction notification
 type NotificationType string
 
@@ -16,6 +24,15 @@ const (
 	
 	// TransactionSent indicates an outgoing transaction
 	TransactionSent     NotificationType = "TRANSACTION_SENT"
+
+	// TransactionSelf indicates a transfer from an address to itself
+	TransactionSelf NotificationType = "TRANSACTION_SELF"
+
+	// TransactionDigest bundles notifications held back by quiet hours
+	TransactionDigest NotificationType = "TRANSACTION_DIGEST"
+
+	// TransactionSummary reports the activity of an address over a period
+	TransactionSummary NotificationType = "TRANSACTION_SUMMARY"
 )
 
 // Notification represents a transaction notification with all relevant details
@@ -24,6 +41,95 @@ type Notification struct {
 	Address     string
 	Transaction storage.Transaction
 	Timestamp   int64
+
+	// Label is the subscription label of Address, empty when it has none
+	Label string
+
+	// Tenant is the tenant the notification is delivered for, empty when
+	// the address is not watched by any tenant
+	Tenant string `json:",omitempty"`
+
+	// Counterparty is the other side of the transfer seen from Address
+	Counterparty string `json:",omitempty"`
+
+	// Amount is the ether amount signed from the perspective of Address:
+	// negative when sent, zero for a self-transfer
+	Amount string `json:",omitempty"`
+
+	// Digest holds the bundled notifications of a TransactionDigest
+	Digest *Digest `json:",omitempty"`
+}
+
+// Digest is a set of notifications delivered together, or the summary of
+// a period for TransactionSummary notifications
+type Digest struct {
+	Start         int64
+	End           int64
+	Notifications []Notification
+	Summary       *Summary `json:",omitempty"`
+}
+
+// Subscriptions resolves the subscription state and label of an address
+type Subscriptions interface {
+	IsSubscribed(address string) bool
+	GetLabel(address string) string
+}
+
+// ForTransaction returns the notifications to send for a newly stored
+// transaction: one per subscribed party, typed from that party's perspective.
+// A transfer between two subscribed addresses notifies both of them.
+func ForTransaction(tx storage.Transaction, isSubscribed func(address string) bool) []Notification {
+	var notifications []Notification
+	if tx.FromAddress != "" && strings.EqualFold(tx.FromAddress, tx.ToAddress) {
+		if isSubscribed(tx.FromAddress) {
+			notifications = append(notifications, newNotification(TransactionSelf, tx.FromAddress, tx))
+		}
+		return notifications
+	}
+
+	if tx.FromAddress != "" && isSubscribed(tx.FromAddress) {
+		notifications = append(notifications, newNotification(TransactionSent, tx.FromAddress, tx))
+	}
+	if tx.ToAddress != "" && isSubscribed(tx.ToAddress) {
+		notifications = append(notifications, newNotification(TransactionReceived, tx.ToAddress, tx))
+	}
+	return notifications
+}
+
+// newNotification builds the notification of one party with the
+// counterparty and the amount signed from that party's perspective
+func newNotification(notificationType NotificationType, address string, tx storage.Transaction) Notification {
+	n := Notification{
+		Type:        notificationType,
+		Address:     address,
+		Transaction: tx,
+		Timestamp:   tx.Timestamp,
+	}
+
+	switch notificationType {
+	case TransactionSent:
+		n.Counterparty = tx.ToAddress
+		n.Amount = "-" + amountEther(tx)
+	case TransactionReceived:
+		n.Counterparty = tx.FromAddress
+		n.Amount = amountEther(tx)
+	default:
+		n.Counterparty = address
+		n.Amount = "0"
+	}
+	if n.Amount == "-0" {
+		n.Amount = "0"
+	}
+	return n
+}
+
+// amountEther returns the exact transferred amount, falling back to the float
+// value for transactions stored before wei amounts were kept
+func amountEther(tx storage.Transaction) string {
+	if wei, ok := new(big.Int).SetString(tx.ValueWei, 10); ok {
+		return utils.WeiToEther(wei)
+	}
+	return strconv.FormatFloat(tx.Value, 'f', -1, 64)
 }
 
 // NotificationService defines the interface for notification delivery
@@ -40,10 +146,44 @@ func NewConsoleNotificationService() NotificationService {
 
 // NewConsoleNotificationService creates a new console notification service
 func (s *ConsoleNotificationService) Notify(n Notification) error {
+	if n.Digest != nil && n.Digest.Summary != nil {
+		summary := n.Digest.Summary
+		fmt.Printf("\n=== Transaction Summary (%s) ===\n", summary.Period)
+		fmt.Printf("Address: %s\n", n.Address)
+		fmt.Printf("Period: %s - %s\n", time.Unix(n.Digest.Start, 0).UTC().Format(time.RFC3339), time.Unix(n.Digest.End, 0).UTC().Format(time.RFC3339))
+		fmt.Printf("Transactions: %d (%d in, %d out, %d self, %d failed)\n",
+			summary.Transactions, summary.Incoming, summary.Outgoing, summary.Self, len(summary.Failed))
+		fmt.Printf("Total In: %s ETH\n", summary.TotalIn)
+		fmt.Printf("Total Out: %s ETH\n", summary.TotalOut)
+		for _, tx := range summary.Largest {
+			fmt.Printf("  %s %s ETH (block %d)\n", tx.Hash, amountEther(tx), tx.BlockNumber)
+		}
+		fmt.Printf("================================\n\n")
+
+		log.Info("Summary sent", "period", summary.Period, "address", n.Address)
+		return nil
+	}
+
+	if n.Digest != nil {
+		fmt.Printf("\n=== Transaction Digest ===\n")
+		fmt.Printf("Address: %s\n", n.Address)
+		fmt.Printf("Transactions: %d\n", len(n.Digest.Notifications))
+		for _, held := range n.Digest.Notifications {
+			fmt.Printf("  %s %s ETH (block %d)\n", held.Transaction.Hash, amountEther(held.Transaction), held.Transaction.BlockNumber)
+		}
+		fmt.Printf("================================\n\n")
+
+		log.Info("Digest sent", "notifications", len(n.Digest.Notifications), "address", n.Address)
+		return nil
+	}
+
 	var direction string
-	if n.Type == TransactionReceived {
+	switch n.Type {
+	case TransactionReceived:
 		direction = "Incoming"
-	} else {
+	case TransactionSelf:
+		direction = "Self"
+	default:
 		direction = "Outgoing"
 	}
 
@@ -56,6 +196,6 @@ func (s *ConsoleNotificationService) Notify(n Notification) error {
 	fmt.Printf("Block Number: %d\n", n.Transaction.BlockNumber)
 	fmt.Printf("================================\n\n")
 
-	logger.Info("Notification sent for %s transaction to address %s", direction, n.Address)
+	log.Info("Notification sent", "direction", direction, "address", n.Address, "hash", n.Transaction.Hash)
 	return nil
 }
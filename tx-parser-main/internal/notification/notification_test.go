@@ -69,4 +69,7 @@ func TestNotificationTypes(t *testing.T) {
 	if TransactionSent != "TRANSACTION_SENT" {
 		t.Errorf("Expected TransactionSent to be 'TRANSACTION_SENT', got %s", TransactionSent)
 	}
+	if TransactionSelf != "TRANSACTION_SELF" {
+		t.Errorf("Expected TransactionSelf to be 'TRANSACTION_SELF', got %s", TransactionSelf)
+	}
 }
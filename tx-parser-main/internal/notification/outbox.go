@@ -0,0 +1,428 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/tracing"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OutboxConfig controls outbox delivery
+type OutboxConfig struct {
+	// Workers is the number of concurrent delivery workers
+	Workers int
+
+	// MaxAttempts is the number of failed deliveries before a message is dead-lettered
+	MaxAttempts int
+
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// PollInterval is how often idle workers look for due messages
+	PollInterval time.Duration
+
+	// Lease hides a claimed message from other workers while it is
+	// delivered. The leases of a claimed batch are renewed every half lease
+	// until each outcome is recorded, so messages waiting behind a slow
+	// delivery or in an email batch are not claimed twice.
+	Lease time.Duration
+
+	// BatchSize bounds how many messages a worker claims at once
+	BatchSize int
+}
+
+// DefaultOutboxConfig returns the delivery settings used when none are configured
+func DefaultOutboxConfig() OutboxConfig {
+	return OutboxConfig{
+		Workers:      4,
+		MaxAttempts:  5,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		PollInterval: time.Second,
+		Lease:        time.Minute,
+		BatchSize:    10,
+	}
+}
+
+// Outbox delivers notifications persisted in an OutboxStore with
+// at-least-once semantics. Messages that keep failing are dead-lettered and
+// can be replayed once the destination is fixed.
+type Outbox struct {
+	store    storage.OutboxStore
+	notifier NotificationService
+	config   OutboxConfig
+	tenants  TenantResolver
+	now      func() time.Time
+
+	// pending tracks deliveries whose outcome is reported later
+	pending sync.WaitGroup
+}
+
+// PendingDelivery is returned by notifiers that accepted a notification but
+// send it later, such as in an email batch. The outbox keeps the message
+// leased and records the outcome once Wait returns.
+type PendingDelivery struct {
+	wait func() error
+}
+
+// Error describes the delivery as pending
+func (p *PendingDelivery) Error() string {
+	return "delivery pending"
+}
+
+// Wait blocks until the notification is sent and returns the delivery error
+func (p *PendingDelivery) Wait() error {
+	return p.wait()
+}
+
+// then returns a pending delivery calling done with the outcome of p
+func (p *PendingDelivery) then(done func(err error)) *PendingDelivery {
+	return &PendingDelivery{wait: func() error {
+		err := p.wait()
+		done(err)
+		return err
+	}}
+}
+
+// NewOutbox creates an outbox delivering messages from store through notifier
+func NewOutbox(store storage.OutboxStore, notifier NotificationService, cfg OutboxConfig) *Outbox {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1
+	}
+	return &Outbox{
+		store:    store,
+		notifier: notifier,
+		config:   cfg,
+		now:      time.Now,
+	}
+}
+
+// Messages encodes notifications as outbox messages
+func Messages(notifications []Notification) ([]storage.OutboxMessage, error) {
+	messages := make([]storage.OutboxMessage, 0, len(notifications))
+	for _, n := range notifications {
+		payload, err := json.Marshal(n)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding notification: %v", err)
+		}
+		messages = append(messages, storage.OutboxMessage{Payload: payload})
+	}
+	return messages, nil
+}
+
+// SetTenants makes the outbox queue a copy of each notification for every
+// tenant watching its address, routed with that tenant's settings
+func (o *Outbox) SetTenants(tenants TenantResolver) {
+	o.tenants = tenants
+}
+
+// messages encodes notifications, queueing one message per routed channel
+// when the notifier delivers through several channels
+func (o *Outbox) messages(notifications []Notification) ([]storage.OutboxMessage, error) {
+	if o.tenants != nil {
+		notifications = ForTenants(notifications, o.tenants)
+	}
+	encoded, err := Messages(notifications)
+	if err != nil {
+		return nil, err
+	}
+	channels, ok := o.notifier.(ChannelNotifier)
+	if !ok {
+		return encoded, nil
+	}
+
+	messages := make([]storage.OutboxMessage, 0, len(encoded))
+	for i, n := range notifications {
+		for _, channel := range channels.Channels(n) {
+			message := encoded[i]
+			message.Channel = channel
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// Builder returns the function the parser uses to persist the notifications
+// of a new transaction in the same storage operation as the transaction
+func (o *Outbox) Builder(subscriptions Subscriptions) func(tx storage.Transaction) []storage.OutboxMessage {
+	return func(tx storage.Transaction) []storage.OutboxMessage {
+		notifications := ForTransaction(tx, subscriptions.IsSubscribed)
+		for i := range notifications {
+			notifications[i].Label = subscriptions.GetLabel(notifications[i].Address)
+		}
+
+		messages, err := o.messages(notifications)
+		if err != nil {
+			log.Error("Failed to build notifications", "hash", tx.Hash, "error", err)
+			return nil
+		}
+		return messages
+	}
+}
+
+// Notify queues a notification for asynchronous delivery
+func (o *Outbox) Notify(n Notification) error {
+	messages, err := o.messages([]Notification{n})
+	if err != nil {
+		return err
+	}
+	o.store.EnqueueOutbox(messages...)
+	return nil
+}
+
+// Start runs the delivery workers until stop is closed
+func (o *Outbox) Start(stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for i := 0; i < o.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o.work(stop)
+		}()
+	}
+	wg.Wait()
+}
+
+// work delivers due messages, polling whenever the outbox is drained
+func (o *Outbox) work(stop <-chan struct{}) {
+	ticker := time.NewTicker(o.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for o.ProcessBatch() > 0 {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain delivers the messages that are due until none is left or ctx is
+// done, and returns the number of messages claimed. It is used at shutdown
+// after the workers have stopped; messages scheduled for a later retry stay
+// in the store.
+func (o *Outbox) Drain(ctx context.Context) int {
+	drained := 0
+	for ctx.Err() == nil {
+		claimed := o.ProcessBatch()
+		if claimed == 0 {
+			break
+		}
+		drained += claimed
+	}
+	return drained
+}
+
+// ProcessBatch claims and delivers one batch of due messages and returns
+// the number of messages claimed
+func (o *Outbox) ProcessBatch() int {
+	messages := o.store.ClaimOutbox(o.config.BatchSize, o.now(), o.config.Lease)
+	leases := o.renewLeases(messages)
+	for _, message := range messages {
+		o.deliver(message, leases)
+	}
+	return len(messages)
+}
+
+// deliver sends one message and records the outcome. The delivery is traced
+// in the trace of the work that queued the message. A pending delivery is
+// recorded in the background once its outcome is known.
+func (o *Outbox) deliver(message storage.OutboxMessage, leases *outboxLeases) {
+	ctx, span := tracing.Start(tracing.WithTraceParent(context.Background(), message.TraceParent), "notification.deliver",
+		tracing.String("notification.channel", channelName(message.Channel)),
+		tracing.Int64("outbox.message_id", message.ID),
+		tracing.Int64("outbox.attempt", int64(message.Attempts+1)))
+
+	var n Notification
+	if err := json.Unmarshal(message.Payload, &n); err != nil {
+		span.RecordError(err)
+		log.ErrorContext(ctx, "Dead-lettering undecodable outbox message", "id", message.ID, "error", err)
+		leases.release(message.ID)
+		o.store.DeadLetterOutbox(message.ID, fmt.Sprintf("invalid payload: %v", err))
+		span.End()
+		return
+	}
+	span.SetAttributes(tracing.String("notification.address", n.Address))
+
+	err := o.notify(message.Channel, n)
+	var pending *PendingDelivery
+	if errors.As(err, &pending) {
+		o.pending.Add(1)
+		go func() {
+			defer o.pending.Done()
+			defer span.End()
+			err := pending.Wait()
+			leases.release(message.ID)
+			o.record(ctx, span, message, n, err)
+		}()
+		return
+	}
+	defer span.End()
+	leases.release(message.ID)
+	o.record(ctx, span, message, n, err)
+}
+
+// outboxLeases renews the leases of a claimed batch every half lease until
+// each message is released
+type outboxLeases struct {
+	mu   sync.Mutex
+	held map[int64]bool
+	done chan struct{}
+}
+
+// renewLeases starts renewing the leases of claimed messages
+func (o *Outbox) renewLeases(messages []storage.OutboxMessage) *outboxLeases {
+	leases := &outboxLeases{held: make(map[int64]bool, len(messages)), done: make(chan struct{})}
+	for _, message := range messages {
+		leases.held[message.ID] = true
+	}
+	if len(messages) == 0 || o.config.Lease <= 0 {
+		return leases
+	}
+
+	go func() {
+		ticker := time.NewTicker(o.config.Lease / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-leases.done:
+				return
+			case <-ticker.C:
+				leases.mu.Lock()
+				for id := range leases.held {
+					if !o.store.RenewOutbox(id, o.now().Add(o.config.Lease)) {
+						leases.drop(id)
+					}
+				}
+				leases.mu.Unlock()
+			}
+		}
+	}()
+	return leases
+}
+
+// release stops renewing the lease of a message. It must be called before
+// the outcome is recorded so a late renewal cannot move a scheduled retry.
+func (l *outboxLeases) release(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.drop(id)
+}
+
+// drop forgets a message, stopping the renewals once none is held. Callers
+// must hold the lock.
+func (l *outboxLeases) drop(id int64) {
+	if !l.held[id] {
+		return
+	}
+	delete(l.held, id)
+	if len(l.held) == 0 {
+		close(l.done)
+	}
+}
+
+// record completes, retries or dead-letters a message after a delivery
+func (o *Outbox) record(ctx context.Context, span *tracing.Span, message storage.OutboxMessage, n Notification, err error) {
+	if err == nil {
+		o.store.CompleteOutbox(message.ID)
+		return
+	}
+	span.RecordError(err)
+
+	attempt := message.Attempts + 1
+	if attempt >= o.config.MaxAttempts {
+		log.ErrorContext(ctx, "Dead-lettering outbox message",
+			"id", message.ID, "address", n.Address, "channel", channelName(message.Channel), "attempts", attempt, "error", err)
+		o.store.DeadLetterOutbox(message.ID, err.Error())
+		return
+	}
+
+	delay := backoffDelay(o.config.BaseDelay, o.config.MaxDelay, attempt)
+	log.WarnContext(ctx, "Outbox delivery failed, retrying",
+		"id", message.ID, "address", n.Address, "channel", channelName(message.Channel),
+		"attempt", attempt, "max_attempts", o.config.MaxAttempts, "delay", delay, "error", err)
+	o.store.RetryOutbox(message.ID, err.Error(), o.now().Add(delay))
+}
+
+// Wait blocks until the outcome of every pending delivery is recorded or
+// ctx is done. It is used at shutdown once batching notifiers are flushed.
+func (o *Outbox) Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		o.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// notify delivers through the message channel. Channel notifiers receive
+// every message through NotifyChannel so decisions made when it was queued
+// are not repeated; other notifiers only accept messages without a channel.
+func (o *Outbox) notify(channel string, n Notification) error {
+	if channels, ok := o.notifier.(ChannelNotifier); ok {
+		return channels.NotifyChannel(channel, n)
+	}
+	if channel != "" {
+		return fmt.Errorf("notifier does not support channel %q", channel)
+	}
+	return o.notifier.Notify(n)
+}
+
+// channelName returns a printable name for a message channel
+func channelName(channel string) string {
+	if channel == "" {
+		return "default"
+	}
+	return channel
+}
+
+// DeadLetters returns the messages that exhausted their attempts
+func (o *Outbox) DeadLetters() []storage.OutboxMessage {
+	return o.store.DeadLetters()
+}
+
+// Replay moves a dead-lettered message back to the outbox
+func (o *Outbox) Replay(id int64) bool {
+	if !o.store.ReplayDeadLetter(id) {
+		return false
+	}
+	log.Info("Replaying dead-lettered outbox message", "id", id)
+	return true
+}
+
+// ReplayAll moves every dead-lettered message back to the outbox
+func (o *Outbox) ReplayAll() int {
+	replayed := 0
+	for _, message := range o.store.DeadLetters() {
+		if o.Replay(message.ID) {
+			replayed++
+		}
+	}
+	return replayed
+}
+
+// Stats returns the outbox queue sizes
+func (o *Outbox) Stats() storage.OutboxStats {
+	return o.store.OutboxStats()
+}
@@ -0,0 +1,265 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier fails the first failures calls and records delivered notifications
+type recordingNotifier struct {
+	mu        sync.Mutex
+	failures  int
+	delivered []Notification
+}
+
+func (r *recordingNotifier) Notify(n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("unavailable")
+	}
+	r.delivered = append(r.delivered, n)
+	return nil
+}
+
+func newTestOutbox(notifier NotificationService, maxAttempts int) (*Outbox, *storage.MemoryStorage) {
+	store := storage.NewMemoryStorage()
+	outbox := NewOutbox(store, notifier, OutboxConfig{
+		Workers:      2,
+		MaxAttempts:  maxAttempts,
+		PollInterval: time.Millisecond,
+		Lease:        time.Minute,
+		BatchSize:    10,
+	})
+	return outbox, store
+}
+
+func TestForTransaction(t *testing.T) {
+	tx := storage.Transaction{Hash: "0xabc", FromAddress: "0x1", ToAddress: "0x2", ValueWei: "1500000000000000000", Timestamp: 10}
+	subscribed := func(addresses ...string) func(string) bool {
+		return func(address string) bool {
+			for _, a := range addresses {
+				if a == address {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	notifications := ForTransaction(tx, subscribed("0x2"))
+	if len(notifications) != 1 || notifications[0].Address != "0x2" || notifications[0].Type != TransactionReceived ||
+		notifications[0].Counterparty != "0x1" || notifications[0].Amount != "1.5" {
+		t.Errorf("Expected recipient notification, got %+v", notifications)
+	}
+
+	notifications = ForTransaction(tx, subscribed("0x1"))
+	if len(notifications) != 1 || notifications[0].Address != "0x1" || notifications[0].Type != TransactionSent ||
+		notifications[0].Counterparty != "0x2" || notifications[0].Amount != "-1.5" {
+		t.Errorf("Expected sender notification, got %+v", notifications)
+	}
+
+	// Both parties are notified from their own perspective
+	notifications = ForTransaction(tx, subscribed("0x1", "0x2"))
+	if len(notifications) != 2 || notifications[0].Type != TransactionSent || notifications[1].Type != TransactionReceived {
+		t.Errorf("Expected sender and recipient notifications, got %+v", notifications)
+	}
+
+	if notifications = ForTransaction(tx, subscribed()); len(notifications) != 0 {
+		t.Errorf("Expected no notifications without subscribers, got %+v", notifications)
+	}
+
+	self := tx
+	self.ToAddress = "0X1"
+	notifications = ForTransaction(self, subscribed("0x1"))
+	if len(notifications) != 1 || notifications[0].Type != TransactionSelf || notifications[0].Amount != "0" {
+		t.Errorf("Expected one self-transfer notification, got %+v", notifications)
+	}
+
+	creation := tx
+	creation.ToAddress = ""
+	notifications = ForTransaction(creation, subscribed("0x1", ""))
+	if len(notifications) != 1 || notifications[0].Type != TransactionSent {
+		t.Errorf("Expected contract creation to notify the sender, got %+v", notifications)
+	}
+}
+
+func TestOutboxDelivers(t *testing.T) {
+	notifier := &recordingNotifier{}
+	outbox, store := newTestOutbox(notifier, 3)
+
+	sender := "0x4560000000000000000000000000000000000456"
+	store.AddSubscriber(sender)
+	store.SetLabel(sender, "Treasury")
+	tx := testNotification().Transaction
+	tx.FromAddress = sender
+	build := outbox.Builder(store)
+	store.StoreTransactionWithOutbox(tx, build(tx))
+
+	if claimed := outbox.ProcessBatch(); claimed != 1 {
+		t.Fatalf("Expected 1 claimed message, got %d", claimed)
+	}
+	if len(notifier.delivered) != 1 || notifier.delivered[0].Transaction.ValueWei != "1000000000000000000" ||
+		notifier.delivered[0].Label != "Treasury" || notifier.delivered[0].Type != TransactionSent {
+		t.Errorf("Expected decoded notification to be delivered, got %+v", notifier.delivered)
+	}
+	if stats := outbox.Stats(); stats.Pending != 0 {
+		t.Errorf("Expected delivered message to be removed, got %+v", stats)
+	}
+}
+
+func TestOutboxDeadLetterAndReplay(t *testing.T) {
+	notifier := &recordingNotifier{failures: 2}
+	outbox, _ := newTestOutbox(notifier, 2)
+	if err := outbox.Notify(testNotification()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	current := time.Now()
+	outbox.now = func() time.Time { return current }
+
+	outbox.ProcessBatch()
+	if stats := outbox.Stats(); stats.Pending != 1 {
+		t.Fatalf("Expected message to be retried, got %+v", stats)
+	}
+
+	current = current.Add(time.Hour)
+	outbox.ProcessBatch()
+	dead := outbox.DeadLetters()
+	if len(dead) != 1 || dead[0].LastError != "unavailable" {
+		t.Fatalf("Expected message to be dead-lettered, got %+v", dead)
+	}
+
+	if replayed := outbox.ReplayAll(); replayed != 1 {
+		t.Errorf("Expected 1 replayed message, got %d", replayed)
+	}
+	outbox.now = time.Now
+	outbox.ProcessBatch()
+	if len(notifier.delivered) != 1 || len(outbox.DeadLetters()) != 0 {
+		t.Errorf("Expected replayed message to be delivered, got %d deliveries", len(notifier.delivered))
+	}
+}
+
+func TestOutboxStart(t *testing.T) {
+	notifier := &recordingNotifier{}
+	outbox, _ := newTestOutbox(notifier, 1)
+	for i := 0; i < 5; i++ {
+		outbox.Notify(testNotification())
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		outbox.Start(stop)
+		close(done)
+	}()
+
+	deadline := time.After(time.Second)
+	for outbox.Stats().Pending > 0 {
+		select {
+		case <-deadline:
+			t.Fatal("Timed out waiting for outbox to drain")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	close(stop)
+	<-done
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if len(notifier.delivered) != 5 {
+		t.Errorf("Expected 5 deliveries, got %d", len(notifier.delivered))
+	}
+}
+
+func TestOutboxDrain(t *testing.T) {
+	notifier := &recordingNotifier{failures: 1}
+	outbox, _ := newTestOutbox(notifier, 3)
+	for i := 0; i < 15; i++ {
+		outbox.Notify(testNotification())
+	}
+
+	// Without a retry delay the failed message is due again and retried
+	if drained := outbox.Drain(context.Background()); drained != 16 {
+		t.Errorf("Expected 16 claimed messages, got %d", drained)
+	}
+	if stats := outbox.Stats(); stats.Pending != 0 {
+		t.Errorf("Expected the outbox to be drained, got %+v", stats)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	outbox.Notify(testNotification())
+	if drained := outbox.Drain(ctx); drained != 0 {
+		t.Errorf("Expected a cancelled drain to deliver nothing, got %d", drained)
+	}
+}
+
+// slowNotifier signals started and blocks the first delivery until
+// release is closed, counting the deliveries per address
+type slowNotifier struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu        sync.Mutex
+	delivered map[string]int
+}
+
+func (s *slowNotifier) Notify(n Notification) error {
+	s.mu.Lock()
+	first := len(s.delivered) == 0
+	s.delivered[n.Address]++
+	s.mu.Unlock()
+	if first {
+		close(s.started)
+		<-s.release
+	}
+	return nil
+}
+
+func TestOutboxRenewsBatchLeases(t *testing.T) {
+	notifier := &slowNotifier{
+		started:   make(chan struct{}),
+		release:   make(chan struct{}),
+		delivered: make(map[string]int),
+	}
+	store := storage.NewMemoryStorage()
+	outbox := NewOutbox(store, notifier, OutboxConfig{MaxAttempts: 1, Lease: 40 * time.Millisecond, BatchSize: 10})
+	for _, address := range []string{"0x1", "0x2", "0x3"} {
+		n := testNotification()
+		n.Address = address
+		outbox.Notify(n)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		outbox.ProcessBatch()
+		close(done)
+	}()
+	<-notifier.started
+
+	// Another worker polls while the first delivery outlasts several leases
+	deadline := time.Now().Add(150 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		outbox.ProcessBatch()
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(notifier.release)
+	<-done
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	for _, address := range []string{"0x1", "0x2", "0x3"} {
+		if count := notifier.delivered[address]; count != 1 {
+			t.Errorf("Expected one delivery to %s, got %d", address, count)
+		}
+	}
+	if stats := outbox.Stats(); stats.Pending != 0 {
+		t.Errorf("Expected every message to be completed, got %+v", stats)
+	}
+}
@@ -0,0 +1,765 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/utils"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule decides which transactions of a subscription produce a notification.
+// Empty fields do not filter.
+type Rule struct {
+	// MinValue is the smallest amount in ether that is notified
+	MinValue string `json:"min_value,omitempty"`
+
+	// Directions limits notifications to in, out or self transfers
+	Directions []storage.Direction `json:"directions,omitempty"`
+
+	// AllowCounterparties only notifies transfers with these counterparties
+	AllowCounterparties []string `json:"allow_counterparties,omitempty"`
+
+	// DenyCounterparties never notifies transfers with these counterparties
+	DenyCounterparties []string `json:"deny_counterparties,omitempty"`
+
+	// Tokens limits notifications to these token contracts, ETH for ether
+	Tokens []string `json:"tokens,omitempty"`
+
+	// FailedOnly only notifies reverted transactions
+	FailedOnly bool `json:"failed_only,omitempty"`
+
+	// MaxPerHour caps the notifications delivered within any hour
+	MaxPerHour int `json:"max_per_hour,omitempty"`
+
+	QuietHours *QuietHours `json:"quiet_hours,omitempty"`
+}
+
+// QuietHours is a daily window in which notifications are held for a digest
+// or dropped. The window wraps around midnight when End is before Start.
+type QuietHours struct {
+	// Start and End are HH:MM times of day
+	Start string `json:"start"`
+	End   string `json:"end"`
+
+	// Timezone is an IANA zone name, UTC when empty
+	Timezone string `json:"timezone,omitempty"`
+
+	// Digest delivers the held notifications as one digest when the window
+	// ends instead of dropping them
+	Digest bool `json:"digest,omitempty"`
+}
+
+// Validate checks the rule fields
+func (r Rule) Validate() error {
+	if r.MinValue != "" {
+		if _, err := utils.EtherToWei(r.MinValue); err != nil {
+			return fmt.Errorf("invalid min_value: %v", err)
+		}
+	}
+	for _, direction := range r.Directions {
+		switch direction {
+		case storage.DirectionIn, storage.DirectionOut, storage.DirectionSelf:
+		default:
+			return fmt.Errorf("invalid direction %q", direction)
+		}
+	}
+	if r.MaxPerHour < 0 {
+		return fmt.Errorf("max_per_hour must not be negative")
+	}
+	if r.QuietHours != nil {
+		return r.QuietHours.validate()
+	}
+	return nil
+}
+
+func (q *QuietHours) validate() error {
+	if _, err := parseClock(q.Start); err != nil {
+		return fmt.Errorf("invalid quiet_hours start: %v", err)
+	}
+	if _, err := parseClock(q.End); err != nil {
+		return fmt.Errorf("invalid quiet_hours end: %v", err)
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("invalid quiet_hours timezone: %v", err)
+	}
+	return nil
+}
+
+// parseClock returns the minutes since midnight of an HH:MM time
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t falls within the quiet hours
+func (q *QuietHours) Contains(t time.Time) bool {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return false
+	}
+	location, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return false
+	}
+
+	local := t.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// Decision is the outcome of evaluating the rules for a notification
+type Decision string
+
+const (
+	// DecisionDeliver sends the notification
+	DecisionDeliver Decision = "deliver"
+
+	// DecisionDrop discards the notification
+	DecisionDrop Decision = "drop"
+
+	// DecisionHold keeps the notification for the quiet-hours digest
+	DecisionHold Decision = "hold"
+)
+
+// Match reports whether the rule filters let the notification through and
+// otherwise the reason it was filtered. Rate caps and quiet hours are
+// applied by the RuleEngine.
+func (r Rule) Match(n Notification) (bool, string) {
+	tx := n.Transaction
+	direction := directionOf(n)
+
+	if r.FailedOnly && tx.Status != storage.StatusFailed {
+		return false, "transaction did not fail"
+	}
+
+	if len(r.Directions) > 0 && !containsDirection(r.Directions, direction) {
+		return false, fmt.Sprintf("direction %s not allowed", direction)
+	}
+
+	if len(r.Tokens) > 0 && !containsFold(r.Tokens, tx.Asset()) {
+		return false, fmt.Sprintf("asset %s not allowed", tx.Asset())
+	}
+
+	counterparty := counterpartyOf(tx, n.Address, direction)
+	if containsFold(r.DenyCounterparties, counterparty) {
+		return false, fmt.Sprintf("counterparty %s denied", counterparty)
+	}
+	if len(r.AllowCounterparties) > 0 && !containsFold(r.AllowCounterparties, counterparty) {
+		return false, fmt.Sprintf("counterparty %s not allowed", counterparty)
+	}
+
+	if r.MinValue != "" {
+		min, err := utils.EtherToWei(r.MinValue)
+		if err == nil {
+			value, ok := new(big.Int).SetString(tx.ValueWei, 10)
+			if !ok {
+				value, _ = utils.EtherToWei(amountEther(tx))
+			}
+			if value == nil || value.Cmp(min) < 0 {
+				return false, fmt.Sprintf("value %s below minimum %s", amountEther(tx), r.MinValue)
+			}
+		}
+	}
+
+	return true, ""
+}
+
+// directionOf returns the direction of the notified transaction relative to
+// the notified address, derived from the addresses for untyped notifications
+func directionOf(n Notification) storage.Direction {
+	switch n.Type {
+	case TransactionReceived:
+		return storage.DirectionIn
+	case TransactionSent:
+		return storage.DirectionOut
+	case TransactionSelf:
+		return storage.DirectionSelf
+	}
+
+	tx := n.Transaction
+	from := strings.EqualFold(tx.FromAddress, n.Address)
+	to := strings.EqualFold(tx.ToAddress, n.Address)
+	switch {
+	case from && to:
+		return storage.DirectionSelf
+	case to:
+		return storage.DirectionIn
+	default:
+		return storage.DirectionOut
+	}
+}
+
+// counterpartyOf returns the other side of a transaction for address
+func counterpartyOf(tx storage.Transaction, address string, direction storage.Direction) string {
+	switch direction {
+	case storage.DirectionIn:
+		return tx.FromAddress
+	case storage.DirectionOut:
+		return tx.ToAddress
+	default:
+		return address
+	}
+}
+
+func containsDirection(directions []storage.Direction, direction storage.Direction) bool {
+	for _, d := range directions {
+		if d == direction {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleEngine holds a default rule and per-address rules and tracks the
+// deliveries counted against rate caps
+type RuleEngine struct {
+	mu         sync.Mutex
+	defaults   Rule
+	rules      map[string]Rule
+	deliveries map[string][]time.Time
+}
+
+// NewRuleEngine creates an engine that lets every notification through
+func NewRuleEngine() *RuleEngine {
+	return &RuleEngine{
+		rules:      make(map[string]Rule),
+		deliveries: make(map[string][]time.Time),
+	}
+}
+
+// rulesFile is the layout of a rules configuration file
+type rulesFile struct {
+	Default   Rule            `json:"default"`
+	Addresses map[string]Rule `json:"addresses"`
+}
+
+// LoadRuleEngine reads the default and per-address rules from a JSON file.
+// An empty path returns an engine without rules.
+func LoadRuleEngine(path string) (*RuleEngine, error) {
+	engine := NewRuleEngine()
+	if path == "" {
+		return engine, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rules file: %v", err)
+	}
+	var file rulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing rules file: %v", err)
+	}
+
+	if err := engine.SetDefaultRule(file.Default); err != nil {
+		return nil, fmt.Errorf("default rule: %v", err)
+	}
+	for address, rule := range file.Addresses {
+		if err := engine.SetRule(address, rule); err != nil {
+			return nil, fmt.Errorf("rule for %s: %v", address, err)
+		}
+	}
+	return engine, nil
+}
+
+// SetDefaultRule sets the rule of addresses without their own rule
+func (e *RuleEngine) SetDefaultRule(rule Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.defaults = rule
+	return nil
+}
+
+// DefaultRule returns the rule of addresses without their own rule
+func (e *RuleEngine) DefaultRule() Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.defaults
+}
+
+// SetRule sets the rule of an address
+func (e *RuleEngine) SetRule(address string, rule Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules[strings.ToLower(address)] = rule
+	return nil
+}
+
+// RemoveRule removes the rule of an address and reports whether it existed
+func (e *RuleEngine) RemoveRule(address string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	address = strings.ToLower(address)
+	if _, ok := e.rules[address]; !ok {
+		return false
+	}
+	delete(e.rules, address)
+	return true
+}
+
+// Rules returns the per-address rules
+func (e *RuleEngine) Rules() map[string]Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rules := make(map[string]Rule, len(e.rules))
+	for address, rule := range e.rules {
+		rules[address] = rule
+	}
+	return rules
+}
+
+// RuleFor returns the rule applied to an address
+func (e *RuleEngine) RuleFor(address string) Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ruleFor(address)
+}
+
+// ruleFor returns the rule of an address. Callers must hold the lock.
+func (e *RuleEngine) ruleFor(address string) Rule {
+	if rule, ok := e.rules[strings.ToLower(address)]; ok {
+		return rule
+	}
+	return e.defaults
+}
+
+// Evaluate decides what happens to a notification at time now and returns
+// the reason when it is not delivered. Delivered notifications count
+// against the rate cap of their address. Digests are always delivered.
+func (e *RuleEngine) Evaluate(n Notification, now time.Time) (Decision, string) {
+	if n.Digest != nil {
+		return DecisionDeliver, ""
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rule := e.ruleFor(n.Address)
+
+	if ok, reason := rule.Match(n); !ok {
+		return DecisionDrop, reason
+	}
+
+	if rule.QuietHours != nil && rule.QuietHours.Contains(now) {
+		if rule.QuietHours.Digest {
+			return DecisionHold, "quiet hours"
+		}
+		return DecisionDrop, "quiet hours"
+	}
+
+	// Tenants watching the same address have their own rate budget
+	address := strings.ToLower(n.Address)
+	if n.Tenant != "" {
+		address = n.Tenant + "/" + address
+	}
+	if rule.MaxPerHour > 0 {
+		recent := e.recentDeliveries(address, now)
+		if len(recent) >= rule.MaxPerHour {
+			return DecisionDrop, fmt.Sprintf("rate cap of %d per hour reached", rule.MaxPerHour)
+		}
+	}
+	e.deliveries[address] = append(e.deliveries[address], now)
+	return DecisionDeliver, ""
+}
+
+// recentDeliveries drops deliveries older than an hour and returns the rest.
+// Callers must hold the lock.
+func (e *RuleEngine) recentDeliveries(address string, now time.Time) []time.Time {
+	cutoff := now.Add(-time.Hour)
+	recent := e.deliveries[address][:0]
+	for _, t := range e.deliveries[address] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	e.deliveries[address] = recent
+	return recent
+}
+
+// DryRunResult is the decision a rule would have made for a transaction
+type DryRunResult struct {
+	Transaction storage.Transaction `json:"transaction"`
+	Decision    Decision            `json:"decision"`
+	Reason      string              `json:"reason,omitempty"`
+}
+
+// DryRun evaluates rule against the historical transactions of address in
+// timestamp order, simulating rate caps and quiet hours at the time each
+// transaction was mined
+func DryRun(address string, rule Rule, transactions []storage.Transaction) ([]DryRunResult, error) {
+	engine := NewRuleEngine()
+	if err := engine.SetRule(address, rule); err != nil {
+		return nil, err
+	}
+
+	sorted := append([]storage.Transaction(nil), transactions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	results := make([]DryRunResult, 0, len(sorted))
+	for _, tx := range sorted {
+		n := Notification{Address: address, Transaction: tx, Timestamp: tx.Timestamp}
+		decision, reason := engine.Evaluate(n, time.Unix(tx.Timestamp, 0))
+		results = append(results, DryRunResult{Transaction: tx, Decision: decision, Reason: reason})
+	}
+	return results, nil
+}
+
+// FilteredNotificationService applies a RuleEngine before delivering
+// through the next notifier. Notifications held by quiet hours are
+// released as one TransactionDigest per address when the window ends.
+type FilteredNotificationService struct {
+	next    NotificationService
+	engine  *RuleEngine
+	digests NotificationService
+	now     func() time.Time
+
+	mu   sync.Mutex
+	held map[string][]Notification
+
+	// decisions remembers the outcome of dispatched notifications, so the
+	// messages queued for each of their channels are counted once
+	decisions  map[string]dispatchDecision
+	lastPruned time.Time
+}
+
+// dispatchDecision is the outcome of the rules for a dispatched notification
+type dispatchDecision struct {
+	deliver bool
+	at      time.Time
+}
+
+// decisionTTL is how long dispatch decisions are remembered, longer than a
+// message waits between its first and last delivery attempt
+const decisionTTL = time.Hour
+
+// NewFilteredNotificationService creates a notifier filtering through engine
+func NewFilteredNotificationService(next NotificationService, engine *RuleEngine) *FilteredNotificationService {
+	return &FilteredNotificationService{
+		next:      next,
+		engine:    engine,
+		now:       time.Now,
+		held:      make(map[string][]Notification),
+		decisions: make(map[string]dispatchDecision),
+	}
+}
+
+// Engine returns the rule engine of the notifier
+func (f *FilteredNotificationService) Engine() *RuleEngine {
+	return f.engine
+}
+
+// SetDigestNotifier sets where released digests are sent, such as the
+// outbox so they are delivered durably. Digests go to the next notifier
+// when unset.
+func (f *FilteredNotificationService) SetDigestNotifier(digests NotificationService) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.digests = digests
+}
+
+// evaluate applies the rules and holds the notification when required
+func (f *FilteredNotificationService) evaluate(n Notification) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.evaluateLocked(n, f.now())
+}
+
+// evaluateLocked applies the rules at now, counting delivered notifications
+// against rate caps and holding those in quiet hours. Callers hold mu.
+func (f *FilteredNotificationService) evaluateLocked(n Notification, now time.Time) bool {
+	decision, reason := f.engine.Evaluate(n, now)
+	switch decision {
+	case DecisionDeliver:
+		return true
+	case DecisionHold:
+		log.Debug("Holding notification", "hash", n.Transaction.Hash, "address", n.Address, "reason", reason)
+		key := heldKey(n)
+		f.held[key] = append(f.held[key], n)
+	default:
+		log.Debug("Dropping notification", "hash", n.Transaction.Hash, "address", n.Address, "reason", reason)
+	}
+	return false
+}
+
+// dispatch evaluates a notification the first time one of its channels
+// delivers it and returns the same decision for its other channels and
+// retries
+func (f *FilteredNotificationService) dispatch(n Notification) bool {
+	if n.Digest != nil {
+		return true
+	}
+	now := f.now()
+	key := dispatchKey(n)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now.Sub(f.lastPruned) > decisionTTL/60 {
+		for k, d := range f.decisions {
+			if now.Sub(d.at) > decisionTTL {
+				delete(f.decisions, k)
+			}
+		}
+		f.lastPruned = now
+	}
+	if d, ok := f.decisions[key]; ok {
+		return d.deliver
+	}
+	deliver := f.evaluateLocked(n, now)
+	f.decisions[key] = dispatchDecision{deliver: deliver, at: now}
+	return deliver
+}
+
+// dispatchKey identifies a notification across the messages of its channels
+func dispatchKey(n Notification) string {
+	return fmt.Sprintf("%s/%s/%s", n.Type, heldKey(n), n.Transaction.Key())
+}
+
+// heldKey groups held notifications per tenant and address, so each tenant
+// receives its own digest
+func heldKey(n Notification) string {
+	return n.Tenant + "/" + strings.ToLower(n.Address)
+}
+
+// Notify delivers the notification when the rules let it through
+func (f *FilteredNotificationService) Notify(n Notification) error {
+	if !f.evaluate(n) {
+		return nil
+	}
+	return f.next.Notify(n)
+}
+
+// Channels returns no channels when the rule of the address filters the
+// notification out. It does not count against rate caps or hold anything:
+// quiet hours and rate caps apply when the notification is dispatched.
+func (f *FilteredNotificationService) Channels(n Notification) []string {
+	if n.Digest == nil {
+		if ok, reason := f.engine.RuleFor(n.Address).Match(n); !ok {
+			log.Debug("Dropping notification", "hash", n.Transaction.Hash, "address", n.Address, "reason", reason)
+			return nil
+		}
+	}
+	if channels, ok := f.next.(ChannelNotifier); ok {
+		return channels.Channels(n)
+	}
+	return []string{""}
+}
+
+// NotifyChannel applies quiet hours and rate caps, once for all channels of
+// the notification, and delivers it through the next notifier. Held and
+// dropped notifications are done with.
+func (f *FilteredNotificationService) NotifyChannel(channel string, n Notification) error {
+	if !f.dispatch(n) {
+		return nil
+	}
+	if channels, ok := f.next.(ChannelNotifier); ok {
+		return channels.NotifyChannel(channel, n)
+	}
+	if channel != "" {
+		return fmt.Errorf("notifier does not support channel %q", channel)
+	}
+	return f.next.Notify(n)
+}
+
+// Held returns the number of notifications waiting for a digest
+func (f *FilteredNotificationService) Held() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, held := range f.held {
+		count += len(held)
+	}
+	return count
+}
+
+// Release sends a digest for every address whose quiet hours have ended
+// and returns the number of digests sent
+func (f *FilteredNotificationService) Release() int {
+	return f.release(false)
+}
+
+// Flush sends a digest for every address holding notifications, even in
+// quiet hours, and returns the number of digests sent. It is used at
+// shutdown when held notifications cannot be saved.
+func (f *FilteredNotificationService) Flush() int {
+	return f.release(true)
+}
+
+// release sends the digests of addresses whose quiet hours have ended, or
+// of every address when all is set
+func (f *FilteredNotificationService) release(all bool) int {
+	now := f.now()
+
+	f.mu.Lock()
+	var digests []Notification
+	for key, held := range f.held {
+		rule := f.engine.RuleFor(held[0].Address)
+		if !all && rule.QuietHours != nil && rule.QuietHours.Digest && rule.QuietHours.Contains(now) {
+			continue
+		}
+		delete(f.held, key)
+		digests = append(digests, Notification{
+			Type:      TransactionDigest,
+			Address:   held[0].Address,
+			Timestamp: now.Unix(),
+			Label:     held[0].Label,
+			Tenant:    held[0].Tenant,
+			Digest: &Digest{
+				Start:         held[0].Timestamp,
+				End:           held[len(held)-1].Timestamp,
+				Notifications: held,
+			},
+		})
+	}
+	target := f.digests
+	f.mu.Unlock()
+
+	if target == nil {
+		target = f.next
+	}
+	for _, digest := range digests {
+		if err := target.Notify(digest); err != nil {
+			log.Error("Failed to send digest", "notifications", len(digest.Digest.Notifications), "address", digest.Address, "error", err)
+		}
+	}
+	return len(digests)
+}
+
+// Start releases digests every interval until stop is closed
+func (f *FilteredNotificationService) Start(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if released := f.Release(); released > 0 {
+				log.Info("Released notification digests", "count", released)
+			}
+		}
+	}
+}
+
+// HeldNotifications exposes the notifications held for digests as an
+// archive section, so they survive a restart
+type HeldNotifications struct {
+	filter *FilteredNotificationService
+}
+
+// Settings returns the archive section holding the held notifications
+func (f *FilteredNotificationService) Settings() *HeldNotifications {
+	return &HeldNotifications{filter: f}
+}
+
+// Name returns the archive record type
+func (h *HeldNotifications) Name() string {
+	return "held_notification"
+}
+
+// Export emits one record per held notification, oldest first per address
+func (h *HeldNotifications) Export(emit func(data interface{}) error) error {
+	h.filter.mu.Lock()
+	var held []Notification
+	for _, notifications := range h.filter.held {
+		held = append(held, notifications...)
+	}
+	h.filter.mu.Unlock()
+
+	for _, n := range held {
+		if err := emit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import holds a notification again until its digest is released
+func (h *HeldNotifications) Import(data json.RawMessage) error {
+	var n Notification
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	h.filter.mu.Lock()
+	defer h.filter.mu.Unlock()
+	key := heldKey(n)
+	h.filter.held[key] = append(h.filter.held[key], n)
+	return nil
+}
+
+// RuleSettings exposes the notification rules as an archive section
+type RuleSettings struct {
+	engine *RuleEngine
+}
+
+type ruleSetting struct {
+	// Address is empty for the default rule
+	Address string `json:"address,omitempty"`
+	Rule    Rule   `json:"rule"`
+}
+
+// Settings returns the archive section holding the notification rules
+func (e *RuleEngine) Settings() *RuleSettings {
+	return &RuleSettings{engine: e}
+}
+
+// Name returns the archive record type
+func (r *RuleSettings) Name() string {
+	return "rule"
+}
+
+// Export emits the default rule followed by one record per address rule
+func (r *RuleSettings) Export(emit func(data interface{}) error) error {
+	if err := emit(ruleSetting{Rule: r.engine.DefaultRule()}); err != nil {
+		return err
+	}
+	for address, rule := range r.engine.Rules() {
+		if err := emit(ruleSetting{Address: address, Rule: rule}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import restores the default rule or an address rule
+func (r *RuleSettings) Import(data json.RawMessage) error {
+	var setting ruleSetting
+	if err := json.Unmarshal(data, &setting); err != nil {
+		return err
+	}
+	if setting.Address == "" {
+		return r.engine.SetDefaultRule(setting.Rule)
+	}
+	return r.engine.SetRule(setting.Address, setting.Rule)
+}
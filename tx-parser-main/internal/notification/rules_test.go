@@ -0,0 +1,355 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRuleMatch(t *testing.T) {
+	failed := testNotification()
+	failed.Transaction.Status = storage.StatusFailed
+
+	token := testNotification()
+	token.Transaction.Token = "0xToken"
+
+	testCases := []struct {
+		name  string
+		rule  Rule
+		n     Notification
+		match bool
+	}{
+		{"empty rule", Rule{}, testNotification(), true},
+		{"above minimum", Rule{MinValue: "0.5"}, testNotification(), true},
+		{"below minimum", Rule{MinValue: "1.5"}, testNotification(), false},
+		{"direction allowed", Rule{Directions: []storage.Direction{storage.DirectionIn}}, testNotification(), true},
+		{"direction filtered", Rule{Directions: []storage.Direction{storage.DirectionOut}}, testNotification(), false},
+		{"counterparty allowed", Rule{AllowCounterparties: []string{"0x456"}}, testNotification(), true},
+		{"counterparty not allowed", Rule{AllowCounterparties: []string{"0x789"}}, testNotification(), false},
+		{"counterparty denied", Rule{DenyCounterparties: []string{"0X456"}}, testNotification(), false},
+		{"ether allowed", Rule{Tokens: []string{"ETH"}}, testNotification(), true},
+		{"token filtered", Rule{Tokens: []string{"ETH"}}, token, false},
+		{"token allowed", Rule{Tokens: []string{"0xtoken"}}, token, true},
+		{"failed only", Rule{FailedOnly: true}, testNotification(), false},
+		{"failed", Rule{FailedOnly: true}, failed, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if match, reason := tc.rule.Match(tc.n); match != tc.match {
+				t.Errorf("Expected match %v, got %v (%s)", tc.match, match, reason)
+			}
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	invalid := []Rule{
+		{MinValue: "abc"},
+		{Directions: []storage.Direction{"sideways"}},
+		{MaxPerHour: -1},
+		{QuietHours: &QuietHours{Start: "25:00", End: "07:00"}},
+		{QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}},
+	}
+	for _, rule := range invalid {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", rule)
+		}
+	}
+
+	valid := Rule{MinValue: "0.1", QuietHours: &QuietHours{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight := &QuietHours{Start: "22:00", End: "07:00"}
+	daytime := &QuietHours{Start: "09:00", End: "17:00"}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	if !overnight.Contains(at(23, 0)) || !overnight.Contains(at(3, 0)) || overnight.Contains(at(7, 0)) {
+		t.Error("Expected overnight quiet hours to wrap around midnight")
+	}
+	if !daytime.Contains(at(9, 0)) || daytime.Contains(at(17, 0)) || daytime.Contains(at(8, 59)) {
+		t.Error("Expected daytime quiet hours to end at 17:00")
+	}
+
+	zoned := &QuietHours{Start: "22:00", End: "07:00", Timezone: "Asia/Tokyo"}
+	if !zoned.Contains(at(14, 0)) {
+		t.Error("Expected 14:00 UTC to be 23:00 in Tokyo")
+	}
+}
+
+func TestRuleEngineRateCap(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetRule("0x123", Rule{MaxPerHour: 2})
+	now := time.Unix(10000, 0)
+
+	for i, want := range []Decision{DecisionDeliver, DecisionDeliver, DecisionDrop} {
+		if decision, _ := engine.Evaluate(testNotification(), now); decision != want {
+			t.Errorf("Notification %d: expected %s, got %s", i, want, decision)
+		}
+	}
+	if decision, _ := engine.Evaluate(testNotification(), now.Add(time.Hour)); decision != DecisionDeliver {
+		t.Errorf("Expected delivery once the hour has passed, got %s", decision)
+	}
+
+	// Each tenant of an address has its own budget
+	tenant := testNotification()
+	tenant.Tenant = "treasury"
+	if decision, _ := engine.Evaluate(tenant, now); decision != DecisionDeliver {
+		t.Errorf("Expected the tenant copy to be delivered, got %s", decision)
+	}
+
+	// Other addresses use the default rule without a cap
+	other := testNotification()
+	other.Address = "0x456"
+	for i := 0; i < 5; i++ {
+		if decision, _ := engine.Evaluate(other, now); decision != DecisionDeliver {
+			t.Fatalf("Expected default rule to deliver, got %s", decision)
+		}
+	}
+}
+
+func TestFilteredNotificationService(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetDefaultRule(Rule{MinValue: "2"})
+	next := &recordingNotifier{}
+	filter := NewFilteredNotificationService(next, engine)
+
+	filter.Notify(testNotification())
+	if len(next.delivered) != 0 {
+		t.Fatal("Expected notification below the minimum to be dropped")
+	}
+
+	engine.SetRule("0x123", Rule{MinValue: "0.5"})
+	filter.Notify(testNotification())
+	if len(next.delivered) != 1 {
+		t.Fatal("Expected address rule to let the notification through")
+	}
+}
+
+func TestFilteredQuietHoursDigest(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetRule("0x123", Rule{QuietHours: &QuietHours{Start: "22:00", End: "07:00", Digest: true}})
+	next := &recordingNotifier{}
+	filter := NewFilteredNotificationService(next, engine)
+
+	filter.now = func() time.Time { return time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC) }
+	for i := 0; i < 3; i++ {
+		filter.Notify(testNotification())
+	}
+	if len(next.delivered) != 0 || filter.Held() != 3 {
+		t.Fatalf("Expected 3 held notifications, delivered %d", len(next.delivered))
+	}
+	if filter.Release() != 0 {
+		t.Error("Expected no digest during quiet hours")
+	}
+
+	filter.now = func() time.Time { return time.Date(2024, 1, 2, 7, 30, 0, 0, time.UTC) }
+	if filter.Release() != 1 {
+		t.Fatal("Expected one digest after quiet hours")
+	}
+	if len(next.delivered) != 1 {
+		t.Fatalf("Expected the digest to be delivered, got %d", len(next.delivered))
+	}
+	digest := next.delivered[0]
+	if digest.Type != TransactionDigest || len(digest.Digest.Notifications) != 3 || filter.Held() != 0 {
+		t.Errorf("Unexpected digest: %+v", digest)
+	}
+}
+
+func TestFilteredDigestPerTenant(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetRule("0x123", Rule{QuietHours: &QuietHours{Start: "22:00", End: "07:00", Digest: true}})
+	next := &recordingNotifier{}
+	filter := NewFilteredNotificationService(next, engine)
+
+	filter.now = func() time.Time { return time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC) }
+	for _, tenant := range []string{"payments", "treasury", "treasury"} {
+		n := testNotification()
+		n.Tenant = tenant
+		filter.Notify(n)
+	}
+
+	filter.now = func() time.Time { return time.Date(2024, 1, 2, 7, 30, 0, 0, time.UTC) }
+	if filter.Release() != 2 {
+		t.Fatal("Expected one digest per tenant")
+	}
+	for _, digest := range next.delivered {
+		want := map[string]int{"payments": 1, "treasury": 2}[digest.Tenant]
+		if len(digest.Digest.Notifications) != want {
+			t.Errorf("Expected %d notifications for %s, got %d", want, digest.Tenant, len(digest.Digest.Notifications))
+		}
+	}
+}
+
+func TestFilteredOutbox(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetDefaultRule(Rule{MaxPerHour: 1})
+	next := &recordingNotifier{}
+	filter := NewFilteredNotificationService(next, engine)
+	outbox, _ := newTestOutbox(filter, 3)
+
+	// Queueing only matches the filters; the rate cap counts deliveries
+	first, second := testNotification(), testNotification()
+	second.Transaction.Hash = "0xdef"
+	outbox.Notify(first)
+	outbox.Notify(second)
+	if claimed := outbox.ProcessBatch(); claimed != 2 {
+		t.Fatalf("Expected 2 queued messages, got %d", claimed)
+	}
+	if len(next.delivered) != 1 {
+		t.Errorf("Expected 1 delivery, got %d", len(next.delivered))
+	}
+}
+
+func TestFilteredChannelsArePure(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetDefaultRule(Rule{MaxPerHour: 1, QuietHours: &QuietHours{Start: "22:00", End: "07:00", Digest: true}})
+	next := &recordingNotifier{}
+	filter := NewFilteredNotificationService(next, engine)
+	filter.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+	for i := 0; i < 3; i++ {
+		if channels := filter.Channels(testNotification()); len(channels) != 1 {
+			t.Fatalf("Expected the notification to be routed, got %v", channels)
+		}
+	}
+
+	// The channels and retries of one notification count once
+	for i := 0; i < 3; i++ {
+		filter.NotifyChannel("", testNotification())
+	}
+	other := testNotification()
+	other.Transaction.Hash = "0xdef"
+	filter.NotifyChannel("", other)
+	if len(next.delivered) != 3 {
+		t.Errorf("Expected the first notification on each attempt and the second capped, got %d", len(next.delivered))
+	}
+
+	// Quiet hours hold the notification when it is dispatched
+	filter.now = func() time.Time { return time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC) }
+	late := testNotification()
+	late.Transaction.Hash = "0x789"
+	if len(filter.Channels(late)) != 1 || filter.Held() != 0 {
+		t.Fatal("Expected routing not to hold the notification")
+	}
+	filter.NotifyChannel("", late)
+	filter.NotifyChannel("", late)
+	if filter.Held() != 1 {
+		t.Errorf("Expected one held notification, got %d", filter.Held())
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	var transactions []storage.Transaction
+	for i, wei := range []string{"3000000000000000000", "100000000000000000", "2000000000000000000", "5000000000000000000"} {
+		tx := testNotification().Transaction
+		tx.ValueWei = wei
+		tx.Timestamp = int64(1000 + i*60)
+		transactions = append(transactions, tx)
+	}
+
+	results, err := DryRun("0x123", Rule{MinValue: "1", MaxPerHour: 2}, transactions)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []Decision{DecisionDeliver, DecisionDrop, DecisionDeliver, DecisionDrop}
+	for i, result := range results {
+		if result.Decision != want[i] {
+			t.Errorf("Transaction %d: expected %s, got %s (%s)", i, want[i], result.Decision, result.Reason)
+		}
+	}
+
+	if _, err := DryRun("0x123", Rule{MinValue: "x"}, transactions); err == nil {
+		t.Error("Expected error for an invalid rule")
+	}
+}
+
+func TestLoadRuleEngine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`{
+		"default": {"min_value": "0.1"},
+		"addresses": {"0xABC": {"directions": ["in"], "max_per_hour": 5}}
+	}`), 0644)
+
+	engine, err := LoadRuleEngine(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if engine.DefaultRule().MinValue != "0.1" || engine.RuleFor("0xabc").MaxPerHour != 5 {
+		t.Errorf("Unexpected rules: %+v %+v", engine.DefaultRule(), engine.Rules())
+	}
+
+	os.WriteFile(path, []byte(`{"default": {"max_per_hour": -1}}`), 0644)
+	if _, err := LoadRuleEngine(path); err == nil {
+		t.Error("Expected error for an invalid rule")
+	}
+}
+
+func TestRuleSettingsRoundTrip(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetDefaultRule(Rule{MinValue: "1"})
+	engine.SetRule("0x123", Rule{FailedOnly: true})
+
+	var records []json.RawMessage
+	engine.Settings().Export(func(data interface{}) error {
+		raw, _ := json.Marshal(data)
+		records = append(records, raw)
+		return nil
+	})
+
+	restored := NewRuleEngine()
+	for _, record := range records {
+		if err := restored.Settings().Import(record); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if restored.DefaultRule().MinValue != "1" || !restored.RuleFor("0x123").FailedOnly {
+		t.Errorf("Expected rules to round-trip, got %+v %+v", restored.DefaultRule(), restored.Rules())
+	}
+}
+
+func TestHeldNotificationsSurviveRestart(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetRule("0x123", Rule{QuietHours: &QuietHours{Start: "22:00", End: "07:00", Digest: true}})
+	night := func() time.Time { return time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC) }
+	filter := NewFilteredNotificationService(&recordingNotifier{}, engine)
+	filter.now = night
+	filter.Notify(testNotification())
+	filter.Notify(testNotification())
+
+	var records []json.RawMessage
+	filter.Settings().Export(func(data interface{}) error {
+		raw, _ := json.Marshal(data)
+		records = append(records, raw)
+		return nil
+	})
+
+	next := &recordingNotifier{}
+	restored := NewFilteredNotificationService(next, engine)
+	restored.now = night
+	for _, record := range records {
+		if err := restored.Settings().Import(record); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if restored.Held() != 2 {
+		t.Fatalf("Expected 2 restored notifications, got %d", restored.Held())
+	}
+
+	// Without a state file the held notifications are sent at shutdown
+	if restored.Release() != 0 || restored.Flush() != 1 {
+		t.Fatal("Expected one digest to be flushed during quiet hours")
+	}
+	if len(next.delivered) != 1 || len(next.delivered[0].Digest.Notifications) != 2 || restored.Held() != 0 {
+		t.Errorf("Unexpected digest: %+v", next.delivered)
+	}
+}
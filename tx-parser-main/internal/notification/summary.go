@@ -0,0 +1,280 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/utils"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SummaryPeriod is the window a periodic summary covers
+type SummaryPeriod string
+
+const (
+	SummaryHourly SummaryPeriod = "hourly"
+	SummaryDaily  SummaryPeriod = "daily"
+	SummaryWeekly SummaryPeriod = "weekly"
+)
+
+// ParseSummaryPeriod parses hourly, daily or weekly
+func ParseSummaryPeriod(value string) (SummaryPeriod, error) {
+	switch period := SummaryPeriod(strings.ToLower(value)); period {
+	case SummaryHourly, SummaryDaily, SummaryWeekly:
+		return period, nil
+	default:
+		return "", fmt.Errorf("invalid summary period %q, expected hourly, daily or weekly", value)
+	}
+}
+
+// windowStart returns the start of the window containing t. Daily and
+// weekly windows start at midnight, weekly windows on Monday.
+func (p SummaryPeriod) windowStart(t time.Time) time.Time {
+	switch p {
+	case SummaryHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case SummaryWeekly:
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return midnight.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+// next returns the start of the window following the one starting at start
+func (p SummaryPeriod) next(start time.Time) time.Time {
+	switch p {
+	case SummaryHourly:
+		return start.Add(time.Hour)
+	case SummaryWeekly:
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Summary aggregates the transactions of one address over a window.
+// Ether totals leave out token transfers and fees.
+type Summary struct {
+	Period       SummaryPeriod
+	Transactions int
+	Incoming     int
+	Outgoing     int
+	Self         int
+	TotalIn      string
+	TotalOut     string
+
+	// Largest holds the largest ether transfers, largest first
+	Largest []storage.Transaction
+
+	// Failed holds the reverted transactions in timestamp order
+	Failed []storage.Transaction
+}
+
+// SummaryConfig controls the summary scheduler
+type SummaryConfig struct {
+	Period SummaryPeriod
+
+	// Location aligns windows to local midnight, UTC when nil
+	Location *time.Location
+
+	// Largest is the number of largest transfers listed per summary
+	Largest int
+
+	// MaxCatchUp bounds how many missed windows are summarised after
+	// downtime; older windows are skipped
+	MaxCatchUp int
+
+	// CheckInterval is how often the scheduler looks for ended windows
+	CheckInterval time.Duration
+}
+
+// DefaultSummaryConfig returns the settings used when none are configured
+func DefaultSummaryConfig() SummaryConfig {
+	return SummaryConfig{
+		Period:        SummaryDaily,
+		Location:      time.UTC,
+		Largest:       3,
+		MaxCatchUp:    7,
+		CheckInterval: time.Minute,
+	}
+}
+
+// SummaryStore is the storage surface needed to build summaries
+type SummaryStore interface {
+	storage.TransactionScanner
+	storage.CheckpointStore
+	GetSubscribers() []string
+	GetLabel(address string) string
+}
+
+// SummaryScheduler sends a TransactionSummary per subscription whenever a
+// window ends. The end of the last summarised window is kept as a storage
+// checkpoint, so windows missed while the process was down are sent when it
+// starts again.
+type SummaryScheduler struct {
+	store    SummaryStore
+	notifier NotificationService
+	config   SummaryConfig
+	now      func() time.Time
+}
+
+// NewSummaryScheduler creates a scheduler delivering through notifier
+func NewSummaryScheduler(store SummaryStore, notifier NotificationService, cfg SummaryConfig) *SummaryScheduler {
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	if cfg.MaxCatchUp <= 0 {
+		cfg.MaxCatchUp = 1
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Minute
+	}
+	return &SummaryScheduler{
+		store:    store,
+		notifier: notifier,
+		config:   cfg,
+		now:      time.Now,
+	}
+}
+
+// checkpoint names the storage checkpoint of the scheduler period
+func (s *SummaryScheduler) checkpoint() string {
+	return "summary:" + string(s.config.Period)
+}
+
+// Start sends summaries for ended windows, including windows missed while
+// the process was down, and then checks every CheckInterval until stop is
+// closed
+func (s *SummaryScheduler) Start(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.Run()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run sends the summaries of every window that ended since the last run and
+// returns the number of windows summarised. The first run only records the
+// current window, so history from before summaries were enabled is skipped.
+func (s *SummaryScheduler) Run() int {
+	current := s.config.Period.windowStart(s.now().In(s.config.Location))
+
+	last, ok := s.store.GetCheckpoint(s.checkpoint())
+	if !ok {
+		s.store.SetCheckpoint(s.checkpoint(), current.Unix())
+		return 0
+	}
+
+	var windows []time.Time
+	for start := s.config.Period.windowStart(time.Unix(last, 0).In(s.config.Location)); start.Before(current); start = s.config.Period.next(start) {
+		windows = append(windows, start)
+	}
+	if skipped := len(windows) - s.config.MaxCatchUp; skipped > 0 {
+		log.Warn("Skipping missed summary windows", "count", skipped, "period", s.config.Period)
+		windows = windows[skipped:]
+	}
+
+	for _, start := range windows {
+		end := s.config.Period.next(start)
+		sent := s.summarize(start, end)
+		s.store.SetCheckpoint(s.checkpoint(), end.Unix())
+		log.Info("Sent summaries", "count", sent, "period", s.config.Period, "start", start.Format(time.RFC3339))
+	}
+	return len(windows)
+}
+
+// summarize sends the summary of [start, end) for every subscription with
+// transactions in the window and returns the number sent
+func (s *SummaryScheduler) summarize(start, end time.Time) int {
+	sent := 0
+	for _, address := range s.store.GetSubscribers() {
+		summary := s.Summarize(address, start, end)
+		if summary.Transactions == 0 {
+			continue
+		}
+
+		n := Notification{
+			Type:      TransactionSummary,
+			Address:   address,
+			Timestamp: end.Unix(),
+			Label:     s.store.GetLabel(address),
+			Digest: &Digest{
+				Start:   start.Unix(),
+				End:     end.Unix(),
+				Summary: summary,
+			},
+		}
+		if err := s.notifier.Notify(n); err != nil {
+			log.Error("Failed to send summary", "period", s.config.Period, "address", address, "error", err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// Summarize aggregates the stored transactions of address in [start, end)
+func (s *SummaryScheduler) Summarize(address string, start, end time.Time) *Summary {
+	summary := &Summary{Period: s.config.Period}
+	totalIn, totalOut := new(big.Int), new(big.Int)
+	var ether []storage.Transaction
+
+	s.store.ScanTransactions(address, func(tx storage.Transaction) error {
+		if tx.Timestamp < start.Unix() || tx.Timestamp >= end.Unix() {
+			return nil
+		}
+		summary.Transactions++
+		if tx.Status == storage.StatusFailed {
+			summary.Failed = append(summary.Failed, tx)
+		}
+
+		switch tx.Direction {
+		case storage.DirectionIn:
+			summary.Incoming++
+		case storage.DirectionOut:
+			summary.Outgoing++
+		default:
+			summary.Self++
+		}
+
+		value, ok := new(big.Int).SetString(tx.ValueWei, 10)
+		if tx.Token != "" || !ok || tx.Status == storage.StatusFailed {
+			return nil
+		}
+		ether = append(ether, tx)
+		switch tx.Direction {
+		case storage.DirectionIn:
+			totalIn.Add(totalIn, value)
+		case storage.DirectionOut:
+			totalOut.Add(totalOut, value)
+		}
+		return nil
+	})
+
+	summary.TotalIn = utils.WeiToEther(totalIn)
+	summary.TotalOut = utils.WeiToEther(totalOut)
+
+	sort.SliceStable(ether, func(i, j int) bool {
+		a, _ := new(big.Int).SetString(ether[i].ValueWei, 10)
+		b, _ := new(big.Int).SetString(ether[j].ValueWei, 10)
+		return a.Cmp(b) > 0
+	})
+	if len(ether) > s.config.Largest {
+		ether = ether[:s.config.Largest]
+	}
+	summary.Largest = ether
+
+	sort.SliceStable(summary.Failed, func(i, j int) bool {
+		return summary.Failed[i].Timestamp < summary.Failed[j].Timestamp
+	})
+	return summary
+}
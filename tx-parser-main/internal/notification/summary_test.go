@@ -0,0 +1,181 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	summaryAddress      = "0x1111111111111111111111111111111111111111"
+	summaryCounterparty = "0x2222222222222222222222222222222222222222"
+)
+
+func newSummaryStore(t *testing.T, day time.Time) *storage.MemoryStorage {
+	t.Helper()
+	store := storage.NewMemoryStorage()
+	store.AddSubscriber(summaryAddress)
+	store.SetLabel(summaryAddress, "Treasury")
+
+	transactions := []storage.Transaction{
+		{Hash: "0x01", FromAddress: summaryCounterparty, ToAddress: summaryAddress, ValueWei: "2000000000000000000"},
+		{Hash: "0x02", FromAddress: summaryCounterparty, ToAddress: summaryAddress, ValueWei: "500000000000000000"},
+		{Hash: "0x03", FromAddress: summaryAddress, ToAddress: summaryCounterparty, ValueWei: "1000000000000000000"},
+		{Hash: "0x04", FromAddress: summaryAddress, ToAddress: summaryCounterparty, ValueWei: "9000000000000000000", Status: storage.StatusFailed},
+		{Hash: "0x05", FromAddress: summaryAddress, ToAddress: summaryCounterparty, ValueWei: "7", Token: "0xtoken"},
+	}
+	for i, tx := range transactions {
+		tx.Timestamp = day.Add(time.Duration(i+1) * time.Hour).Unix()
+		tx.BlockNumber = int64(i + 1)
+		store.StoreTransaction(tx)
+	}
+
+	// Outside the window
+	store.StoreTransaction(storage.Transaction{
+		Hash: "0x06", FromAddress: summaryCounterparty, ToAddress: summaryAddress,
+		ValueWei: "100000000000000000000", Timestamp: day.Add(-time.Hour).Unix(),
+	})
+	return store
+}
+
+func TestParseSummaryPeriod(t *testing.T) {
+	if period, err := ParseSummaryPeriod("Daily"); err != nil || period != SummaryDaily {
+		t.Errorf("Expected daily period, got %q (%v)", period, err)
+	}
+	if _, err := ParseSummaryPeriod("monthly"); err == nil {
+		t.Error("Expected error for an unsupported period")
+	}
+}
+
+func TestSummaryPeriodWindows(t *testing.T) {
+	// Wednesday
+	at := time.Date(2024, 1, 3, 15, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		period SummaryPeriod
+		start  time.Time
+		next   time.Time
+	}{
+		{SummaryHourly, time.Date(2024, 1, 3, 15, 0, 0, 0, time.UTC), time.Date(2024, 1, 3, 16, 0, 0, 0, time.UTC)},
+		{SummaryDaily, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{SummaryWeekly, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range testCases {
+		start := tc.period.windowStart(at)
+		if !start.Equal(tc.start) || !tc.period.next(start).Equal(tc.next) {
+			t.Errorf("%s: expected window %s-%s, got %s-%s", tc.period, tc.start, tc.next, start, tc.period.next(start))
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := DefaultSummaryConfig()
+	cfg.Largest = 2
+	scheduler := NewSummaryScheduler(newSummaryStore(t, day), &recordingNotifier{}, cfg)
+
+	summary := scheduler.Summarize(summaryAddress, day, day.AddDate(0, 0, 1))
+	if summary.Transactions != 5 || summary.Incoming != 2 || summary.Outgoing != 3 {
+		t.Errorf("Unexpected counts: %+v", summary)
+	}
+	if summary.TotalIn != "2.5" || summary.TotalOut != "1" {
+		t.Errorf("Expected totals 2.5 in and 1 out, got %s and %s", summary.TotalIn, summary.TotalOut)
+	}
+	if len(summary.Largest) != 2 || summary.Largest[0].Hash != "0x01" || summary.Largest[1].Hash != "0x03" {
+		t.Errorf("Unexpected largest transfers: %+v", summary.Largest)
+	}
+	if len(summary.Failed) != 1 || summary.Failed[0].Hash != "0x04" {
+		t.Errorf("Expected the failed transaction, got %+v", summary.Failed)
+	}
+}
+
+func TestSummarySchedulerCatchUp(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newSummaryStore(t, day)
+	notifier := &recordingNotifier{}
+	scheduler := NewSummaryScheduler(store, notifier, DefaultSummaryConfig())
+
+	// The first run only records the current window
+	scheduler.now = func() time.Time { return day.Add(30 * time.Minute) }
+	if windows := scheduler.Run(); windows != 0 {
+		t.Fatalf("Expected no summaries on the first run, got %d", windows)
+	}
+
+	// The process was down for two days: both missed days are summarised
+	scheduler.now = func() time.Time { return day.AddDate(0, 0, 2).Add(time.Hour) }
+	if windows := scheduler.Run(); windows != 2 {
+		t.Fatalf("Expected 2 caught-up windows, got %d", windows)
+	}
+	if len(notifier.delivered) != 1 {
+		t.Fatalf("Expected one summary for the day with transactions, got %d", len(notifier.delivered))
+	}
+	n := notifier.delivered[0]
+	if n.Type != TransactionSummary || n.Label != "Treasury" || n.Digest.Start != day.Unix() ||
+		n.Digest.Summary.Transactions != 5 {
+		t.Errorf("Unexpected summary notification: %+v", n)
+	}
+
+	if windows := scheduler.Run(); windows != 0 {
+		t.Errorf("Expected no windows on a repeated run, got %d", windows)
+	}
+	if value, _ := store.GetCheckpoint("summary:daily"); value != day.AddDate(0, 0, 2).Unix() {
+		t.Errorf("Expected checkpoint at the current window, got %d", value)
+	}
+}
+
+func TestSummarySchedulerMaxCatchUp(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newSummaryStore(t, day)
+	store.SetCheckpoint("summary:hourly", day.Add(-48*time.Hour).Unix())
+
+	cfg := DefaultSummaryConfig()
+	cfg.Period = SummaryHourly
+	cfg.MaxCatchUp = 3
+	scheduler := NewSummaryScheduler(store, &recordingNotifier{}, cfg)
+	scheduler.now = func() time.Time { return day }
+
+	if windows := scheduler.Run(); windows != 3 {
+		t.Errorf("Expected catch-up to be bounded to 3 windows, got %d", windows)
+	}
+}
+
+func TestSummaryPayloads(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	scheduler := NewSummaryScheduler(newSummaryStore(t, day), &recordingNotifier{}, DefaultSummaryConfig())
+	n := Notification{
+		Type:    TransactionSummary,
+		Address: summaryAddress,
+		Label:   "Treasury",
+		Digest: &Digest{
+			Start:   day.Unix(),
+			End:     day.AddDate(0, 0, 1).Unix(),
+			Summary: scheduler.Summarize(summaryAddress, day, day.AddDate(0, 0, 1)),
+		},
+	}
+
+	body, _ := json.Marshal(newWebhookPayload(n))
+	for _, want := range []string{`"type":"TRANSACTION_SUMMARY"`, `"total_in":"2.5"`, `"period":"daily"`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected webhook payload to contain %s: %s", want, body)
+		}
+	}
+
+	message, _ := FormatChat(ChatSlack, n, Explorer{})
+	body, _ = json.Marshal(message)
+	if !strings.Contains(string(body), "daily summary: 5 transactions") {
+		t.Errorf("Expected chat summary title: %s", body)
+	}
+
+	server := newFakeSMTPServer(t, false)
+	email := newTestEmailService(server, time.Hour)
+	email.SetRecipient(summaryAddress, "owner@example.com")
+	if err := email.Notify(n); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	messages := server.received()
+	if len(messages) != 1 || !strings.Contains(messages[0].data, "Subject: daily summary for "+summaryAddress) {
+		t.Errorf("Expected summary email to be sent at once, got %+v", messages)
+	}
+}
@@ -0,0 +1,30 @@
+package notification
+
+// TenantResolver returns the tenants watching an address
+type TenantResolver interface {
+	GetAddressTenants(address string) []string
+}
+
+// ForTenants returns one copy of each notification per tenant watching its
+// address. Notifications already bound to a tenant, and those of addresses
+// without tenants, are kept as they are.
+func ForTenants(notifications []Notification, tenants TenantResolver) []Notification {
+	result := make([]Notification, 0, len(notifications))
+	for _, n := range notifications {
+		if n.Tenant != "" {
+			result = append(result, n)
+			continue
+		}
+		owners := tenants.GetAddressTenants(n.Address)
+		if len(owners) == 0 {
+			result = append(result, n)
+			continue
+		}
+		for _, tenant := range owners {
+			owned := n
+			owned.Tenant = tenant
+			result = append(result, owned)
+		}
+	}
+	return result
+}
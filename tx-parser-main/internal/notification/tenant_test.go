@@ -0,0 +1,79 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForTenants(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	store.AddTenantAddress("payments", "0x123")
+	store.AddTenantAddress("treasury", "0x123")
+
+	owned := testNotification()
+	owned.Tenant = "payments"
+	other := testNotification()
+	other.Address = "0x999"
+
+	result := ForTenants([]Notification{testNotification(), owned, other}, store)
+	if len(result) != 4 {
+		t.Fatalf("Expected 4 notifications, got %d", len(result))
+	}
+	if result[0].Tenant != "payments" || result[1].Tenant != "treasury" {
+		t.Errorf("Expected one copy per tenant, got %q and %q", result[0].Tenant, result[1].Tenant)
+	}
+	if result[2].Tenant != "payments" || result[3].Tenant != "" {
+		t.Errorf("Expected bound and untenanted notifications to be kept, got %+v", result[2:])
+	}
+}
+
+func TestOutboxRoutesPerTenant(t *testing.T) {
+	composite, healthy, _ := newTestComposite()
+	composite.SetDefaultChannels("console")
+	if err := composite.SetTenantRoute("treasury", []string{"webhook"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	outbox, store := newTestOutbox(composite, 1)
+	store.AddTenantAddress("payments", "0x123")
+	store.AddTenantAddress("treasury", "0x123")
+	outbox.SetTenants(store)
+
+	outbox.Notify(testNotification())
+	if stats := outbox.Stats(); stats.Pending != 2 {
+		t.Fatalf("Expected one message per tenant, got %+v", stats)
+	}
+	outbox.ProcessBatch()
+
+	if len(healthy.delivered) != 1 || healthy.delivered[0].Tenant != "payments" {
+		t.Errorf("Expected the payments copy on the default channel, got %+v", healthy.delivered)
+	}
+	if dead := outbox.DeadLetters(); len(dead) != 1 || dead[0].Channel != "webhook" {
+		t.Errorf("Expected the treasury copy on its own route, got %+v", dead)
+	}
+}
+
+func TestWebhookTenantEndpoint(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestWebhookService(1)
+	service.SetEndpoint("0x123", WebhookEndpoint{URL: server.URL + "/address"})
+	service.SetTenantEndpoint("treasury", WebhookEndpoint{URL: server.URL + "/treasury"})
+
+	tenant := testNotification()
+	tenant.Tenant = "treasury"
+	service.Notify(tenant)
+	other := testNotification()
+	other.Tenant = "payments"
+	service.Notify(other)
+
+	if len(received) != 2 || received[0] != "/treasury" || received[1] != "/address" {
+		t.Errorf("Expected the tenant webhook before the address webhook, got %v", received)
+	}
+}
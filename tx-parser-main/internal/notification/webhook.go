@@ -0,0 +1,438 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers set on every webhook request
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+)
+
+// WebhookEndpoint is a webhook destination and the secret used to sign its requests
+type WebhookEndpoint struct {
+	URL    string
+	Secret string
+}
+
+// WebhookConfig controls webhook delivery
+type WebhookConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Timeout     time.Duration
+	// HistorySize bounds how many delivery attempts are kept for inspection
+	HistorySize int
+}
+
+// DefaultWebhookConfig returns the delivery settings used when none are configured
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		Timeout:     10 * time.Second,
+		HistorySize: 1000,
+	}
+}
+
+// DeliveryAttempt records a single webhook request
+type DeliveryAttempt struct {
+	Address    string
+	URL        string
+	Hash       string
+	Attempt    int
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	Time       time.Time
+}
+
+// WebhookNotificationService POSTs signed JSON payloads to per-address URLs
+type WebhookNotificationService struct {
+	config WebhookConfig
+	client *http.Client
+	sleep  func(time.Duration)
+
+	mu              sync.RWMutex
+	defaultEndpoint *WebhookEndpoint
+	endpoints       map[string]WebhookEndpoint
+	tenantEndpoints map[string]WebhookEndpoint
+	attempts        []DeliveryAttempt
+}
+
+// NewWebhookNotificationService creates a webhook notifier without endpoints
+func NewWebhookNotificationService(cfg WebhookConfig) *WebhookNotificationService {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	return &WebhookNotificationService{
+		config:          cfg,
+		client:          &http.Client{Timeout: cfg.Timeout},
+		sleep:           time.Sleep,
+		endpoints:       make(map[string]WebhookEndpoint),
+		tenantEndpoints: make(map[string]WebhookEndpoint),
+	}
+}
+
+// webhookPayload is the JSON body sent for each notification
+type webhookPayload struct {
+	Type         NotificationType     `json:"type"`
+	Address      string               `json:"address"`
+	Label        string               `json:"label,omitempty"`
+	Tenant       string               `json:"tenant,omitempty"`
+	Counterparty string               `json:"counterparty,omitempty"`
+	Amount       string               `json:"amount,omitempty"`
+	Timestamp    int64                `json:"timestamp"`
+	Transaction  *webhookTransaction  `json:"transaction,omitempty"`
+	Digest       []webhookTransaction `json:"digest,omitempty"`
+	Summary      *webhookSummary      `json:"summary,omitempty"`
+}
+
+type webhookSummary struct {
+	Period       SummaryPeriod        `json:"period"`
+	Start        int64                `json:"start"`
+	End          int64                `json:"end"`
+	Transactions int                  `json:"transactions"`
+	Incoming     int                  `json:"incoming"`
+	Outgoing     int                  `json:"outgoing"`
+	Self         int                  `json:"self"`
+	TotalIn      string               `json:"total_in"`
+	TotalOut     string               `json:"total_out"`
+	Largest      []webhookTransaction `json:"largest"`
+	Failed       []webhookTransaction `json:"failed"`
+}
+
+type webhookTransaction struct {
+	Hash        string  `json:"hash"`
+	Index       int     `json:"index"`
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	Value       float64 `json:"value"`
+	ValueWei    string  `json:"value_wei,omitempty"`
+	FeeWei      string  `json:"fee_wei,omitempty"`
+	Status      string  `json:"status,omitempty"`
+	Token       string  `json:"token,omitempty"`
+	BlockNumber int64   `json:"block_number"`
+	Timestamp   int64   `json:"timestamp"`
+}
+
+func newWebhookPayload(n Notification) webhookPayload {
+	payload := webhookPayload{
+		Type:         n.Type,
+		Address:      n.Address,
+		Label:        n.Label,
+		Tenant:       n.Tenant,
+		Counterparty: n.Counterparty,
+		Amount:       n.Amount,
+		Timestamp:    n.Timestamp,
+	}
+	if n.Digest != nil && n.Digest.Summary != nil {
+		payload.Summary = newWebhookSummary(n.Digest)
+		return payload
+	}
+	if n.Digest != nil {
+		for _, held := range n.Digest.Notifications {
+			payload.Digest = append(payload.Digest, newWebhookTransaction(held.Transaction))
+		}
+		return payload
+	}
+	tx := newWebhookTransaction(n.Transaction)
+	payload.Transaction = &tx
+	return payload
+}
+
+func newWebhookSummary(digest *Digest) *webhookSummary {
+	summary := digest.Summary
+	payload := &webhookSummary{
+		Period:       summary.Period,
+		Start:        digest.Start,
+		End:          digest.End,
+		Transactions: summary.Transactions,
+		Incoming:     summary.Incoming,
+		Outgoing:     summary.Outgoing,
+		Self:         summary.Self,
+		TotalIn:      summary.TotalIn,
+		TotalOut:     summary.TotalOut,
+		Largest:      []webhookTransaction{},
+		Failed:       []webhookTransaction{},
+	}
+	for _, tx := range summary.Largest {
+		payload.Largest = append(payload.Largest, newWebhookTransaction(tx))
+	}
+	for _, tx := range summary.Failed {
+		payload.Failed = append(payload.Failed, newWebhookTransaction(tx))
+	}
+	return payload
+}
+
+func newWebhookTransaction(tx storage.Transaction) webhookTransaction {
+	return webhookTransaction{
+		Hash:        tx.Hash,
+		Index:       tx.Index,
+		From:        tx.FromAddress,
+		To:          tx.ToAddress,
+		Value:       tx.Value,
+		ValueWei:    tx.ValueWei,
+		FeeWei:      tx.FeeWei,
+		Status:      tx.Status,
+		Token:       tx.Token,
+		BlockNumber: tx.BlockNumber,
+		Timestamp:   tx.Timestamp,
+	}
+}
+
+// Sign returns the signature header value for a body sent at timestamp.
+// Receivers recompute it over "<timestamp>.<body>" with the shared secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetDefaultEndpoint sets the endpoint used for addresses without their own
+func (s *WebhookNotificationService) SetDefaultEndpoint(endpoint WebhookEndpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultEndpoint = &endpoint
+}
+
+// SetEndpoint sets the webhook of a subscribed address. An empty URL removes it.
+func (s *WebhookNotificationService) SetEndpoint(address string, endpoint WebhookEndpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	address = strings.ToLower(address)
+	if endpoint.URL == "" {
+		delete(s.endpoints, address)
+		return
+	}
+	s.endpoints[address] = endpoint
+}
+
+// Endpoints returns the per-address webhooks
+func (s *WebhookNotificationService) Endpoints() map[string]WebhookEndpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	endpoints := make(map[string]WebhookEndpoint, len(s.endpoints))
+	for address, endpoint := range s.endpoints {
+		endpoints[address] = endpoint
+	}
+	return endpoints
+}
+
+// SetTenantEndpoint sets the webhook receiving every notification delivered
+// for a tenant. An empty URL removes it.
+func (s *WebhookNotificationService) SetTenantEndpoint(tenant string, endpoint WebhookEndpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if endpoint.URL == "" {
+		delete(s.tenantEndpoints, tenant)
+		return
+	}
+	s.tenantEndpoints[tenant] = endpoint
+}
+
+// TenantEndpoints returns the per-tenant webhooks
+func (s *WebhookNotificationService) TenantEndpoints() map[string]WebhookEndpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	endpoints := make(map[string]WebhookEndpoint, len(s.tenantEndpoints))
+	for tenant, endpoint := range s.tenantEndpoints {
+		endpoints[tenant] = endpoint
+	}
+	return endpoints
+}
+
+// endpointFor returns the webhook of the notification tenant or address,
+// falling back to the default
+func (s *WebhookNotificationService) endpointFor(n Notification) (WebhookEndpoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if endpoint, ok := s.tenantEndpoints[n.Tenant]; ok && n.Tenant != "" {
+		return endpoint, true
+	}
+	if endpoint, ok := s.endpoints[strings.ToLower(n.Address)]; ok {
+		return endpoint, true
+	}
+	if s.defaultEndpoint != nil {
+		return *s.defaultEndpoint, true
+	}
+	return WebhookEndpoint{}, false
+}
+
+// Attempts returns the most recent delivery attempts, oldest first
+func (s *WebhookNotificationService) Attempts() []DeliveryAttempt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]DeliveryAttempt(nil), s.attempts...)
+}
+
+func (s *WebhookNotificationService) recordAttempt(attempt DeliveryAttempt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, attempt)
+	if s.config.HistorySize > 0 && len(s.attempts) > s.config.HistorySize {
+		s.attempts = s.attempts[len(s.attempts)-s.config.HistorySize:]
+	}
+}
+
+// Notify delivers the notification to the address webhook, retrying with
+// exponential backoff on network errors, 429 and 5xx responses
+func (s *WebhookNotificationService) Notify(n Notification) error {
+	endpoint, ok := s.endpointFor(n)
+	if !ok {
+		log.Debug("No webhook configured, skipping", "address", n.Address)
+		return nil
+	}
+
+	body, err := json.Marshal(newWebhookPayload(n))
+	if err != nil {
+		return fmt.Errorf("error encoding webhook payload: %v", err)
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= s.config.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			s.sleep(s.backoff(attempt - 1))
+		}
+
+		retry, err := s.deliver(endpoint, n, body, attempt)
+		if err == nil {
+			log.Info("Webhook delivered", "address", n.Address, "url", endpoint.URL, "attempt", attempt)
+			return nil
+		}
+		lastErr = err
+		log.Warn("Webhook delivery failed",
+			"address", n.Address, "url", endpoint.URL, "attempt", attempt, "max_attempts", s.config.MaxAttempts, "error", err)
+		if !retry {
+			break
+		}
+	}
+	return fmt.Errorf("webhook delivery to %s failed: %v", endpoint.URL, lastErr)
+}
+
+// deliver sends one signed request and reports whether a failure is retryable
+func (s *WebhookNotificationService) deliver(endpoint WebhookEndpoint, n Notification, body []byte, attempt int) (bool, error) {
+	started := time.Now()
+	record := DeliveryAttempt{
+		Address: n.Address,
+		URL:     endpoint.URL,
+		Hash:    n.Transaction.Hash,
+		Attempt: attempt,
+		Time:    started,
+	}
+	defer func() {
+		record.Duration = time.Since(started)
+		s.recordAttempt(record)
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		record.Error = err.Error()
+		return false, err
+	}
+	timestamp := started.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureTimestampHeader, strconv.FormatInt(timestamp, 10))
+	if endpoint.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(endpoint.Secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		record.Error = err.Error()
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	record.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	record.Error = err.Error()
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, err
+}
+
+// backoff returns the delay before the retry following attempt
+func (s *WebhookNotificationService) backoff(attempt int) time.Duration {
+	return backoffDelay(s.config.BaseDelay, s.config.MaxDelay, attempt)
+}
+
+// backoffDelay doubles base for every attempt, capped at max
+func backoffDelay(base, max time.Duration, attempt int) time.Duration {
+	delay := base << (attempt - 1)
+	if max > 0 && (delay > max || delay <= 0) {
+		delay = max
+	}
+	return delay
+}
+
+// WebhookSettings exposes the per-address webhooks as an archive section
+type WebhookSettings struct {
+	service *WebhookNotificationService
+}
+
+type webhookSetting struct {
+	Address string `json:"address,omitempty"`
+	Tenant  string `json:"tenant,omitempty"`
+	URL     string `json:"url"`
+	Secret  string `json:"secret,omitempty"`
+}
+
+// Settings returns the archive section holding the per-address webhooks
+func (s *WebhookNotificationService) Settings() *WebhookSettings {
+	return &WebhookSettings{service: s}
+}
+
+// Name returns the archive record type
+func (w *WebhookSettings) Name() string {
+	return "webhook"
+}
+
+// Export emits one record per address webhook and per tenant webhook
+func (w *WebhookSettings) Export(emit func(data interface{}) error) error {
+	for address, endpoint := range w.service.Endpoints() {
+		if err := emit(webhookSetting{Address: address, URL: endpoint.URL, Secret: endpoint.Secret}); err != nil {
+			return err
+		}
+	}
+	for tenant, endpoint := range w.service.TenantEndpoints() {
+		if err := emit(webhookSetting{Tenant: tenant, URL: endpoint.URL, Secret: endpoint.Secret}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import restores an address or tenant webhook
+func (w *WebhookSettings) Import(data json.RawMessage) error {
+	var setting webhookSetting
+	if err := json.Unmarshal(data, &setting); err != nil {
+		return err
+	}
+	if setting.Tenant != "" {
+		w.service.SetTenantEndpoint(setting.Tenant, WebhookEndpoint{URL: setting.URL, Secret: setting.Secret})
+		return nil
+	}
+	w.service.SetEndpoint(setting.Address, WebhookEndpoint{URL: setting.URL, Secret: setting.Secret})
+	return nil
+}
@@ -0,0 +1,168 @@
+package notification
+
+import (
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestWebhookService(maxAttempts int) *WebhookNotificationService {
+	service := NewWebhookNotificationService(WebhookConfig{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+		Timeout:     time.Second,
+		HistorySize: 10,
+	})
+	service.sleep = func(time.Duration) {}
+	return service
+}
+
+func testNotification() Notification {
+	return Notification{
+		Type:    TransactionReceived,
+		Address: "0x123",
+		Transaction: storage.Transaction{
+			Hash:        "0xabc",
+			FromAddress: "0x456",
+			ToAddress:   "0x123",
+			Value:       1.0,
+			ValueWei:    "1000000000000000000",
+			BlockNumber: 100,
+			Timestamp:   1000,
+		},
+		Timestamp:    1000,
+		Counterparty: "0x456",
+		Amount:       "1",
+	}
+}
+
+func TestWebhookDeliverySigned(t *testing.T) {
+	const secret = "s3cret"
+	var received webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(SignatureTimestampHeader), 10, 64)
+		if err != nil {
+			t.Errorf("Missing or invalid timestamp header: %v", err)
+		}
+		if got := r.Header.Get(SignatureHeader); got != Sign(secret, timestamp, body) {
+			t.Errorf("Signature mismatch: %s", got)
+		}
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	service := newTestWebhookService(3)
+	service.SetEndpoint("0x123", WebhookEndpoint{URL: server.URL, Secret: secret})
+
+	if err := service.Notify(testNotification()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received.Transaction.Hash != "0xabc" || received.Type != TransactionReceived ||
+		received.Counterparty != "0x456" || received.Amount != "1" {
+		t.Errorf("Unexpected payload: %+v", received)
+	}
+	if attempts := service.Attempts(); len(attempts) != 1 || attempts[0].StatusCode != http.StatusNoContent {
+		t.Errorf("Expected one successful attempt, got %+v", attempts)
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	service := newTestWebhookService(5)
+	service.SetDefaultEndpoint(WebhookEndpoint{URL: server.URL})
+
+	if err := service.Notify(testNotification()); err != nil {
+		t.Fatalf("Unexpected error after retries: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+	if attempts := service.Attempts(); len(attempts) != 3 || attempts[0].Error == "" {
+		t.Errorf("Expected 3 recorded attempts with failures first, got %+v", attempts)
+	}
+}
+
+func TestWebhookFailures(t *testing.T) {
+	testCases := []struct {
+		name      string
+		status    int
+		wantCalls int32
+	}{
+		{"client error is not retried", http.StatusBadRequest, 1},
+		{"server error exhausts attempts", http.StatusInternalServerError, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			service := newTestWebhookService(3)
+			service.SetEndpoint("0x123", WebhookEndpoint{URL: server.URL})
+
+			if err := service.Notify(testNotification()); err == nil {
+				t.Error("Expected error but got none")
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tc.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestWebhookWithoutEndpoint(t *testing.T) {
+	service := newTestWebhookService(3)
+	if err := service.Notify(testNotification()); err != nil {
+		t.Errorf("Expected no error without endpoint, got %v", err)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	service := NewWebhookNotificationService(WebhookConfig{BaseDelay: time.Second, MaxDelay: 5 * time.Second})
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := service.backoff(i + 1); got != want {
+			t.Errorf("Retry %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+}
+
+func TestWebhookSettingsRoundTrip(t *testing.T) {
+	source := newTestWebhookService(1)
+	source.SetEndpoint("0xABC", WebhookEndpoint{URL: "http://example.com/hook", Secret: "x"})
+
+	target := newTestWebhookService(1)
+	err := source.Settings().Export(func(data interface{}) error {
+		raw, _ := json.Marshal(data)
+		return target.Settings().Import(raw)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if endpoint := target.Endpoints()["0xabc"]; endpoint.URL != "http://example.com/hook" || endpoint.Secret != "x" {
+		t.Errorf("Unexpected imported endpoint %+v", endpoint)
+	}
+}
@@ -0,0 +1,9 @@
+package parser
+
+import "blockchain-parser/internal/metrics"
+
+// RPC metrics per JSON-RPC method, exposed on /metrics
+var (
+	rpcDuration = metrics.Default.NewHistogram("parser_rpc_request_duration_seconds", "JSON-RPC call latency", metrics.DefaultBuckets, "method")
+	rpcErrors   = metrics.Default.NewCounter("parser_rpc_errors_total", "Failed JSON-RPC calls", "method")
+)
@@ -2,13 +2,20 @@
 package parser
 
 import (
+	"blockchain-parser/internal/logger"
 	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/tracing"
 	"blockchain-parser/internal/utils"
+	"context"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 )
 
+// log is the logger of transaction processing
+var log = logger.Component("parser")
+
 // Parser defines the interface for blockchain transaction parsing operations
 type Parser interface {
 
@@ -21,6 +28,9 @@ type Parser interface {
 	// Subscribe adds an address to monitor, returns false if address is invalid
 	Subscribe(address string) bool
 
+	// Unsubscribe stops monitoring an address, returns false if it was not monitored
+	Unsubscribe(address string) bool
+
 	// IsSubscribed checks if an address is being monitored
 	IsSubscribed(address string) bool
 
@@ -30,22 +40,48 @@ type Parser interface {
 	// GetTransactions returns all transactions for a given address
 	GetTransactions(address string) []storage.Transaction
 
-	// ProcessTransaction processes a raw transaction and stores it if relevant
-	ProcessTransaction(tx map[string]interface{}, blockTimestamp int64) (*storage.Transaction, error)
+	// ProcessTransaction processes a raw transaction and stores it if relevant,
+	// together with the token transfers of its receipt that involve a
+	// subscribed address. It returns the records that were new, none when
+	// the transaction is not relevant or was already stored. The receipt
+	// lookup and the storage writes are traced under ctx.
+	ProcessTransaction(ctx context.Context, tx map[string]interface{}, blockTimestamp int64) ([]storage.Transaction, error)
 }
 
 // parserImpl implements the Parser interface
 type parserImpl struct {
 	storage   storage.StorageInterface
 	rpcClient *RPCClient
+
+	outbox        storage.OutboxStore
+	buildMessages OutboxBuilder
+}
+
+// OutboxBuilder returns the notifications to persist with a new transaction
+type OutboxBuilder func(tx storage.Transaction) []storage.OutboxMessage
+
+// Option configures optional parser behaviour
+type Option func(*parserImpl)
+
+// WithOutbox stores the messages built for every new relevant transaction in
+// the outbox atomically with the transaction itself
+func WithOutbox(outbox storage.OutboxStore, build OutboxBuilder) Option {
+	return func(p *parserImpl) {
+		p.outbox = outbox
+		p.buildMessages = build
+	}
 }
 
 // NewParser creates a new Parser instance with the given storage and RPC client
-func NewParser(storage storage.StorageInterface, rpcClient *RPCClient) Parser {
-	return &parserImpl{
+func NewParser(storage storage.StorageInterface, rpcClient *RPCClient, opts ...Option) Parser {
+	p := &parserImpl{
 		storage:   storage,
 		rpcClient: rpcClient,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // func (p *parserImpl) GetCurrentBlock() int64 {
@@ -64,6 +100,10 @@ func (p *parserImpl) Subscribe(address string) bool {
 	return p.storage.AddSubscriber(address)
 }
 
+func (p *parserImpl) Unsubscribe(address string) bool {
+	return p.storage.RemoveSubscriber(address)
+}
+
 func (p *parserImpl) IsSubscribed(address string) bool {
 	return p.storage.IsSubscribed(address)
 }
@@ -76,7 +116,7 @@ func (p *parserImpl) GetTransactions(address string) []storage.Transaction {
 	return p.storage.GetTransactions(address)
 }
 
-func (p *parserImpl) ProcessTransaction(tx map[string]interface{}, blockTimestamp int64) (*storage.Transaction, error) {
+func (p *parserImpl) ProcessTransaction(ctx context.Context, tx map[string]interface{}, blockTimestamp int64) ([]storage.Transaction, error) {
 	// Check if required fields exist and are not nil
 	if tx == nil {
 		return nil, fmt.Errorf("transaction data is nil")
@@ -109,13 +149,11 @@ func (p *parserImpl) ProcessTransaction(tx map[string]interface{}, blockTimestam
 		toAddress = strings.ToLower(to)
 	}
 
-	// Parse values
-	valueHex := strings.TrimPrefix(value, "0x")
-	valueInt64, err := parseHexToInt64(valueHex)
+	// Parse values; big.Int keeps amounts above 9.2 ETH exact
+	valueWei, err := utils.HexToBigInt(value)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing transaction value: %v", err)
 	}
-	valueETH := float64(valueInt64) / 1e18
 
 	blockNumberHex := strings.TrimPrefix(blockNumber, "0x")
 	blockNum, err := parseHexToInt64(blockNumberHex)
@@ -128,19 +166,110 @@ func (p *parserImpl) ProcessTransaction(tx map[string]interface{}, blockTimestam
 		Hash:        hash,
 		FromAddress: strings.ToLower(from),
 		ToAddress:   toAddress,
-		Value:       valueETH,
+		Value:       utils.WeiToFloat(valueWei),
+		ValueWei:    valueWei.String(),
 		BlockNumber: blockNum,
 		Timestamp:   blockTimestamp,
 	}
 
-	// Check if we should store this transaction
-	if p.storage.IsSubscribed(transaction.FromAddress) ||
-		(transaction.ToAddress != "" && p.storage.IsSubscribed(transaction.ToAddress)) {
-		p.storage.StoreTransaction(transaction)
-		return &transaction, nil
+	// Check if we should store this transaction. Token transfers to a
+	// subscribed address are sent to the token contract, so the receipt is
+	// also read when the call data names a subscribed address.
+	relevant := p.storage.IsSubscribed(transaction.FromAddress) ||
+		(transaction.ToAddress != "" && p.storage.IsSubscribed(transaction.ToAddress))
+	input, _ := tx["input"].(string)
+	if !relevant && !p.namesSubscriber(input) {
+		return nil, nil
+	}
+
+	receipt := p.fetchReceipt(ctx, hash)
+	var records []storage.Transaction
+	if relevant {
+		applyReceipt(&transaction, receipt)
+		records = append(records, transaction)
+	}
+	records = append(records, p.tokenTransfers(transaction, receipt)...)
+
+	// Re-processed blocks must not produce duplicate records or alerts
+	var stored []storage.Transaction
+	for _, record := range records {
+		if p.store(ctx, record) {
+			stored = append(stored, record)
+		}
+	}
+	return stored, nil
+}
+
+// store saves a relevant transaction, together with its outbox messages
+// when an outbox is configured, and reports whether it was new. The
+// messages carry the trace of ctx so their delivery joins it.
+func (p *parserImpl) store(ctx context.Context, tx storage.Transaction) bool {
+	ctx, span := tracing.Start(ctx, "storage.store_transaction", tracing.String("tx.hash", tx.Hash))
+	defer span.End()
+
+	if p.outbox == nil {
+		stored := p.storage.StoreTransaction(tx)
+		span.SetAttributes(tracing.Bool("tx.new", stored))
+		return stored
+	}
+
+	// Notifications are only built for new transactions, so a re-processed
+	// block does not evaluate the rules of its notifications again
+	if p.outbox.HasTransaction(tx) {
+		span.SetAttributes(tracing.Bool("tx.new", false))
+		return false
+	}
+	messages := p.buildMessages(tx)
+	traceParent := tracing.TraceParent(ctx)
+	for i := range messages {
+		messages[i].TraceParent = traceParent
 	}
+	stored := p.outbox.StoreTransactionWithOutbox(tx, messages)
+	span.SetAttributes(tracing.Bool("tx.new", stored), tracing.Int64("outbox.messages", int64(len(messages))))
+	return stored
+}
 
-	return nil, nil
+// fetchReceipt returns the receipt of a transaction. Failures are logged
+// and return nil, leaving the status, fee and token transfers unknown.
+func (p *parserImpl) fetchReceipt(ctx context.Context, hash string) map[string]interface{} {
+	if p.rpcClient == nil {
+		return nil
+	}
+
+	result, err := p.rpcClient.MakeCallContext(ctx, "eth_getTransactionReceipt", []interface{}{hash})
+	if err != nil {
+		log.WarnContext(ctx, "Failed to fetch receipt", "hash", hash, "error", err)
+		return nil
+	}
+	receipt, ok := result.Result.(map[string]interface{})
+	if !ok {
+		log.WarnContext(ctx, "Receipt not available", "hash", hash)
+		return nil
+	}
+	return receipt
+}
+
+// applyReceipt fills the execution status and fee of a relevant transaction
+// from its receipt
+func applyReceipt(tx *storage.Transaction, receipt map[string]interface{}) {
+	switch receipt["status"] {
+	case "0x1":
+		tx.Status = storage.StatusSuccess
+	case "0x0":
+		tx.Status = storage.StatusFailed
+	}
+
+	gasUsedHex, _ := receipt["gasUsed"].(string)
+	gasPriceHex, _ := receipt["effectiveGasPrice"].(string)
+	gasUsed, err := utils.HexToBigInt(gasUsedHex)
+	if err != nil {
+		return
+	}
+	gasPrice, err := utils.HexToBigInt(gasPriceHex)
+	if err != nil {
+		return
+	}
+	tx.FeeWei = new(big.Int).Mul(gasUsed, gasPrice).String()
 }
 
 func parseHexToInt64(hex string) (int64, error) {
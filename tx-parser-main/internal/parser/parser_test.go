@@ -1,7 +1,13 @@
 package parser
 
 import (
+	"blockchain-parser/config"
 	"blockchain-parser/internal/storage"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +33,13 @@ func (m *MockStorage) AddSubscriber(address string) bool {
 	m.subscribers[address] = true
 	return true
 }
+func (m *MockStorage) RemoveSubscriber(address string) bool {
+	if !m.subscribers[address] {
+		return false
+	}
+	delete(m.subscribers, address)
+	return true
+}
 func (m *MockStorage) IsSubscribed(address string) bool { return m.subscribers[address] }
 func (m *MockStorage) GetSubscribers() []string {
 	subs := make([]string, 0, len(m.subscribers))
@@ -36,8 +49,9 @@ func (m *MockStorage) GetSubscribers() []string {
 	return subs
 }
 func (m *MockStorage) GetTransactions(address string) []storage.Transaction { return m.transactions }
-func (m *MockStorage) StoreTransaction(tx storage.Transaction) {
+func (m *MockStorage) StoreTransaction(tx storage.Transaction) bool {
 	m.transactions = append(m.transactions, tx)
+	return true
 }
 
 func TestNewParser(t *testing.T) {
@@ -135,13 +149,13 @@ func TestProcessTransaction(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			tx, err := parser.ProcessTransaction(tc.tx, tc.timestamp)
+			tx, err := parser.ProcessTransaction(context.Background(), tc.tx, tc.timestamp)
 			if tc.expectSuccess {
 				if err != nil {
 					t.Errorf("Unexpected error: %v", err)
 				}
-				if tx == nil {
-					t.Error("Expected non-nil transaction")
+				if len(tx) != 1 {
+					t.Errorf("Expected one stored transaction, got %v", tx)
 				}
 			} else {
 				if err == nil {
@@ -187,3 +201,149 @@ func TestParseHexToInt64(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessTransactionReceipt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&JSONRPCResponse{
+			Result: map[string]interface{}{
+				"status":            "0x0",
+				"gasUsed":           "0x5208",     // 21000
+				"effectiveGasPrice": "0x3b9aca00", // 1 gwei
+			},
+		})
+	}))
+	defer server.Close()
+
+	rpc := NewRPCClient(&config.Config{RPCEndpoint: server.URL})
+	parser := NewParser(newMockStorage(), rpc)
+	parser.Subscribe("0x123")
+
+	stored, err := parser.ProcessTransaction(context.Background(), map[string]interface{}{
+		"hash":        "0xabc",
+		"from":        "0x123",
+		"to":          "0x456",
+		"value":       "0x1bc16d674ec800000", // 32 ETH, above the int64 wei range
+		"blockNumber": "0x1",
+	}, 1000)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("Expected one stored transaction, got %v (%v)", stored, err)
+	}
+	tx := stored[0]
+
+	if tx.ValueWei != "32000000000000000000" || tx.Value != 32 {
+		t.Errorf("Expected 32 ETH value, got %s wei (%f)", tx.ValueWei, tx.Value)
+	}
+	if tx.Status != storage.StatusFailed {
+		t.Errorf("Expected status %s, got %s", storage.StatusFailed, tx.Status)
+	}
+	if tx.FeeWei != "21000000000000" {
+		t.Errorf("Expected fee 21000000000000 wei, got %s", tx.FeeWei)
+	}
+}
+
+func TestProcessTransactionOutbox(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	built := 0
+	parser := NewParser(store, nil, WithOutbox(store, func(tx storage.Transaction) []storage.OutboxMessage {
+		built++
+		return []storage.OutboxMessage{{Payload: []byte(tx.Hash)}}
+	}))
+	parser.Subscribe("0x1234567890123456789012345678901234567890")
+
+	raw := map[string]interface{}{
+		"hash":        "0xabc",
+		"from":        "0x1234567890123456789012345678901234567890",
+		"to":          "0x456",
+		"value":       "0x1",
+		"blockNumber": "0x1",
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := parser.ProcessTransaction(context.Background(), raw, 1000); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if stats := store.OutboxStats(); stats.Pending != 1 {
+		t.Errorf("Expected 1 pending message after re-processing, got %d", stats.Pending)
+	}
+	if built != 1 {
+		t.Errorf("Expected builder to run only for the new transaction, ran %d times", built)
+	}
+}
+
+func TestProcessTransactionTokenTransfer(t *testing.T) {
+	const (
+		sender    = "0x1111111111111111111111111111111111111111"
+		recipient = "0x2222222222222222222222222222222222222222"
+		token     = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+	)
+	pad := func(address string) string {
+		return "0x000000000000000000000000" + strings.TrimPrefix(address, "0x")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&JSONRPCResponse{
+			Result: map[string]interface{}{
+				"status":            "0x1",
+				"gasUsed":           "0xfde8",
+				"effectiveGasPrice": "0x1",
+				"logs": []interface{}{
+					map[string]interface{}{
+						"address":  token,
+						"topics":   []interface{}{transferTopic, pad(sender), pad(recipient)},
+						"data":     "0x00000000000000000000000000000000000000000000000000000000000f4240",
+						"logIndex": "0x0",
+					},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	store := storage.NewMemoryStorage()
+	parser := NewParser(store, NewRPCClient(&config.Config{RPCEndpoint: server.URL}))
+	parser.Subscribe(recipient)
+
+	// transfer(recipient, 1000000) sent by an unsubscribed address to the token
+	raw := map[string]interface{}{
+		"hash":        "0xabc",
+		"from":        sender,
+		"to":          token,
+		"value":       "0x0",
+		"blockNumber": "0x1",
+		"input":       "0xa9059cbb" + strings.TrimPrefix(pad(recipient), "0x") + "00000000000000000000000000000000000000000000000000000000000f4240",
+	}
+	stored, err := parser.ProcessTransaction(context.Background(), raw, 1000)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("Expected the token transfer to be stored, got %+v", stored)
+	}
+	transfer := stored[0]
+	if transfer.Token != strings.ToLower(token) || transfer.Index != 0 || transfer.ValueWei != "1000000" ||
+		transfer.FromAddress != sender || transfer.ToAddress != recipient || transfer.Status != storage.StatusSuccess {
+		t.Errorf("Unexpected token transfer %+v", transfer)
+	}
+
+	history := store.GetTransactions(recipient)
+	if len(history) != 1 || history[0].Direction != storage.DirectionIn {
+		t.Fatalf("Expected an incoming token transfer, got %+v", history)
+	}
+	changes := history[0].BalanceChanges()
+	if len(changes) != 1 || changes[0].Asset != strings.ToLower(token) || changes[0].Delta.String() != "1000000" {
+		t.Errorf("Expected the token balance to move by 1000000, got %+v", changes)
+	}
+
+	if stored, _ := parser.ProcessTransaction(context.Background(), raw, 1000); len(stored) != 0 {
+		t.Errorf("Expected a re-processed transfer not to be stored again, got %+v", stored)
+	}
+
+	// The sender keeps its top-level record, with the fee, next to the
+	// token transfer at log index 0
+	parser.Subscribe(sender)
+	raw["hash"] = "0xdef"
+	stored, _ = parser.ProcessTransaction(context.Background(), raw, 1000)
+	if len(stored) != 2 || stored[0].Token != "" || stored[0].FeeWei != "65000" || stored[1].Token == "" {
+		t.Errorf("Expected the transaction and its token transfer, got %+v", stored)
+	}
+}
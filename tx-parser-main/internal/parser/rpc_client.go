@@ -3,12 +3,21 @@ package parser
 
 import (
 	"blockchain-parser/config"
+	"blockchain-parser/internal/logger"
+	"blockchain-parser/internal/tracing"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 )
 
+// rpcLog is the logger of JSON-RPC calls
+var rpcLog = logger.Component("rpc")
+
 // RPCClient handles communication with a blockchain node's JSON-RPC API
 type RPCClient struct {
 	config config.NetworkConfig
@@ -65,8 +74,47 @@ func NewRPCClient(cfg *config.Config) *RPCClient {
 	}
 }
 
-// MakeCall sends a JSON-RPC request to the blockchain node
+// Endpoint returns the scheme and host of the node URL. The path, query and
+// user info are left out since providers often put API keys there.
+func (rc *RPCClient) Endpoint() string {
+	u, err := url.Parse(rc.url)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// MakeCall sends a JSON-RPC request to the blockchain node, recording its
+// latency and failures per method
 func (rc *RPCClient) MakeCall(method string, params []interface{}) (*JSONRPCResponse, error) {
+	return rc.MakeCallContext(context.Background(), method, params)
+}
+
+// MakeCallContext is MakeCall traced as a child of the span of ctx. The
+// trace is propagated to the node with the traceparent header.
+func (rc *RPCClient) MakeCallContext(ctx context.Context, method string, params []interface{}) (*JSONRPCResponse, error) {
+	ctx, span := tracing.Start(ctx, "rpc "+method,
+		tracing.String("rpc.system", "jsonrpc"),
+		tracing.String("rpc.method", method),
+		tracing.String("server.address", rc.Endpoint()))
+	span.SetKind(tracing.KindClient)
+	defer span.End()
+
+	start := time.Now()
+	result, err := rc.call(ctx, method, params)
+	rpcDuration.ObserveSince(start, method)
+	if err != nil {
+		rpcErrors.Inc(method)
+		span.RecordError(err)
+		rpcLog.WarnContext(ctx, "RPC call failed", "method", method, "duration", time.Since(start), "error", err)
+		return result, err
+	}
+	rpcLog.DebugContext(ctx, "RPC call", "method", method, "duration", time.Since(start))
+	return result, err
+}
+
+// call sends one JSON-RPC request
+func (rc *RPCClient) call(ctx context.Context, method string, params []interface{}) (*JSONRPCResponse, error) {
 	payload := JSONRPCRequest{
 		JsonRPC: "2.0",
 		Method:  method,
@@ -79,9 +127,21 @@ func (rc *RPCClient) MakeCall(method string, params []interface{}) (*JSONRPCResp
 		return nil, fmt.Errorf("error marshaling request: %v", err)
 	}
 
-	resp, err := http.Post(rc.url, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rc.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making HTTP request: %v", err)
+		// url.Error repeats the full URL, which may contain an API key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("error making HTTP request to %s: %v", rc.Endpoint(), err)
 	}
 	defer resp.Body.Close()
 
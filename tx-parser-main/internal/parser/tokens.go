@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/utils"
+	"strings"
+)
+
+// transferTopic is the topic of the ERC-20 Transfer(address,address,uint256)
+// event. ERC-721 transfers share it but index the token ID as a fourth topic.
+const transferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// tokenTransfers returns the ERC-20 transfers logged in the receipt of tx
+// that involve a subscribed address. Each is a record of its own, keyed by
+// the token contract and the log index.
+func (p *parserImpl) tokenTransfers(tx storage.Transaction, receipt map[string]interface{}) []storage.Transaction {
+	logs, _ := receipt["logs"].([]interface{})
+	var transfers []storage.Transaction
+	for _, entry := range logs {
+		event, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		topics, _ := event["topics"].([]interface{})
+		if len(topics) != 3 {
+			continue
+		}
+		if topic, _ := topics[0].(string); !strings.EqualFold(topic, transferTopic) {
+			continue
+		}
+
+		token, _ := event["address"].(string)
+		from, okFrom := topicAddress(topics[1])
+		to, okTo := topicAddress(topics[2])
+		if token == "" || !okFrom || !okTo {
+			continue
+		}
+		if !p.storage.IsSubscribed(from) && !p.storage.IsSubscribed(to) {
+			continue
+		}
+
+		data, _ := event["data"].(string)
+		amount, err := utils.HexToBigInt(data)
+		if err != nil {
+			continue
+		}
+		indexHex, _ := event["logIndex"].(string)
+		index, err := parseHexToInt64(strings.TrimPrefix(indexHex, "0x"))
+		if err != nil {
+			continue
+		}
+
+		// Only successful transactions emit logs
+		transfers = append(transfers, storage.Transaction{
+			Hash:        tx.Hash,
+			FromAddress: from,
+			ToAddress:   to,
+			Value:       utils.WeiToFloat(amount),
+			ValueWei:    amount.String(),
+			BlockNumber: tx.BlockNumber,
+			Timestamp:   tx.Timestamp,
+			Status:      storage.StatusSuccess,
+			Token:       strings.ToLower(token),
+			Index:       int(index),
+		})
+	}
+	return transfers
+}
+
+// topicAddress returns the address held in an indexed event topic
+func topicAddress(topic interface{}) (string, bool) {
+	value, _ := topic.(string)
+	value = strings.TrimPrefix(value, "0x")
+	if len(value) != 64 {
+		return "", false
+	}
+	return "0x" + strings.ToLower(value[24:]), true
+}
+
+// namesSubscriber reports whether call data passes a subscribed address as
+// an argument, as transfer and transferFrom do for their recipient
+func (p *parserImpl) namesSubscriber(input string) bool {
+	input = strings.TrimPrefix(input, "0x")
+	if len(input) < 8+64 {
+		return false
+	}
+	for word := input[8:]; len(word) >= 64; word = word[64:] {
+		if strings.Trim(word[:24], "0") != "" {
+			continue
+		}
+		if p.storage.IsSubscribed("0x" + strings.ToLower(word[24:64])) {
+			return true
+		}
+	}
+	return false
+}
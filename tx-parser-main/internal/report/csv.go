@@ -0,0 +1,164 @@
+// Package report renders stored transactions into spreadsheet and
+// accounting formats.
+package report
+
+import (
+	"blockchain-parser/internal/storage"
+	"blockchain-parser/internal/utils"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format selects the CSV column layout
+type Format string
+
+const (
+	// FormatCSV is the standard layout with one column per transaction field
+	FormatCSV Format = "csv"
+
+	// FormatKoinly follows the Koinly universal import layout used by crypto-tax tools
+	FormatKoinly Format = "koinly"
+)
+
+// flushEvery controls how many rows are buffered before flushing to the writer
+const flushEvery = 100
+
+var standardHeader = []string{
+	"timestamp_utc", "hash", "block_number", "direction", "counterparty",
+	"value_eth", "value_wei", "fee_eth", "fee_wei", "status", "token",
+}
+
+var koinlyHeader = []string{
+	"Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency",
+	"Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency",
+	"Label", "Description", "TxHash",
+}
+
+// ParseFormat validates a format name, defaulting to FormatCSV when empty
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatKoinly:
+		return FormatKoinly, nil
+	default:
+		return "", fmt.Errorf("unsupported format %q (supported: %s, %s)", name, FormatCSV, FormatKoinly)
+	}
+}
+
+// Flusher is implemented by writers that can push buffered data to the client
+type Flusher interface {
+	Flush()
+}
+
+// WriteCSV streams the transactions of address to w in the given format.
+// Rows are flushed in small batches so large histories are never buffered.
+func WriteCSV(w io.Writer, scanner storage.TransactionScanner, address string, format Format) error {
+	cw := csv.NewWriter(w)
+	flush := func() error {
+		cw.Flush()
+		if f, ok := w.(Flusher); ok {
+			f.Flush()
+		}
+		return cw.Error()
+	}
+
+	header, row := standardHeader, standardRow
+	if format == FormatKoinly {
+		header, row = koinlyHeader, koinlyRow
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	address = strings.ToLower(address)
+	rows := 0
+	err := scanner.ScanTransactions(address, func(tx storage.Transaction) error {
+		if err := cw.Write(row(address, tx)); err != nil {
+			return err
+		}
+		rows++
+		if rows%flushEvery == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// standardRow renders a transaction in the FormatCSV layout
+func standardRow(address string, tx storage.Transaction) []string {
+	return []string{
+		time.Unix(tx.Timestamp, 0).UTC().Format(time.RFC3339),
+		tx.Hash,
+		strconv.FormatInt(tx.BlockNumber, 10),
+		string(tx.Direction),
+		tx.Counterparty(address),
+		valueEther(tx),
+		tx.ValueWei,
+		weiToEther(tx.FeeWei),
+		tx.FeeWei,
+		tx.Status,
+		tx.Asset(),
+	}
+}
+
+// koinlyRow renders a transaction in the FormatKoinly layout. The sender pays
+// the fee; self-transfers and failed transactions only record the fee.
+func koinlyRow(address string, tx storage.Transaction) []string {
+	var sentAmount, sentCurrency, receivedAmount, receivedCurrency, feeAmount, feeCurrency string
+
+	failed := tx.Status == storage.StatusFailed
+	switch {
+	case failed:
+	case tx.Direction == storage.DirectionIn:
+		receivedAmount, receivedCurrency = valueEther(tx), tx.Asset()
+	case tx.Direction == storage.DirectionOut:
+		sentAmount, sentCurrency = valueEther(tx), tx.Asset()
+	}
+	if tx.Direction != storage.DirectionIn && tx.FeeWei != "" {
+		feeAmount, feeCurrency = weiToEther(tx.FeeWei), storage.NativeAsset
+	}
+
+	label := ""
+	if failed {
+		label = "failed"
+	}
+
+	return []string{
+		time.Unix(tx.Timestamp, 0).UTC().Format("2006-01-02 15:04 UTC"),
+		sentAmount, sentCurrency,
+		receivedAmount, receivedCurrency,
+		feeAmount, feeCurrency,
+		"", "",
+		label,
+		fmt.Sprintf("%s %s", tx.Direction, tx.Counterparty(address)),
+		tx.Hash,
+	}
+}
+
+// valueEther returns the exact ether amount, falling back to the float value
+// for records stored before wei amounts were kept
+func valueEther(tx storage.Transaction) string {
+	if tx.ValueWei != "" {
+		return weiToEther(tx.ValueWei)
+	}
+	return strconv.FormatFloat(tx.Value, 'f', -1, 64)
+}
+
+// weiToEther converts a decimal wei string to ether, returning "" when unknown
+func weiToEther(wei string) string {
+	amount, ok := new(big.Int).SetString(wei, 10)
+	if !ok {
+		return ""
+	}
+	return utils.WeiToEther(amount)
+}
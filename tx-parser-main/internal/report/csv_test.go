@@ -0,0 +1,124 @@
+package report
+
+import (
+	"blockchain-parser/internal/storage"
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+const (
+	testAddress = "0x742d35cc6634c0532925a3b844bc454e4438f44e"
+	testOther   = "0xdd93e92dc32d0b2f51430b0e6da29bdd01af68d6"
+)
+
+func newTestStore() *storage.MemoryStorage {
+	store := storage.NewMemoryStorage()
+	store.StoreTransaction(storage.Transaction{
+		Hash:        "0xaaa",
+		FromAddress: testOther,
+		ToAddress:   testAddress,
+		Value:       1.5,
+		ValueWei:    "1500000000000000000",
+		FeeWei:      "21000000000000",
+		Status:      storage.StatusSuccess,
+		BlockNumber: 10,
+		Timestamp:   1700000000,
+	})
+	store.StoreTransaction(storage.Transaction{
+		Hash:        "0xbbb",
+		FromAddress: testAddress,
+		ToAddress:   testOther,
+		Value:       0.25,
+		ValueWei:    "250000000000000000",
+		FeeWei:      "21000000000000",
+		Status:      storage.StatusFailed,
+		BlockNumber: 11,
+		Timestamp:   1700000060,
+	})
+	return store
+}
+
+func readCSV(t *testing.T, data []byte) [][]string {
+	t.Helper()
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV output: %v", err)
+	}
+	return records
+}
+
+func TestParseFormat(t *testing.T) {
+	testCases := []struct {
+		input       string
+		expected    Format
+		expectError bool
+	}{
+		{"", FormatCSV, false},
+		{"csv", FormatCSV, false},
+		{"KOINLY", FormatKoinly, false},
+		{"xlsx", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			format, err := ParseFormat(tc.input)
+			if tc.expectError != (err != nil) {
+				t.Fatalf("Unexpected error result: %v", err)
+			}
+			if format != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, format)
+			}
+		})
+	}
+}
+
+func TestWriteStandardCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, newTestStore(), testAddress, FormatCSV); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	records := readCSV(t, buf.Bytes())
+	if len(records) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %d", len(records))
+	}
+
+	expected := []string{
+		"2023-11-14T22:13:20Z", "0xaaa", "10", "in", testOther,
+		"1.5", "1500000000000000000", "0.000021", "21000000000000", "success", "ETH",
+	}
+	for i, want := range expected {
+		if records[1][i] != want {
+			t.Errorf("Column %s: expected %q, got %q", standardHeader[i], want, records[1][i])
+		}
+	}
+	if records[2][3] != "out" || records[2][4] != testOther {
+		t.Errorf("Expected outgoing row to the counterparty, got %v", records[2])
+	}
+}
+
+func TestWriteKoinlyCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, newTestStore(), testAddress, FormatKoinly); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+
+	records := readCSV(t, buf.Bytes())
+	if len(records) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %d", len(records))
+	}
+
+	incoming := records[1]
+	if incoming[3] != "1.5" || incoming[4] != "ETH" || incoming[1] != "" {
+		t.Errorf("Expected received amount only, got %v", incoming)
+	}
+	if incoming[5] != "" {
+		t.Errorf("Receiver should not pay the fee, got %q", incoming[5])
+	}
+
+	failed := records[2]
+	if failed[1] != "" || failed[5] != "0.000021" || failed[9] != "failed" {
+		t.Errorf("Expected failed transaction to record only the fee, got %v", failed)
+	}
+}
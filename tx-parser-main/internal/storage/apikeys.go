@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// APIKey is an API credential. Only the hash of the secret is stored.
+type APIKey struct {
+	ID     string
+	Name   string
+	Hash   string
+	Scopes []string
+
+	// Tenant owns the subscriptions made with the key
+	Tenant string
+
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	Revoked    bool
+}
+
+// AuditEntry records an action taken with an API key
+type AuditEntry struct {
+	Time       time.Time
+	KeyID      string
+	KeyName    string
+	Tenant     string
+	Action     string
+	Address    string
+	RemoteAddr string
+	Status     int
+}
+
+// APIKeyStore is implemented by storages that keep API keys and the audit
+// log of what each key did
+type APIKeyStore interface {
+	// SaveAPIKey creates or replaces a key
+	SaveAPIKey(key APIKey)
+
+	// GetAPIKey returns a key by ID
+	GetAPIKey(id string) (APIKey, bool)
+
+	// GetAPIKeyByHash returns the key with the given secret hash
+	GetAPIKeyByHash(hash string) (APIKey, bool)
+
+	// GetAPIKeys returns every key ordered by creation time
+	GetAPIKeys() []APIKey
+
+	// TouchAPIKey sets only the last use time of a key, so recording a use
+	// never undoes a concurrent change such as a revocation
+	TouchAPIKey(id string, at time.Time)
+
+	// RevokeAPIKey marks a key revoked and reports whether it exists
+	RevokeAPIKey(id string) bool
+
+	// AppendAudit stores an audit entry and drops the oldest beyond keep
+	AppendAudit(entry AuditEntry, keep int)
+
+	// GetAudit returns the newest audit entries first, limited to those of
+	// keyID when it is not empty
+	GetAudit(keyID string, limit int) []AuditEntry
+}
+
+// SaveAPIKey stores a key under its ID
+func (ms *MemoryStorage) SaveAPIKey(key APIKey) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	key.Scopes = append([]string(nil), key.Scopes...)
+	ms.apiKeys[key.ID] = key
+}
+
+// GetAPIKey returns a key by ID
+func (ms *MemoryStorage) GetAPIKey(id string) (APIKey, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	key, ok := ms.apiKeys[id]
+	return key, ok
+}
+
+// TouchAPIKey sets the last use time of a key, if it still exists
+func (ms *MemoryStorage) TouchAPIKey(id string, at time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if key, ok := ms.apiKeys[id]; ok {
+		key.LastUsedAt = at
+		ms.apiKeys[id] = key
+	}
+}
+
+// RevokeAPIKey marks a key revoked
+func (ms *MemoryStorage) RevokeAPIKey(id string) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	key, ok := ms.apiKeys[id]
+	if ok {
+		key.Revoked = true
+		ms.apiKeys[id] = key
+	}
+	return ok
+}
+
+// GetAPIKeyByHash returns the key whose secret hashes to hash
+func (ms *MemoryStorage) GetAPIKeyByHash(hash string) (APIKey, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	for _, key := range ms.apiKeys {
+		if key.Hash == hash {
+			return key, true
+		}
+	}
+	return APIKey{}, false
+}
+
+// GetAPIKeys returns every key, oldest first
+func (ms *MemoryStorage) GetAPIKeys() []APIKey {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	keys := make([]APIKey, 0, len(ms.apiKeys))
+	for _, key := range ms.apiKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// AppendAudit stores an audit entry
+func (ms *MemoryStorage) AppendAudit(entry AuditEntry, keep int) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.audit = append(ms.audit, entry)
+	if keep > 0 && len(ms.audit) > keep {
+		ms.audit = append([]AuditEntry(nil), ms.audit[len(ms.audit)-keep:]...)
+	}
+}
+
+// GetAudit returns up to limit audit entries, newest first
+func (ms *MemoryStorage) GetAudit(keyID string, limit int) []AuditEntry {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	var entries []AuditEntry
+	for i := len(ms.audit) - 1; i >= 0; i-- {
+		if keyID != "" && !strings.EqualFold(ms.audit[i].KeyID, keyID) {
+			continue
+		}
+		entries = append(entries, ms.audit[i])
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+	}
+	return entries
+}
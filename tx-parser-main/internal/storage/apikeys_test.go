@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ms := NewMemoryStorage()
+	now := time.Now()
+	ms.SaveAPIKey(APIKey{ID: "b", Name: "second", Hash: "hash-b", CreatedAt: now.Add(time.Second)})
+	ms.SaveAPIKey(APIKey{ID: "a", Name: "first", Hash: "hash-a", Scopes: []string{"read"}, CreatedAt: now})
+
+	if key, ok := ms.GetAPIKeyByHash("hash-a"); !ok || key.ID != "a" {
+		t.Errorf("Expected key a by hash, got %+v (%v)", key, ok)
+	}
+	if _, ok := ms.GetAPIKeyByHash("unknown"); ok {
+		t.Error("Expected no key for an unknown hash")
+	}
+
+	key, _ := ms.GetAPIKey("a")
+	key.Revoked = true
+	ms.SaveAPIKey(key)
+	if stored, _ := ms.GetAPIKey("a"); !stored.Revoked {
+		t.Error("Expected the key to be replaced")
+	}
+
+	// Recording a use keeps the revocation made since the key was read
+	ms.TouchAPIKey("a", now.Add(time.Minute))
+	if stored, _ := ms.GetAPIKey("a"); !stored.Revoked || !stored.LastUsedAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected only the last use time to change, got %+v", stored)
+	}
+	if !ms.RevokeAPIKey("b") || ms.RevokeAPIKey("unknown") {
+		t.Error("Expected RevokeAPIKey to report whether the key exists")
+	}
+
+	if keys := ms.GetAPIKeys(); len(keys) != 2 || keys[0].ID != "a" {
+		t.Errorf("Expected keys ordered by creation, got %+v", keys)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	ms := NewMemoryStorage()
+	for _, id := range []string{"a", "b", "a", "a"} {
+		ms.AppendAudit(AuditEntry{KeyID: id, Action: "subscribe"}, 3)
+	}
+
+	if entries := ms.GetAudit("", 0); len(entries) != 3 {
+		t.Errorf("Expected 3 retained entries, got %d", len(entries))
+	}
+	if entries := ms.GetAudit("a", 1); len(entries) != 1 || entries[0].KeyID != "a" {
+		t.Errorf("Expected the newest entry of key a, got %+v", entries)
+	}
+	if entries := ms.GetAudit("b", 10); len(entries) != 1 {
+		t.Errorf("Expected 1 entry of key b, got %d", len(entries))
+	}
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"math/big"
+	"strings"
+)
+
+// BalanceChange is the amount an asset balance moves by for one transaction
+type BalanceChange struct {
+	Asset string
+	Delta *big.Int
+}
+
+// BalanceChanges returns how the transaction moves the balances of the
+// address it is stored under: the transferred amount unless it failed, and
+// the fee paid by the sender of a top-level ether transaction
+func (t Transaction) BalanceChanges() []BalanceChange {
+	var changes []BalanceChange
+	add := func(asset string, delta *big.Int) {
+		if delta.Sign() != 0 {
+			changes = append(changes, BalanceChange{Asset: asset, Delta: delta})
+		}
+	}
+
+	value := t.ValueWeiAmount()
+	if t.Status != StatusFailed {
+		switch t.Direction {
+		case DirectionIn:
+			add(t.Asset(), value)
+		case DirectionOut:
+			add(t.Asset(), new(big.Int).Neg(value))
+		}
+	}
+
+	// Only the sender of the top-level transaction pays gas
+	if t.Direction != DirectionIn && t.Token == "" {
+		add(NativeAsset, new(big.Int).Neg(parseWei(t.FeeWei)))
+	}
+	return changes
+}
+
+// ValueWeiAmount returns the transferred amount, converting the float value
+// of records stored before exact wei amounts were kept
+func (t Transaction) ValueWeiAmount() *big.Int {
+	if t.ValueWei != "" {
+		return parseWei(t.ValueWei)
+	}
+	wei, _ := new(big.Float).Mul(big.NewFloat(t.Value), big.NewFloat(1e18)).Int(nil)
+	return wei
+}
+
+// parseWei parses a decimal wei string, treating unknown amounts as zero
+func parseWei(wei string) *big.Int {
+	value, ok := new(big.Int).SetString(wei, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return value
+}
+
+// BalanceCheckpoint holds the balance changes of the transactions pruned
+// from the history of an address, so balances stay correct after pruning
+type BalanceCheckpoint struct {
+	// Block is the newest block of a pruned transaction
+	Block int64
+
+	// Balances sums the changes of the pruned transactions per asset
+	Balances map[string]*big.Int
+}
+
+// BalanceStore is implemented by storages that fold pruned transactions
+// into a balance checkpoint per address
+type BalanceStore interface {
+	// BalanceHistory returns the checkpoint of address together with the
+	// transactions stored after it, read in one consistent step
+	BalanceHistory(address string) (BalanceCheckpoint, []Transaction)
+
+	// BalanceCheckpoints returns the checkpoint of every pruned address
+	BalanceCheckpoints() map[string]BalanceCheckpoint
+
+	// SetBalanceCheckpoint replaces the checkpoint of address, such as when
+	// loading saved state
+	SetBalanceCheckpoint(address string, checkpoint BalanceCheckpoint)
+}
+
+// BalanceHistory returns the checkpoint and stored transactions of address
+func (ms *MemoryStorage) BalanceHistory(address string) (BalanceCheckpoint, []Transaction) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	address = strings.ToLower(address)
+	txs := append([]Transaction(nil), ms.transactions[address]...)
+	return copyCheckpoint(ms.balances[address]), txs
+}
+
+// BalanceCheckpoints returns a copy of every balance checkpoint
+func (ms *MemoryStorage) BalanceCheckpoints() map[string]BalanceCheckpoint {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	checkpoints := make(map[string]BalanceCheckpoint, len(ms.balances))
+	for address, checkpoint := range ms.balances {
+		checkpoints[address] = copyCheckpoint(checkpoint)
+	}
+	return checkpoints
+}
+
+// SetBalanceCheckpoint replaces the balance checkpoint of address
+func (ms *MemoryStorage) SetBalanceCheckpoint(address string, checkpoint BalanceCheckpoint) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.balances[strings.ToLower(address)] = copyCheckpoint(checkpoint)
+}
+
+// foldBalances adds the balance changes of pruned transactions to the
+// checkpoint of address. Callers must hold the write lock.
+func (ms *MemoryStorage) foldBalances(address string, pruned []Transaction) {
+	checkpoint := ms.balances[address]
+	if checkpoint.Balances == nil {
+		checkpoint.Balances = make(map[string]*big.Int)
+	}
+	for _, tx := range pruned {
+		if tx.BlockNumber > checkpoint.Block {
+			checkpoint.Block = tx.BlockNumber
+		}
+		for _, change := range tx.BalanceChanges() {
+			balance, ok := checkpoint.Balances[change.Asset]
+			if !ok {
+				balance = new(big.Int)
+			}
+			checkpoint.Balances[change.Asset] = new(big.Int).Add(balance, change.Delta)
+		}
+	}
+	ms.balances[address] = checkpoint
+}
+
+// copyCheckpoint returns a checkpoint that shares no balances with c
+func copyCheckpoint(c BalanceCheckpoint) BalanceCheckpoint {
+	balances := make(map[string]*big.Int, len(c.Balances))
+	for asset, balance := range c.Balances {
+		balances[asset] = new(big.Int).Set(balance)
+	}
+	return BalanceCheckpoint{Block: c.Block, Balances: balances}
+}
@@ -0,0 +1,41 @@
+package storage
+
+// CheckpointStore is implemented by storages that keep named progress
+// markers for background jobs, so work resumes where it stopped after a
+// restart
+type CheckpointStore interface {
+	// SetCheckpoint sets the value of a named checkpoint
+	SetCheckpoint(name string, value int64)
+
+	// GetCheckpoint returns the value of a checkpoint and whether it is set
+	GetCheckpoint(name string) (int64, bool)
+
+	// GetCheckpoints returns every named checkpoint
+	GetCheckpoints() map[string]int64
+}
+
+// SetCheckpoint sets the value of a named checkpoint
+func (ms *MemoryStorage) SetCheckpoint(name string, value int64) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.checkpoints[name] = value
+}
+
+// GetCheckpoint returns the value of a named checkpoint
+func (ms *MemoryStorage) GetCheckpoint(name string) (int64, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	value, ok := ms.checkpoints[name]
+	return value, ok
+}
+
+// GetCheckpoints returns a copy of every named checkpoint
+func (ms *MemoryStorage) GetCheckpoints() map[string]int64 {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	checkpoints := make(map[string]int64, len(ms.checkpoints))
+	for name, value := range ms.checkpoints {
+		checkpoints[name] = value
+	}
+	return checkpoints
+}
@@ -0,0 +1,18 @@
+package storage
+
+import "testing"
+
+func TestCheckpoints(t *testing.T) {
+	ms := NewMemoryStorage()
+	if _, ok := ms.GetCheckpoint("summary:daily"); ok {
+		t.Error("Expected unset checkpoint")
+	}
+
+	ms.SetCheckpoint("summary:daily", 1700000000)
+	if value, ok := ms.GetCheckpoint("summary:daily"); !ok || value != 1700000000 {
+		t.Errorf("Expected checkpoint 1700000000, got %d (%v)", value, ok)
+	}
+	if checkpoints := ms.GetCheckpoints(); len(checkpoints) != 1 {
+		t.Errorf("Unexpected checkpoints: %v", checkpoints)
+	}
+}
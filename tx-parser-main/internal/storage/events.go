@@ -0,0 +1,86 @@
+package storage
+
+import "time"
+
+// StreamEvent is a live event kept for clients resuming a stream
+type StreamEvent struct {
+	ID   int64
+	Type string
+
+	// Addresses lists the subscribed addresses the event concerns, empty
+	// for chain-wide events such as new blocks
+	Addresses []string
+
+	// Data is the encoded event payload
+	Data []byte
+
+	CreatedAt time.Time
+}
+
+// EventLog is implemented by storages that keep a bounded history of stream
+// events, so clients can resume from the last event they received
+type EventLog interface {
+	// AppendEvent assigns the next ID to event, stores it and drops the
+	// oldest events beyond keep
+	AppendEvent(event StreamEvent, keep int) StreamEvent
+
+	// EventsSince returns the events after id, oldest first. It reports
+	// false when events after id were already dropped, or when id was never
+	// assigned, such as an ID from before the sequence was lost.
+	EventsSince(id int64) ([]StreamEvent, bool)
+
+	// LastEventID returns the ID of the newest event, 0 when none was stored
+	LastEventID() int64
+
+	// RestoreEventID continues the IDs after id when it is ahead of the
+	// current sequence, such as when loading saved state
+	RestoreEventID(id int64)
+}
+
+// AppendEvent stores an event with the next sequential ID
+func (ms *MemoryStorage) AppendEvent(event StreamEvent, keep int) StreamEvent {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.eventSeq++
+	event.ID = ms.eventSeq
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	ms.events = append(ms.events, event)
+	if keep > 0 && len(ms.events) > keep {
+		ms.events = append([]StreamEvent(nil), ms.events[len(ms.events)-keep:]...)
+	}
+	return event
+}
+
+// EventsSince returns the stored events with an ID greater than id
+func (ms *MemoryStorage) EventsSince(id int64) ([]StreamEvent, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	complete := id == ms.eventSeq || (id < ms.eventSeq && len(ms.events) > 0 && ms.events[0].ID <= id+1)
+	var events []StreamEvent
+	for _, event := range ms.events {
+		if event.ID > id {
+			events = append(events, event)
+		}
+	}
+	return events, complete
+}
+
+// LastEventID returns the ID of the newest event
+func (ms *MemoryStorage) LastEventID() int64 {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.eventSeq
+}
+
+// RestoreEventID moves the event sequence forward to id
+func (ms *MemoryStorage) RestoreEventID(id int64) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if id > ms.eventSeq {
+		ms.eventSeq = id
+	}
+}
@@ -0,0 +1,50 @@
+package storage
+
+import "testing"
+
+func TestEventLog(t *testing.T) {
+	ms := NewMemoryStorage()
+	if events, complete := ms.EventsSince(0); len(events) != 0 || !complete {
+		t.Errorf("Expected empty complete log, got %d events (%v)", len(events), complete)
+	}
+
+	for i := 0; i < 5; i++ {
+		ms.AppendEvent(StreamEvent{Type: "block"}, 3)
+	}
+	if id := ms.LastEventID(); id != 5 {
+		t.Errorf("Expected last event ID 5, got %d", id)
+	}
+
+	events, complete := ms.EventsSince(3)
+	if len(events) != 2 || events[0].ID != 4 || !complete {
+		t.Errorf("Expected events 4 and 5, got %+v (%v)", events, complete)
+	}
+
+	// Events 2 was dropped, so resuming after 1 has a gap
+	events, complete = ms.EventsSince(1)
+	if len(events) != 3 || complete {
+		t.Errorf("Expected 3 retained events with a gap, got %d (%v)", len(events), complete)
+	}
+
+	if events, complete := ms.EventsSince(5); len(events) != 0 || !complete {
+		t.Errorf("Expected no events after the newest, got %d (%v)", len(events), complete)
+	}
+
+	// An ID that was never assigned comes from a lost sequence
+	if _, complete := ms.EventsSince(9); complete {
+		t.Error("Expected an unknown event ID to be reported as a gap")
+	}
+
+	// A restored sequence continues after the saved ID
+	restored := NewMemoryStorage()
+	restored.RestoreEventID(5)
+	if _, complete := restored.EventsSince(5); !complete {
+		t.Error("Expected the last saved event ID to resume without a gap")
+	}
+	if _, complete := restored.EventsSince(4); complete {
+		t.Error("Expected events lost with the restart to be reported as a gap")
+	}
+	if event := restored.AppendEvent(StreamEvent{Type: "block"}, 3); event.ID != 6 {
+		t.Errorf("Expected IDs to continue at 6, got %d", event.ID)
+	}
+}
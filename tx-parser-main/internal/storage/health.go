@@ -0,0 +1,15 @@
+package storage
+
+// Pinger is implemented by storages that can report whether they are
+// reachable, used by the readiness check
+type Pinger interface {
+	// Ping returns an error when the storage cannot serve requests
+	Ping() error
+}
+
+// Ping reports the memory storage as reachable once its lock can be taken
+func (ms *MemoryStorage) Ping() error {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return nil
+}
@@ -0,0 +1,10 @@
+package storage
+
+import "testing"
+
+func TestMemoryStoragePing(t *testing.T) {
+	var pinger Pinger = NewMemoryStorage()
+	if err := pinger.Ping(); err != nil {
+		t.Errorf("Expected the memory storage to be reachable, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import "strings"
+
+// LabelStore is implemented by storages that keep a human-readable label
+// per subscribed address, shown in notifications
+type LabelStore interface {
+	// SetLabel sets the label of an address. An empty label removes it.
+	SetLabel(address, label string)
+
+	// GetLabel returns the label of an address, or "" when it has none
+	GetLabel(address string) string
+
+	// GetLabels returns every address label
+	GetLabels() map[string]string
+}
+
+// SetLabel sets the label of an address
+func (ms *MemoryStorage) SetLabel(address, label string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	address = strings.ToLower(address)
+	if label == "" {
+		delete(ms.labels, address)
+		return
+	}
+	ms.labels[address] = label
+}
+
+// GetLabel returns the label of an address
+func (ms *MemoryStorage) GetLabel(address string) string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.labels[strings.ToLower(address)]
+}
+
+// GetLabels returns a copy of every address label
+func (ms *MemoryStorage) GetLabels() map[string]string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	labels := make(map[string]string, len(ms.labels))
+	for address, label := range ms.labels {
+		labels[address] = label
+	}
+	return labels
+}
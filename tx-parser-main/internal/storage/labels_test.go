@@ -0,0 +1,20 @@
+package storage
+
+import "testing"
+
+func TestLabels(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.SetLabel("0xABC", "Treasury")
+
+	if label := ms.GetLabel("0xabc"); label != "Treasury" {
+		t.Errorf("Expected label Treasury, got %q", label)
+	}
+	if labels := ms.GetLabels(); len(labels) != 1 || labels["0xabc"] != "Treasury" {
+		t.Errorf("Unexpected labels: %v", labels)
+	}
+
+	ms.SetLabel("0xabc", "")
+	if label := ms.GetLabel("0xabc"); label != "" {
+		t.Errorf("Expected label to be removed, got %q", label)
+	}
+}
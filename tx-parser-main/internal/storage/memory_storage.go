@@ -3,9 +3,36 @@
 package storage
 
 import (
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// Direction describes a transaction from the point of view of one address
+type Direction string
+
+const (
+	// DirectionIn marks a transaction received by the address
+	DirectionIn Direction = "in"
+
+	// DirectionOut marks a transaction sent by the address
+	DirectionOut Direction = "out"
+
+	// DirectionSelf marks a transaction the address sent to itself
+	DirectionSelf Direction = "self"
+)
+
+// Transaction execution statuses taken from the receipt
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+)
+
+// NativeAsset is the asset symbol used for plain ether transfers
+const NativeAsset = "ETH"
+
 // Transaction represents a blockchain transaction with its key details
 type Transaction struct {
 	Hash        string
@@ -14,13 +41,69 @@ type Transaction struct {
 	Value       float64
 	BlockNumber int64
 	Timestamp   int64
+
+	// ValueWei is the exact transferred amount in wei as a decimal string,
+	// in the base units of the token for token transfers
+	ValueWei string
+
+	// FeeWei is the fee paid by the sender in wei, empty when unknown
+	FeeWei string
+
+	// Status is StatusSuccess or StatusFailed, empty when the receipt is unknown
+	Status string
+
+	// Token is the token contract for token transfers, empty for ether
+	Token string
+
+	// Index is the position of the transfer within the transaction: the log
+	// index for token transfers or the trace position for internal calls.
+	// Top-level value transfers use 0.
+	Index int
+
+	// Direction is set by the storage relative to the address it is stored under
+	Direction Direction
+}
+
+// Key returns the identity used to deduplicate stored transactions. Token
+// transfers include the token, as their log index may be 0 like the
+// top-level transfer.
+func (t Transaction) Key() string {
+	if t.Token != "" {
+		return strings.ToLower(t.Hash) + ":" + strings.ToLower(t.Token) + ":" + strconv.Itoa(t.Index)
+	}
+	return strings.ToLower(t.Hash) + ":" + strconv.Itoa(t.Index)
+}
+
+// Asset returns the token contract, or NativeAsset for ether transfers
+func (t Transaction) Asset() string {
+	if t.Token == "" {
+		return NativeAsset
+	}
+	return t.Token
+}
+
+// Counterparty returns the other side of the transaction for the address it
+// is stored under, or the address itself for a self-transfer
+func (t Transaction) Counterparty(address string) string {
+	switch t.Direction {
+	case DirectionIn:
+		return t.FromAddress
+	case DirectionOut:
+		return t.ToAddress
+	default:
+		return address
+	}
 }
 
 // StorageInterface defines the required methods for a storage implementation
 type StorageInterface interface {
-	StoreTransaction(transaction Transaction)
+	// StoreTransaction stores a transaction and reports whether it was new
+	StoreTransaction(transaction Transaction) bool
 	GetTransactions(address string) []Transaction
 	AddSubscriber(address string) bool
+	// RemoveSubscriber stops monitoring an address and reports whether it
+	// was monitored. Its stored transactions are kept.
+	RemoveSubscriber(address string) bool
 	IsSubscribed(address string) bool
 	GetSubscribers() []string
 	UpdateCurrentBlock(blockNumber int64)
@@ -29,8 +112,22 @@ type StorageInterface interface {
 
 // MemoryStorage implements StorageInterface using in-memory data structures
 type MemoryStorage struct {
+	mu           sync.RWMutex
 	transactions map[string][]Transaction
+	seen         map[string]map[string]int64
 	subscribers  map[string]bool
+	labels       map[string]string
+	retention    map[string]RetentionPolicy
+	outbox       map[int64]*OutboxMessage
+	deadLetters  map[int64]*OutboxMessage
+	outboxSeq    int64
+	checkpoints  map[string]int64
+	events       []StreamEvent
+	eventSeq     int64
+	apiKeys      map[string]APIKey
+	audit        []AuditEntry
+	tenants      map[string]map[string]string
+	balances     map[string]BalanceCheckpoint
 	currentBlock int64
 }
 
@@ -38,49 +135,115 @@ type MemoryStorage struct {
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
 		transactions: make(map[string][]Transaction),
+		seen:         make(map[string]map[string]int64),
 		subscribers:  make(map[string]bool),
+		labels:       make(map[string]string),
+		retention:    make(map[string]RetentionPolicy),
+		outbox:       make(map[int64]*OutboxMessage),
+		deadLetters:  make(map[int64]*OutboxMessage),
+		checkpoints:  make(map[string]int64),
+		apiKeys:      make(map[string]APIKey),
+		tenants:      make(map[string]map[string]string),
+		balances:     make(map[string]BalanceCheckpoint),
 		currentBlock: 0,
 	}
 }
 
-// Store a transaction
-func (ms *MemoryStorage) StoreTransaction(transaction Transaction) {
-	address := strings.ToLower(transaction.FromAddress)
-	if _, exists := ms.transactions[address]; !exists {
-		ms.transactions[address] = []Transaction{}
+// StoreTransaction stores a transaction under its sender and recipient.
+// Storing the same transaction again is a no-op, and a self-transfer is
+// stored once with DirectionSelf.
+func (ms *MemoryStorage) StoreTransaction(transaction Transaction) bool {
+	defer storageDuration.ObserveSince(time.Now(), "store_transaction")
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.storeTransaction(transaction)
+}
+
+// storeTransaction stores a transaction. Callers must hold the write lock.
+func (ms *MemoryStorage) storeTransaction(transaction Transaction) bool {
+	from := strings.ToLower(transaction.FromAddress)
+	to := strings.ToLower(transaction.ToAddress)
+
+	if from == to {
+		return ms.storeFor(from, transaction, DirectionSelf)
 	}
-	ms.transactions[address] = append(ms.transactions[address], transaction)
 
-	if transaction.ToAddress != "" {
-		address = strings.ToLower(transaction.ToAddress)
-		if _, exists := ms.transactions[address]; !exists {
-			ms.transactions[address] = []Transaction{}
-		}
-		ms.transactions[address] = append(ms.transactions[address], transaction)
+	stored := ms.storeFor(from, transaction, DirectionOut)
+	if to != "" {
+		stored = ms.storeFor(to, transaction, DirectionIn) || stored
 	}
+	return stored
 }
 
+// storeFor appends the transaction to the address history unless it is
+// already there. Callers must hold the write lock.
+func (ms *MemoryStorage) storeFor(address string, transaction Transaction, direction Direction) bool {
+	key := transaction.Key()
+	if _, seen := ms.seen[address][key]; seen {
+		return false
+	}
+	if _, exists := ms.seen[address]; !exists {
+		ms.seen[address] = make(map[string]int64)
+	}
+	ms.seen[address][key] = transaction.BlockNumber
+
+	transaction.Direction = direction
+	ms.transactions[address] = append(ms.transactions[address], transaction)
+	return true
+}
+
+// GetTransactions returns the transactions stored for an address
 func (ms *MemoryStorage) GetTransactions(address string) []Transaction {
-	return ms.transactions[strings.ToLower(address)]
+	defer storageDuration.ObserveSince(time.Now(), "get_transactions")
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	stored := ms.transactions[strings.ToLower(address)]
+	if stored == nil {
+		return nil
+	}
+	return append([]Transaction(nil), stored...)
 }
 
 // AddSubscriber adds subscriber to memorystorage
 func (ms *MemoryStorage) AddSubscriber(address string) bool {
+	defer storageDuration.ObserveSince(time.Now(), "add_subscriber")
 	if !strings.HasPrefix(address, "0x") || len(address) != 42 {
 		return false
 	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 	ms.subscribers[strings.ToLower(address)] = true
 	return true
 }
 
+// RemoveSubscriber removes subscriber from memorystorage
+func (ms *MemoryStorage) RemoveSubscriber(address string) bool {
+	defer storageDuration.ObserveSince(time.Now(), "remove_subscriber")
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	address = strings.ToLower(address)
+	if !ms.subscribers[address] {
+		return false
+	}
+	delete(ms.subscribers, address)
+	return true
+}
+
 // IsSubscribed for address is subscribed
 func (ms *MemoryStorage) IsSubscribed(address string) bool {
+	defer storageDuration.ObserveSince(time.Now(), "is_subscribed")
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 	_, exists := ms.subscribers[strings.ToLower(address)]
 	return exists
 }
 
 // GetSubscribers gets all subscribers
 func (ms *MemoryStorage) GetSubscribers() []string {
+	defer storageDuration.ObserveSince(time.Now(), "get_subscribers")
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 	subscribers := make([]string, 0, len(ms.subscribers))
 	for addr := range ms.subscribers {
 		subscribers = append(subscribers, addr)
@@ -90,10 +253,66 @@ func (ms *MemoryStorage) GetSubscribers() []string {
 
 // UpdateCurrentBlock  Updates current block
 func (ms *MemoryStorage) UpdateCurrentBlock(blockNumber int64) {
+	defer storageDuration.ObserveSince(time.Now(), "update_current_block")
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
 	ms.currentBlock = blockNumber
 }
 
 // GetCurrentBlock gets current block
 func (ms *MemoryStorage) GetCurrentBlock() int64 {
+	defer storageDuration.ObserveSince(time.Now(), "get_current_block")
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
 	return ms.currentBlock
 }
+
+// TransactionScanner is implemented by storages that can stream their
+// transaction history to a callback instead of returning it in one slice
+type TransactionScanner interface {
+	// ScanTransactions calls fn for every transaction of address, or for
+	// every distinct transaction when address is empty. Scanning stops at
+	// the first error returned by fn.
+	ScanTransactions(address string, fn func(Transaction) error) error
+}
+
+// ScanTransactions streams stored transactions to fn. It copies the history
+// of one address at a time and calls fn without holding the lock, so a slow
+// consumer never blocks writers. When scanning all addresses, each
+// transaction is visited once with Direction cleared.
+func (ms *MemoryStorage) ScanTransactions(address string, fn func(Transaction) error) error {
+	defer storageDuration.ObserveSince(time.Now(), "scan_transactions")
+	if address != "" {
+		for _, tx := range ms.GetTransactions(address) {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ms.mu.RLock()
+	addresses := make([]string, 0, len(ms.transactions))
+	for addr := range ms.transactions {
+		addresses = append(addresses, addr)
+	}
+	ms.mu.RUnlock()
+	sort.Strings(addresses)
+
+	visited := make(map[string]bool)
+	for _, addr := range addresses {
+		for _, tx := range ms.GetTransactions(addr) {
+			key := tx.Key()
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			tx.Direction = ""
+			if err := fn(tx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
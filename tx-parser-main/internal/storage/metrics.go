@@ -0,0 +1,7 @@
+package storage
+
+import "blockchain-parser/internal/metrics"
+
+// storageDuration times MemoryStorage operations, including the wait for
+// the storage lock, exposed on /metrics
+var storageDuration = metrics.Default.NewHistogram("parser_storage_operation_duration_seconds", "Storage operation latency", metrics.DefaultBuckets, "operation")
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// OutboxMessage is a notification persisted for asynchronous delivery
+type OutboxMessage struct {
+	ID int64
+
+	// Channel names the notifier that should deliver the message, empty for the default one
+	Channel string
+
+	// Payload is the encoded notification
+	Payload []byte
+
+	// TraceParent is the W3C trace context of the work that queued the
+	// message, empty when it was not traced
+	TraceParent string
+
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+	NextAttempt time.Time
+}
+
+// OutboxStats counts queued and dead-lettered messages
+type OutboxStats struct {
+	Pending     int
+	DeadLetters int
+}
+
+// OutboxStore is implemented by storages that can persist notifications
+// together with the transactions that produced them
+type OutboxStore interface {
+	// StoreTransactionWithOutbox stores a transaction and, only when it is
+	// new, enqueues messages in the same atomic operation
+	StoreTransactionWithOutbox(transaction Transaction, messages []OutboxMessage) bool
+
+	// HasTransaction reports whether the transaction is already stored for
+	// its sender and recipient, so storing it again would be a no-op
+	HasTransaction(transaction Transaction) bool
+
+	// EnqueueOutbox adds messages that are not tied to a transaction
+	EnqueueOutbox(messages ...OutboxMessage)
+
+	// ClaimOutbox returns up to limit messages due at now and hides them
+	// from other workers for lease. Unacknowledged messages reappear once
+	// the lease expires, giving at-least-once delivery.
+	ClaimOutbox(limit int, now time.Time, lease time.Duration) []OutboxMessage
+
+	// RenewOutbox extends the lease of a claimed message until the given
+	// time and reports whether the message is still in the outbox
+	RenewOutbox(id int64, until time.Time) bool
+
+	// CompleteOutbox removes a delivered message
+	CompleteOutbox(id int64)
+
+	// RetryOutbox records a failed attempt and schedules the next one
+	RetryOutbox(id int64, lastError string, next time.Time)
+
+	// DeadLetterOutbox moves a message to the dead-letter list
+	DeadLetterOutbox(id int64, lastError string)
+
+	// DeadLetters returns the dead-lettered messages, oldest first
+	DeadLetters() []OutboxMessage
+
+	// ReplayDeadLetter moves a dead-lettered message back to the outbox
+	ReplayDeadLetter(id int64) bool
+
+	// OutboxStats returns queue sizes
+	OutboxStats() OutboxStats
+}
+
+// StoreTransactionWithOutbox stores a transaction and its notifications under one lock
+func (ms *MemoryStorage) StoreTransactionWithOutbox(transaction Transaction, messages []OutboxMessage) bool {
+	defer storageDuration.ObserveSince(time.Now(), "store_transaction_with_outbox")
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if !ms.storeTransaction(transaction) {
+		return false
+	}
+	ms.enqueue(messages)
+	return true
+}
+
+// HasTransaction reports whether the transaction is stored for every address
+// it would be stored under
+func (ms *MemoryStorage) HasTransaction(transaction Transaction) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	key := transaction.Key()
+	from := strings.ToLower(transaction.FromAddress)
+	to := strings.ToLower(transaction.ToAddress)
+	if _, seen := ms.seen[from][key]; !seen {
+		return false
+	}
+	_, seen := ms.seen[to][key]
+	return to == "" || seen
+}
+
+// EnqueueOutbox adds messages to the outbox
+func (ms *MemoryStorage) EnqueueOutbox(messages ...OutboxMessage) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.enqueue(messages)
+}
+
+// enqueue assigns IDs and queues messages. Callers must hold the write lock.
+func (ms *MemoryStorage) enqueue(messages []OutboxMessage) {
+	now := time.Now()
+	for _, message := range messages {
+		ms.outboxSeq++
+		message.ID = ms.outboxSeq
+		if message.CreatedAt.IsZero() {
+			message.CreatedAt = now
+		}
+		if message.NextAttempt.IsZero() {
+			message.NextAttempt = message.CreatedAt
+		}
+		stored := message
+		ms.outbox[message.ID] = &stored
+	}
+}
+
+// ClaimOutbox leases due messages to a worker
+func (ms *MemoryStorage) ClaimOutbox(limit int, now time.Time, lease time.Duration) []OutboxMessage {
+	defer storageDuration.ObserveSince(time.Now(), "claim_outbox")
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	due := make([]*OutboxMessage, 0)
+	for _, message := range ms.outbox {
+		if !message.NextAttempt.After(now) {
+			due = append(due, message)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]OutboxMessage, 0, len(due))
+	for _, message := range due {
+		message.NextAttempt = now.Add(lease)
+		claimed = append(claimed, *message)
+	}
+	return claimed
+}
+
+// RenewOutbox extends the lease of a message that is still being delivered
+func (ms *MemoryStorage) RenewOutbox(id int64, until time.Time) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	message, ok := ms.outbox[id]
+	if ok {
+		message.NextAttempt = until
+	}
+	return ok
+}
+
+// CompleteOutbox removes a delivered message
+func (ms *MemoryStorage) CompleteOutbox(id int64) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	delete(ms.outbox, id)
+}
+
+// RetryOutbox records a failed delivery attempt
+func (ms *MemoryStorage) RetryOutbox(id int64, lastError string, next time.Time) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if message, ok := ms.outbox[id]; ok {
+		message.Attempts++
+		message.LastError = lastError
+		message.NextAttempt = next
+	}
+}
+
+// DeadLetterOutbox moves a message that keeps failing out of the outbox
+func (ms *MemoryStorage) DeadLetterOutbox(id int64, lastError string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	message, ok := ms.outbox[id]
+	if !ok {
+		return
+	}
+	delete(ms.outbox, id)
+	message.Attempts++
+	message.LastError = lastError
+	ms.deadLetters[id] = message
+}
+
+// DeadLetters returns the dead-lettered messages
+func (ms *MemoryStorage) DeadLetters() []OutboxMessage {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	messages := make([]OutboxMessage, 0, len(ms.deadLetters))
+	for _, message := range ms.deadLetters {
+		messages = append(messages, *message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages
+}
+
+// ReplayDeadLetter requeues a dead-lettered message with a fresh attempt count
+func (ms *MemoryStorage) ReplayDeadLetter(id int64) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	message, ok := ms.deadLetters[id]
+	if !ok {
+		return false
+	}
+	delete(ms.deadLetters, id)
+	message.Attempts = 0
+	message.NextAttempt = time.Now()
+	ms.outbox[id] = message
+	return true
+}
+
+// OutboxStats returns the number of pending and dead-lettered messages
+func (ms *MemoryStorage) OutboxStats() OutboxStats {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return OutboxStats{Pending: len(ms.outbox), DeadLetters: len(ms.deadLetters)}
+}
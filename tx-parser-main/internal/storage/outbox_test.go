@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreTransactionWithOutbox(t *testing.T) {
+	ms := NewMemoryStorage()
+	tx := Transaction{Hash: "0xabc", FromAddress: "0x1", ToAddress: "0x2", BlockNumber: 1}
+	messages := []OutboxMessage{{Payload: []byte("a")}, {Payload: []byte("b")}}
+
+	if !ms.StoreTransactionWithOutbox(tx, messages) {
+		t.Fatal("Expected new transaction to be stored")
+	}
+	if ms.StoreTransactionWithOutbox(tx, messages) {
+		t.Error("Expected duplicate transaction to be rejected")
+	}
+	if stats := ms.OutboxStats(); stats.Pending != 2 {
+		t.Errorf("Expected 2 pending messages, got %d", stats.Pending)
+	}
+	if len(ms.GetTransactions("0x1")) != 1 {
+		t.Error("Expected transaction to be stored")
+	}
+}
+
+func TestClaimOutboxLease(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.EnqueueOutbox(OutboxMessage{Payload: []byte("a")}, OutboxMessage{Payload: []byte("b")})
+	now := time.Now()
+
+	claimed := ms.ClaimOutbox(1, now, time.Minute)
+	if len(claimed) != 1 || string(claimed[0].Payload) != "a" {
+		t.Fatalf("Expected oldest message to be claimed, got %+v", claimed)
+	}
+	if again := ms.ClaimOutbox(10, now, time.Minute); len(again) != 1 || again[0].ID == claimed[0].ID {
+		t.Errorf("Expected only the unclaimed message, got %+v", again)
+	}
+
+	// An unacknowledged message is redelivered once its lease expires
+	if expired := ms.ClaimOutbox(10, now.Add(2*time.Minute), time.Minute); len(expired) != 2 {
+		t.Errorf("Expected both messages after lease expiry, got %d", len(expired))
+	}
+
+	// A renewed lease hides the message until the new expiry
+	if !ms.RenewOutbox(claimed[0].ID, now.Add(10*time.Minute)) {
+		t.Fatal("Expected the claimed message to be renewed")
+	}
+	if renewed := ms.ClaimOutbox(10, now.Add(5*time.Minute), time.Minute); len(renewed) != 1 || renewed[0].ID == claimed[0].ID {
+		t.Errorf("Expected only the message without a renewed lease, got %+v", renewed)
+	}
+	if ms.RenewOutbox(999, now) {
+		t.Error("Expected renewing an unknown message to fail")
+	}
+}
+
+func TestOutboxRetryAndDeadLetter(t *testing.T) {
+	ms := NewMemoryStorage()
+	ms.EnqueueOutbox(OutboxMessage{Payload: []byte("a")})
+	now := time.Now()
+	id := ms.ClaimOutbox(1, now, time.Minute)[0].ID
+
+	ms.RetryOutbox(id, "boom", now.Add(time.Hour))
+	if claimed := ms.ClaimOutbox(1, now.Add(2*time.Minute), time.Minute); len(claimed) != 0 {
+		t.Error("Expected retried message to wait for its next attempt")
+	}
+
+	ms.DeadLetterOutbox(id, "still failing")
+	dead := ms.DeadLetters()
+	if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].LastError != "still failing" {
+		t.Fatalf("Unexpected dead letters: %+v", dead)
+	}
+	if stats := ms.OutboxStats(); stats.Pending != 0 || stats.DeadLetters != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	if ms.ReplayDeadLetter(id + 1) {
+		t.Error("Expected replay of unknown message to fail")
+	}
+	if !ms.ReplayDeadLetter(id) {
+		t.Fatal("Expected replay to succeed")
+	}
+	claimed := ms.ClaimOutbox(1, time.Now(), time.Minute)
+	if len(claimed) != 1 || claimed[0].Attempts != 0 {
+		t.Errorf("Expected replayed message with reset attempts, got %+v", claimed)
+	}
+
+	ms.CompleteOutbox(id)
+	if stats := ms.OutboxStats(); stats.Pending != 0 || stats.DeadLetters != 0 {
+		t.Errorf("Expected empty outbox, got %+v", stats)
+	}
+}
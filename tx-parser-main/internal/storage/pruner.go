@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"blockchain-parser/internal/logger"
+	"sync"
+	"time"
+)
+
+// log is the logger of the storage background jobs
+var log = logger.Component("storage")
+
+// PruneStats reports how much data the pruner has removed
+type PruneStats struct {
+	Runs        int64
+	TotalPruned int64
+	LastPruned  int
+	LastRun     time.Time
+	LastElapsed time.Duration
+}
+
+// Pruner periodically enforces retention policies on a RetentionStore
+type Pruner struct {
+	store    RetentionStore
+	policy   RetentionPolicy
+	interval time.Duration
+
+	mu    sync.Mutex
+	stats PruneStats
+}
+
+// NewPruner creates a pruner applying policy to every address without an override
+func NewPruner(store RetentionStore, policy RetentionPolicy, interval time.Duration) *Pruner {
+	return &Pruner{
+		store:    store,
+		policy:   policy,
+		interval: interval,
+	}
+}
+
+// Start runs the pruner every interval until stop is closed
+func (p *Pruner) Start(stop <-chan struct{}) {
+	if p.interval <= 0 {
+		log.Warn("Retention pruner disabled: non-positive interval", "interval", p.interval)
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.Prune()
+		}
+	}
+}
+
+// Prune applies retention policies once and returns the number of removed records
+func (p *Pruner) Prune() int {
+	started := time.Now()
+	pruned := p.store.PruneTransactions(p.policy, started)
+	elapsed := time.Since(started)
+
+	p.mu.Lock()
+	p.stats.Runs++
+	p.stats.TotalPruned += int64(pruned)
+	p.stats.LastPruned = pruned
+	p.stats.LastRun = started
+	p.stats.LastElapsed = elapsed
+	p.mu.Unlock()
+
+	if pruned > 0 {
+		log.Info("Pruned transactions", "count", pruned, "elapsed", elapsed)
+	} else {
+		log.Debug("Retention pruning found nothing to remove")
+	}
+	return pruned
+}
+
+// Stats returns a snapshot of the pruning metrics
+func (p *Pruner) Stats() PruneStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats
+}
+
+// Policy returns the default retention policy
+func (p *Pruner) Policy() RetentionPolicy {
+	return p.policy
+}
+
+// SetAddressPolicy overrides the retention policy for a single address
+func (p *Pruner) SetAddressPolicy(address string, policy RetentionPolicy) {
+	p.store.SetRetentionPolicy(address, policy)
+}
+
+// AddressPolicies returns all per-address retention overrides
+func (p *Pruner) AddressPolicies() map[string]RetentionPolicy {
+	return p.store.GetRetentionPolicies()
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrunerStats(t *testing.T) {
+	storage := NewMemoryStorage()
+	storeTestHistory(storage, "0xabc", time.Now())
+
+	pruner := NewPruner(storage, RetentionPolicy{MaxPerAddress: 3}, time.Minute)
+
+	if pruned := pruner.Prune(); pruned != 4 {
+		t.Errorf("Expected 4 pruned, got %d", pruned)
+	}
+	pruner.Prune()
+
+	stats := pruner.Stats()
+	if stats.Runs != 2 {
+		t.Errorf("Expected 2 runs, got %d", stats.Runs)
+	}
+	if stats.TotalPruned != 4 {
+		t.Errorf("Expected 4 total pruned, got %d", stats.TotalPruned)
+	}
+	if stats.LastPruned != 0 {
+		t.Errorf("Expected last run to prune nothing, got %d", stats.LastPruned)
+	}
+	if stats.LastRun.IsZero() {
+		t.Error("Expected last run time to be recorded")
+	}
+}
+
+func TestPrunerStartStops(t *testing.T) {
+	storage := NewMemoryStorage()
+	pruner := NewPruner(storage, RetentionPolicy{MaxPerAddress: 1}, time.Millisecond)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		pruner.Start(stop)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Pruner did not stop")
+	}
+	if pruner.Stats().Runs == 0 {
+		t.Error("Expected pruner to run at least once")
+	}
+}
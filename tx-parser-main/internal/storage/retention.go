@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy limits how much transaction history is kept for an address.
+// A zero value in any field disables that limit.
+type RetentionPolicy struct {
+	// MaxAge drops transactions whose block timestamp is older than this
+	MaxAge time.Duration
+
+	// MaxBlockDepth drops transactions more than this many blocks behind the current block
+	MaxBlockDepth int64
+
+	// MaxPerAddress keeps only the most recent transactions of each address
+	MaxPerAddress int
+}
+
+// IsZero reports whether the policy keeps everything
+func (p RetentionPolicy) IsZero() bool {
+	return p.MaxAge <= 0 && p.MaxBlockDepth <= 0 && p.MaxPerAddress <= 0
+}
+
+// RetentionStore is implemented by storages that support pruning old transactions
+type RetentionStore interface {
+	// SetRetentionPolicy overrides the default policy for one address.
+	// A zero policy removes the override.
+	SetRetentionPolicy(address string, policy RetentionPolicy)
+
+	// GetRetentionPolicies returns all per-address overrides
+	GetRetentionPolicies() map[string]RetentionPolicy
+
+	// PruneTransactions removes transactions that fall outside the address
+	// policy, or defaultPolicy when there is no override, and returns how
+	// many records were removed.
+	PruneTransactions(defaultPolicy RetentionPolicy, now time.Time) int
+}
+
+// SetRetentionPolicy overrides the default retention policy for an address
+func (ms *MemoryStorage) SetRetentionPolicy(address string, policy RetentionPolicy) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	address = strings.ToLower(address)
+	if policy.IsZero() {
+		delete(ms.retention, address)
+		return
+	}
+	ms.retention[address] = policy
+}
+
+// GetRetentionPolicies returns a copy of the per-address retention overrides
+func (ms *MemoryStorage) GetRetentionPolicies() map[string]RetentionPolicy {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	policies := make(map[string]RetentionPolicy, len(ms.retention))
+	for address, policy := range ms.retention {
+		policies[address] = policy
+	}
+	return policies
+}
+
+// PruneTransactions applies retention policies to every stored address,
+// folding the removed transactions into the balance checkpoint of each
+func (ms *MemoryStorage) PruneTransactions(defaultPolicy RetentionPolicy, now time.Time) int {
+	defer storageDuration.ObserveSince(time.Now(), "prune_transactions")
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	pruned := 0
+	for address, txs := range ms.transactions {
+		policy, ok := ms.retention[address]
+		if !ok {
+			policy = defaultPolicy
+		}
+		if policy.IsZero() {
+			continue
+		}
+
+		kept := retain(txs, policy, ms.currentBlock, now)
+		if len(kept) == len(txs) {
+			continue
+		}
+
+		// Pruned transactions live on in the balance checkpoint
+		keep := make(map[string]bool, len(kept))
+		for _, tx := range kept {
+			keep[tx.Key()] = true
+		}
+		var removed []Transaction
+		for _, tx := range txs {
+			if !keep[tx.Key()] {
+				removed = append(removed, tx)
+			}
+		}
+		ms.foldBalances(address, removed)
+
+		pruned += len(txs) - len(kept)
+		if len(kept) == 0 {
+			delete(ms.transactions, address)
+			continue
+		}
+		ms.transactions[address] = kept
+	}
+	ms.pruneSeen()
+	return pruned
+}
+
+// dedupeHorizon is how many blocks the keys of pruned transactions are kept
+// for, so a re-processed block does not store and notify them again
+const dedupeHorizon = 50000
+
+// pruneSeen drops the keys of pruned transactions older than the dedupe
+// horizon. Callers must hold the write lock.
+func (ms *MemoryStorage) pruneSeen() {
+	cutoff := ms.currentBlock - dedupeHorizon
+	for address, keys := range ms.seen {
+		stored := make(map[string]bool, len(ms.transactions[address]))
+		for _, tx := range ms.transactions[address] {
+			stored[tx.Key()] = true
+		}
+		for key, block := range keys {
+			if block < cutoff && !stored[key] {
+				delete(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			delete(ms.seen, address)
+		}
+	}
+}
+
+// retain returns the transactions allowed by the policy, oldest first
+func retain(txs []Transaction, policy RetentionPolicy, currentBlock int64, now time.Time) []Transaction {
+	kept := make([]Transaction, 0, len(txs))
+	for _, tx := range txs {
+		if policy.MaxAge > 0 && now.Sub(time.Unix(tx.Timestamp, 0)) > policy.MaxAge {
+			continue
+		}
+		if policy.MaxBlockDepth > 0 && currentBlock-tx.BlockNumber > policy.MaxBlockDepth {
+			continue
+		}
+		kept = append(kept, tx)
+	}
+
+	if policy.MaxPerAddress > 0 && len(kept) > policy.MaxPerAddress {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return kept[i].BlockNumber < kept[j].BlockNumber
+		})
+		kept = kept[len(kept)-policy.MaxPerAddress:]
+	}
+	return kept
+}
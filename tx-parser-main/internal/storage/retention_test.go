@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func storeTestHistory(storage *MemoryStorage, address string, now time.Time) {
+	for i := int64(1); i <= 5; i++ {
+		storage.StoreTransaction(Transaction{
+			Hash:        "0x" + string(rune('a'+i)),
+			FromAddress: address,
+			ToAddress:   "0xdef",
+			Value:       1.0,
+			BlockNumber: 100 + i,
+			Timestamp:   now.Add(-time.Duration(6-i) * time.Hour).Unix(),
+		})
+	}
+	storage.UpdateCurrentBlock(105)
+}
+
+func TestPruneTransactions(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		name       string
+		policy     RetentionPolicy
+		wantPruned int
+		wantKept   int
+	}{
+		{
+			name:       "zero policy keeps everything",
+			policy:     RetentionPolicy{},
+			wantPruned: 0,
+			wantKept:   5,
+		},
+		{
+			name:       "max age",
+			policy:     RetentionPolicy{MaxAge: 150 * time.Minute},
+			wantPruned: 6, // three per address, sender and receiver
+			wantKept:   2,
+		},
+		{
+			name:       "max block depth",
+			policy:     RetentionPolicy{MaxBlockDepth: 1},
+			wantPruned: 6,
+			wantKept:   2,
+		},
+		{
+			name:       "max per address",
+			policy:     RetentionPolicy{MaxPerAddress: 4},
+			wantPruned: 2,
+			wantKept:   4,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := NewMemoryStorage()
+			storeTestHistory(storage, "0xabc", now)
+
+			if pruned := storage.PruneTransactions(tc.policy, now); pruned != tc.wantPruned {
+				t.Errorf("Expected %d pruned, got %d", tc.wantPruned, pruned)
+			}
+			if kept := len(storage.GetTransactions("0xabc")); kept != tc.wantKept {
+				t.Errorf("Expected %d kept, got %d", tc.wantKept, kept)
+			}
+		})
+	}
+}
+
+func TestPruneKeepsMostRecent(t *testing.T) {
+	now := time.Now()
+	storage := NewMemoryStorage()
+	storeTestHistory(storage, "0xabc", now)
+
+	storage.PruneTransactions(RetentionPolicy{MaxPerAddress: 2}, now)
+
+	txs := storage.GetTransactions("0xabc")
+	if len(txs) != 2 || txs[0].BlockNumber != 104 || txs[1].BlockNumber != 105 {
+		t.Errorf("Expected blocks 104 and 105 to be kept, got %+v", txs)
+	}
+}
+
+func TestAddressRetentionOverride(t *testing.T) {
+	now := time.Now()
+	storage := NewMemoryStorage()
+	storeTestHistory(storage, "0xabc", now)
+
+	storage.SetRetentionPolicy("0xABC", RetentionPolicy{MaxPerAddress: 1})
+	if len(storage.GetRetentionPolicies()) != 1 {
+		t.Fatal("Expected one retention override")
+	}
+
+	// The default policy keeps everything; only the override applies
+	if pruned := storage.PruneTransactions(RetentionPolicy{}, now); pruned != 4 {
+		t.Errorf("Expected 4 pruned, got %d", pruned)
+	}
+	if kept := len(storage.GetTransactions("0xdef")); kept != 5 {
+		t.Errorf("Expected receiver history to be untouched, got %d", kept)
+	}
+
+	// A zero policy removes the override
+	storage.SetRetentionPolicy("0xabc", RetentionPolicy{})
+	if len(storage.GetRetentionPolicies()) != 0 {
+		t.Error("Expected override to be removed")
+	}
+}
+
+func TestPrunedTransactionKeys(t *testing.T) {
+	now := time.Now()
+	storage := NewMemoryStorage()
+	storeTestHistory(storage, "0xabc", now)
+
+	storage.PruneTransactions(RetentionPolicy{MaxPerAddress: 1}, now)
+
+	// A re-processed block must not store a pruned transaction again
+	old := Transaction{Hash: "0xb", FromAddress: "0xabc", ToAddress: "0xdef", BlockNumber: 101}
+	if storage.StoreTransaction(old) || !storage.HasTransaction(old) {
+		t.Error("Expected the pruned transaction to stay deduplicated")
+	}
+
+	// Keys are released once the block is beyond the dedupe horizon
+	storage.UpdateCurrentBlock(old.BlockNumber + dedupeHorizon + 1)
+	storage.PruneTransactions(RetentionPolicy{MaxPerAddress: 1}, now)
+	if !storage.StoreTransaction(old) {
+		t.Error("Expected the pruned transaction key to be released after the horizon")
+	}
+}
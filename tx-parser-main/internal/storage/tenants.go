@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// TenantStore is implemented by storages that record which tenants watch
+// an address. The parser still monitors each address once; tenants only
+// decide who sees it.
+type TenantStore interface {
+	// AddTenantAddress records that tenant watches address and reports
+	// whether it was new
+	AddTenantAddress(tenant, address string) bool
+
+	// RemoveTenantAddress stops tenant watching address and reports whether
+	// it did
+	RemoveTenantAddress(tenant, address string) bool
+
+	// IsTenantAddress reports whether tenant watches address
+	IsTenantAddress(tenant, address string) bool
+
+	// GetTenantAddresses returns the addresses watched by tenant
+	GetTenantAddresses(tenant string) []string
+
+	// GetAddressTenants returns the tenants watching address
+	GetAddressTenants(address string) []string
+
+	// GetTenants returns every tenant watching at least one address
+	GetTenants() []string
+}
+
+// AddTenantAddress records a tenant subscription, keeping the address as
+// first given
+func (ms *MemoryStorage) AddTenantAddress(tenant, address string) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	addresses, ok := ms.tenants[tenant]
+	if !ok {
+		addresses = make(map[string]string)
+		ms.tenants[tenant] = addresses
+	}
+	key := strings.ToLower(address)
+	if _, exists := addresses[key]; exists {
+		return false
+	}
+	addresses[key] = address
+	return true
+}
+
+// RemoveTenantAddress removes a tenant subscription, forgetting tenants
+// left without addresses
+func (ms *MemoryStorage) RemoveTenantAddress(tenant, address string) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	addresses, ok := ms.tenants[tenant]
+	key := strings.ToLower(address)
+	if _, exists := addresses[key]; !ok || !exists {
+		return false
+	}
+	delete(addresses, key)
+	if len(addresses) == 0 {
+		delete(ms.tenants, tenant)
+	}
+	return true
+}
+
+// IsTenantAddress reports whether tenant watches address
+func (ms *MemoryStorage) IsTenantAddress(tenant, address string) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	_, ok := ms.tenants[tenant][strings.ToLower(address)]
+	return ok
+}
+
+// GetTenantAddresses returns the addresses of tenant in sorted order
+func (ms *MemoryStorage) GetTenantAddresses(tenant string) []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	addresses := make([]string, 0, len(ms.tenants[tenant]))
+	for _, address := range ms.tenants[tenant] {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// GetAddressTenants returns the tenants of address in sorted order
+func (ms *MemoryStorage) GetAddressTenants(address string) []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	key := strings.ToLower(address)
+	var tenants []string
+	for tenant, addresses := range ms.tenants {
+		if _, ok := addresses[key]; ok {
+			tenants = append(tenants, tenant)
+		}
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// GetTenants returns the tenants in sorted order
+func (ms *MemoryStorage) GetTenants() []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	tenants := make([]string, 0, len(ms.tenants))
+	for tenant := range ms.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
@@ -0,0 +1,40 @@
+package storage
+
+import "testing"
+
+func TestTenantAddresses(t *testing.T) {
+	ms := NewMemoryStorage()
+	const address = "0xAbC0000000000000000000000000000000000001"
+
+	if !ms.AddTenantAddress("treasury", address) {
+		t.Error("Expected the first subscription to be new")
+	}
+	if ms.AddTenantAddress("treasury", "0xabc0000000000000000000000000000000000001") {
+		t.Error("Expected addresses to be compared case-insensitively")
+	}
+	ms.AddTenantAddress("payments", address)
+	ms.AddTenantAddress("payments", "0x0000000000000000000000000000000000000002")
+
+	if !ms.IsTenantAddress("payments", address) || ms.IsTenantAddress("other", address) {
+		t.Error("Unexpected tenant membership")
+	}
+	if tenants := ms.GetAddressTenants(address); len(tenants) != 2 || tenants[0] != "payments" {
+		t.Errorf("Expected both tenants in order, got %v", tenants)
+	}
+	if addresses := ms.GetTenantAddresses("treasury"); len(addresses) != 1 || addresses[0] != address {
+		t.Errorf("Expected the address as first given, got %v", addresses)
+	}
+	if tenants := ms.GetTenants(); len(tenants) != 2 {
+		t.Errorf("Expected 2 tenants, got %v", tenants)
+	}
+
+	if !ms.RemoveTenantAddress("treasury", "0xABC0000000000000000000000000000000000001") || ms.IsTenantAddress("treasury", address) {
+		t.Error("Expected the tenant subscription to be removed")
+	}
+	if ms.RemoveTenantAddress("treasury", address) {
+		t.Error("Expected removing twice to report false")
+	}
+	if tenants := ms.GetTenants(); len(tenants) != 1 || tenants[0] != "payments" {
+		t.Errorf("Expected the tenant without addresses to be dropped, got %v", tenants)
+	}
+}
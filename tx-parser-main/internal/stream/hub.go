@@ -0,0 +1,343 @@
+// Package stream publishes live transaction, block and reorg events to
+// connected clients and keeps a bounded history so they can resume.
+package stream
+
+import (
+	"blockchain-parser/internal/logger"
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// log is the logger of the event hub
+var log = logger.Component("stream")
+
+// Event types published by the hub
+const (
+	EventTransaction = "transaction"
+	EventBlock       = "block"
+	EventReorg       = "reorg"
+)
+
+// DefaultHistory is the number of events kept for resuming clients
+const DefaultHistory = 1000
+
+// SlowPolicy decides what happens to a subscription whose buffer is full
+type SlowPolicy int
+
+const (
+	// Disconnect closes the subscription so the client can resume later
+	Disconnect SlowPolicy = iota
+	// Drop discards the event and counts it on the subscription
+	Drop
+)
+
+// ParseSlowPolicy parses "disconnect" or "drop"
+func ParseSlowPolicy(value string) (SlowPolicy, error) {
+	switch strings.ToLower(value) {
+	case "", "disconnect":
+		return Disconnect, nil
+	case "drop":
+		return Drop, nil
+	}
+	return Disconnect, fmt.Errorf("unknown slow consumer policy %q", value)
+}
+
+func (p SlowPolicy) String() string {
+	if p == Drop {
+		return "drop"
+	}
+	return "disconnect"
+}
+
+// TransactionEvent is the payload of a transaction event
+type TransactionEvent struct {
+	Hash        string   `json:"hash"`
+	Index       int      `json:"index"`
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	Value       float64  `json:"value"`
+	ValueWei    string   `json:"value_wei,omitempty"`
+	FeeWei      string   `json:"fee_wei,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	Token       string   `json:"token,omitempty"`
+	BlockNumber int64    `json:"block_number"`
+	Timestamp   int64    `json:"timestamp"`
+	Addresses   []string `json:"addresses"`
+}
+
+// BlockEvent is the payload of a block event
+type BlockEvent struct {
+	Number       int64  `json:"number"`
+	Hash         string `json:"hash,omitempty"`
+	Timestamp    int64  `json:"timestamp"`
+	Transactions int    `json:"transactions"`
+}
+
+// ReorgEvent is the payload of a reorg event: the stored hash of Number no
+// longer matches the parent hash of the following block
+type ReorgEvent struct {
+	Number  int64  `json:"number"`
+	OldHash string `json:"old_hash"`
+	NewHash string `json:"new_hash"`
+}
+
+// Hub fans published events out to subscriptions and appends them to an
+// event log bounded to history events
+type Hub struct {
+	log     storage.EventLog
+	history int
+
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// NewHub creates a hub keeping history events in log
+func NewHub(log storage.EventLog, history int) *Hub {
+	if history <= 0 {
+		history = DefaultHistory
+	}
+	return &Hub{
+		log:           log,
+		history:       history,
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// PublishTransaction publishes a transaction of the subscribed addresses
+func (h *Hub) PublishTransaction(tx storage.Transaction, addresses []string) {
+	h.Publish(EventTransaction, addresses, TransactionEvent{
+		Hash:        tx.Hash,
+		Index:       tx.Index,
+		From:        tx.FromAddress,
+		To:          tx.ToAddress,
+		Value:       tx.Value,
+		ValueWei:    tx.ValueWei,
+		FeeWei:      tx.FeeWei,
+		Status:      tx.Status,
+		Token:       tx.Token,
+		BlockNumber: tx.BlockNumber,
+		Timestamp:   tx.Timestamp,
+		Addresses:   addresses,
+	})
+}
+
+// PublishBlock publishes the progress of the monitor
+func (h *Hub) PublishBlock(number int64, hash string, timestamp int64, transactions int) {
+	h.Publish(EventBlock, nil, BlockEvent{
+		Number:       number,
+		Hash:         hash,
+		Timestamp:    timestamp,
+		Transactions: transactions,
+	})
+}
+
+// PublishReorg publishes a detected chain reorganisation
+func (h *Hub) PublishReorg(number int64, oldHash, newHash string) {
+	h.Publish(EventReorg, nil, ReorgEvent{Number: number, OldHash: oldHash, NewHash: newHash})
+}
+
+// Publish stores an event and delivers it to every matching subscription
+func (h *Hub) Publish(eventType string, addresses []string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Error("Failed to encode event", "type", eventType, "error", err)
+		return
+	}
+
+	lower := make([]string, len(addresses))
+	for i, address := range addresses {
+		lower[i] = strings.ToLower(address)
+	}
+
+	// Holding the lock while appending keeps delivery in ID order
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	event := h.log.AppendEvent(storage.StreamEvent{Type: eventType, Addresses: lower, Data: payload}, h.history)
+	for sub := range h.subscriptions {
+		if !sub.matches(event) {
+			continue
+		}
+		scoped, ok := sub.scope(event)
+		if !ok || sub.send(scoped) {
+			continue
+		}
+		if sub.policy == Drop {
+			sub.dropped.Add(1)
+			continue
+		}
+		log.Warn("Closing slow stream subscriber", "event", event.ID)
+		h.remove(sub)
+	}
+}
+
+// Subscribe registers a subscription for events of addresses, or every
+// event when none are given, with room for buffer undelivered events. The
+// events published after lastID are returned for replay; complete is false
+// when some of them were already dropped from the history.
+func (h *Hub) Subscribe(addresses []string, lastID int64, buffer int) (sub *Subscription, replay []storage.StreamEvent, complete bool) {
+	if buffer <= 0 {
+		buffer = 1
+	}
+	sub = &Subscription{
+		hub:       h,
+		all:       len(addresses) == 0,
+		addresses: make(map[string]bool, len(addresses)),
+		events:    make(chan storage.StreamEvent, buffer),
+	}
+	for _, address := range addresses {
+		sub.addresses[strings.ToLower(address)] = true
+	}
+
+	// Replay and registration happen under the lock so no event is missed
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	complete = true
+	if lastID > 0 {
+		var history []storage.StreamEvent
+		history, complete = h.log.EventsSince(lastID)
+		for _, event := range history {
+			if !sub.matches(event) {
+				continue
+			}
+			if scoped, ok := sub.scope(event); ok {
+				replay = append(replay, scoped)
+			}
+		}
+	}
+	h.subscriptions[sub] = struct{}{}
+	return sub, replay, complete
+}
+
+// LastEventID returns the ID of the newest event
+func (h *Hub) LastEventID() int64 {
+	return h.log.LastEventID()
+}
+
+// Subscribers returns the number of open subscriptions
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscriptions)
+}
+
+// remove closes and unregisters a subscription. Callers must hold the lock.
+func (h *Hub) remove(sub *Subscription) {
+	if _, ok := h.subscriptions[sub]; !ok {
+		return
+	}
+	delete(h.subscriptions, sub)
+	close(sub.events)
+}
+
+// Subscription receives the events matching its addresses
+type Subscription struct {
+	hub       *Hub
+	all       bool
+	addresses map[string]bool
+	events    chan storage.StreamEvent
+	policy    SlowPolicy
+	dropped   atomic.Int64
+}
+
+// Events returns the channel of live events. It is closed when the
+// subscription is closed or falls too far behind.
+func (s *Subscription) Events() <-chan storage.StreamEvent {
+	return s.events
+}
+
+// Close unregisters the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// SetAddresses replaces the addresses of the subscription. Unlike Subscribe,
+// an empty list receives no address events at all.
+func (s *Subscription) SetAddresses(addresses []string) {
+	set := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		set[strings.ToLower(address)] = true
+	}
+
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.all = false
+	s.addresses = set
+}
+
+// SetPolicy sets how the subscription handles a full buffer
+func (s *Subscription) SetPolicy(policy SlowPolicy) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.policy = policy
+}
+
+// TakeDropped returns the number of events dropped since the last call
+func (s *Subscription) TakeDropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// matches reports whether the subscription receives an event. Events
+// without addresses, such as blocks, go to every subscription.
+func (s *Subscription) matches(event storage.StreamEvent) bool {
+	if s.all || len(event.Addresses) == 0 {
+		return true
+	}
+	for _, address := range event.Addresses {
+		if s.addresses[address] {
+			return true
+		}
+	}
+	return false
+}
+
+// scope limits the addresses of an event to those of the subscription, so
+// subscribers never learn which other addresses share a transaction. It
+// reports false when the payload cannot be rewritten.
+func (s *Subscription) scope(event storage.StreamEvent) (storage.StreamEvent, bool) {
+	if s.all || len(event.Addresses) == 0 {
+		return event, true
+	}
+	var own []string
+	for _, address := range event.Addresses {
+		if s.addresses[address] {
+			own = append(own, address)
+		}
+	}
+	if len(own) == len(event.Addresses) {
+		return event, true
+	}
+	event.Addresses = own
+	if event.Type != EventTransaction {
+		return event, true
+	}
+
+	var tx TransactionEvent
+	if err := json.Unmarshal(event.Data, &tx); err != nil {
+		log.Error("Failed to scope event", "type", event.Type, "event", event.ID, "error", err)
+		return event, false
+	}
+	tx.Addresses = own
+	payload, err := json.Marshal(tx)
+	if err != nil {
+		log.Error("Failed to scope event", "type", event.Type, "event", event.ID, "error", err)
+		return event, false
+	}
+	event.Data = payload
+	return event, true
+}
+
+// send queues an event without blocking and reports whether it fit
+func (s *Subscription) send(event storage.StreamEvent) bool {
+	select {
+	case s.events <- event:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"blockchain-parser/internal/storage"
+	"encoding/json"
+	"testing"
+)
+
+const (
+	testAddress  = "0x1111111111111111111111111111111111111111"
+	otherAddress = "0x2222222222222222222222222222222222222222"
+)
+
+func TestHubFiltersByAddress(t *testing.T) {
+	hub := NewHub(storage.NewMemoryStorage(), 10)
+	sub, _, _ := hub.Subscribe([]string{testAddress}, 0, 10)
+	defer sub.Close()
+
+	hub.PublishTransaction(storage.Transaction{Hash: "0xa", FromAddress: otherAddress}, []string{otherAddress})
+	hub.PublishTransaction(storage.Transaction{Hash: "0xb", ToAddress: testAddress}, []string{"0x1111111111111111111111111111111111111111"})
+	hub.PublishBlock(5, "0xblock", 1000, 1)
+
+	first := <-sub.Events()
+	var tx TransactionEvent
+	json.Unmarshal(first.Data, &tx)
+	if first.Type != EventTransaction || tx.Hash != "0xb" || first.ID != 2 {
+		t.Errorf("Expected the matching transaction as event 2, got %+v", first)
+	}
+	if second := <-sub.Events(); second.Type != EventBlock {
+		t.Errorf("Expected block events to reach every subscriber, got %+v", second)
+	}
+}
+
+func TestHubReplay(t *testing.T) {
+	hub := NewHub(storage.NewMemoryStorage(), 3)
+	for i := int64(1); i <= 5; i++ {
+		hub.PublishBlock(i, "", 0, 0)
+	}
+
+	sub, replay, complete := hub.Subscribe(nil, 3, 10)
+	defer sub.Close()
+	if len(replay) != 2 || replay[0].ID != 4 || !complete {
+		t.Errorf("Expected events 4 and 5 to be replayed, got %+v (%v)", replay, complete)
+	}
+
+	gap, replay, complete := hub.Subscribe(nil, 1, 10)
+	defer gap.Close()
+	if len(replay) != 3 || complete {
+		t.Errorf("Expected an incomplete replay of 3 events, got %d (%v)", len(replay), complete)
+	}
+}
+
+func TestHubClosesSlowSubscriber(t *testing.T) {
+	hub := NewHub(storage.NewMemoryStorage(), 10)
+	sub, _, _ := hub.Subscribe(nil, 0, 1)
+
+	hub.PublishBlock(1, "", 0, 0)
+	hub.PublishBlock(2, "", 0, 0)
+
+	if hub.Subscribers() != 0 {
+		t.Error("Expected the slow subscriber to be removed")
+	}
+	<-sub.Events()
+	if _, open := <-sub.Events(); open {
+		t.Error("Expected the events channel to be closed")
+	}
+	sub.Close()
+}
+
+func TestHubReorg(t *testing.T) {
+	hub := NewHub(storage.NewMemoryStorage(), 10)
+	sub, _, _ := hub.Subscribe(nil, 0, 1)
+	defer sub.Close()
+
+	hub.PublishReorg(9, "0xold", "0xnew")
+	event := <-sub.Events()
+	var reorg ReorgEvent
+	json.Unmarshal(event.Data, &reorg)
+	if event.Type != EventReorg || reorg.Number != 9 || reorg.NewHash != "0xnew" {
+		t.Errorf("Unexpected reorg event: %+v %+v", event, reorg)
+	}
+}
+
+func TestHubDropPolicy(t *testing.T) {
+	hub := NewHub(storage.NewMemoryStorage(), 10)
+	sub, _, _ := hub.Subscribe(nil, 0, 1)
+	defer sub.Close()
+	sub.SetPolicy(Drop)
+
+	for i := int64(1); i <= 3; i++ {
+		hub.PublishBlock(i, "", 0, 0)
+	}
+
+	if hub.Subscribers() != 1 {
+		t.Fatal("Expected the subscriber to stay connected")
+	}
+	if dropped := sub.TakeDropped(); dropped != 2 {
+		t.Errorf("Expected 2 dropped events, got %d", dropped)
+	}
+	if sub.TakeDropped() != 0 {
+		t.Error("Expected the dropped count to be reset")
+	}
+	if event := <-sub.Events(); event.ID != 1 {
+		t.Errorf("Expected the first event to be kept, got %d", event.ID)
+	}
+}
+
+func TestSubscriptionSetAddresses(t *testing.T) {
+	hub := NewHub(storage.NewMemoryStorage(), 10)
+	sub, _, _ := hub.Subscribe(nil, 0, 10)
+	defer sub.Close()
+
+	sub.SetAddresses(nil)
+	hub.PublishTransaction(storage.Transaction{Hash: "0xa"}, []string{testAddress})
+
+	sub.SetAddresses([]string{"0x1111111111111111111111111111111111111111"})
+	hub.PublishTransaction(storage.Transaction{Hash: "0xb"}, []string{testAddress})
+
+	if event := <-sub.Events(); event.ID != 2 {
+		t.Errorf("Expected only the transaction after the address was added, got %d", event.ID)
+	}
+}
+
+func TestParseSlowPolicy(t *testing.T) {
+	if policy, err := ParseSlowPolicy("DROP"); err != nil || policy != Drop {
+		t.Errorf("Expected drop, got %v (%v)", policy, err)
+	}
+	if policy, err := ParseSlowPolicy(""); err != nil || policy != Disconnect {
+		t.Errorf("Expected disconnect by default, got %v (%v)", policy, err)
+	}
+	if _, err := ParseSlowPolicy("block"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func TestHubScopesTransactionAddresses(t *testing.T) {
+	hub := NewHub(storage.NewMemoryStorage(), 10)
+	sub, _, _ := hub.Subscribe([]string{testAddress}, 0, 10)
+	defer sub.Close()
+	all, _, _ := hub.Subscribe(nil, 0, 10)
+	defer all.Close()
+
+	hub.PublishBlock(1, "", 0, 1)
+	hub.PublishTransaction(storage.Transaction{Hash: "0xa", FromAddress: otherAddress, ToAddress: testAddress},
+		[]string{otherAddress, testAddress})
+
+	<-sub.Events()
+	var tx TransactionEvent
+	event := <-sub.Events()
+	json.Unmarshal(event.Data, &tx)
+	if len(tx.Addresses) != 1 || tx.Addresses[0] != testAddress || len(event.Addresses) != 1 {
+		t.Errorf("Expected only the subscribed address, got %v", tx.Addresses)
+	}
+
+	<-all.Events()
+	json.Unmarshal((<-all.Events()).Data, &tx)
+	if len(tx.Addresses) != 2 {
+		t.Errorf("Expected an unscoped subscription to see both addresses, got %v", tx.Addresses)
+	}
+
+	// Replayed events are scoped the same way
+	resumed, replay, _ := hub.Subscribe([]string{otherAddress}, 1, 10)
+	defer resumed.Close()
+	if len(replay) != 1 {
+		t.Fatalf("Expected the transaction to be replayed, got %+v", replay)
+	}
+	json.Unmarshal(replay[0].Data, &tx)
+	if len(tx.Addresses) != 1 || tx.Addresses[0] != otherAddress {
+		t.Errorf("Expected only the subscribed address on replay, got %v", tx.Addresses)
+	}
+}
@@ -0,0 +1,214 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultOTLPEndpoint is the OTLP/HTTP traces endpoint of a local collector
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+// OTLPExporter sends spans to an OpenTelemetry collector with the OTLP/HTTP
+// protocol in its JSON encoding
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+}
+
+// NewOTLPExporter creates an exporter posting to endpoint, the full URL of
+// the collector's traces receiver, with spans attributed to serviceName
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// OTLP JSON messages. IDs are hex strings and 64-bit integers are strings,
+// as the protobuf JSON mapping requires.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// OTLP status codes
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+func otlpAttribute(attribute Attribute) otlpKeyValue {
+	var value map[string]interface{}
+	switch v := attribute.Value.(type) {
+	case string:
+		value = map[string]interface{}{"stringValue": v}
+	case int64:
+		value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case int:
+		value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case float64:
+		value = map[string]interface{}{"doubleValue": v}
+	case bool:
+		value = map[string]interface{}{"boolValue": v}
+	default:
+		value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return otlpKeyValue{Key: attribute.Key, Value: value}
+}
+
+// encode builds the export request of a batch
+func (e *OTLPExporter) encode(spans []SpanData) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		item := otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: otlpStatusUnset},
+		}
+		if span.ParentSpanID.IsValid() {
+			item.ParentSpanID = span.ParentSpanID.String()
+		}
+		for _, attribute := range span.Attributes {
+			item.Attributes = append(item.Attributes, otlpAttribute(attribute))
+		}
+		if span.Error != "" {
+			item.Status = otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+		encoded = append(encoded, item)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{otlpAttribute(String("service.name", e.serviceName))}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "blockchain-parser"}, Spans: encoded}},
+	}}}
+}
+
+// Export posts a batch of spans to the collector
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return fmt.Errorf("error encoding spans: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating export request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error exporting %d spans: %v", len(spans), err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector rejected %d spans with status %d", len(spans), resp.StatusCode)
+	}
+	return nil
+}
+
+// WriterExporter writes each span as one JSON line, for tests and local
+// debugging without a collector
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter creates an exporter writing to w, such as os.Stdout
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// spanLine is the JSON line written for a span
+type spanLine struct {
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Name         string                 `json:"name"`
+	Start        time.Time              `json:"start"`
+	DurationMS   float64                `json:"duration_ms"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// Export writes a batch of spans
+func (e *WriterExporter) Export(ctx context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	encoder := json.NewEncoder(e.w)
+	for _, span := range spans {
+		line := spanLine{
+			TraceID:    span.TraceID.String(),
+			SpanID:     span.SpanID.String(),
+			Name:       span.Name,
+			Start:      span.Start.UTC(),
+			DurationMS: float64(span.End.Sub(span.Start).Microseconds()) / 1000,
+			Error:      span.Error,
+		}
+		if span.ParentSpanID.IsValid() {
+			line.ParentSpanID = span.ParentSpanID.String()
+		}
+		if len(span.Attributes) > 0 {
+			line.Attributes = make(map[string]interface{}, len(span.Attributes))
+			for _, attribute := range span.Attributes {
+				line.Attributes[attribute.Key] = attribute.Value
+			}
+		}
+		if err := encoder.Encode(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
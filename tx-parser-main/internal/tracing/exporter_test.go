@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSpans() []SpanData {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	parent := SpanData{
+		Name:    "monitor.process_block",
+		Kind:    KindInternal,
+		TraceID: TraceID{1},
+		SpanID:  SpanID{2},
+		Start:   start,
+		End:     start.Add(1500 * time.Microsecond),
+	}
+	child := SpanData{
+		Name:         "rpc eth_getBlockByNumber",
+		Kind:         KindClient,
+		TraceID:      TraceID{1},
+		SpanID:       SpanID{3},
+		ParentSpanID: SpanID{2},
+		Start:        start,
+		End:          start.Add(time.Millisecond),
+		Attributes:   []Attribute{String("rpc.method", "eth_getBlockByNumber"), Int64("block.number", 16)},
+		Error:        "timeout",
+	}
+	return []SpanData{child, parent}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var received otlpRequest
+	var contentType string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL+"/v1/traces", "parser-test")
+	if err := exporter.Export(context.Background(), testSpans()); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if contentType != "application/json" || len(received.ResourceSpans) != 1 {
+		t.Fatalf("Unexpected request %q %+v", contentType, received)
+	}
+	resource := received.ResourceSpans[0]
+	if resource.Resource.Attributes[0].Value["stringValue"] != "parser-test" {
+		t.Errorf("Unexpected resource %+v", resource.Resource)
+	}
+	spans := resource.ScopeSpans[0].Spans
+	child := spans[0]
+	if child.TraceID != "01000000000000000000000000000000" || child.ParentSpanID != "0200000000000000" || child.Kind != KindClient {
+		t.Errorf("Unexpected span %+v", child)
+	}
+	if child.StartTimeUnixNano != "1714564800000000000" || child.Status.Code != otlpStatusError || child.Status.Message != "timeout" {
+		t.Errorf("Unexpected timing or status %+v", child)
+	}
+	if child.Attributes[1].Value["intValue"] != "16" {
+		t.Errorf("Expected integers encoded as strings, got %+v", child.Attributes[1])
+	}
+	if spans[1].ParentSpanID != "" || spans[1].Status.Code != otlpStatusUnset {
+		t.Errorf("Unexpected root span %+v", spans[1])
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	if err := NewOTLPExporter(failing.URL, "parser-test").Export(context.Background(), testSpans()); err == nil {
+		t.Error("Expected an error when the collector rejects the spans")
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var out bytes.Buffer
+	if err := NewWriterExporter(&out).Export(context.Background(), testSpans()); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected one line per span, got %q", out.String())
+	}
+	var line spanLine
+	json.Unmarshal([]byte(lines[0]), &line)
+	if line.Name != "rpc eth_getBlockByNumber" || line.DurationMS != 1 || line.Error != "timeout" || line.Attributes["rpc.method"] != "eth_getBlockByNumber" {
+		t.Errorf("Unexpected line %+v", line)
+	}
+}
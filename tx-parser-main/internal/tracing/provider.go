@@ -0,0 +1,179 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans to a tracing backend
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// ProviderConfig controls how spans are batched for export
+type ProviderConfig struct {
+	// BatchSize is the number of spans that triggers an export
+	BatchSize int
+
+	// FlushInterval is how often queued spans are exported regardless of
+	// the batch size
+	FlushInterval time.Duration
+
+	// MaxQueue bounds the spans waiting for export; newer spans are dropped
+	// while it is full
+	MaxQueue int
+
+	// OnError is called when an export fails, nil to ignore failures
+	OnError func(error)
+}
+
+// DefaultProviderConfig returns the batching settings used when none are
+// configured
+func DefaultProviderConfig() ProviderConfig {
+	return ProviderConfig{
+		BatchSize:     256,
+		FlushInterval: 5 * time.Second,
+		MaxQueue:      4096,
+	}
+}
+
+// Provider creates spans and exports them in batches from a background
+// goroutine, so exporting never delays the traced work
+type Provider struct {
+	exporter Exporter
+	config   ProviderConfig
+
+	mu      sync.Mutex
+	queue   []SpanData
+	dropped int64
+
+	flush    chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewProvider creates a provider exporting through exporter and starts its
+// export loop. Shutdown stops the loop.
+func NewProvider(exporter Exporter, cfg ProviderConfig) *Provider {
+	defaults := DefaultProviderConfig()
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaults.BatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaults.FlushInterval
+	}
+	if cfg.MaxQueue < cfg.BatchSize {
+		cfg.MaxQueue = cfg.BatchSize
+	}
+	p := &Provider{
+		exporter: exporter,
+		config:   cfg,
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Start begins a span, see the package-level Start
+func (p *Provider) Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	span := &Span{
+		provider: p,
+		data: SpanData{
+			Name:       name,
+			Kind:       KindInternal,
+			SpanID:     newSpanID(),
+			Start:      time.Now(),
+			Attributes: attributes,
+		},
+	}
+	if parent, ok := fromContext(ctx); ok {
+		span.data.TraceID = parent.traceID
+		span.data.ParentSpanID = parent.spanID
+	} else {
+		span.data.TraceID = newTraceID()
+	}
+	return contextWith(ctx, spanContext{traceID: span.data.TraceID, spanID: span.data.SpanID}), span
+}
+
+// Dropped returns the number of spans dropped because the queue was full
+func (p *Provider) Dropped() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+// enqueue queues a finished span, waking the export loop once a batch is full
+func (p *Provider) enqueue(span SpanData) {
+	p.mu.Lock()
+	if len(p.queue) >= p.config.MaxQueue {
+		p.dropped++
+		p.mu.Unlock()
+		return
+	}
+	p.queue = append(p.queue, span)
+	full := len(p.queue) >= p.config.BatchSize
+	p.mu.Unlock()
+
+	if full {
+		select {
+		case p.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run exports queued spans on every interval and whenever a batch fills up
+func (p *Provider) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		case <-p.flush:
+		}
+		p.Flush(context.Background())
+	}
+}
+
+// Flush exports every queued span, in batches of BatchSize
+func (p *Provider) Flush(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		n := len(p.queue)
+		if n > p.config.BatchSize {
+			n = p.config.BatchSize
+		}
+		batch := p.queue[:n:n]
+		p.queue = p.queue[n:]
+		p.mu.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := p.exporter.Export(ctx, batch); err != nil {
+			if p.config.OnError != nil {
+				p.config.OnError(err)
+			}
+			return err
+		}
+	}
+}
+
+// Shutdown stops the export loop and exports the spans still queued
+func (p *Provider) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.Flush(ctx)
+}
@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProviderBatching(t *testing.T) {
+	exporter := &recordingExporter{}
+	provider := NewProvider(exporter, ProviderConfig{BatchSize: 2, FlushInterval: time.Hour, MaxQueue: 3})
+
+	for i := 0; i < 4; i++ {
+		provider.enqueue(SpanData{Name: "span"})
+	}
+	if provider.Dropped() != 1 {
+		t.Errorf("Expected the span beyond the queue bound to be dropped, got %d", provider.Dropped())
+	}
+
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if spans := exporter.spans(); len(spans) != 3 {
+		t.Errorf("Expected every queued span to be exported, got %d", len(spans))
+	}
+	for _, batch := range exporter.batches {
+		if len(batch) > 2 {
+			t.Errorf("Expected batches of at most 2 spans, got %d", len(batch))
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Package tracing records spans of work across the monitor, RPC calls,
+// storage and notifications, and exports them in batches. Trace context is
+// propagated with the W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns the lowercase hex form of the ID
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid reports whether the ID is not all zeros
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the lowercase hex form of the ID
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid reports whether the ID is not all zeros
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanKind describes the relationship of a span to its callers
+type SpanKind int
+
+// Span kinds, numbered as in OTLP
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Attribute is a key and a string, int64, float64 or bool value
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 returns an integer attribute
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanData is a finished span as handed to exporters
+type SpanData struct {
+	Name         string
+	Kind         SpanKind
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+
+	// Error is the recorded failure, empty when the span succeeded
+	Error string
+}
+
+// Span is an operation being traced. Every method is safe to call on a nil
+// span, which is what Start returns while tracing is disabled.
+type Span struct {
+	provider *Provider
+	mu       sync.Mutex
+	data     SpanData
+	ended    bool
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Attributes = append(s.data.Attributes, attributes...)
+	s.mu.Unlock()
+}
+
+// SetKind changes the kind of the span, internal by default
+func (s *Span) SetKind(kind SpanKind) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Kind = kind
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed. A nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// TraceID returns the ID of the trace the span belongs to
+func (s *Span) TraceID() TraceID {
+	if s == nil {
+		return TraceID{}
+	}
+	return s.data.TraceID
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.provider.enqueue(data)
+}
+
+// spanContext is the part of a span that children and remote services need
+type spanContext struct {
+	traceID TraceID
+	spanID  SpanID
+}
+
+type spanContextKey struct{}
+
+// contextWith returns ctx carrying sc as the current span context
+func contextWith(ctx context.Context, sc spanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// fromContext returns the current span context of ctx
+func fromContext(ctx context.Context) (spanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(spanContext)
+	return sc, ok
+}
+
+// IDs returns the hex trace and span IDs of the current span of ctx, or
+// empty strings when there is none
+func IDs(ctx context.Context) (traceID, spanID string) {
+	sc, ok := fromContext(ctx)
+	if !ok {
+		return "", ""
+	}
+	return sc.traceID.String(), sc.spanID.String()
+}
+
+// TraceParent returns the W3C traceparent value of the current span of
+// ctx, or an empty string when there is none
+func TraceParent(ctx context.Context) string {
+	sc, ok := fromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", sc.traceID, sc.spanID)
+}
+
+// WithTraceParent returns ctx continuing the trace of a W3C traceparent
+// value, such as one received from a client or stored with a queued
+// message. Invalid values leave ctx unchanged.
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ctx
+	}
+	var sc spanContext
+	if len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil || !sc.traceID.IsValid() {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil || !sc.spanID.IsValid() {
+		return ctx
+	}
+	return contextWith(ctx, sc)
+}
+
+// Inject sets the traceparent header of an outgoing request
+func Inject(ctx context.Context, header http.Header) {
+	if traceparent := TraceParent(ctx); traceparent != "" {
+		header.Set("traceparent", traceparent)
+	}
+}
+
+// Extract returns ctx continuing the trace of an incoming request
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return WithTraceParent(ctx, header.Get("traceparent"))
+}
+
+var (
+	globalMu       sync.RWMutex
+	globalProvider *Provider
+)
+
+// SetProvider makes Start record spans with provider. A nil provider
+// disables tracing.
+func SetProvider(provider *Provider) {
+	globalMu.Lock()
+	globalProvider = provider
+	globalMu.Unlock()
+}
+
+// Start begins a span named name as a child of the current span of ctx,
+// or as the root of a new trace, and returns ctx carrying the new span.
+// While tracing is disabled it returns ctx unchanged and a nil span.
+func Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	globalMu.RLock()
+	provider := globalProvider
+	globalMu.RUnlock()
+	if provider == nil {
+		return ctx, nil
+	}
+	return provider.Start(ctx, name, attributes...)
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
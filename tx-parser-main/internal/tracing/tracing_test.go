@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// recordingExporter keeps exported spans
+type recordingExporter struct {
+	batches [][]SpanData
+}
+
+func (r *recordingExporter) Export(ctx context.Context, spans []SpanData) error {
+	r.batches = append(r.batches, append([]SpanData(nil), spans...))
+	return nil
+}
+
+func (r *recordingExporter) spans() []SpanData {
+	var spans []SpanData
+	for _, batch := range r.batches {
+		spans = append(spans, batch...)
+	}
+	return spans
+}
+
+func TestDisabledTracing(t *testing.T) {
+	SetProvider(nil)
+	ctx, span := Start(context.Background(), "noop")
+	if span != nil || ctx != context.Background() {
+		t.Fatal("Expected no span while tracing is disabled")
+	}
+	// Every method is safe on the nil span
+	span.SetAttributes(String("key", "value"))
+	span.SetKind(KindClient)
+	span.RecordError(errors.New("failed"))
+	span.End()
+	if traceID, _ := IDs(ctx); traceID != "" || TraceParent(ctx) != "" {
+		t.Error("Expected no trace context")
+	}
+}
+
+func TestParentAndChild(t *testing.T) {
+	exporter := &recordingExporter{}
+	provider := NewProvider(exporter, ProviderConfig{})
+	defer provider.Shutdown(context.Background())
+	SetProvider(provider)
+	defer SetProvider(nil)
+
+	ctx, parent := Start(context.Background(), "monitor.process_block", Int64("block.number", 16))
+	childCtx, child := Start(ctx, "rpc eth_getBlockByNumber")
+	child.SetKind(KindClient)
+	child.RecordError(errors.New("timeout"))
+	child.End()
+	parent.End()
+	parent.End()
+
+	if err := provider.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	spans := exporter.spans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].TraceID != spans[1].TraceID || spans[0].ParentSpanID != spans[1].SpanID {
+		t.Errorf("Expected the child to belong to its parent, got %+v", spans)
+	}
+	if spans[0].Kind != KindClient || spans[0].Error != "timeout" || spans[1].ParentSpanID.IsValid() {
+		t.Errorf("Unexpected spans %+v", spans)
+	}
+
+	traceID, spanID := IDs(childCtx)
+	if traceID != parent.TraceID().String() || spanID != spans[0].SpanID.String() {
+		t.Errorf("Unexpected IDs %s %s", traceID, spanID)
+	}
+}
+
+func TestTraceParentPropagation(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	header := http.Header{}
+	header.Set("traceparent", traceparent)
+	ctx := Extract(context.Background(), header)
+	if TraceParent(ctx) != traceparent {
+		t.Fatalf("Expected the incoming trace to be continued, got %q", TraceParent(ctx))
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if out.Get("traceparent") != traceparent {
+		t.Errorf("Expected the trace to be injected, got %q", out.Get("traceparent"))
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+	} {
+		if TraceParent(WithTraceParent(context.Background(), invalid)) != "" {
+			t.Errorf("Expected %q to be ignored", invalid)
+		}
+	}
+}
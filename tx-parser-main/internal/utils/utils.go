@@ -3,10 +3,66 @@
 package utils
 
 import (
-    "strconv"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 )
 
+// weiPerEther is the number of wei in one ether
+var weiPerEther = big.NewInt(1e18)
+
 // String2Int64 converts a string to an int64 using the specified base.
 func String2Int64(s string, base int) (int64, error) {
-    return strconv.ParseInt(s, base, 64)
-}
\ No newline at end of file
+	return strconv.ParseInt(s, base, 64)
+}
+
+// HexToBigInt converts a hex quantity, with or without the 0x prefix, to a big.Int
+func HexToBigInt(hex string) (*big.Int, error) {
+	hex = strings.TrimPrefix(hex, "0x")
+	if hex == "" {
+		return nil, fmt.Errorf("empty hex value")
+	}
+	value, ok := new(big.Int).SetString(hex, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex value %q", hex)
+	}
+	return value, nil
+}
+
+// WeiToEther formats a wei amount as an exact decimal ether string
+func WeiToEther(wei *big.Int) string {
+	quotient, remainder := new(big.Int).QuoRem(wei, weiPerEther, new(big.Int))
+
+	sign := ""
+	if wei.Sign() < 0 {
+		sign = "-"
+		quotient.Abs(quotient)
+		remainder.Abs(remainder)
+	}
+	if remainder.Sign() == 0 {
+		return sign + quotient.String()
+	}
+
+	fraction := strings.TrimRight(fmt.Sprintf("%018s", remainder.String()), "0")
+	return sign + quotient.String() + "." + fraction
+}
+
+// WeiToFloat converts a wei amount to an approximate ether float
+func WeiToFloat(wei *big.Int) float64 {
+	ether, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), new(big.Float).SetInt(weiPerEther)).Float64()
+	return ether
+}
+
+// EtherToWei parses a decimal ether amount such as "0.5" into wei
+func EtherToWei(ether string) (*big.Int, error) {
+	amount, ok := new(big.Rat).SetString(ether)
+	if !ok {
+		return nil, fmt.Errorf("invalid ether amount %q", ether)
+	}
+	wei := amount.Mul(amount, new(big.Rat).SetInt(weiPerEther))
+	if !wei.IsInt() {
+		return nil, fmt.Errorf("ether amount %q has more than 18 decimals", ether)
+	}
+	return new(big.Int).Set(wei.Num()), nil
+}
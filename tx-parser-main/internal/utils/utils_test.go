@@ -1,6 +1,7 @@
 package utils
 
 import (
+    "math/big"
     "testing"
 )
 
@@ -78,4 +79,91 @@ func TestString2Int64(t *testing.T) {
             }
         })
     }
-}
\ No newline at end of file
+}
+func TestHexToBigInt(t *testing.T) {
+    testCases := []struct {
+        name        string
+        input       string
+        expected    string
+        expectError bool
+    }{
+        {name: "with prefix", input: "0x7b", expected: "123"},
+        {name: "without prefix", input: "7b", expected: "123"},
+        {name: "larger than int64", input: "0x1bc16d674ec800000", expected: "32000000000000000000"},
+        {name: "empty", input: "0x", expectError: true},
+        {name: "invalid", input: "0xzz", expectError: true},
+    }
+
+    for _, tc := range testCases {
+        t.Run(tc.name, func(t *testing.T) {
+            result, err := HexToBigInt(tc.input)
+            if tc.expectError {
+                if err == nil {
+                    t.Error("Expected error but got none")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Unexpected error: %v", err)
+            }
+            if result.String() != tc.expected {
+                t.Errorf("Expected %s but got %s", tc.expected, result.String())
+            }
+        })
+    }
+}
+
+func TestWeiToEther(t *testing.T) {
+    testCases := []struct {
+        wei      string
+        expected string
+    }{
+        {"0", "0"},
+        {"1000000000000000000", "1"},
+        {"1500000000000000000", "1.5"},
+        {"1", "0.000000000000000001"},
+        {"32000000000000000000", "32"},
+        {"-2500000000000000000", "-2.5"},
+    }
+
+    for _, tc := range testCases {
+        t.Run(tc.wei, func(t *testing.T) {
+            wei, _ := new(big.Int).SetString(tc.wei, 10)
+            if result := WeiToEther(wei); result != tc.expected {
+                t.Errorf("Expected %s but got %s", tc.expected, result)
+            }
+        })
+    }
+
+    wei, _ := new(big.Int).SetString("1500000000000000000", 10)
+    if result := WeiToFloat(wei); result != 1.5 {
+        t.Errorf("Expected 1.5 but got %f", result)
+    }
+}
+
+func TestEtherToWei(t *testing.T) {
+    testCases := []struct {
+        ether    string
+        expected string
+        wantErr  bool
+    }{
+        {"0", "0", false},
+        {"1", "1000000000000000000", false},
+        {"0.5", "500000000000000000", false},
+        {"0.000000000000000001", "1", false},
+        {"0.0000000000000000001", "", true},
+        {"abc", "", true},
+    }
+
+    for _, tc := range testCases {
+        t.Run(tc.ether, func(t *testing.T) {
+            result, err := EtherToWei(tc.ether)
+            if (err != nil) != tc.wantErr {
+                t.Fatalf("Expected error: %v, got: %v", tc.wantErr, err)
+            }
+            if !tc.wantErr && result.String() != tc.expected {
+                t.Errorf("Expected %s but got %s", tc.expected, result)
+            }
+        })
+    }
+}
@@ -0,0 +1,396 @@
+// Package websocket implements the subset of RFC 6455 used by the live API:
+// the opening handshake, text and binary messages, fragmentation, and the
+// ping, pong and close control frames. Extensions and subprotocols are not
+// supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message opcodes
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// Close status codes
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+)
+
+// DefaultMaxMessageSize bounds the size of a received message
+const DefaultMaxMessageSize = 64 << 10
+
+// acceptGUID is appended to the client key to compute Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrNotWebSocket is returned by Upgrade for plain HTTP requests
+	ErrNotWebSocket = errors.New("not a websocket handshake")
+
+	// ErrMessageTooBig is returned when a message exceeds the size limit
+	ErrMessageTooBig = errors.New("websocket message too big")
+)
+
+// CloseError is returned by ReadMessage when the peer closed the connection
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// Conn is a WebSocket connection. ReadMessage must be called from a single
+// goroutine; writes may come from several.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	client bool
+
+	writeMu sync.Mutex
+	closed  bool
+
+	// MaxMessageSize bounds received messages, DefaultMaxMessageSize when 0
+	MaxMessageSize int64
+
+	pongHandler func()
+}
+
+// acceptKey computes the Sec-WebSocket-Accept value of a client key
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// headerContains reports whether a comma-separated header has token
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsUpgrade reports whether r asks for a WebSocket connection
+func IsUpgrade(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		headerContains(r.Header, "Connection", "upgrade") &&
+		headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade completes the opening handshake and takes over the connection
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if !IsUpgrade(r) {
+		return nil, ErrNotWebSocket
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, fmt.Errorf("unsupported websocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("hijack failed: %v", err)
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake failed: %v", err)
+	}
+	return &Conn{conn: conn, reader: rw.Reader}, nil
+}
+
+// Dial opens a client connection to a ws:// URL, mainly for tests and tools
+func Dial(rawURL string, header http.Header) (*Conn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	conn, err := net.DialTimeout("tcp", u.Host, 10*time.Second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{Method: http.MethodGet, URL: u, Host: u.Host, Header: http.Header{}}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, resp, fmt.Errorf("handshake failed with status %d", resp.StatusCode)
+	}
+	return &Conn{conn: conn, reader: reader, client: true}, resp, nil
+}
+
+// SetPongHandler sets a function called for every received pong
+func (c *Conn) SetPongHandler(handler func()) {
+	c.pongHandler = handler
+}
+
+// SetReadDeadline sets the deadline for the next reads
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// ReadMessage returns the next text or binary message. Control frames are
+// handled while waiting: pings are answered and a close frame is echoed and
+// returned as a *CloseError.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	limit := c.MaxMessageSize
+	if limit <= 0 {
+		limit = DefaultMaxMessageSize
+	}
+
+	var opcode int
+	var message []byte
+	for {
+		fin, op, payload, err := c.readFrame(limit)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case OpPing:
+			if err := c.writeFrame(OpPong, payload, time.Now().Add(5*time.Second)); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case OpPong:
+			if c.pongHandler != nil {
+				c.pongHandler()
+			}
+			continue
+		case OpClose:
+			closeErr := &CloseError{Code: CloseNormal}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			c.Close(closeErr.Code, "")
+			return 0, nil, closeErr
+		case OpText, OpBinary:
+			if message != nil {
+				c.Close(CloseProtocolError, "unexpected data frame")
+				return 0, nil, errors.New("websocket: data frame inside fragmented message")
+			}
+			opcode = op
+			message = payload
+		case OpContinuation:
+			if message == nil {
+				c.Close(CloseProtocolError, "unexpected continuation")
+				return 0, nil, errors.New("websocket: continuation without message")
+			}
+			message = append(message, payload...)
+		default:
+			c.Close(CloseProtocolError, "unknown opcode")
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", op)
+		}
+
+		if int64(len(message)) > limit {
+			c.Close(CloseMessageTooBig, "")
+			return 0, nil, ErrMessageTooBig
+		}
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame reads a single frame and unmasks its payload
+func (c *Conn) readFrame(limit int64) (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0F)
+	masked := header[1]&0x80 != 0
+
+	// Clients must mask their frames and servers must not
+	if masked == c.client {
+		c.Close(CloseProtocolError, "invalid masking")
+		return false, 0, nil, errors.New("websocket: invalid frame masking")
+	}
+
+	length := int64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(extended[:]))
+	}
+	if length < 0 || length > limit {
+		c.Close(CloseMessageTooBig, "")
+		return false, 0, nil, ErrMessageTooBig
+	}
+	if opcode >= OpClose && (length > 125 || !fin) {
+		c.Close(CloseProtocolError, "invalid control frame")
+		return false, 0, nil, errors.New("websocket: invalid control frame")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage writes a complete message, failing when it cannot be sent
+// before deadline
+func (c *Conn) WriteMessage(opcode int, data []byte, deadline time.Time) error {
+	return c.writeFrame(opcode, data, deadline)
+}
+
+// Ping sends a ping control frame
+func (c *Conn) Ping(deadline time.Time) error {
+	return c.writeFrame(OpPing, nil, deadline)
+}
+
+// writeFrame writes one unfragmented frame, masking it on the client side
+func (c *Conn) writeFrame(opcode int, payload []byte, deadline time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|byte(opcode))
+
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	if c.client {
+		var mask [4]byte
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.conn.SetWriteDeadline(deadline)
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close sends a close frame with code and reason and closes the connection
+func (c *Conn) Close(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	c.writeFrame(OpClose, payload, time.Now().Add(time.Second))
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
@@ -0,0 +1,157 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer upgrades every request and echoes messages back
+func echoServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conn.MaxMessageSize = 1 << 20
+		for {
+			opcode, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(opcode, data, time.Now().Add(time.Second))
+		}
+	}))
+}
+
+func wsURL(server *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept key %q", got)
+	}
+}
+
+func TestEcho(t *testing.T) {
+	server := echoServer(t)
+	defer server.Close()
+
+	conn, _, err := Dial(wsURL(server), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close(CloseNormal, "")
+	conn.MaxMessageSize = 1 << 20
+
+	// Sizes covering the 7, 16 and 64 bit length encodings
+	for _, size := range []int{5, 300, 70000} {
+		message := strings.Repeat("x", size)
+		if err := conn.WriteMessage(OpText, []byte(message), time.Now().Add(time.Second)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		opcode, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Read of %d bytes failed: %v", size, err)
+		}
+		if opcode != OpText || string(data) != message {
+			t.Errorf("Expected %d bytes echoed, got %d", size, len(data))
+		}
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	server := echoServer(t)
+	defer server.Close()
+
+	conn, _, err := Dial(wsURL(server), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close(CloseNormal, "")
+
+	pong := make(chan struct{}, 1)
+	conn.SetPongHandler(func() { pong <- struct{}{} })
+	conn.Ping(time.Now().Add(time.Second))
+	conn.WriteMessage(OpText, []byte("after"), time.Now().Add(time.Second))
+
+	// The pong is handled while waiting for the echoed message
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "after" {
+		t.Fatalf("Unexpected message %q: %v", data, err)
+	}
+	select {
+	case <-pong:
+	default:
+		t.Error("Expected a pong for the ping")
+	}
+}
+
+func TestClose(t *testing.T) {
+	closed := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		_, _, err = conn.ReadMessage()
+		closed <- err
+	}))
+	defer server.Close()
+
+	conn, _, err := Dial(wsURL(server), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	conn.Close(CloseGoingAway, "bye")
+
+	var closeErr *CloseError
+	if err := <-closed; !errors.As(err, &closeErr) || closeErr.Code != CloseGoingAway || closeErr.Reason != "bye" {
+		t.Errorf("Expected close 1001 bye, got %v", err)
+	}
+}
+
+func TestMessageTooBig(t *testing.T) {
+	result := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		conn.MaxMessageSize = 10
+		_, _, err = conn.ReadMessage()
+		result <- err
+	}))
+	defer server.Close()
+
+	conn, _, err := Dial(wsURL(server), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close(CloseNormal, "")
+	conn.WriteMessage(OpText, []byte(strings.Repeat("x", 11)), time.Now().Add(time.Second))
+
+	if err := <-result; !errors.Is(err, ErrMessageTooBig) {
+		t.Errorf("Expected ErrMessageTooBig, got %v", err)
+	}
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if _, err := Upgrade(rec, httptest.NewRequest(http.MethodGet, "/", nil)); !errors.Is(err, ErrNotWebSocket) {
+		t.Errorf("Expected ErrNotWebSocket, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	if _, err := Upgrade(httptest.NewRecorder(), req); err == nil {
+		t.Error("Expected an error for an unsupported version")
+	}
+}